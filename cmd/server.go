@@ -62,6 +62,9 @@ func runServer(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to initialize search engine: %w", err)
 	}
 	defer searchEngine.Close()
+	if err := searchEngine.SetIndexTemplates(cfg.IndexTemplates); err != nil {
+		return fmt.Errorf("invalid index templates: %w", err)
+	}
 
 	// Initialize indexer
 	indexerService, err := indexer.NewService(mongoClient, searchEngine, cfg)
@@ -91,8 +94,19 @@ func runServer(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to start indexer: %w", err)
 	}
 
+	// Only the leader indexes; followers keep serving searches
+	if clusterManager != nil && cfg.Cluster.LeaderOnlyIndexing {
+		clusterManager.OnLeadershipChange(func(isLeader bool) {
+			if isLeader {
+				indexerService.StartIndexing()
+			} else {
+				indexerService.StopIndexing()
+			}
+		})
+	}
+
 	// Initialize API server
-	apiServer := api.NewServer(searchEngine, indexerService, cfg, clusterManager)
+	apiServer := api.NewServer(searchEngine, indexerService, mongoClient, cfg, clusterManager)
 
 	// Setup HTTP server
 	server := &http.Server{
@@ -125,9 +139,16 @@ func runServer(cmd *cobra.Command, args []string) error {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
-		return err
+	shutdownErr := server.Shutdown(shutdownCtx)
+	if shutdownErr != nil {
+		log.Printf("Server forced to shutdown: %v", shutdownErr)
+	}
+
+	// Stop the indexer while MongoDB and the indexes are still open, so its
+	// final poll is indexed and the sync state saved
+	indexerService.Stop()
+	if shutdownErr != nil {
+		return shutdownErr
 	}
 
 	log.Println("Server exited")
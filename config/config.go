@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/spf13/viper"
 )
@@ -14,14 +17,33 @@ type Config struct {
 	Search  SearchConfig  `mapstructure:"search"`
 	Cluster ClusterConfig `mapstructure:"cluster"`
 	Indexes []IndexConfig `mapstructure:"indexes"`
+	// Definitions applied to indexes whose name matches a pattern
+	IndexTemplates []IndexTemplate `mapstructure:"index_templates"`
+}
+
+// IndexTemplate supplies the definition of configured indexes without one
+// whose name matches Pattern. Templates don't create indexes: collections
+// matching Pattern aren't discovered, so each index is still listed under
+// Indexes.
+type IndexTemplate struct {
+	Name       string          `mapstructure:"name"`
+	Pattern    string          `mapstructure:"pattern"` // Glob matched against index names, e.g. "logs-*"
+	Definition IndexDefinition `mapstructure:"definition"`
 }
 
 // ServerConfig contains HTTP server settings
 type ServerConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
+	Host        string   `mapstructure:"host"`
+	Port        int      `mapstructure:"port"`
+	Username    string   `mapstructure:"username"`
+	Password    string   `mapstructure:"password"`
+	APIKeys     []string `mapstructure:"api_keys"`     // Keys accepted in the X-API-Key header
+	EnablePprof bool     `mapstructure:"enable_pprof"` // Serve net/http/pprof profiles under /debug/pprof/
+	// Slow query logging
+	SlowQueryThreshold    int      `mapstructure:"slow_query_threshold"`     // Log searches taking at least this long, in milliseconds (0 disables)
+	SlowQueryRedactFields []string `mapstructure:"slow_query_redact_fields"` // Fields whose query values are masked in the slow query log
+	MaxConcurrentSearches int      `mapstructure:"max_concurrent_searches"`  // Searches run at once; excess searches are rejected with 503 (0 is unlimited)
+	ResponseFormat        string   `mapstructure:"response_format"`          // Default shape of search responses: flat or envelope
 }
 
 // MongoDBConfig contains MongoDB connection settings
@@ -31,45 +53,156 @@ type MongoDBConfig struct {
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
 	Timeout  int    `mapstructure:"timeout"` // in seconds
+	// Startup connection retries
+	ConnectRetries int `mapstructure:"connect_retries"` // Attempts after the first before startup fails
+	ConnectBackoff int `mapstructure:"connect_backoff"` // Delay between attempts, in seconds
+	// Circuit breaker around the indexer's MongoDB calls
+	BreakerThreshold int `mapstructure:"breaker_threshold"` // Consecutive failures opening the breaker (0 disables it)
+	BreakerCooldown  int `mapstructure:"breaker_cooldown"`  // Seconds the breaker stays open before a trial call
+	// Idle connections
+	MaxConnIdleTime   int `mapstructure:"max_conn_idle_time"` // Seconds a pooled connection may sit idle before it is closed (0 keeps it open)
+	KeepaliveInterval int `mapstructure:"keepalive_interval"` // Seconds between pings keeping the connection warm (0 disables)
 }
 
 // SearchConfig contains search engine settings
 type SearchConfig struct {
-	IndexPath     string `mapstructure:"index_path"`
-	BatchSize     int    `mapstructure:"batch_size"`
-	FlushInterval int    `mapstructure:"flush_interval"`  // in seconds
-	SyncStatePath string `mapstructure:"sync_state_path"` // Path to store sync state for persistence
+	IndexPath       string `mapstructure:"index_path"`
+	IndexType       string `mapstructure:"index_type"`        // Bleve index type for new indexes: scorch (default) or upsidedown
+	IndexDirMode    string `mapstructure:"index_dir_mode"`    // Octal mode of index_path and the index directories, e.g. "0700" (empty leaves the defaults)
+	BatchSize       int    `mapstructure:"batch_size"`        // Documents fetched from MongoDB per batch
+	CommitBatchSize int    `mapstructure:"commit_batch_size"` // Documents written per Bleve batch (0 writes each commit in one batch)
+	FlushInterval   int    `mapstructure:"flush_interval"`    // Default seconds between commits of buffered documents (0 commits every poll)
+	SyncStatePath   string `mapstructure:"sync_state_path"`   // Path to store sync state for persistence
 	// Performance optimization settings
-	WorkerCount     int  `mapstructure:"worker_count"`      // Number of concurrent indexing workers
-	BulkIndexing    bool `mapstructure:"bulk_indexing"`     // Enable bulk indexing for better performance
-	PrefetchCount   int  `mapstructure:"prefetch_count"`    // Number of documents to prefetch from MongoDB
-	IndexBufferSize int  `mapstructure:"index_buffer_size"` // Buffer size for index operations
+	WorkerCount       int  `mapstructure:"worker_count"`        // Number of concurrent indexing workers
+	BulkIndexing      bool `mapstructure:"bulk_indexing"`       // Enable bulk indexing for better performance
+	PrefetchCount     int  `mapstructure:"prefetch_count"`      // Number of documents to prefetch from MongoDB
+	IndexBufferSize   int  `mapstructure:"index_buffer_size"`   // Buffer size for index operations
+	ShardWorkers      int  `mapstructure:"shard_workers"`       // Number of shards opened or created in parallel
+	ShardVirtualNodes int  `mapstructure:"shard_virtual_nodes"` // Points each shard owns on its index's consistent-hash ring
+	// Query limits
+	MaxResultWindow       int `mapstructure:"max_result_window"`       // Maximum value of from + size for a search request
+	SuggestThreshold      int `mapstructure:"suggest_threshold"`       // Suggest a corrected query when a search has fewer hits than this (0 disables)
+	FilterCacheSize       int `mapstructure:"filter_cache_size"`       // Compound filter clauses whose matching documents are cached (0 disables)
+	ResultCacheSize       int `mapstructure:"result_cache_size"`       // Search results cached for identical requests (0 disables)
+	ResultCacheTTL        int `mapstructure:"result_cache_ttl"`        // Seconds a cached search result is served before it is run again
+	MaxHighlightFragments int `mapstructure:"max_highlight_fragments"` // Fragments returned per highlighted field unless a search sets maxNumberOfFragments
+	// Indexing limits
+	MaxDocumentBytes int `mapstructure:"max_document_bytes"` // Skip documents larger than this once normalized (0 disables the limit)
+	MaxFieldLength   int `mapstructure:"max_field_length"`   // Truncate string values longer than this many characters before indexing (0 disables)
+	// Index size monitoring
+	SizeCheckInterval int   `mapstructure:"size_check_interval"`  // Seconds between index size measurements (0 disables monitoring)
+	MaxIndexSizeBytes int64 `mapstructure:"max_index_size_bytes"` // Log a warning when an index grows larger than this on disk (0 disables)
+	// Document expiry
+	TTLSweepInterval int `mapstructure:"ttl_sweep_interval"` // Seconds between deletions of expired documents from indexes with a ttl (0 disables)
+	// Initial sync verification
+	InitialSyncRetries int `mapstructure:"initial_sync_retries"` // Times an initial sync is rerun when the index has fewer documents than the collection
 }
 
 // ClusterConfig contains cluster-specific settings
 type ClusterConfig struct {
-	Enabled   bool     `mapstructure:"enabled"`   // Enable cluster mode
-	NodeID    string   `mapstructure:"node_id"`   // Unique node identifier
-	BindAddr  string   `mapstructure:"bind_addr"` // Address to bind Raft transport
-	RaftPort  int      `mapstructure:"raft_port"` // Port for Raft communication
-	RaftDir   string   `mapstructure:"raft_dir"`  // Directory for Raft logs and snapshots
-	Bootstrap bool     `mapstructure:"bootstrap"` // Bootstrap cluster (only for first node)
-	JoinAddr  []string `mapstructure:"join_addr"` // Addresses of existing cluster members to join
-	DataDir   string   `mapstructure:"data_dir"`  // Directory for cluster data
+	Enabled            bool     `mapstructure:"enabled"`              // Enable cluster mode
+	NodeID             string   `mapstructure:"node_id"`              // Unique node identifier
+	BindAddr           string   `mapstructure:"bind_addr"`            // Address to bind Raft transport
+	RaftPort           int      `mapstructure:"raft_port"`            // Port for Raft communication
+	RaftDir            string   `mapstructure:"raft_dir"`             // Directory for Raft logs and snapshots
+	Bootstrap          bool     `mapstructure:"bootstrap"`            // Bootstrap cluster (only for first node)
+	JoinAddr           []string `mapstructure:"join_addr"`            // Addresses of existing cluster members to join
+	DataDir            string   `mapstructure:"data_dir"`             // Directory for cluster data
+	LeaderOnlyIndexing bool     `mapstructure:"leader_only_indexing"` // Only poll MongoDB and index on the Raft leader
+	GRPCPort           int      `mapstructure:"grpc_port"`            // Port for cluster gRPC, such as forwarded searches (0 disables)
+	Peers              []string `mapstructure:"peers"`                // gRPC addresses of the other nodes, asked in order for indexes this node lacks
+	GRPCTLSCert        string   `mapstructure:"grpc_tls_cert"`        // PEM certificate serving cluster gRPC over TLS, also presented to peers
+	GRPCTLSKey         string   `mapstructure:"grpc_tls_key"`         // PEM key of grpc_tls_cert
+	GRPCTLSCA          string   `mapstructure:"grpc_tls_ca"`          // PEM CA verifying peer certificates; when set, peers must present one
 }
 
 // IndexConfig represents a search index configuration similar to MongoDB Atlas Search
 type IndexConfig struct {
-	Name           string            `mapstructure:"name"`
-	Database       string            `mapstructure:"database"`
-	Collection     string            `mapstructure:"collection"`
-	Definition     IndexDefinition   `mapstructure:"definition"`
-	TimestampField string            `mapstructure:"timestamp_field,omitempty"` // Custom field for polling timestamps
-	IDField        string            `mapstructure:"id_field,omitempty"`        // Custom field name for document ID (defaults to "_id")
-	PollInterval   int               `mapstructure:"poll_interval,omitempty"`   // Collection-specific poll interval in seconds
-	Distribution   IndexDistribution `mapstructure:"distribution,omitempty"`    // Distribution settings for cluster mode
+	Name                    string                 `mapstructure:"name"`
+	Database                string                 `mapstructure:"database"`
+	Collection              string                 `mapstructure:"collection"`
+	Definition              IndexDefinition        `mapstructure:"definition"`
+	TimestampField          string                 `mapstructure:"timestamp_field,omitempty"`            // Custom field for polling timestamps
+	IDField                 string                 `mapstructure:"id_field,omitempty"`                   // Custom field name for document ID (defaults to "_id")
+	IDStrategy              string                 `mapstructure:"id_strategy,omitempty"`                // How the document ID is derived: hex (default), string, json or hash
+	ExcludeIDFromSource     bool                   `mapstructure:"exclude_id_from_source,omitempty"`     // Return the ID only as the hit ID, leaving id_field out of the hit source
+	Filter                  string                 `mapstructure:"filter,omitempty"`                     // MongoDB query (Extended JSON) selecting which documents to index
+	VersionField            string                 `mapstructure:"version_field,omitempty"`              // Field whose value orders document versions; older versions don't overwrite newer ones
+	StrictMapping           string                 `mapstructure:"strict_mapping,omitempty"`             // How documents with fields outside a static mapping are handled: warn or reject
+	PollInterval            int                    `mapstructure:"poll_interval,omitempty"`              // Seconds between polls of the collection for changes (defaults to half the refresh interval)
+	RefreshInterval         int                    `mapstructure:"refresh_interval,omitempty"`           // Seconds between commits of buffered documents, making them searchable (defaults to flush_interval)
+	Tailable                bool                   `mapstructure:"tailable,omitempty"`                   // Stream inserts into a capped collection from a tailable cursor instead of polling
+	WarmupQuery             map[string]interface{} `mapstructure:"warmup_query,omitempty"`               // Search run once at startup to warm Bleve's caches
+	Distribution            IndexDistribution      `mapstructure:"distribution,omitempty"`               // Distribution settings for cluster mode
+	Auth                    IndexAuth              `mapstructure:"auth,omitempty"`                       // Tenant credentials required for this index's endpoints
+	SearchDuringInitialSync *bool                  `mapstructure:"search_during_initial_sync,omitempty"` // Whether searches are answered before the initial sync completes (defaults to true)
+	Transforms              []TransformConfig      `mapstructure:"transforms,omitempty"`                 // Changes applied in order to each document before it is indexed
+	ReindexOnMappingChange  bool                   `mapstructure:"reindex_on_mapping_change,omitempty"`  // Rebuild the index at startup when its definition changed, instead of only warning
+	TTLField                string                 `mapstructure:"ttl_field,omitempty"`                  // Date field documents expire from, ttl seconds after its value
+	TTL                     int                    `mapstructure:"ttl,omitempty"`                        // Seconds after ttl_field a document expires and is deleted from the index
+	DefaultSize             int                    `mapstructure:"default_size,omitempty"`               // Hits returned by searches that don't set size (defaults to 10)
+	MaxSize                 int                    `mapstructure:"max_size,omitempty"`                   // Largest size a search may request (defaults to 1000)
+}
+
+// TransformConfig is a declarative change made to documents before they are
+// indexed. Fields are top-level document fields.
+type TransformConfig struct {
+	Type      string   `mapstructure:"type"`      // rename, concat, lowercase or drop
+	Field     string   `mapstructure:"field"`     // Field renamed, lowercased or dropped
+	Fields    []string `mapstructure:"fields"`    // Fields joined by concat, in order
+	Target    string   `mapstructure:"target"`    // Field written by rename and concat
+	Separator string   `mapstructure:"separator"` // Placed between the values joined by concat
+}
+
+// SearchableDuringInitialSync reports whether the index answers searches while
+// its initial sync is still running, returning incomplete results
+func (c IndexConfig) SearchableDuringInitialSync() bool {
+	return c.SearchDuringInitialSync == nil || *c.SearchDuringInitialSync
+}
+
+// Search size limits of indexes that don't set default_size or max_size
+const (
+	DefaultSearchSize = 10
+	MaxSearchSize     = 1000
+)
+
+// SearchSizeLimits returns the number of hits searches on the index return
+// when they don't set a size, and the largest size they may request. Without
+// default_size the default is capped at max_size.
+func (c IndexConfig) SearchSizeLimits() (int, int) {
+	maxSize := MaxSearchSize
+	if c.MaxSize > 0 {
+		maxSize = c.MaxSize
+	}
+	if c.DefaultSize > 0 {
+		return c.DefaultSize, maxSize
+	}
+	return min(DefaultSearchSize, maxSize), maxSize
+}
+
+// IndexAuth holds the tenant credentials of an index. When any are set the
+// index's endpoints require them, or the global server credentials, which
+// access every index.
+type IndexAuth struct {
+	Users   []IndexUser `mapstructure:"users"`    // Basic authentication users
+	APIKeys []string    `mapstructure:"api_keys"` // Keys accepted in the X-API-Key header
+}
+
+// IndexUser is a basic authentication user of an index
+type IndexUser struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// Enabled reports whether the index has credentials of its own
+func (a IndexAuth) Enabled() bool {
+	return len(a.Users) > 0 || len(a.APIKeys) > 0
 }
 
+// DefaultTimestampField is the field polled for changes when an index doesn't set timestamp_field
+const DefaultTimestampField = "updated_at"
+
 // IndexDistribution defines how an index is distributed across the cluster
 type IndexDistribution struct {
 	Replicas int `mapstructure:"replicas"` // Number of replicas for this index (default: 1)
@@ -78,7 +211,9 @@ type IndexDistribution struct {
 
 // IndexDefinition mirrors MongoDB Atlas Search index structure
 type IndexDefinition struct {
-	Mappings IndexMappings `mapstructure:"mappings"`
+	Mappings        IndexMappings `mapstructure:"mappings"`
+	DefaultAnalyzer string        `mapstructure:"default_analyzer,omitempty"` // Analyzer for dynamic text fields (defaults to "standard")
+	DefaultOperator string        `mapstructure:"default_operator,omitempty"` // Operator for text queries without one: "or" (default) or "and"
 }
 
 // IndexMappings contains field mappings for the index
@@ -89,12 +224,21 @@ type IndexMappings struct {
 
 // FieldConfig represents field-specific indexing configuration
 type FieldConfig struct {
-	Name     string                 `mapstructure:"name"`  // Field name in the index
-	Field    string                 `mapstructure:"field"` // Source field name in the document
-	Type     string                 `mapstructure:"type"`
-	Analyzer string                 `mapstructure:"analyzer,omitempty"`
-	Multi    map[string]FieldConfig `mapstructure:"multi,omitempty"`
-	Facet    bool                   `mapstructure:"facet,omitempty"`
+	Name              string                 `mapstructure:"name"`  // Field name in the index
+	Field             string                 `mapstructure:"field"` // Source field name in the document
+	Type              string                 `mapstructure:"type"`
+	Analyzer          string                 `mapstructure:"analyzer,omitempty"`
+	IndexAnalyzer     string                 `mapstructure:"index_analyzer,omitempty"`  // Analyzer used when indexing, overriding analyzer and language
+	SearchAnalyzer    string                 `mapstructure:"search_analyzer,omitempty"` // Analyzer used for text queries, overriding analyzer and language
+	Language          string                 `mapstructure:"language,omitempty"`        // Language code selecting a language analyzer for text fields (e.g. "en")
+	StopWords         []string               `mapstructure:"stop_words,omitempty"`      // Extra words dropped from text fields at index and query time
+	PathDelimiter     string                 `mapstructure:"path_delimiter,omitempty"`  // Index keyword values as hierarchical paths split on this delimiter, e.g. "/"
+	Multi             map[string]FieldConfig `mapstructure:"multi,omitempty"`
+	Facet             bool                   `mapstructure:"facet,omitempty"`
+	ExcludeFromSource bool                   `mapstructure:"exclude_from_source,omitempty"` // Index the field without storing its value, leaving it out of hit sources
+	Boost             float64                `mapstructure:"boost,omitempty"`               // Multiplies the score of every query on the field (defaults to 1)
+	MinGram           int                    `mapstructure:"min_gram,omitempty"`            // Shortest substring indexed by ngram fields (defaults to 3)
+	MaxGram           int                    `mapstructure:"max_gram,omitempty"`            // Longest substring indexed by ngram fields (defaults to 10)
 }
 
 // LoadConfig loads configuration from file and environment variables
@@ -139,15 +283,66 @@ func LoadConfig(configPath string) (*Config, error) {
 		config.Server.Password = envPassword
 	}
 
+	if err := applyIndexEnvOverrides(config.Indexes); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
+// applyIndexEnvOverrides applies per-index settings from environment variables
+// named OAS_INDEX_<NAME>_<SETTING>, see IndexEnvKey. Viper can't bind these
+// because indexes is a list.
+func applyIndexEnvOverrides(indexes []IndexConfig) error {
+	for i := range indexes {
+		key := IndexEnvKey(indexes[i].Name, "poll_interval")
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		pollInterval, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || pollInterval < 0 {
+			return fmt.Errorf("invalid %s: expected a non-negative number of seconds, got %q", key, value)
+		}
+		indexes[i].PollInterval = pollInterval
+	}
+	return nil
+}
+
+// IndexEnvKey returns the environment variable overriding a setting of an
+// index. The index name is upper-cased and every character other than a
+// letter or digit becomes an underscore, so poll_interval of "my-index.v2" is
+// OAS_INDEX_MY_INDEX_V2_POLL_INTERVAL.
+func IndexEnvKey(indexName, setting string) string {
+	normalize := func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}
+	return "OAS_INDEX_" + strings.Map(normalize, indexName) + "_" + strings.Map(normalize, setting)
+}
+
 func setDefaults() {
 	viper.SetDefault("server.host", "0.0.0.0")
 	viper.SetDefault("server.port", 8080)
+	viper.SetDefault("server.api_keys", []string{})
+	viper.SetDefault("server.enable_pprof", false)
+	viper.SetDefault("server.slow_query_threshold", 0)
+	viper.SetDefault("server.slow_query_redact_fields", []string{})
+	viper.SetDefault("server.max_concurrent_searches", 0)
+	viper.SetDefault("server.response_format", "flat")
 	viper.SetDefault("mongodb.timeout", 30)
+	viper.SetDefault("mongodb.connect_retries", 5)
+	viper.SetDefault("mongodb.connect_backoff", 2)
+	viper.SetDefault("mongodb.breaker_threshold", 5)
+	viper.SetDefault("mongodb.breaker_cooldown", 30)
+	viper.SetDefault("mongodb.max_conn_idle_time", 0)
+	viper.SetDefault("mongodb.keepalive_interval", 0)
 	viper.SetDefault("search.index_path", "./indexes")
+	viper.SetDefault("search.index_type", "scorch")
 	viper.SetDefault("search.batch_size", 1000)
+	viper.SetDefault("search.commit_batch_size", 0) // Commit each buffer in a single Bleve batch
 	viper.SetDefault("search.flush_interval", 30)
 	viper.SetDefault("search.sync_state_path", "./sync_state.json")
 	// Performance optimization defaults
@@ -155,6 +350,20 @@ func setDefaults() {
 	viper.SetDefault("search.bulk_indexing", true)    // Enable bulk indexing
 	viper.SetDefault("search.prefetch_count", 5000)   // Prefetch 5000 documents
 	viper.SetDefault("search.index_buffer_size", 100) // Buffer 100 operations
+	viper.SetDefault("search.shard_workers", 4)       // Open 4 shards at a time
+	viper.SetDefault("search.shard_virtual_nodes", 128)
+	viper.SetDefault("search.ttl_sweep_interval", 60)
+	viper.SetDefault("search.initial_sync_retries", 0) // Report count mismatches without resyncing
+	viper.SetDefault("search.max_result_window", 10000)
+	viper.SetDefault("search.suggest_threshold", 0) // No did-you-mean suggestions
+	viper.SetDefault("search.filter_cache_size", 0) // No filter cache
+	viper.SetDefault("search.result_cache_size", 0) // No result cache
+	viper.SetDefault("search.result_cache_ttl", 60)
+	viper.SetDefault("search.max_highlight_fragments", 1)
+	viper.SetDefault("search.max_document_bytes", 0) // No document size limit
+	viper.SetDefault("search.max_field_length", 0)   // No field length limit
+	viper.SetDefault("search.size_check_interval", 60)
+	viper.SetDefault("search.max_index_size_bytes", 0) // No index size warning
 	// Cluster defaults
 	viper.SetDefault("cluster.enabled", false)
 	viper.SetDefault("cluster.node_id", "")
@@ -164,6 +373,12 @@ func setDefaults() {
 	viper.SetDefault("cluster.bootstrap", false)
 	viper.SetDefault("cluster.join_addr", []string{})
 	viper.SetDefault("cluster.data_dir", "./cluster_data")
+	viper.SetDefault("cluster.leader_only_indexing", false)
+	viper.SetDefault("cluster.grpc_port", 7947)
+	viper.SetDefault("cluster.peers", []string{})
+	viper.SetDefault("cluster.grpc_tls_cert", "")
+	viper.SetDefault("cluster.grpc_tls_key", "")
+	viper.SetDefault("cluster.grpc_tls_ca", "")
 }
 
 // GetMongoURI returns the complete MongoDB connection URI
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/spf13/viper"
@@ -216,6 +217,9 @@ indexes:
 	if cfg.Search.SyncStatePath != "./sync_state.json" {
 		t.Errorf("Expected default search sync_state_path './sync_state.json', got '%s'", cfg.Search.SyncStatePath)
 	}
+	if cfg.Search.MaxResultWindow != 10000 {
+		t.Errorf("Expected default search max_result_window 10000, got %d", cfg.Search.MaxResultWindow)
+	}
 
 	// Verify index uses defaults for optional fields
 	index := cfg.Indexes[0]
@@ -323,6 +327,63 @@ indexes:
 	}
 }
 
+func TestIndexEnvironmentVariableOverrides(t *testing.T) {
+	t.Setenv("OAS_INDEX_PRODUCTS_V2_POLL_INTERVAL", "30")
+
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configContent := `
+indexes:
+  - name: "products-v2"
+    database: "testdb"
+    collection: "products"
+    poll_interval: 5
+  - name: "users"
+    database: "testdb"
+    collection: "users"
+    poll_interval: 5
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	viper.Reset()
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Indexes[0].PollInterval != 30 {
+		t.Errorf("Expected poll_interval 30 from env var, got %d", cfg.Indexes[0].PollInterval)
+	}
+	if cfg.Indexes[1].PollInterval != 5 {
+		t.Errorf("Expected poll_interval 5 for index without override, got %d", cfg.Indexes[1].PollInterval)
+	}
+
+	// Invalid values are rejected rather than silently ignored
+	t.Setenv("OAS_INDEX_USERS_POLL_INTERVAL", "soon")
+	viper.Reset()
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "OAS_INDEX_USERS_POLL_INTERVAL") {
+		t.Errorf("Expected error naming the invalid env var, got %v", err)
+	}
+}
+
+func TestIndexEnvKey(t *testing.T) {
+	tests := map[string]string{
+		"products":      "OAS_INDEX_PRODUCTS_POLL_INTERVAL",
+		"my-index.v2":   "OAS_INDEX_MY_INDEX_V2_POLL_INTERVAL",
+		"shop products": "OAS_INDEX_SHOP_PRODUCTS_POLL_INTERVAL",
+	}
+	for name, expected := range tests {
+		if key := IndexEnvKey(name, "poll_interval"); key != expected {
+			t.Errorf("IndexEnvKey(%q): expected %s, got %s", name, expected, key)
+		}
+	}
+}
+
 func TestSetDefaults(t *testing.T) {
 	// Reset viper to ensure clean state
 	viper.Reset()
@@ -336,9 +397,30 @@ func TestSetDefaults(t *testing.T) {
 	if viper.GetInt("server.port") != 8080 {
 		t.Errorf("Expected default server.port 8080, got %d", viper.GetInt("server.port"))
 	}
+	if viper.GetString("server.response_format") != "flat" {
+		t.Errorf("Expected default server.response_format 'flat', got '%s'", viper.GetString("server.response_format"))
+	}
 	if viper.GetInt("mongodb.timeout") != 30 {
 		t.Errorf("Expected default mongodb.timeout 30, got %d", viper.GetInt("mongodb.timeout"))
 	}
+	if viper.GetInt("mongodb.connect_retries") != 5 {
+		t.Errorf("Expected default mongodb.connect_retries 5, got %d", viper.GetInt("mongodb.connect_retries"))
+	}
+	if viper.GetInt("mongodb.connect_backoff") != 2 {
+		t.Errorf("Expected default mongodb.connect_backoff 2, got %d", viper.GetInt("mongodb.connect_backoff"))
+	}
+	if viper.GetInt("mongodb.breaker_threshold") != 5 {
+		t.Errorf("Expected default mongodb.breaker_threshold 5, got %d", viper.GetInt("mongodb.breaker_threshold"))
+	}
+	if viper.GetInt("mongodb.breaker_cooldown") != 30 {
+		t.Errorf("Expected default mongodb.breaker_cooldown 30, got %d", viper.GetInt("mongodb.breaker_cooldown"))
+	}
+	if viper.GetInt("mongodb.max_conn_idle_time") != 0 {
+		t.Errorf("Expected default mongodb.max_conn_idle_time 0, got %d", viper.GetInt("mongodb.max_conn_idle_time"))
+	}
+	if viper.GetInt("mongodb.keepalive_interval") != 0 {
+		t.Errorf("Expected default mongodb.keepalive_interval 0, got %d", viper.GetInt("mongodb.keepalive_interval"))
+	}
 	if viper.GetString("search.index_path") != "./indexes" {
 		t.Errorf("Expected default search.index_path './indexes', got '%s'", viper.GetString("search.index_path"))
 	}
@@ -351,4 +433,39 @@ func TestSetDefaults(t *testing.T) {
 	if viper.GetString("search.sync_state_path") != "./sync_state.json" {
 		t.Errorf("Expected default search.sync_state_path './sync_state.json', got '%s'", viper.GetString("search.sync_state_path"))
 	}
+	if viper.GetInt("search.max_highlight_fragments") != 1 {
+		t.Errorf("Expected default search.max_highlight_fragments 1, got %d", viper.GetInt("search.max_highlight_fragments"))
+	}
+	if viper.GetInt("search.shard_virtual_nodes") != 128 {
+		t.Errorf("Expected default search.shard_virtual_nodes 128, got %d", viper.GetInt("search.shard_virtual_nodes"))
+	}
+	if viper.GetInt("search.max_field_length") != 0 {
+		t.Errorf("Expected default search.max_field_length 0, got %d", viper.GetInt("search.max_field_length"))
+	}
+	if viper.GetInt("search.ttl_sweep_interval") != 60 {
+		t.Errorf("Expected default search.ttl_sweep_interval 60, got %d", viper.GetInt("search.ttl_sweep_interval"))
+	}
+	if viper.GetInt("search.initial_sync_retries") != 0 {
+		t.Errorf("Expected default search.initial_sync_retries 0, got %d", viper.GetInt("search.initial_sync_retries"))
+	}
+	if viper.GetInt("search.result_cache_size") != 0 {
+		t.Errorf("Expected default search.result_cache_size 0, got %d", viper.GetInt("search.result_cache_size"))
+	}
+	if viper.GetInt("search.result_cache_ttl") != 60 {
+		t.Errorf("Expected default search.result_cache_ttl 60, got %d", viper.GetInt("search.result_cache_ttl"))
+	}
+	if viper.GetBool("cluster.leader_only_indexing") {
+		t.Error("Expected default cluster.leader_only_indexing false")
+	}
+	if viper.GetInt("cluster.grpc_port") != 7947 {
+		t.Errorf("Expected default cluster.grpc_port 7947, got %d", viper.GetInt("cluster.grpc_port"))
+	}
+	if peers := viper.GetStringSlice("cluster.peers"); len(peers) != 0 {
+		t.Errorf("Expected no default cluster.peers, got %v", peers)
+	}
+	for _, key := range []string{"cluster.grpc_tls_cert", "cluster.grpc_tls_key", "cluster.grpc_tls_ca"} {
+		if viper.GetString(key) != "" {
+			t.Errorf("Expected no default %s, got '%s'", key, viper.GetString(key))
+		}
+	}
 }
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// principal is what a request's credentials authenticated as
+type principal struct {
+	admin   bool            // Global server credentials, which access every index
+	indexes map[string]bool // Indexes whose auth block accepts the credentials
+}
+
+// principalKey is the context key of the authenticated principal
+type principalKey struct{}
+
+// withPrincipal returns a copy of ctx carrying p
+func withPrincipal(ctx context.Context, p *principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// principalFrom returns the principal a request authenticated as, or nil for
+// requests without credentials
+func principalFrom(ctx context.Context) *principal {
+	p, _ := ctx.Value(principalKey{}).(*principal)
+	return p
+}
+
+// authenticate resolves the credentials of a request against the global and
+// per-index credentials. A request without credentials yields a nil principal.
+// Credentials that match nothing get a 401 response and false is returned.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (*principal, bool) {
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" && (s.isAPIKeyAuthEnabled() || s.hasIndexAuth()) {
+		p := &principal{
+			admin:   s.isAPIKeyAuthEnabled() && s.validAPIKey(apiKey),
+			indexes: s.indexesAccepting(func(auth config.IndexAuth) bool { return validKey(apiKey, auth.APIKeys) }),
+		}
+		if !p.admin && len(p.indexes) == 0 {
+			log.Printf("Authentication failed: invalid API key")
+			s.authenticationFailed(w)
+			return nil, false
+		}
+		return p, true
+	}
+
+	if r.Header.Get("Authorization") == "" {
+		return nil, true
+	}
+	username, password, ok := basicAuthCredentials(r)
+	if !ok {
+		s.authenticationFailed(w)
+		return nil, false
+	}
+
+	// Compare both fields in constant time and combine the results without
+	// short-circuiting, so a wrong username costs as much as a wrong password
+	p := &principal{
+		admin: s.isBasicAuthEnabled() &&
+			secureCompare(username, s.config.Server.Username)&secureCompare(password, s.config.Server.Password) == 1,
+		indexes: s.indexesAccepting(func(auth config.IndexAuth) bool { return validUser(username, password, auth.Users) }),
+	}
+	if !p.admin && len(p.indexes) == 0 {
+		log.Printf("Authentication failed for user: %s", username)
+		s.authenticationFailed(w)
+		return nil, false
+	}
+	return p, true
+}
+
+// authorized reports whether p may use the endpoints of index, or the
+// endpoints that aren't about a single index if index is empty. Indexes with
+// an auth block need their own or the global credentials; everything else
+// needs the global credentials if any are configured.
+func (s *Server) authorized(p *principal, index string) bool {
+	if p != nil && p.admin {
+		return true
+	}
+	if index != "" && s.indexAuth(index).Enabled() {
+		return p != nil && p.indexes[index]
+	}
+	return !s.isAuthenticationEnabled()
+}
+
+// indexAuth returns the auth block of an index
+func (s *Server) indexAuth(index string) config.IndexAuth {
+	if s.config == nil {
+		return config.IndexAuth{}
+	}
+	for _, indexCfg := range s.config.Indexes {
+		if indexCfg.Name == index {
+			return indexCfg.Auth
+		}
+	}
+	return config.IndexAuth{}
+}
+
+// hasIndexAuth reports whether any index has credentials of its own
+func (s *Server) hasIndexAuth() bool {
+	if s.config == nil {
+		return false
+	}
+	for _, indexCfg := range s.config.Indexes {
+		if indexCfg.Auth.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// indexesAccepting returns the indexes whose auth block accepts credentials,
+// as checked by accepts. Every index is checked so the timing doesn't reveal
+// which one matched.
+func (s *Server) indexesAccepting(accepts func(config.IndexAuth) bool) map[string]bool {
+	if s.config == nil {
+		return nil
+	}
+	indexes := make(map[string]bool)
+	for _, indexCfg := range s.config.Indexes {
+		if accepts(indexCfg.Auth) {
+			indexes[indexCfg.Name] = true
+		}
+	}
+	return indexes
+}
+
+// validKey reports whether key matches one of keys, comparing every key
+func validKey(key string, keys []string) bool {
+	match := 0
+	for _, configured := range keys {
+		if configured == "" {
+			continue
+		}
+		match |= secureCompare(key, configured)
+	}
+	return match == 1
+}
+
+// validUser reports whether username and password match one of users,
+// comparing every user
+func validUser(username, password string, users []config.IndexUser) bool {
+	match := 0
+	for _, user := range users {
+		if user.Username == "" || user.Password == "" {
+			continue
+		}
+		match |= secureCompare(username, user.Username) & secureCompare(password, user.Password)
+	}
+	return match == 1
+}
+
+// multiSearchAuthMiddleware authenticates multi-search requests. Their indexes
+// are named in the body, so each search is authorized by handleMultiSearch.
+func (s *Server) multiSearchAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if p == nil && s.isAuthenticationEnabled() {
+			s.authenticationFailed(w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+	})
+}
+
+// accessDenied sends the response for credentials that don't grant access to an index
+func (s *Server) accessDenied(w http.ResponseWriter, index string) {
+	message := "Credentials do not grant access to this endpoint"
+	if index != "" {
+		message = fmt.Sprintf("Credentials do not grant access to index '%s'", index)
+	}
+	s.errorResponse(w, "access_denied", message, http.StatusForbidden)
+}
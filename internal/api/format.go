@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davidschrooten/open-atlas-search/internal/search"
+)
+
+// Shapes a search response can be returned in
+const (
+	responseFormatFlat     = "flat"     // The search result itself
+	responseFormatEnvelope = "envelope" // The result wrapped with took and timedOut
+)
+
+// searchEnvelope is a search result in the envelope response format
+type searchEnvelope struct {
+	Took       int64                  `json:"took"`     // Milliseconds the server spent handling the search
+	TimedOut   bool                   `json:"timedOut"` // Always false, timed out searches fail with search_timeout
+	Hits       envelopeHits           `json:"hits"`
+	Facets     map[string]interface{} `json:"facets,omitempty"`
+	Suggestion string                 `json:"suggestion,omitempty"`
+	Profile    *search.SearchProfile  `json:"profile,omitempty"`
+}
+
+// envelopeHits holds the hits of an enveloped search result with their totals
+type envelopeHits struct {
+	Total    int                `json:"total"`
+	MaxScore float64            `json:"maxScore"`
+	Hits     []search.SearchHit `json:"hits"`
+}
+
+// responseFormat returns the format a search is answered in: the request's
+// response_format, or else server.response_format, defaulting to flat
+func (s *Server) responseFormat(searchReq searchRequestBody) (string, *ErrorResponse) {
+	format := searchReq.ResponseFormat
+	if format == "" && s.config != nil {
+		format = s.config.Server.ResponseFormat
+	}
+	switch format {
+	case "":
+		return responseFormatFlat, nil
+	case responseFormatFlat, responseFormatEnvelope:
+		return format, nil
+	default:
+		return "", &ErrorResponse{
+			Error:   "invalid_parameter",
+			Message: fmt.Sprintf("Response format must be '%s' or '%s'", responseFormatFlat, responseFormatEnvelope),
+			Code:    http.StatusBadRequest,
+		}
+	}
+}
+
+// formatSearchResult shapes a search result in format, took being the time
+// spent on the search so far
+func formatSearchResult(format string, result *search.SearchResult, took time.Duration) interface{} {
+	if format != responseFormatEnvelope {
+		return result
+	}
+	return &searchEnvelope{
+		Took: took.Milliseconds(),
+		Hits: envelopeHits{
+			Total:    result.Total,
+			MaxScore: result.MaxScore,
+			Hits:     result.Hits,
+		},
+		Facets:     result.Facets,
+		Suggestion: result.Suggestion,
+		Profile:    result.Profile,
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/davidschrooten/open-atlas-search/internal/cluster"
+)
+
+// forwardedRequestHeaders are the request headers relayed with a forwarded search
+var forwardedRequestHeaders = []string{"Content-Type"}
+
+// forwardedCredentialHeaders are relayed too when cluster gRPC runs over TLS,
+// so the node running the search authenticates the same credentials
+var forwardedCredentialHeaders = []string{"Authorization", "X-API-Key"}
+
+// forwardSearch relays a search on an index this node lacks to the cluster
+// peer that has it and writes the peer's response, reporting whether it wrote
+// one. Searches forwarded to this node are never forwarded again.
+func (s *Server) forwardSearch(w http.ResponseWriter, r *http.Request, index string) bool {
+	if s.clusterManager == nil || r.Header.Get(cluster.ForwardedByHeader) != "" {
+		return false
+	}
+
+	req, ok := s.forwardedRequest(w, r, index)
+	if !ok {
+		return true
+	}
+	resp, err := s.clusterManager.ForwardSearch(r.Context(), req)
+	if errors.Is(err, cluster.ErrIndexNotOnPeers) {
+		return false
+	}
+	if err != nil {
+		s.errorResponse(w, "forward_failed", "Failed to forward search to a cluster peer: "+err.Error(), http.StatusBadGateway)
+		return true
+	}
+	writeForwardedResponse(w, resp)
+	return true
+}
+
+// forwardSearchToLeader relays a search to the cluster leader when this node
+// is a follower under leader_only_indexing, whose own indexes aren't updated,
+// and writes the leader's response, reporting whether it wrote one
+func (s *Server) forwardSearchToLeader(w http.ResponseWriter, r *http.Request, index string) bool {
+	if !s.isLeaderOnlyFollower() || r.Header.Get(cluster.ForwardedByHeader) != "" {
+		return false
+	}
+
+	req, ok := s.forwardedRequest(w, r, index)
+	if !ok {
+		return true
+	}
+	resp, err := s.clusterManager.ForwardSearchToLeader(r.Context(), req)
+	if errors.Is(err, cluster.ErrNoLeader) {
+		w.Header().Set("Retry-After", syncRetryAfter)
+		s.errorResponse(w, "not_leader", "No cluster peer is the leader to run the search; followers don't serve searches with leader_only_indexing", http.StatusServiceUnavailable)
+		return true
+	}
+	if err != nil {
+		s.errorResponse(w, "forward_failed", "Failed to forward search to the cluster leader: "+err.Error(), http.StatusBadGateway)
+		return true
+	}
+	writeForwardedResponse(w, resp)
+	return true
+}
+
+// isLeaderOnlyFollower reports whether this node is a follower that doesn't
+// index because of leader_only_indexing, so its indexes may be stale
+func (s *Server) isLeaderOnlyFollower() bool {
+	return s.clusterManager != nil && s.config != nil && s.config.Cluster.LeaderOnlyIndexing && !s.clusterManager.IsLeader()
+}
+
+// leaderOnlyMiddleware rejects reads of index contents on a follower under
+// leader_only_indexing instead of answering them from its stale indexes
+func (s *Server) leaderOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.isLeaderOnlyFollower() {
+			w.Header().Set("Retry-After", syncRetryAfter)
+			s.errorResponse(w, "not_leader", "This node is a follower with leader_only_indexing; send the request to the cluster leader", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedRequest reads a search into a request for the cluster service,
+// writing an error response and returning false if its body can't be read
+func (s *Server) forwardedRequest(w http.ResponseWriter, r *http.Request, index string) (*cluster.ForwardSearchRequest, bool) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			s.errorResponse(w, "bad_request", "Failed to read request body: "+err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	req := &cluster.ForwardSearchRequest{
+		Index:  index,
+		Query:  r.URL.RawQuery,
+		Header: make(map[string]string),
+		Body:   body,
+	}
+	headers := forwardedRequestHeaders
+	if s.clusterManager.SecureTransport() {
+		headers = append(headers[:len(headers):len(headers)], forwardedCredentialHeaders...)
+	}
+	for _, name := range headers {
+		if value := r.Header.Get(name); value != "" {
+			req.Header[name] = value
+		}
+	}
+	return req, true
+}
+
+// writeForwardedResponse writes the response of a forwarded search
+func writeForwardedResponse(w http.ResponseWriter, resp *cluster.ForwardSearchResponse) {
+	for name, value := range resp.Header {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// serveForwardedSearch runs a search forwarded by another node through this
+// node's routes, including authentication, and captures its response
+func (s *Server) serveForwardedSearch(ctx context.Context, req *cluster.ForwardSearchRequest, forwardedBy string) *cluster.ForwardSearchResponse {
+	rec := &bufferedResponse{header: make(http.Header)}
+
+	target := "/indexes/" + url.PathEscape(req.Index) + "/search"
+	if req.Query != "" {
+		target += "?" + req.Query
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(req.Body))
+	if err != nil {
+		s.errorResponse(rec, "bad_request", "Invalid forwarded search: "+err.Error(), http.StatusBadRequest)
+		return rec.response()
+	}
+	for name, value := range req.Header {
+		r.Header.Set(name, value)
+	}
+	r.Header.Set(cluster.ForwardedByHeader, forwardedBy)
+
+	s.forwardOnce.Do(func() { s.forwardRouter = s.Router() })
+	s.forwardRouter.ServeHTTP(rec, r)
+	return rec.response()
+}
+
+// bufferedResponse is a ResponseWriter keeping the response in memory
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// response converts the buffered response for the cluster service
+func (b *bufferedResponse) response() *cluster.ForwardSearchResponse {
+	resp := &cluster.ForwardSearchResponse{
+		Status: b.status,
+		Header: make(map[string]string, len(b.header)),
+		Body:   b.body.Bytes(),
+	}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	for name := range b.header {
+		resp.Header[name] = b.header.Get(name)
+	}
+	return resp
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/davidschrooten/open-atlas-search/internal/search"
+)
+
+// Limits of an import request
+const (
+	importBatchSize    = 500      // Documents indexed per batch
+	importMaxInFlight  = 2        // Batches read ahead of indexing before reading blocks
+	maxImportErrors    = 10       // Failed lines reported in the summary
+	maxImportLineBytes = 16 << 20 // Longest line read; longer lines are skipped as failed
+)
+
+// errImportLineTooLong is the error of lines longer than maxImportLineBytes
+var errImportLineTooLong = fmt.Errorf("line exceeds %d bytes", maxImportLineBytes)
+
+// importSummary reports the outcome of an import
+type importSummary struct {
+	Indexed int           `json:"indexed"`
+	Failed  int           `json:"failed"`
+	Errors  []importError `json:"errors,omitempty"` // The first maxImportErrors failures
+}
+
+// importError describes a line that couldn't be imported
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// fail counts a failed line, keeping its error if there's room
+func (s *importSummary) fail(line int, err error) {
+	s.Failed++
+	if len(s.Errors) < maxImportErrors {
+		s.Errors = append(s.Errors, importError{Line: line, Error: err.Error()})
+	}
+}
+
+// importLine is a parsed document with the line it was read from
+type importLine struct {
+	line int
+	doc  search.DocumentBatch
+}
+
+// importDocuments indexes a newline-delimited JSON stream of documents in the
+// format written by _export. The stream is read one line at a time and
+// indexed in batches; at most importMaxInFlight batches wait to be indexed, so
+// reading pauses while indexing catches up. Malformed lines and lines longer
+// than maxImportLineBytes are counted as failed and skipped. An error is returned if the body can't be read; the
+// summary then covers the lines read before it.
+func (s *Server) importDocuments(index string, body io.Reader) (*importSummary, error) {
+	summary := &importSummary{}
+	var mutex sync.Mutex // Guards summary, updated by the reader and the indexer
+
+	batches := make(chan []importLine, importMaxInFlight)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for batch := range batches {
+			indexed, failed := s.indexImportBatch(index, batch)
+			mutex.Lock()
+			summary.Indexed += indexed
+			for _, f := range failed {
+				summary.fail(f.line, f.err)
+			}
+			mutex.Unlock()
+		}
+	}()
+
+	reader := bufio.NewReader(body)
+	batch := make([]importLine, 0, importBatchSize)
+	var readErr error
+	for lineNumber := 1; ; lineNumber++ {
+		line, tooLong, err := readImportLine(reader)
+		if err != nil && !errors.Is(err, io.EOF) {
+			readErr = fmt.Errorf("failed to read line %d: %w", lineNumber, err)
+			break
+		}
+
+		if tooLong {
+			mutex.Lock()
+			summary.fail(lineNumber, errImportLineTooLong)
+			mutex.Unlock()
+		} else if line = bytes.TrimSpace(line); len(line) > 0 {
+			doc, parseErr := parseImportLine(line)
+			if parseErr != nil {
+				mutex.Lock()
+				summary.fail(lineNumber, parseErr)
+				mutex.Unlock()
+			} else {
+				batch = append(batch, importLine{line: lineNumber, doc: doc})
+			}
+		}
+		if len(batch) == importBatchSize {
+			batches <- batch
+			batch = make([]importLine, 0, importBatchSize)
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	if len(batch) > 0 {
+		batches <- batch
+	}
+	close(batches)
+	<-done
+
+	return summary, readErr
+}
+
+// readImportLine reads a line of up to maxImportLineBytes. Longer lines are
+// read to their end without being kept, and reported as too long.
+func readImportLine(reader *bufio.Reader) ([]byte, bool, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > maxImportLineBytes {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, tooLong, err
+		}
+	}
+}
+
+// parseImportLine parses a line of the form {"_id": "...", "source": {...}}
+func parseImportLine(line []byte) (search.DocumentBatch, error) {
+	var doc search.ExportedDocument
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return search.DocumentBatch{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if doc.ID == "" {
+		return search.DocumentBatch{}, errors.New("missing _id")
+	}
+	if doc.Source == nil {
+		return search.DocumentBatch{}, errors.New("missing source")
+	}
+	return search.DocumentBatch{ID: doc.ID, Doc: doc.Source}, nil
+}
+
+// failedImport is a document the engine couldn't index
+type failedImport struct {
+	line int
+	err  error
+}
+
+// indexImportBatch bulk indexes a batch, falling back to indexing documents
+// one by one if the batch fails, so a bad document fails only its own line
+func (s *Server) indexImportBatch(index string, batch []importLine) (int, []failedImport) {
+	docs := make([]search.DocumentBatch, len(batch))
+	for i, line := range batch {
+		docs[i] = line.doc
+	}
+	if err := s.searchEngine.IndexDocuments(index, docs); err == nil {
+		return len(batch), nil
+	}
+
+	indexed := 0
+	var failed []failedImport
+	for _, line := range batch {
+		if err := s.searchEngine.IndexDocument(index, line.doc.ID, line.doc.Doc); err != nil {
+			log.Printf("Failed to import document %s into index '%s': %v", line.doc.ID, index, err)
+			failed = append(failed, failedImport{line: line.line, err: err})
+			continue
+		}
+		indexed++
+	}
+	return indexed, failed
+}
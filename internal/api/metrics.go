@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/davidschrooten/open-atlas-search/internal/search"
+)
+
+// redactedValue replaces query values on redacted fields in the slow query log
+const redactedValue = "[REDACTED]"
+
+// searchMetrics tracks search latency per index. The zero value is ready to use.
+type searchMetrics struct {
+	mutex   sync.Mutex
+	indexes map[string]*indexSearchMetrics
+}
+
+// indexSearchMetrics accumulates the searches run against one index
+type indexSearchMetrics struct {
+	count  int64
+	errors int64
+	total  time.Duration
+	max    time.Duration
+}
+
+// record adds a search that took took to the metrics of an index
+func (m *searchMetrics) record(index string, took time.Duration, failed bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.indexes == nil {
+		m.indexes = make(map[string]*indexSearchMetrics)
+	}
+	metrics, exists := m.indexes[index]
+	if !exists {
+		metrics = &indexSearchMetrics{}
+		m.indexes[index] = metrics
+	}
+	metrics.count++
+	if failed {
+		metrics.errors++
+	}
+	metrics.total += took
+	metrics.max = max(metrics.max, took)
+}
+
+// latency returns the search latency of an index, or nil if it hasn't been searched
+func (m *searchMetrics) latency(index string) *search.SearchLatency {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	metrics, exists := m.indexes[index]
+	if !exists {
+		return nil
+	}
+	return &search.SearchLatency{
+		Count:  metrics.count,
+		Errors: metrics.errors,
+		AvgMs:  durationMs(metrics.total / time.Duration(metrics.count)),
+		MaxMs:  durationMs(metrics.max),
+	}
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// observeSearch records a completed search in the index's metrics and logs it
+// if it took at least server.slow_query_threshold
+func (s *Server) observeSearch(sReq search.SearchRequest, took time.Duration, err error) {
+	s.metrics.record(sReq.Index, took, err != nil)
+
+	if s.config == nil || s.config.Server.SlowQueryThreshold <= 0 {
+		return
+	}
+	if took < time.Duration(s.config.Server.SlowQueryThreshold)*time.Millisecond {
+		return
+	}
+
+	redact := make(map[string]bool, len(s.config.Server.SlowQueryRedactFields))
+	for _, field := range s.config.Server.SlowQueryRedactFields {
+		redact[field] = true
+	}
+	body := map[string]interface{}{"query": redactQuery(sReq.Query, redact)}
+	if len(sReq.FacetFilters) > 0 {
+		body["facet_filters"] = redactQuery(sReq.FacetFilters, redact)
+	}
+	query, marshalErr := json.Marshal(body)
+	if marshalErr != nil {
+		query = []byte("<unavailable>")
+	}
+	log.Printf("Slow query on index %s took %v: %s", sReq.Index, took, query)
+}
+
+// redactQuery returns a copy of a query with the values of clauses whose path
+// names a redacted field replaced, keeping the query's structure
+func redactQuery(value interface{}, redact map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		mask := pathRedacted(v["path"], redact)
+		for key, child := range v {
+			if mask && key != "path" {
+				redacted[key] = redactedValue
+			} else {
+				redacted[key] = redactQuery(child, redact)
+			}
+		}
+		return redacted
+	case map[string]map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			redacted[key] = redactQuery(child, redact)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, child := range v {
+			redacted[i] = redactQuery(child, redact)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// pathRedacted reports whether a clause path, a field name or list of field
+// names, includes a redacted field
+func pathRedacted(path interface{}, redact map[string]bool) bool {
+	switch p := path.(type) {
+	case string:
+		return redact[p]
+	case []interface{}:
+		for _, field := range p {
+			if name, ok := field.(string); ok && redact[name] {
+				return true
+			}
+		}
+	}
+	return false
+}
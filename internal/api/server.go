@@ -1,13 +1,20 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/pprof"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -15,8 +22,25 @@ import (
 	"github.com/davidschrooten/open-atlas-search/internal/cluster"
 	"github.com/davidschrooten/open-atlas-search/internal/indexer"
 	"github.com/davidschrooten/open-atlas-search/internal/search"
+	syncstate "github.com/davidschrooten/open-atlas-search/internal/sync"
 )
 
+// defaultMaxResultWindow is the default limit on from + size for search requests
+const defaultMaxResultWindow = 10000
+
+// exportFlushInterval is the number of exported documents written between flushes
+const exportFlushInterval = 1000
+
+// searchRetryAfter is the Retry-After value, in seconds, sent when searches are saturated
+const searchRetryAfter = "1"
+
+// syncRetryAfter is the Retry-After value, in seconds, sent while an index is still
+// performing its initial sync
+const syncRetryAfter = "5"
+
+// errTooManySearches is returned when max_concurrent_searches searches are already running
+var errTooManySearches = errors.New("too many concurrent searches")
+
 // ErrorResponse represents a structured API error response
 type ErrorResponse struct {
 	Error   string `json:"error"`
@@ -24,22 +48,42 @@ type ErrorResponse struct {
 	Code    int    `json:"code"`
 }
 
+// MongoPinger checks connectivity to MongoDB for the readiness probe
+type MongoPinger interface {
+	Ping(ctx context.Context) error
+}
+
 // Server represents the API server
 type Server struct {
 	searchEngine   search.SearchEngine
 	indexerService *indexer.Service
+	mongoClient    MongoPinger
 	clusterManager *cluster.Manager
 	config         *config.Config
+	metrics        searchMetrics
+	searchSlots    chan struct{} // Semaphore limiting concurrent searches; nil is unlimited
+	forwardOnce    sync.Once
+	forwardRouter  http.Handler // Routes searches forwarded by other cluster nodes
 }
 
 // NewServer creates a new API server
-func NewServer(searchEngine search.SearchEngine, indexerService *indexer.Service, cfg *config.Config, clusterManager *cluster.Manager) *Server {
-	return &Server{
+func NewServer(searchEngine search.SearchEngine, indexerService *indexer.Service, mongoClient MongoPinger, cfg *config.Config, clusterManager *cluster.Manager) *Server {
+	var searchSlots chan struct{}
+	if cfg != nil && cfg.Server.MaxConcurrentSearches > 0 {
+		searchSlots = make(chan struct{}, cfg.Server.MaxConcurrentSearches)
+	}
+	s := &Server{
 		searchEngine:   searchEngine,
 		indexerService: indexerService,
+		mongoClient:    mongoClient,
 		clusterManager: clusterManager,
 		config:         cfg,
+		searchSlots:    searchSlots,
 	}
+	if clusterManager != nil {
+		clusterManager.SetSearchHandler(s.serveForwardedSearch)
+	}
+	return s
 }
 
 // Router setups the API routes
@@ -55,22 +99,54 @@ func (s *Server) Router() http.Handler {
 	r.Get("/ready", s.handleReady)
 
 	// Protected endpoints (authentication required if configured)
+	authEnabled := s.isAuthenticationEnabled() || s.hasIndexAuth()
 	r.Group(func(r chi.Router) {
 		// Apply authentication middleware if credentials are configured
-		if s.isAuthenticationEnabled() {
-			r.Use(s.basicAuthMiddleware)
+		if authEnabled {
+			r.Use(s.authMiddleware)
 		}
 
 		r.Post("/indexes/{index}/search", s.handleSearch)
+		r.Post("/indexes/{index}/_analyze_query", s.handleAnalyzeQuery)
+		r.Post("/indexes/{index}/_validate", s.handleValidate)
+		r.Post("/indexes/{index}/_analyze", s.handleAnalyze)
+		r.With(s.leaderOnlyMiddleware).Post("/indexes/{index}/_count_by", s.handleCountBy)
+		r.With(s.leaderOnlyMiddleware).Get("/indexes/{index}/terms", s.handleTerms)
+		r.With(s.leaderOnlyMiddleware).Get("/indexes/{index}/_export", s.handleExport)
+		r.Post("/indexes/{index}/_import", s.handleImport)
 		r.Get("/indexes/{index}/status", s.handleStatus)
 		r.Get("/indexes/{index}/mapping", s.handleMapping)
+		r.Get("/indexes/{index}/stats", s.handleStats)
+		r.Post("/indexes/{index}/_optimize", s.handleOptimize)
+		r.Post("/indexes/{index}/_repoll", s.handleRepoll)
+		r.Post("/indexes/{index}/_pause", s.handlePause)
+		r.Post("/indexes/{index}/_resume", s.handleResume)
+		r.Post("/indexes/{index}/_rename", s.handleRename)
 		r.Get("/indexes", s.handleListIndexes)
+
+		if s.config != nil && s.config.Server.EnablePprof {
+			r.HandleFunc("/debug/pprof/*", pprof.Index)
+			r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+			r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+			r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+			r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		}
+	})
+
+	// Multi-search names its indexes in the body and authorizes each search
+	r.Group(func(r chi.Router) {
+		if authEnabled {
+			r.Use(s.multiSearchAuthMiddleware)
+		}
+		r.With(s.leaderOnlyMiddleware).Post("/_msearch", s.handleMultiSearch)
 	})
 
 	return r
 }
 
 func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
 	// Validate index parameter
 	index := strings.TrimSpace(chi.URLParam(r, "index"))
 	if index == "" {
@@ -78,24 +154,33 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate index exists
+	// Followers under leader_only_indexing leave searches to the leader
+	if s.forwardSearchToLeader(w, r, index) {
+		return
+	}
+
+	// Validate index exists, asking the cluster peers for indexes this node lacks
 	if !s.indexExists(index) {
+		if s.forwardSearch(w, r, index) {
+			return
+		}
 		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
 		return
 	}
 
+	if errResp := s.indexNotReady(index); errResp != nil {
+		w.Header().Set("Retry-After", syncRetryAfter)
+		s.errorResponse(w, errResp.Error, errResp.Message, errResp.Code)
+		return
+	}
+
 	// Validate request body
 	if r.Body == nil {
 		s.errorResponse(w, "bad_request", "Request body is required", http.StatusBadRequest)
 		return
 	}
 
-	var searchReq struct {
-		Query  map[string]interface{}         `json:"query"`
-		Facets map[string]search.FacetRequest `json:"facets"`
-		Size   int                            `json:"size"`
-		From   int                            `json:"from"`
-	}
+	var searchReq searchRequestBody
 
 	// Parse the request body
 	if err := json.NewDecoder(r.Body).Decode(&searchReq); err != nil {
@@ -104,66 +189,523 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate search parameters
-	if searchReq.Size < 0 {
-		s.errorResponse(w, "invalid_parameter", "Size parameter cannot be negative", http.StatusBadRequest)
+	sReq, errResp := s.buildSearchRequest(index, searchReq)
+	if errResp != nil {
+		s.errorResponse(w, errResp.Error, errResp.Message, errResp.Code)
 		return
 	}
-	if searchReq.From < 0 {
-		s.errorResponse(w, "invalid_parameter", "From parameter cannot be negative", http.StatusBadRequest)
+	format, errResp := s.responseFormat(searchReq)
+	if errResp != nil {
+		s.errorResponse(w, errResp.Error, errResp.Message, errResp.Code)
 		return
 	}
-	if searchReq.Size > 1000 {
-		s.errorResponse(w, "invalid_parameter", "Size parameter cannot exceed 1000", http.StatusBadRequest)
+
+	searchResult, err := s.runSearch(sReq)
+	if err != nil {
+		log.Printf("Search error for index '%s': %v", index, err)
+		if errors.Is(err, errTooManySearches) {
+			w.Header().Set("Retry-After", searchRetryAfter)
+		}
+		errResp := searchError(index, err)
+		s.errorResponse(w, errResp.Error, errResp.Message, errResp.Code)
+		return
+	}
+
+	s.successResponse(w, formatSearchResult(format, searchResult, time.Since(start)), prettyRequested(r))
+}
+
+// Limits of a multi-search request
+const (
+	maxMultiSearches   = 100 // Sub-searches accepted in one request
+	multiSearchWorkers = 4   // Sub-searches executed concurrently
+)
+
+// multiSearchItem is one search of a multi-search request
+type multiSearchItem struct {
+	Index string `json:"index"`
+	searchRequestBody
+}
+
+func (s *Server) handleMultiSearch(w http.ResponseWriter, r *http.Request) {
+	var items []multiSearchItem
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		s.errorResponse(w, "invalid_json", "Invalid JSON in request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 {
+		s.errorResponse(w, "invalid_parameter", "At least one search is required", http.StatusBadRequest)
+		return
+	}
+	if len(items) > maxMultiSearches {
+		s.errorResponse(w, "invalid_parameter", fmt.Sprintf("A multi-search cannot contain more than %d searches", maxMultiSearches), http.StatusBadRequest)
 		return
 	}
 
+	// Each response is a search result or, if that search failed, an error
+	responses := make([]interface{}, len(items))
+	p := principalFrom(r.Context())
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < min(multiSearchWorkers, len(items)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				responses[i] = s.multiSearch(items[i], p)
+			}
+		}()
+	}
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	s.successResponse(w, map[string]interface{}{
+		"responses": responses,
+	}, prettyRequested(r))
+}
+
+// multiSearch runs one search of a multi-search request as principal p and
+// returns its result or error response
+func (s *Server) multiSearch(item multiSearchItem, p *principal) interface{} {
+	start := time.Now()
+	index := strings.TrimSpace(item.Index)
+	if index == "" {
+		return &ErrorResponse{Error: "bad_request", Message: "Index is required", Code: http.StatusBadRequest}
+	}
+	if !s.authorized(p, index) {
+		return &ErrorResponse{Error: "access_denied", Message: fmt.Sprintf("Credentials do not grant access to index '%s'", index), Code: http.StatusForbidden}
+	}
+	if !s.indexExists(index) {
+		return &ErrorResponse{Error: "index_not_found", Message: fmt.Sprintf("Index '%s' not found", index), Code: http.StatusNotFound}
+	}
+	if errResp := s.indexNotReady(index); errResp != nil {
+		return errResp
+	}
+
+	sReq, errResp := s.buildSearchRequest(index, item.searchRequestBody)
+	if errResp != nil {
+		return errResp
+	}
+	format, errResp := s.responseFormat(item.searchRequestBody)
+	if errResp != nil {
+		return errResp
+	}
+
+	result, err := s.runSearch(sReq)
+	if err != nil {
+		log.Printf("Multi-search error for index '%s': %v", index, err)
+		return searchError(index, err)
+	}
+	return formatSearchResult(format, result, time.Since(start))
+}
+
+// searchRequestBody is the JSON body of a search request
+type searchRequestBody struct {
+	Query          map[string]interface{}            `json:"query"`
+	Facets         map[string]search.FacetRequest    `json:"facets"`
+	FacetFilters   map[string]map[string]interface{} `json:"facet_filters"`
+	Size           int                               `json:"size"`
+	From           int                               `json:"from"`
+	ScoreMode      string                            `json:"score_mode"`
+	Source         []string                          `json:"_source"`
+	Profile        bool                              `json:"profile"`
+	MinScore       float64                           `json:"min_score"`
+	MatchedFields  bool                              `json:"matched_fields"`
+	TypedSource    bool                              `json:"typed_source"`    // Tag date and numeric source values with their type
+	Highlight      map[string]interface{}            `json:"highlight"`       // fields, fragmentOrder and maxNumberOfFragments
+	ResponseFormat string                            `json:"response_format"` // flat or envelope, defaulting to server.response_format
+}
+
+// buildSearchRequest validates a search request body, applies defaults and
+// converts it to a search engine request for index
+func (s *Server) buildSearchRequest(index string, searchReq searchRequestBody) (search.SearchRequest, *ErrorResponse) {
+	invalid := func(errorType, message string) (search.SearchRequest, *ErrorResponse) {
+		return search.SearchRequest{}, &ErrorResponse{Error: errorType, Message: message, Code: http.StatusBadRequest}
+	}
+
+	// Validate search parameters
+	if searchReq.Size < 0 {
+		return invalid("invalid_parameter", "Size parameter cannot be negative")
+	}
+	if searchReq.From < 0 {
+		return invalid("invalid_parameter", "From parameter cannot be negative")
+	}
+	defaultSize, maxSize := s.searchSizeLimits(index)
+	if searchReq.Size > maxSize {
+		return invalid("invalid_parameter", fmt.Sprintf("Size parameter cannot exceed %d", maxSize))
+	}
+	if searchReq.MinScore < 0 {
+		return invalid("invalid_parameter", "Min score parameter cannot be negative")
+	}
+
+	if searchReq.ScoreMode != "" && searchReq.ScoreMode != search.ScoreModeRaw && searchReq.ScoreMode != search.ScoreModeNormalized {
+		return invalid("invalid_parameter", fmt.Sprintf("Score mode must be '%s' or '%s'", search.ScoreModeRaw, search.ScoreModeNormalized))
+	}
+
 	// Set defaults
 	if searchReq.Size == 0 {
-		searchReq.Size = 10
+		searchReq.Size = defaultSize
+	}
+	if searchReq.ScoreMode == "" {
+		searchReq.ScoreMode = search.ScoreModeRaw
+	}
+
+	if maxWindow := s.maxResultWindow(); searchReq.From+searchReq.Size > maxWindow {
+		return invalid("result_window_too_large", fmt.Sprintf("Result window is too large, from + size must be less than or equal to %d but was %d. Use the scroll API to page through large result sets, or raise search.max_result_window", maxWindow, searchReq.From+searchReq.Size))
 	}
 
 	// Prepare the search request for the search engine
-	sReq := search.SearchRequest{
-		Index:  index,
-		Query:  searchReq.Query,
-		Facets: searchReq.Facets,
-		Size:   searchReq.Size,
-		From:   searchReq.From,
+	return search.SearchRequest{
+		Index:         index,
+		Query:         searchReq.Query,
+		Facets:        searchReq.Facets,
+		FacetFilters:  searchReq.FacetFilters,
+		Size:          searchReq.Size,
+		From:          searchReq.From,
+		ScoreMode:     searchReq.ScoreMode,
+		Fields:        searchReq.Source,
+		Profile:       searchReq.Profile,
+		MinScore:      searchReq.MinScore,
+		MatchedFields: searchReq.MatchedFields,
+		TypedSource:   searchReq.TypedSource,
+		Highlight:     searchReq.Highlight,
+	}, nil
+}
+
+// runSearch executes a search request and records its latency
+func (s *Server) runSearch(sReq search.SearchRequest) (*search.SearchResult, error) {
+	// Reject searches beyond max_concurrent_searches instead of queueing them
+	if s.searchSlots != nil {
+		select {
+		case s.searchSlots <- struct{}{}:
+			defer func() { <-s.searchSlots }()
+		default:
+			return nil, errTooManySearches
+		}
 	}
 
-	// Determine if this index is sharded and use appropriate search method
-	var searchResult *search.SearchResult
-	var err error
+	start := time.Now()
+	result, err := s.executeSearch(sReq)
+	s.observeSearch(sReq, time.Since(start), err)
+	return result, err
+}
 
+// executeSearch runs a search request, searching every shard of sharded indexes
+func (s *Server) executeSearch(sReq search.SearchRequest) (*search.SearchResult, error) {
 	// Check if this index has multiple shards
-	if s.isIndexSharded(index) {
+	if s.isIndexSharded(sReq.Index) {
 		// Use sharded search
 		if engine, ok := s.searchEngine.(*search.Engine); ok {
-			searchResult, err = engine.SearchSharded(sReq)
+			return engine.SearchSharded(sReq)
+		}
+	}
+	// Use regular search for non-sharded indexes, or engines that can't search shards
+	return s.searchEngine.Search(sReq)
+}
+
+// searchError maps a search engine error to an error response
+func searchError(index string, err error) *ErrorResponse {
+	switch {
+	case errors.Is(err, errTooManySearches):
+		return &ErrorResponse{Error: "too_many_searches", Message: "Too many concurrent searches, retry later", Code: http.StatusServiceUnavailable}
+	case errors.Is(err, search.ErrIndexNotFound):
+		return &ErrorResponse{Error: "index_not_found", Message: fmt.Sprintf("Index '%s' not found", index), Code: http.StatusNotFound}
+	case errors.Is(err, search.ErrInvalidFacet):
+		return &ErrorResponse{Error: "invalid_facet", Message: "Invalid facet: " + err.Error(), Code: http.StatusBadRequest}
+	case errors.Is(err, search.ErrInvalidQuery):
+		return &ErrorResponse{Error: "invalid_query", Message: "Invalid search query: " + err.Error(), Code: http.StatusBadRequest}
+	case errors.Is(err, search.ErrSearchTimeout):
+		return &ErrorResponse{Error: "search_timeout", Message: "Search operation timed out", Code: http.StatusGatewayTimeout}
+	default:
+		return &ErrorResponse{Error: "search_failed", Message: "Search operation failed", Code: http.StatusInternalServerError}
+	}
+}
+
+func (s *Server) handleAnalyzeQuery(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	var analyzeReq struct {
+		Query map[string]interface{} `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&analyzeReq); err != nil {
+		s.errorResponse(w, "invalid_json", "Invalid JSON in request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	description, err := s.searchEngine.DescribeQuery(index, analyzeReq.Query)
+	if err != nil {
+		log.Printf("Failed to analyze query for index '%s': %v", index, err)
+		if errors.Is(err, search.ErrIndexNotFound) {
+			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
 		} else {
-			// Fallback to regular search
-			searchResult, err = s.searchEngine.Search(sReq)
+			s.errorResponse(w, "invalid_query", "Invalid search query: "+err.Error(), http.StatusBadRequest)
 		}
-	} else {
-		// Use regular search for non-sharded indexes
-		searchResult, err = s.searchEngine.Search(sReq)
+		return
+	}
+
+	s.successResponse(w, map[string]interface{}{
+		"index": index,
+		"query": description,
+	}, prettyRequested(r))
+}
+
+// handleValidate checks that a query converts for an index without running it,
+// so saved queries can be validated before they are deployed. Invalid queries
+// are reported in a successful response rather than as an error.
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	var validateReq struct {
+		Query map[string]interface{} `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&validateReq); err != nil {
+		s.errorResponse(w, "invalid_json", "Invalid JSON in request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := s.searchEngine.ValidateQuery(index, validateReq.Query)
+	switch {
+	case err == nil:
+		s.successResponse(w, map[string]interface{}{"valid": true}, prettyRequested(r))
+	case errors.Is(err, search.ErrIndexNotFound):
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+	case errors.Is(err, search.ErrInvalidQuery):
+		s.successResponse(w, map[string]interface{}{"valid": false, "error": err.Error()}, prettyRequested(r))
+	default:
+		log.Printf("Failed to validate query for index '%s': %v", index, err)
+		s.errorResponse(w, "internal_error", "Failed to validate query", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
 	}
 
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	var analyzeReq struct {
+		Analyzer string `json:"analyzer"`
+		Text     string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&analyzeReq); err != nil {
+		s.errorResponse(w, "invalid_json", "Invalid JSON in request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := s.searchEngine.AnalyzeText(index, analyzeReq.Analyzer, analyzeReq.Text)
 	if err != nil {
-		log.Printf("Search error for index '%s': %v", index, err)
-		// Check if it's an index not found error
-		if strings.Contains(err.Error(), "not found") {
+		log.Printf("Failed to analyze text for index '%s': %v", index, err)
+		if errors.Is(err, search.ErrUnknownAnalyzer) {
+			s.errorResponse(w, "invalid_analyzer", err.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, search.ErrIndexNotFound) {
 			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
-		} else if strings.Contains(err.Error(), "query") {
+		} else {
+			s.errorResponse(w, "analyze_failed", "Failed to analyze text", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.successResponse(w, map[string]interface{}{
+		"tokens": tokens,
+	}, prettyRequested(r))
+}
+
+func (s *Server) handleCountBy(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	if errResp := s.indexNotReady(index); errResp != nil {
+		w.Header().Set("Retry-After", syncRetryAfter)
+		s.errorResponse(w, errResp.Error, errResp.Message, errResp.Code)
+		return
+	}
+
+	var countReq struct {
+		Field string                 `json:"field"`
+		Query map[string]interface{} `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&countReq); err != nil {
+		s.errorResponse(w, "invalid_json", "Invalid JSON in request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(countReq.Field) == "" {
+		s.errorResponse(w, "invalid_parameter", "Field parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	counts, err := s.searchEngine.CountBy(index, countReq.Field, countReq.Query)
+	if err != nil {
+		log.Printf("Failed to count by %s for index '%s': %v", countReq.Field, index, err)
+		if errors.Is(err, search.ErrIndexNotFound) {
+			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		} else if errors.Is(err, search.ErrInvalidQuery) {
 			s.errorResponse(w, "invalid_query", "Invalid search query: "+err.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, search.ErrSearchTimeout) {
+			s.errorResponse(w, "search_timeout", "Count operation timed out", http.StatusGatewayTimeout)
+		} else {
+			s.errorResponse(w, "count_failed", "Failed to count documents", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.successResponse(w, counts, prettyRequested(r))
+}
+
+func (s *Server) handleTerms(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	field := strings.TrimSpace(r.URL.Query().Get("field"))
+	if field == "" {
+		s.errorResponse(w, "invalid_parameter", "Field parameter is required", http.StatusBadRequest)
+		return
+	}
+	size := search.DefaultTermsSize
+	if sizeParam := r.URL.Query().Get("size"); sizeParam != "" {
+		parsed, err := strconv.Atoi(sizeParam)
+		if err != nil || parsed < 1 || parsed > search.MaxTermsSize {
+			s.errorResponse(w, "invalid_parameter", fmt.Sprintf("Size must be a number between 1 and %d", search.MaxTermsSize), http.StatusBadRequest)
+			return
+		}
+		size = parsed
+	}
+
+	terms, err := s.searchEngine.Terms(index, field, r.URL.Query().Get("prefix"), size)
+	if err != nil {
+		log.Printf("Failed to list terms of %s for index '%s': %v", field, index, err)
+		if errors.Is(err, search.ErrIndexNotFound) {
+			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		} else {
+			s.errorResponse(w, "terms_failed", "Failed to list terms", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.successResponse(w, map[string]interface{}{
+		"field": field,
+		"terms": terms,
+	}, prettyRequested(r))
+}
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	exported := 0
+	err := s.searchEngine.ExportDocuments(index, func(doc search.ExportedDocument) error {
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+		exported++
+		if exported%exportFlushInterval == 0 && flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to export index '%s' after %d documents: %v", index, exported, err)
+		// Once documents are streamed the status can't change, so the export just ends
+		if exported > 0 {
+			return
+		}
+		if errors.Is(err, search.ErrIndexNotFound) {
+			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		} else if errors.Is(err, search.ErrSearchTimeout) {
+			s.errorResponse(w, "search_timeout", "Export timed out", http.StatusGatewayTimeout)
 		} else {
-			s.errorResponse(w, "search_failed", "Search operation failed", http.StatusInternalServerError)
+			s.errorResponse(w, "export_failed", "Failed to export index", http.StatusInternalServerError)
 		}
+	}
+}
+
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
 		return
 	}
 
-	s.successResponse(w, searchResult)
+	summary, err := s.importDocuments(index, r.Body)
+	if err != nil {
+		log.Printf("Failed to import into index '%s' after %d documents: %v", index, summary.Indexed, err)
+		s.errorResponse(w, "import_failed", fmt.Sprintf("Import stopped after %d documents: %v", summary.Indexed, err), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Imported %d documents into index '%s' (%d failed)", summary.Indexed, index, summary.Failed)
+
+	s.successResponse(w, summary, prettyRequested(r))
 }
 
 func (s *Server) handleListIndexes(w http.ResponseWriter, r *http.Request) {
@@ -174,6 +716,18 @@ func (s *Server) handleListIndexes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Sharded indexes are reported once under their logical name unless the
+	// individual shards are asked for
+	if r.URL.Query().Get("expand_shards") != "true" {
+		logical := make([]search.IndexInfo, 0, len(indexes))
+		for _, index := range indexes {
+			if index.ShardOf == "" {
+				logical = append(logical, index)
+			}
+		}
+		indexes = logical
+	}
+
 	// Get sync states from indexer service and update indexes status
 	if s.indexerService != nil {
 		syncStates := s.indexerService.GetSyncStates()
@@ -184,7 +738,9 @@ func (s *Server) handleListIndexes(w http.ResponseWriter, r *http.Request) {
 			collectionKey := s.findCollectionKeyForIndex(indexName)
 			if collectionKey != "" {
 				if syncState, exists := syncStates[collectionKey]; exists {
-					if string(syncState.SyncStatus) == "in_progress" {
+					if syncState.Paused {
+						indexes[i].Status = "paused"
+					} else if string(syncState.SyncStatus) == "in_progress" {
 						indexes[i].Status = "syncing"
 						indexes[i].SyncProgress = syncState.Progress
 					} else {
@@ -198,7 +754,7 @@ func (s *Server) handleListIndexes(w http.ResponseWriter, r *http.Request) {
 	s.successResponse(w, map[string]interface{}{
 		"indexes": indexes,
 		"total":   len(indexes),
-	})
+	}, prettyRequested(r))
 }
 
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
@@ -236,7 +792,9 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		collectionKey := s.findCollectionKeyForIndex(targetIndex.Name)
 		if collectionKey != "" {
 			if syncState, exists := syncStates[collectionKey]; exists {
-				if string(syncState.SyncStatus) == "in_progress" {
+				if syncState.Paused {
+					targetIndex.Status = "paused"
+				} else if string(syncState.SyncStatus) == "in_progress" {
 					targetIndex.Status = "syncing"
 					targetIndex.SyncProgress = syncState.Progress
 				} else {
@@ -252,8 +810,19 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		"status":  "running",
 		"index":   *targetIndex,
 	}
+	if s.indexerService != nil {
+		if size, measured := s.indexerService.IndexSize(targetIndex.Name); measured {
+			status["size"] = size
+		}
+		if verification, verified := s.indexerService.SyncVerification(targetIndex.Name); verified {
+			status["syncVerification"] = verification
+		}
+		if breaker, enabled := s.indexerService.MongoBreaker(); enabled {
+			status["mongodbBreaker"] = breaker
+		}
+	}
 
-	s.successResponse(w, status)
+	s.successResponse(w, status, prettyRequested(r))
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -261,7 +830,7 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	s.successResponse(w, map[string]interface{}{
 		"status":  "healthy",
 		"service": "open-atlas-search",
-	})
+	}, prettyRequested(r))
 }
 
 func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
@@ -304,11 +873,38 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 	}
 	checks["indexes"] = "ok"
 
+	// Wait for the warm-up queries so the first searches aren't slow
+	if s.indexerService.WarmingUp() {
+		checks["warmup"] = "in_progress"
+		s.jsonResponse(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":  "not_ready",
+			"service": "open-atlas-search",
+			"checks":  checks,
+		}, prettyRequested(r))
+		return
+	}
+	checks["warmup"] = "ok"
+
+	// Verify that MongoDB is reachable
+	if s.mongoClient != nil {
+		if err := s.mongoClient.Ping(r.Context()); err != nil {
+			log.Printf("Readiness check failed - cannot reach MongoDB: %v", err)
+			checks["mongodb"] = err.Error()
+			s.jsonResponse(w, http.StatusServiceUnavailable, map[string]interface{}{
+				"status":  "not_ready",
+				"service": "open-atlas-search",
+				"checks":  checks,
+			}, prettyRequested(r))
+			return
+		}
+		checks["mongodb"] = "ok"
+	}
+
 	s.successResponse(w, map[string]interface{}{
 		"status":  "ready",
 		"service": "open-atlas-search",
 		"checks":  checks,
-	})
+	}, prettyRequested(r))
 }
 
 func (s *Server) handleMapping(w http.ResponseWriter, r *http.Request) {
@@ -328,7 +924,7 @@ func (s *Server) handleMapping(w http.ResponseWriter, r *http.Request) {
 	mapping, err := s.searchEngine.GetIndexMapping(index)
 	if err != nil {
 		log.Printf("Failed to get mapping for index '%s': %v", index, err)
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, search.ErrIndexNotFound) {
 			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
 		} else {
 			s.errorResponse(w, "mapping_failed", "Failed to retrieve index mapping", http.StatusInternalServerError)
@@ -336,7 +932,230 @@ func (s *Server) handleMapping(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.successResponse(w, mapping)
+	s.successResponse(w, mapping, prettyRequested(r))
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	stats, err := s.searchEngine.GetIndexStats(index)
+	if err != nil {
+		log.Printf("Failed to get stats for index '%s': %v", index, err)
+		if errors.Is(err, search.ErrIndexNotFound) {
+			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		} else {
+			s.errorResponse(w, "stats_failed", "Failed to retrieve index stats", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Apply sync counters from the indexer
+	if s.indexerService != nil {
+		syncStates := s.indexerService.GetSyncStates()
+		collectionKey := s.findCollectionKeyForIndex(index)
+		if syncState, exists := syncStates[collectionKey]; exists && collectionKey != "" {
+			stats.DocumentsIndexed = syncState.DocumentsIndexed
+			stats.DocumentsFailed = syncState.DocumentsFailed
+		}
+	}
+	stats.Searches = s.metrics.latency(index)
+
+	s.successResponse(w, stats, prettyRequested(r))
+}
+
+func (s *Server) handleOptimize(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	result, err := s.searchEngine.OptimizeIndex(index)
+	if err != nil {
+		log.Printf("Failed to optimize index '%s': %v", index, err)
+		if errors.Is(err, search.ErrIndexNotFound) {
+			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		} else if errors.Is(err, search.ErrOptimizeInProgress) {
+			s.errorResponse(w, "optimize_in_progress", fmt.Sprintf("Index '%s' is already being optimized", index), http.StatusConflict)
+		} else {
+			s.errorResponse(w, "optimize_failed", "Failed to optimize index", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.successResponse(w, result, prettyRequested(r))
+}
+
+func (s *Server) handleRepoll(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	sinceParam := r.URL.Query().Get("since")
+	if sinceParam == "" {
+		s.errorResponse(w, "invalid_parameter", "The since parameter is required", http.StatusBadRequest)
+		return
+	}
+	since, err := time.Parse(time.RFC3339, sinceParam)
+	if err != nil {
+		s.errorResponse(w, "invalid_parameter", "The since parameter must be an RFC3339 timestamp", http.StatusBadRequest)
+		return
+	}
+	if since.After(time.Now()) {
+		s.errorResponse(w, "invalid_parameter", "The since parameter cannot be in the future", http.StatusBadRequest)
+		return
+	}
+
+	if s.indexerService == nil {
+		s.errorResponse(w, "service_unavailable", "Indexer service not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	count, err := s.indexerService.Repoll(r.Context(), index, since)
+	if err != nil {
+		log.Printf("Failed to re-poll index '%s': %v", index, err)
+		if errors.Is(err, search.ErrIndexNotFound) {
+			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		} else if errors.Is(err, indexer.ErrPollingNotStarted) {
+			s.errorResponse(w, "polling_not_started", fmt.Sprintf("Polling has not started for index '%s'", index), http.StatusConflict)
+		} else if errors.Is(err, indexer.ErrIndexPaused) {
+			s.errorResponse(w, "index_paused", fmt.Sprintf("Syncing index '%s' is paused", index), http.StatusConflict)
+		} else {
+			s.errorResponse(w, "repoll_failed", "Failed to re-poll index", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.successResponse(w, map[string]interface{}{
+		"index":           index,
+		"since":           since,
+		"documentsPolled": count,
+	}, prettyRequested(r))
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.setIndexPaused(w, r, true)
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.setIndexPaused(w, r, false)
+}
+
+// setIndexPaused pauses or resumes syncing the collection of the requested index
+func (s *Server) setIndexPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	if s.indexerService == nil {
+		s.errorResponse(w, "service_unavailable", "Indexer service not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	var err error
+	if paused {
+		err = s.indexerService.Pause(index)
+	} else {
+		err = s.indexerService.Resume(index)
+	}
+	if err != nil {
+		log.Printf("Failed to set paused=%v for index '%s': %v", paused, index, err)
+		if errors.Is(err, search.ErrIndexNotFound) {
+			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' is not synced from a collection", index), http.StatusNotFound)
+		} else if errors.Is(err, indexer.ErrPollingNotStarted) {
+			s.errorResponse(w, "polling_not_started", fmt.Sprintf("Polling has not started for index '%s'", index), http.StatusConflict)
+		} else {
+			s.errorResponse(w, "pause_failed", "Failed to save the paused state", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.successResponse(w, map[string]interface{}{
+		"index":  index,
+		"paused": paused,
+	}, prettyRequested(r))
+}
+
+func (s *Server) handleRename(w http.ResponseWriter, r *http.Request) {
+	// Validate index parameter
+	index := strings.TrimSpace(chi.URLParam(r, "index"))
+	if index == "" {
+		s.errorResponse(w, "bad_request", "Index parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate index exists
+	if !s.indexExists(index) {
+		s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		return
+	}
+
+	var renameReq struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&renameReq); err != nil {
+		s.errorResponse(w, "invalid_json", "Invalid JSON in request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(renameReq.Name) == "" {
+		s.errorResponse(w, "invalid_parameter", "Name parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.searchEngine.RenameIndex(index, renameReq.Name); err != nil {
+		log.Printf("Failed to rename index '%s' to '%s': %v", index, renameReq.Name, err)
+		if errors.Is(err, search.ErrIndexNotFound) {
+			s.errorResponse(w, "index_not_found", fmt.Sprintf("Index '%s' not found", index), http.StatusNotFound)
+		} else if errors.Is(err, search.ErrIndexExists) {
+			s.errorResponse(w, "index_exists", fmt.Sprintf("Index '%s' already exists", renameReq.Name), http.StatusConflict)
+		} else if errors.Is(err, search.ErrInvalidIndexName) {
+			s.errorResponse(w, "invalid_parameter", fmt.Sprintf("Invalid index name '%s'", renameReq.Name), http.StatusBadRequest)
+		} else {
+			s.errorResponse(w, "rename_failed", "Failed to rename index", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.successResponse(w, map[string]interface{}{
+		"index":        renameReq.Name,
+		"previousName": index,
+	}, prettyRequested(r))
 }
 
 // findCollectionKeyForIndex finds the collection key for a given index name
@@ -352,16 +1171,65 @@ func (s *Server) findCollectionKeyForIndex(indexName string) string {
 	return ""
 }
 
+// indexNotReady returns the error for searching an index that sets
+// search_during_initial_sync to false while its initial sync is in progress,
+// or nil when the index can be searched
+func (s *Server) indexNotReady(index string) *ErrorResponse {
+	if s.config == nil || s.indexerService == nil {
+		return nil
+	}
+	for _, indexCfg := range s.config.Indexes {
+		if indexCfg.Name != index || indexCfg.SearchableDuringInitialSync() {
+			continue
+		}
+		collectionKey := fmt.Sprintf("%s.%s", indexCfg.Database, indexCfg.Collection)
+		syncState, exists := s.indexerService.GetSyncStates()[collectionKey]
+		if !exists || syncState.SyncStatus != syncstate.StatusInProgress {
+			return nil
+		}
+		return &ErrorResponse{
+			Error:   "index_not_ready",
+			Message: fmt.Sprintf("Index '%s' is not searchable until its initial sync completes (progress: %s)", index, syncState.Progress),
+			Code:    http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
 // successResponse writes a successful response in JSON
-func (s *Server) successResponse(w http.ResponseWriter, data interface{}) {
+func (s *Server) successResponse(w http.ResponseWriter, data interface{}, pretty bool) {
+	s.jsonResponse(w, http.StatusOK, data, pretty)
+}
+
+// jsonResponse writes data as JSON with the given status code, indented when
+// pretty is set and compact otherwise
+func (s *Server) jsonResponse(w http.ResponseWriter, statusCode int, data interface{}, pretty bool) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
+	w.WriteHeader(statusCode)
+	encoder := json.NewEncoder(w)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(data); err != nil {
 		log.Printf("Failed to encode response: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
+// prettyRequested reports whether a request asks for indented JSON with
+// ?pretty or ?pretty=true
+func prettyRequested(r *http.Request) bool {
+	values, ok := r.URL.Query()["pretty"]
+	if !ok {
+		return false
+	}
+	if values[0] == "" {
+		return true
+	}
+	pretty, _ := strconv.ParseBool(values[0])
+	return pretty
+}
+
 // errorResponse writes an error response in JSON
 func (s *Server) errorResponse(w http.ResponseWriter, errorType, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
@@ -392,6 +1260,27 @@ func (s *Server) indexExists(indexName string) bool {
 	return false
 }
 
+// maxResultWindow returns the configured limit on from + size, falling back to the default
+func (s *Server) maxResultWindow() int {
+	if s.config == nil || s.config.Search.MaxResultWindow <= 0 {
+		return defaultMaxResultWindow
+	}
+	return s.config.Search.MaxResultWindow
+}
+
+// searchSizeLimits returns the default and maximum search size of an index,
+// set by its default_size and max_size
+func (s *Server) searchSizeLimits(indexName string) (int, int) {
+	if s.config != nil {
+		for _, indexCfg := range s.config.Indexes {
+			if indexCfg.Name == indexName {
+				return indexCfg.SearchSizeLimits()
+			}
+		}
+	}
+	return config.IndexConfig{}.SearchSizeLimits()
+}
+
 // isIndexSharded checks if an index has multiple shards configured
 func (s *Server) isIndexSharded(indexName string) bool {
 	if s.config == nil {
@@ -410,7 +1299,7 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -431,58 +1320,80 @@ func (s *Server) methodNotAllowedMiddleware(next http.Handler) http.Handler {
 
 // isAuthenticationEnabled checks if authentication is configured
 func (s *Server) isAuthenticationEnabled() bool {
+	return s.isBasicAuthEnabled() || s.isAPIKeyAuthEnabled()
+}
+
+// isBasicAuthEnabled checks if basic auth credentials are configured
+func (s *Server) isBasicAuthEnabled() bool {
 	if s.config == nil {
 		return false
 	}
 	return strings.TrimSpace(s.config.Server.Username) != "" && strings.TrimSpace(s.config.Server.Password) != ""
 }
 
-// basicAuthMiddleware provides HTTP Basic Authentication
-func (s *Server) basicAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the Authorization header
-		auth := r.Header.Get("Authorization")
-		if auth == "" {
-			s.authenticationFailed(w)
-			return
-		}
+// isAPIKeyAuthEnabled checks if any API keys are configured
+func (s *Server) isAPIKeyAuthEnabled() bool {
+	return s.config != nil && len(s.config.Server.APIKeys) > 0
+}
 
-		// Check if it starts with "Basic "
-		if !strings.HasPrefix(auth, "Basic ") {
-			s.authenticationFailed(w)
+// authMiddleware authenticates requests with either an X-API-Key header or
+// HTTP Basic Authentication and checks that the credentials grant access to
+// the index in the URL, if any
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.authenticate(w, r)
+		if !ok {
 			return
 		}
 
-		// Decode the base64 encoded credentials
-		credentials, err := base64.StdEncoding.DecodeString(auth[6:])
-		if err != nil {
-			log.Printf("Failed to decode basic auth credentials: %v", err)
-			s.authenticationFailed(w)
+		index := strings.TrimSpace(chi.URLParam(r, "index"))
+		if !s.authorized(p, index) {
+			if p == nil {
+				s.authenticationFailed(w)
+			} else {
+				s.accessDenied(w, index)
+			}
 			return
 		}
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+	})
+}
 
-		// Split username:password
-		credsParts := strings.SplitN(string(credentials), ":", 2)
-		if len(credsParts) != 2 {
-			s.authenticationFailed(w)
-			return
-		}
+// validAPIKey reports whether key matches one of the configured API keys.
+// Every configured key is compared so the timing doesn't reveal which one matched.
+func (s *Server) validAPIKey(key string) bool {
+	return validKey(key, s.config.Server.APIKeys)
+}
 
-		username, password := credsParts[0], credsParts[1]
+// secureCompare returns 1 if a and b are equal and 0 otherwise. Both values are
+// hashed first so the comparison time doesn't leak the length of the secret.
+func secureCompare(a, b string) int {
+	hashA := sha256.Sum256([]byte(a))
+	hashB := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(hashA[:], hashB[:])
+}
 
-		// Use constant-time comparison to prevent timing attacks
-		usernameMatch := subtle.ConstantTimeCompare([]byte(username), []byte(s.config.Server.Username)) == 1
-		passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(s.config.Server.Password)) == 1
+// basicAuthCredentials returns the username and password of a request's HTTP
+// Basic Authentication header
+func basicAuthCredentials(r *http.Request) (string, string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Basic ") {
+		return "", "", false
+	}
 
-		if !usernameMatch || !passwordMatch {
-			log.Printf("Authentication failed for user: %s", username)
-			s.authenticationFailed(w)
-			return
-		}
+	// Decode the base64 encoded credentials
+	credentials, err := base64.StdEncoding.DecodeString(auth[6:])
+	if err != nil {
+		log.Printf("Failed to decode basic auth credentials: %v", err)
+		return "", "", false
+	}
 
-		// Authentication successful, proceed to the next handler
-		next.ServeHTTP(w, r)
-	})
+	// Split username:password
+	credsParts := strings.SplitN(string(credentials), ":", 2)
+	if len(credsParts) != 2 {
+		return "", "", false
+	}
+	return credsParts[0], credsParts[1], true
 }
 
 // authenticationFailed sends an authentication failed response
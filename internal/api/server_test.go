@@ -2,21 +2,32 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/davidschrooten/open-atlas-search/config"
+	"github.com/davidschrooten/open-atlas-search/internal/cluster"
 	"github.com/davidschrooten/open-atlas-search/internal/indexer"
 	"github.com/davidschrooten/open-atlas-search/internal/search"
 )
 
 // mockSearchEngine implements a basic mock for testing
 type mockSearchEngine struct {
-	indexes   []search.IndexInfo
-	searchErr error
+	indexes     []search.IndexInfo
+	searchErr   error
+	searchDelay time.Duration
+	lastRequest search.SearchRequest
+	optimizeErr error
 }
 
 func (m *mockSearchEngine) ListIndexes() ([]search.IndexInfo, error) {
@@ -24,6 +35,8 @@ func (m *mockSearchEngine) ListIndexes() ([]search.IndexInfo, error) {
 }
 
 func (m *mockSearchEngine) Search(req search.SearchRequest) (*search.SearchResult, error) {
+	m.lastRequest = req
+	time.Sleep(m.searchDelay)
 	if m.searchErr != nil {
 		return nil, m.searchErr
 	}
@@ -42,6 +55,18 @@ func (m *mockSearchEngine) Search(req search.SearchRequest) (*search.SearchResul
 	}, nil
 }
 
+func (m *mockSearchEngine) DescribeQuery(indexName string, atlasQuery map[string]interface{}) (*search.QueryDescription, error) {
+	return &search.QueryDescription{Type: "mock"}, nil
+}
+
+func (m *mockSearchEngine) ValidateQuery(indexName string, atlasQuery map[string]interface{}) error {
+	return nil
+}
+
+func (m *mockSearchEngine) AnalyzeText(indexName, analyzerName, text string) ([]search.AnalyzedToken, error) {
+	return nil, nil
+}
+
 func (m *mockSearchEngine) IndexDocument(indexName, docID string, doc map[string]interface{}) error {
 	return nil
 }
@@ -58,6 +83,10 @@ func (m *mockSearchEngine) RemoveIndex(indexName string) error {
 	return nil
 }
 
+func (m *mockSearchEngine) RenameIndex(oldName, newName string) error {
+	return nil
+}
+
 func (m *mockSearchEngine) CleanupIndexes(cfg *config.Config) {}
 
 func (m *mockSearchEngine) UpdateLastSync(indexName string, syncTime time.Time) {}
@@ -74,10 +103,42 @@ func (m *mockSearchEngine) GetIndexMapping(indexName string) (map[string]interfa
 	}, nil
 }
 
+func (m *mockSearchEngine) GetIndexStats(indexName string) (*search.IndexStats, error) {
+	return &search.IndexStats{Name: indexName}, nil
+}
+
+func (m *mockSearchEngine) OptimizeIndex(indexName string) (*search.OptimizeResult, error) {
+	if m.optimizeErr != nil {
+		return nil, m.optimizeErr
+	}
+	return &search.OptimizeResult{Name: indexName, Optimized: true}, nil
+}
+
+func (m *mockSearchEngine) CountBy(indexName, field string, atlasQuery map[string]interface{}) (map[string]int, error) {
+	return map[string]int{"electronics": 10, "books": 3}, nil
+}
+
+func (m *mockSearchEngine) Terms(indexName, field, prefix string, size int) ([]search.TermCount, error) {
+	return nil, nil
+}
+
+func (m *mockSearchEngine) ExportDocuments(indexName string, fn func(search.ExportedDocument) error) error {
+	return nil
+}
+
 func (m *mockSearchEngine) IndexDocuments(indexName string, docs []search.DocumentBatch) error {
 	return nil
 }
 
+// mockMongoClient implements MongoPinger for testing
+type mockMongoClient struct {
+	pingErr error
+}
+
+func (m *mockMongoClient) Ping(ctx context.Context) error {
+	return m.pingErr
+}
+
 func TestServer_handleHealth(t *testing.T) {
 	server := &Server{}
 
@@ -204,6 +265,63 @@ func TestServer_handleReady_NotReady(t *testing.T) {
 	}
 }
 
+func TestServer_handleReady_MongoDB(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{{Name: "test.collection.index", Status: "active"}},
+	}
+
+	tests := []struct {
+		name         string
+		pingErr      error
+		expectedCode int
+		expectedMsg  string
+	}{
+		{"reachable", nil, http.StatusOK, "ok"},
+		{"unreachable", errors.New("connection refused"), http.StatusServiceUnavailable, "connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(mockEngine, &indexer.Service{}, &mockMongoClient{pingErr: tt.pingErr}, &config.Config{}, nil)
+
+			req := httptest.NewRequest("GET", "/ready", nil)
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, w.Code)
+			}
+
+			var response map[string]interface{}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			checks, ok := response["checks"].(map[string]interface{})
+			if !ok {
+				t.Fatal("Expected checks to be present")
+			}
+			if checks["mongodb"] != tt.expectedMsg {
+				t.Errorf("Expected mongodb check '%s', got '%v'", tt.expectedMsg, checks["mongodb"])
+			}
+		})
+	}
+}
+
+func TestServer_handleHealth_IgnoresMongoDB(t *testing.T) {
+	server := NewServer(&mockSearchEngine{}, &indexer.Service{}, &mockMongoClient{pingErr: errors.New("connection refused")}, &config.Config{}, nil)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected health check to stay %d when MongoDB is down, got %d", http.StatusOK, w.Code)
+	}
+}
+
 func TestServer_handleListIndexes(t *testing.T) {
 	mockEngine := &mockSearchEngine{
 		indexes: []search.IndexInfo{
@@ -404,6 +522,100 @@ func TestServer_handleStatus_WithIndex(t *testing.T) {
 	}
 }
 
+func TestServer_handleListIndexes_Sharded(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{
+			{Name: "products_shard_0", DocCount: 3, Shards: 1, Replicas: 1, ShardOf: "products", Status: "active"},
+			{Name: "products_shard_1", DocCount: 4, Shards: 1, Replicas: 1, ShardOf: "products", Status: "active"},
+			{Name: "products", DocCount: 7, Shards: 2, Replicas: 1, Status: "active"},
+		},
+	}
+
+	server := &Server{
+		searchEngine: mockEngine,
+	}
+	router := server.Router()
+
+	listIndexes := func(url string) []interface{} {
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var response map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		indexes, ok := response["indexes"].([]interface{})
+		if !ok {
+			t.Fatal("Expected indexes to be an array")
+		}
+		return indexes
+	}
+
+	indexes := listIndexes("/indexes")
+	if len(indexes) != 1 {
+		t.Fatalf("Expected 1 logical index, got %d: %v", len(indexes), indexes)
+	}
+	index := indexes[0].(map[string]interface{})
+	if index["name"] != "products" {
+		t.Errorf("Expected index name 'products', got %v", index["name"])
+	}
+	if index["docCount"] != float64(7) {
+		t.Errorf("Expected combined docCount 7, got %v", index["docCount"])
+	}
+
+	if indexes := listIndexes("/indexes?expand_shards=true"); len(indexes) != 3 {
+		t.Errorf("Expected the logical index and 2 shards, got %d: %v", len(indexes), indexes)
+	}
+}
+
+func TestServer_handleStatus_Sharded(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{
+			{Name: "products_shard_0", DocCount: 3, Shards: 1, Replicas: 2, Status: "active"},
+			{Name: "products_shard_1", DocCount: 4, Shards: 1, Replicas: 2, Status: "active"},
+			{Name: "products", DocCount: 7, Shards: 2, Replicas: 2, Status: "active"},
+		},
+	}
+
+	server := &Server{
+		searchEngine: mockEngine,
+	}
+	router := server.Router()
+
+	req := httptest.NewRequest("GET", "/indexes/products/status", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	index, ok := response["index"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected index to be present")
+	}
+	if index["docCount"] != float64(7) {
+		t.Errorf("Expected docCount 7, got %v", index["docCount"])
+	}
+	if index["shards"] != float64(2) {
+		t.Errorf("Expected 2 shards, got %v", index["shards"])
+	}
+	if index["replicas"] != float64(2) {
+		t.Errorf("Expected 2 replicas, got %v", index["replicas"])
+	}
+}
+
 func TestServer_Authentication_Disabled(t *testing.T) {
 	mockEngine := &mockSearchEngine{
 		indexes: []search.IndexInfo{
@@ -555,6 +767,245 @@ func TestServer_Authentication_Enabled_InvalidAuth(t *testing.T) {
 	}
 }
 
+func TestServer_Authentication_BasicAuthCredentials(t *testing.T) {
+	server := &Server{
+		searchEngine: &mockSearchEngine{},
+		config: &config.Config{
+			Server: config.ServerConfig{
+				Username: "admin",
+				Password: "secret",
+			},
+		},
+	}
+	router := server.Router()
+
+	tests := []struct {
+		name         string
+		username     string
+		password     string
+		expectedCode int
+	}{
+		{"valid credentials", "admin", "secret", http.StatusOK},
+		{"wrong username", "root", "secret", http.StatusUnauthorized},
+		{"wrong password", "admin", "wrong", http.StatusUnauthorized},
+		{"both wrong", "root", "wrong", http.StatusUnauthorized},
+		{"username prefix", "adm", "secret", http.StatusUnauthorized},
+		{"password with suffix", "admin", "secret123", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/indexes", nil)
+			req.SetBasicAuth(tt.username, tt.password)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestServer_Authentication_APIKey(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{{Name: "test.index", DocCount: 1, Status: "active"}},
+	}
+
+	server := &Server{
+		searchEngine: mockEngine,
+		config: &config.Config{
+			Server: config.ServerConfig{
+				Username: "admin",
+				Password: "secret",
+				APIKeys:  []string{"key-one", "key-two"},
+			},
+		},
+	}
+	router := server.Router()
+
+	tests := []struct {
+		name         string
+		apiKey       string
+		username     string
+		password     string
+		expectedCode int
+	}{
+		{"valid key", "key-two", "", "", http.StatusOK},
+		{"invalid key", "wrong-key", "", "", http.StatusUnauthorized},
+		{"invalid key with valid basic auth", "wrong-key", "admin", "secret", http.StatusUnauthorized},
+		{"basic auth fallback", "", "admin", "secret", http.StatusOK},
+		{"invalid basic auth", "", "admin", "wrong", http.StatusUnauthorized},
+		{"no credentials", "", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/indexes", nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestServer_Authentication_APIKeyOnly(t *testing.T) {
+	server := &Server{
+		searchEngine: &mockSearchEngine{},
+		config: &config.Config{
+			Server: config.ServerConfig{APIKeys: []string{"key-one"}},
+		},
+	}
+	router := server.Router()
+
+	// Empty basic auth credentials must not match the unset username/password
+	req := httptest.NewRequest("GET", "/indexes", nil)
+	req.SetBasicAuth("", "")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d for basic auth without configured credentials, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/indexes", nil)
+	req.Header.Set("X-API-Key", "key-one")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d with valid API key, got %d", http.StatusOK, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/health", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected /health to be exempt from API key auth, got %d", w.Code)
+	}
+}
+
+func TestServer_Authentication_IndexAuth(t *testing.T) {
+	indexes := []config.IndexConfig{
+		{Name: "tenant_a", Auth: config.IndexAuth{APIKeys: []string{"key-a"}, Users: []config.IndexUser{{Username: "alice", Password: "a-secret"}}}},
+		{Name: "tenant_b", Auth: config.IndexAuth{APIKeys: []string{"key-b"}}},
+		{Name: "public"},
+	}
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{{Name: "tenant_a"}, {Name: "tenant_b"}, {Name: "public"}},
+	}
+
+	type credentials struct {
+		apiKey, username, password string
+	}
+	request := func(router http.Handler, method, path, body string, creds credentials) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if creds.apiKey != "" {
+			req.Header.Set("X-API-Key", creds.apiKey)
+		}
+		if creds.username != "" {
+			req.SetBasicAuth(creds.username, creds.password)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("with global credentials", func(t *testing.T) {
+		server := &Server{
+			searchEngine: mockEngine,
+			config: &config.Config{
+				Server:  config.ServerConfig{Username: "admin", Password: "secret", APIKeys: []string{"admin-key"}},
+				Indexes: indexes,
+			},
+		}
+		router := server.Router()
+
+		tests := []struct {
+			name         string
+			path         string
+			creds        credentials
+			expectedCode int
+		}{
+			{"tenant key on own index", "/indexes/tenant_a/mapping", credentials{apiKey: "key-a"}, http.StatusOK},
+			{"tenant user on own index", "/indexes/tenant_a/mapping", credentials{username: "alice", password: "a-secret"}, http.StatusOK},
+			{"tenant key on other tenant", "/indexes/tenant_b/mapping", credentials{apiKey: "key-a"}, http.StatusForbidden},
+			{"tenant user on other tenant", "/indexes/tenant_b/mapping", credentials{username: "alice", password: "a-secret"}, http.StatusForbidden},
+			{"tenant key on index without auth", "/indexes/public/mapping", credentials{apiKey: "key-a"}, http.StatusForbidden},
+			{"tenant key on index list", "/indexes", credentials{apiKey: "key-a"}, http.StatusForbidden},
+			{"admin key on tenant index", "/indexes/tenant_b/mapping", credentials{apiKey: "admin-key"}, http.StatusOK},
+			{"admin user on tenant index", "/indexes/tenant_a/mapping", credentials{username: "admin", password: "secret"}, http.StatusOK},
+			{"wrong tenant password", "/indexes/tenant_a/mapping", credentials{username: "alice", password: "wrong"}, http.StatusUnauthorized},
+			{"unknown key", "/indexes/tenant_a/mapping", credentials{apiKey: "key-c"}, http.StatusUnauthorized},
+			{"no credentials", "/indexes/tenant_a/mapping", credentials{}, http.StatusUnauthorized},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := request(router, "GET", tt.path, "", tt.creds)
+				if w.Code != tt.expectedCode {
+					t.Errorf("Expected status code %d, got %d: %s", tt.expectedCode, w.Code, w.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("without global credentials", func(t *testing.T) {
+		server := &Server{searchEngine: mockEngine, config: &config.Config{Indexes: indexes}}
+		router := server.Router()
+
+		if w := request(router, "GET", "/indexes/public/mapping", "", credentials{}); w.Code != http.StatusOK {
+			t.Errorf("Expected an index without auth to stay public, got %d", w.Code)
+		}
+		if w := request(router, "GET", "/indexes/tenant_a/mapping", "", credentials{}); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a tenant index to require credentials, got %d", w.Code)
+		}
+		if w := request(router, "GET", "/indexes/tenant_b/mapping", "", credentials{apiKey: "key-a"}); w.Code != http.StatusForbidden {
+			t.Errorf("Expected another tenant's key to be denied, got %d", w.Code)
+		}
+		if w := request(router, "GET", "/indexes/tenant_b/mapping", "", credentials{apiKey: "key-b"}); w.Code != http.StatusOK {
+			t.Errorf("Expected the tenant's own key to be accepted, got %d", w.Code)
+		}
+	})
+
+	t.Run("multi-search", func(t *testing.T) {
+		server := &Server{searchEngine: mockEngine, config: &config.Config{Indexes: indexes}}
+		router := server.Router()
+
+		body := `[{"index": "tenant_a", "query": {}}, {"index": "tenant_b", "query": {}}, {"index": "public", "query": {}}]`
+		w := request(router, "POST", "/_msearch", body, credentials{apiKey: "key-a"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var response struct {
+			Responses []map[string]interface{} `json:"responses"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(response.Responses) != 3 {
+			t.Fatalf("Expected 3 responses, got %d", len(response.Responses))
+		}
+		if _, failed := response.Responses[0]["error"]; failed {
+			t.Errorf("Expected the tenant's own index to be searched, got %v", response.Responses[0])
+		}
+		if response.Responses[1]["error"] != "access_denied" {
+			t.Errorf("Expected another tenant's index to be denied, got %v", response.Responses[1])
+		}
+		if _, failed := response.Responses[2]["error"]; failed {
+			t.Errorf("Expected an index without auth to be searched, got %v", response.Responses[2])
+		}
+	})
+}
+
 func TestServer_HealthEndpoint_AlwaysAccessible(t *testing.T) {
 	mockEngine := &mockSearchEngine{}
 
@@ -582,3 +1033,1852 @@ func TestServer_HealthEndpoint_AlwaysAccessible(t *testing.T) {
 		t.Errorf("Expected health endpoint to be accessible without auth, got status %d", w.Code)
 	}
 }
+
+func TestServer_handleStats(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Database:   "shop",
+		Collection: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if err := engine.IndexDocument("products", id, map[string]interface{}{"name": "product " + id}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+	engine.UpdateLastSync("products", time.Now())
+
+	server := &Server{
+		searchEngine:   engine,
+		indexerService: &indexer.Service{},
+		config:         &config.Config{Indexes: []config.IndexConfig{indexCfg}},
+	}
+	router := server.Router()
+
+	req := httptest.NewRequest("GET", "/indexes/products/stats", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response["name"] != "products" {
+		t.Errorf("Expected name 'products', got '%v'", response["name"])
+	}
+	if docCount, ok := response["docCount"].(float64); !ok || docCount != 3 {
+		t.Errorf("Expected docCount 3, got %v", response["docCount"])
+	}
+	if diskSize, ok := response["diskSizeBytes"].(float64); !ok || diskSize <= 0 {
+		t.Errorf("Expected positive diskSizeBytes, got %v", response["diskSizeBytes"])
+	}
+	if _, ok := response["lastSync"]; !ok {
+		t.Error("Expected lastSync to be present")
+	}
+	for _, field := range []string{"documentsIndexed", "documentsFailed"} {
+		if _, ok := response[field].(float64); !ok {
+			t.Errorf("Expected %s to be a number, got %v", field, response[field])
+		}
+	}
+	if bleveStats, ok := response["bleveStats"].(map[string]interface{}); !ok || len(bleveStats) == 0 {
+		t.Errorf("Expected non-empty bleveStats, got %v", response["bleveStats"])
+	}
+}
+
+func TestServer_handleStats_IndexNotFound(t *testing.T) {
+	server := &Server{
+		searchEngine: &mockSearchEngine{},
+		config:       &config.Config{},
+	}
+	router := server.Router()
+
+	req := httptest.NewRequest("GET", "/indexes/missing/stats", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServer_handleSearch_MaxResultWindow(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{
+			{
+				Name:     "test.index",
+				DocCount: 1,
+				Status:   "active",
+			},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		maxWindow      int
+		from           int
+		size           int
+		expectedStatus int
+	}{
+		{"at configured boundary", 100, 90, 10, http.StatusOK},
+		{"just beyond configured boundary", 100, 91, 10, http.StatusBadRequest},
+		{"at default boundary", 0, 9990, 10, http.StatusOK},
+		{"just beyond default boundary", 0, 9991, 10, http.StatusBadRequest},
+		{"default size counts towards window", 0, 9991, 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &Server{
+				searchEngine: mockEngine,
+				config: &config.Config{
+					Search: config.SearchConfig{MaxResultWindow: tt.maxWindow},
+				},
+			}
+			router := server.Router()
+
+			reqBody, _ := json.Marshal(map[string]interface{}{"from": tt.from, "size": tt.size})
+			req := httptest.NewRequest("POST", "/indexes/test.index/search", bytes.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusBadRequest {
+				var errResp ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+					t.Fatalf("Failed to decode error response: %v", err)
+				}
+				if errResp.Error != "result_window_too_large" {
+					t.Errorf("Expected error 'result_window_too_large', got '%s'", errResp.Error)
+				}
+				if !strings.Contains(errResp.Message, "scroll") {
+					t.Errorf("Expected message to suggest the scroll API, got '%s'", errResp.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_handleSearch_SizeLimits(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{
+			{Name: "suggest", DocCount: 1, Status: "active"},
+			{Name: "capped", DocCount: 1, Status: "active"},
+			{Name: "products", DocCount: 1, Status: "active"},
+		},
+	}
+	server := &Server{
+		searchEngine: mockEngine,
+		config: &config.Config{
+			Indexes: []config.IndexConfig{
+				{Name: "suggest", DefaultSize: 5, MaxSize: 20},
+				{Name: "capped", MaxSize: 3},
+				{Name: "products"},
+			},
+		},
+	}
+	router := server.Router()
+
+	tests := []struct {
+		name           string
+		index          string
+		size           int
+		expectedStatus int
+		expectedSize   int
+		expectedMax    string
+	}{
+		{"index default size", "suggest", 0, http.StatusOK, 5, ""},
+		{"within index max size", "suggest", 20, http.StatusOK, 20, ""},
+		{"beyond index max size", "suggest", 21, http.StatusBadRequest, 0, "20"},
+		{"default capped at index max size", "capped", 0, http.StatusOK, 3, ""},
+		{"global default size", "products", 0, http.StatusOK, 10, ""},
+		{"beyond global max size", "products", 1001, http.StatusBadRequest, 0, "1000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqBody, _ := json.Marshal(map[string]interface{}{"size": tt.size})
+			req := httptest.NewRequest("POST", "/indexes/"+tt.index+"/search", bytes.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				if mockEngine.lastRequest.Size != tt.expectedSize {
+					t.Errorf("Expected size %d, got %d", tt.expectedSize, mockEngine.lastRequest.Size)
+				}
+				return
+			}
+
+			var errResp ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if errResp.Error != "invalid_parameter" || !strings.Contains(errResp.Message, "cannot exceed "+tt.expectedMax) {
+				t.Errorf("Expected size to be capped at %s, got %+v", tt.expectedMax, errResp)
+			}
+		})
+	}
+}
+
+func TestServer_handleAnalyzeQuery(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	server := &Server{searchEngine: engine}
+	router := server.Router()
+
+	body := `{"query": {"text": {"query": "Gaming Laptop", "path": "title"}}}`
+	req := httptest.NewRequest("POST", "/indexes/products/_analyze_query", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Index string                  `json:"index"`
+		Query search.QueryDescription `json:"query"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Query.Type != "match" || response.Query.Field != "title" {
+		t.Errorf("Expected match query on title, got %+v", response.Query)
+	}
+	if len(response.Query.Terms) != 2 || response.Query.Terms[0] != "gaming" || response.Query.Terms[1] != "laptop" {
+		t.Errorf("Expected analyzed terms [gaming laptop], got %v", response.Query.Terms)
+	}
+}
+
+func TestServer_handleAnalyzeQuery_InvalidQuery(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if err := engine.CreateIndex(config.IndexConfig{Name: "products"}); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	server := &Server{searchEngine: engine}
+	router := server.Router()
+
+	body := `{"query": {"compound": {"should": [], "minimumShouldMatch": "abc"}}}`
+	req := httptest.NewRequest("POST", "/indexes/products/_analyze_query", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestServer_handleValidate(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if err := engine.CreateIndex(config.IndexConfig{Name: "products"}); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	server := &Server{searchEngine: engine}
+	router := server.Router()
+
+	tests := []struct {
+		name      string
+		index     string
+		body      string
+		wantCode  int
+		wantValid bool
+		wantError string
+	}{
+		{name: "valid query", index: "products", body: `{"query": {"text": {"query": "laptop", "path": "title"}}}`, wantCode: http.StatusOK, wantValid: true},
+		{name: "invalid query", index: "products", body: `{"query": {"compound": {"should": [], "minimumShouldMatch": "abc"}}}`, wantCode: http.StatusOK, wantError: "minimumShouldMatch"},
+		{name: "unknown index", index: "missing", body: `{"query": {}}`, wantCode: http.StatusNotFound},
+		{name: "invalid JSON", index: "products", body: `{"query": `, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/indexes/"+tt.index+"/_validate", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Valid bool   `json:"valid"`
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Valid != tt.wantValid {
+				t.Errorf("Expected valid %t, got %t (%s)", tt.wantValid, response.Valid, response.Error)
+			}
+			if !strings.Contains(response.Error, tt.wantError) || (tt.wantError == "") != (response.Error == "") {
+				t.Errorf("Expected error containing %q, got %q", tt.wantError, response.Error)
+			}
+		})
+	}
+}
+
+func TestServer_handleAnalyze(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if err := engine.CreateIndex(config.IndexConfig{Name: "products"}); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	server := &Server{searchEngine: engine}
+	router := server.Router()
+
+	analyze := func(body string) (int, []search.AnalyzedToken) {
+		req := httptest.NewRequest("POST", "/indexes/products/_analyze", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Tokens []search.AnalyzedToken `json:"tokens"`
+		}
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return w.Code, response.Tokens
+	}
+
+	code, tokens := analyze(`{"analyzer": "standard", "text": "The Quick Brown Fox"}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+	}
+	// The standard analyzer lowercases and drops the stop word "the"
+	expected := []search.AnalyzedToken{
+		{Token: "quick", Position: 2, StartOffset: 4, EndOffset: 9},
+		{Token: "brown", Position: 3, StartOffset: 10, EndOffset: 15},
+		{Token: "fox", Position: 4, StartOffset: 16, EndOffset: 19},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d standard tokens, got %v", len(expected), tokens)
+	}
+	for i, want := range expected {
+		if tokens[i] != want {
+			t.Errorf("Expected token %d to be %+v, got %+v", i, want, tokens[i])
+		}
+	}
+
+	code, tokens = analyze(`{"analyzer": "keyword", "text": "The Quick Brown Fox"}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+	}
+	if len(tokens) != 1 || tokens[0].Token != "The Quick Brown Fox" || tokens[0].EndOffset != 19 {
+		t.Errorf("Expected keyword analyzer to emit the whole input as one token, got %v", tokens)
+	}
+
+	if code, _ := analyze(`{"analyzer": "does_not_exist", "text": "fox"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for unknown analyzer, got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestServer_handleSearch_Source(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{{Name: "test.index", Status: "active"}},
+	}
+	server := &Server{searchEngine: mockEngine}
+	router := server.Router()
+
+	body := `{"query": {}, "_source": ["title", "price"]}`
+	req := httptest.NewRequest("POST", "/indexes/test.index/search", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	fields := mockEngine.lastRequest.Fields
+	if len(fields) != 2 || fields[0] != "title" || fields[1] != "price" {
+		t.Errorf("Expected _source to be passed as fields [title price], got %v", fields)
+	}
+}
+
+func TestServer_handleMapping(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{
+				Dynamic: false,
+				Fields: []config.FieldConfig{
+					{Name: "title", Type: "text"},
+					{Name: "category", Type: "keyword", Facet: true},
+				},
+			},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	server := &Server{searchEngine: engine}
+	router := server.Router()
+
+	req := httptest.NewRequest("GET", "/indexes/products/mapping", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response struct {
+		Name            string                   `json:"name"`
+		Dynamic         bool                     `json:"dynamic"`
+		DefaultAnalyzer string                   `json:"defaultAnalyzer"`
+		Fields          []map[string]interface{} `json:"fields"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Name != "products" || response.Dynamic || response.DefaultAnalyzer != "standard" {
+		t.Errorf("Unexpected mapping header: %+v", response)
+	}
+	if len(response.Fields) != 2 {
+		t.Fatalf("Expected 2 fields, got %v", response.Fields)
+	}
+	if response.Fields[0]["name"] != "title" || response.Fields[0]["type"] != "text" || response.Fields[0]["analyzer"] != "standard" {
+		t.Errorf("Unexpected title mapping: %v", response.Fields[0])
+	}
+	if response.Fields[1]["name"] != "category" || response.Fields[1]["type"] != "keyword" || response.Fields[1]["facet"] != true {
+		t.Errorf("Unexpected category mapping: %v", response.Fields[1])
+	}
+}
+
+func TestServer_handleCountBy(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	docs := []map[string]interface{}{
+		{"category": "electronics", "name": "laptop"},
+		{"category": "electronics", "name": "phone"},
+		{"category": "electronics", "name": "laptop bag"},
+		{"category": "books", "name": "laptop repair guide"},
+		{"category": "books", "name": "novel"},
+	}
+	for i, doc := range docs {
+		if err := engine.IndexDocument("products", fmt.Sprintf("%d", i), doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	server := &Server{
+		searchEngine: engine,
+		config:       &config.Config{Indexes: []config.IndexConfig{indexCfg}},
+	}
+	router := server.Router()
+
+	tests := []struct {
+		name     string
+		body     string
+		expected map[string]float64
+	}{
+		{"all documents", `{"field": "category"}`, map[string]float64{"electronics": 3, "books": 2}},
+		{"matching documents", `{"field": "category", "query": {"text": {"query": "laptop", "path": "name"}}}`, map[string]float64{"electronics": 2, "books": 1}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/indexes/products/_count_by", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code %d, got %d: %s", tt.name, http.StatusOK, w.Code, w.Body.String())
+		}
+		var counts map[string]float64
+		if err := json.NewDecoder(w.Body).Decode(&counts); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if !reflect.DeepEqual(counts, tt.expected) {
+			t.Errorf("%s: expected counts %v, got %v", tt.name, tt.expected, counts)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/indexes/products/_count_by", strings.NewReader(`{"query": {}}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without a field, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestServer_handleTerms(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+			{Name: "category", Type: "keyword"},
+		}}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for i, category := range []string{"electronics", "electronics", "books", "beauty", "electronics"} {
+		if err := engine.IndexDocument("products", fmt.Sprintf("%d", i), map[string]interface{}{"category": category}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	server := &Server{
+		searchEngine: engine,
+		config:       &config.Config{Indexes: []config.IndexConfig{indexCfg}},
+	}
+	router := server.Router()
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []search.TermCount
+	}{
+		{"all terms", "field=category", []search.TermCount{{Term: "beauty", Count: 1}, {Term: "books", Count: 1}, {Term: "electronics", Count: 3}}},
+		{"prefix", "field=category&prefix=b", []search.TermCount{{Term: "beauty", Count: 1}, {Term: "books", Count: 1}}},
+		{"size", "field=category&size=1", []search.TermCount{{Term: "beauty", Count: 1}}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/indexes/products/terms?"+tt.query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code %d, got %d: %s", tt.name, http.StatusOK, w.Code, w.Body.String())
+		}
+		var response struct {
+			Field string             `json:"field"`
+			Terms []search.TermCount `json:"terms"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Field != "category" || !reflect.DeepEqual(response.Terms, tt.expected) {
+			t.Errorf("%s: expected terms %v of category, got %v of %s", tt.name, tt.expected, response.Terms, response.Field)
+		}
+	}
+
+	for _, query := range []string{"", "field=category&size=0", "field=category&size=1001", "field=category&size=ten"} {
+		req := httptest.NewRequest("GET", "/indexes/products/terms?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %q, got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+}
+
+func TestServer_handleExport(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	docs := map[string]string{"1": "laptop", "2": "phone", "3": "headphones"}
+	for id, name := range docs {
+		if err := engine.IndexDocument("products", id, map[string]interface{}{"name": name}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	server := &Server{
+		searchEngine: engine,
+		config:       &config.Config{Indexes: []config.IndexConfig{indexCfg}},
+	}
+	router := server.Router()
+
+	req := httptest.NewRequest("GET", "/indexes/products/_export", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("Expected content type application/x-ndjson, got %s", contentType)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if len(lines) != len(docs) {
+		t.Fatalf("Expected %d lines, got %d: %q", len(docs), len(lines), w.Body.String())
+	}
+	for _, line := range lines {
+		var doc search.ExportedDocument
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			t.Fatalf("Expected each line to be a JSON document, got %q: %v", line, err)
+		}
+		if doc.Source["name"] != docs[doc.ID] {
+			t.Errorf("Expected document %s named %q, got %v", doc.ID, docs[doc.ID], doc.Source)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/indexes/missing/_export", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for unknown index, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServer_handleImport(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	server := &Server{
+		searchEngine: engine,
+		config:       &config.Config{Indexes: []config.IndexConfig{indexCfg}},
+	}
+	router := server.Router()
+
+	body := strings.Join([]string{
+		`{"_id": "1", "source": {"name": "laptop"}}`,
+		`{"_id": "2", "source": {"name": "phone"}`,
+		``,
+		`{"_id": "3", "source": {"name": "headphones"}}`,
+		`{"source": {"name": "tablet"}}`,
+		`{"_id": "4", "source": {"name": "monitor"}}`,
+	}, "\n")
+	req := httptest.NewRequest("POST", "/indexes/products/_import", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var summary importSummary
+	if err := json.NewDecoder(w.Body).Decode(&summary); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if summary.Indexed != 3 || summary.Failed != 2 {
+		t.Errorf("Expected 3 indexed and 2 failed documents, got %+v", summary)
+	}
+	if len(summary.Errors) != 2 || summary.Errors[0].Line != 2 || summary.Errors[1].Line != 5 {
+		t.Errorf("Expected errors on lines 2 and 5, got %+v", summary.Errors)
+	}
+
+	result, err := engine.Search(search.SearchRequest{Index: "products", Query: map[string]interface{}{"text": map[string]interface{}{"query": "headphones", "path": "name"}}, Size: 10})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 1 || result.Hits[0].ID != "3" {
+		t.Errorf("Expected imported document 3 to be searchable, got %+v", result.Hits)
+	}
+
+	// An export imports back unchanged
+	exportReq := httptest.NewRequest("GET", "/indexes/products/_export", nil)
+	exported := httptest.NewRecorder()
+	router.ServeHTTP(exported, exportReq)
+
+	copyCfg := config.IndexConfig{Name: "products_copy", Definition: indexCfg.Definition}
+	if err := engine.CreateIndex(copyCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	req = httptest.NewRequest("POST", "/indexes/products_copy/_import", exported.Body)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	summary = importSummary{}
+	if err := json.NewDecoder(w.Body).Decode(&summary); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if summary.Indexed != 3 || summary.Failed != 0 {
+		t.Errorf("Expected the export of 3 documents to import cleanly, got %+v", summary)
+	}
+}
+
+func TestServer_handleImport_ShardedWithLongLine(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:         "products",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		Distribution: config.IndexDistribution{Shards: 3},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	server := &Server{
+		searchEngine: engine,
+		config:       &config.Config{Indexes: []config.IndexConfig{indexCfg}},
+	}
+
+	lines := []string{`{"_id": "big", "source": {"name": "` + strings.Repeat("a", maxImportLineBytes) + `"}}`}
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf(`{"_id": "%d", "source": {"name": "widget"}}`, i))
+	}
+	req := httptest.NewRequest("POST", "/indexes/products/_import", strings.NewReader(strings.Join(lines, "\n")))
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var summary importSummary
+	if err := json.NewDecoder(w.Body).Decode(&summary); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if summary.Indexed != 10 || summary.Failed != 1 || len(summary.Errors) != 1 || summary.Errors[0].Line != 1 {
+		t.Errorf("Expected the long first line to fail and 10 documents to be indexed, got %+v", summary)
+	}
+
+	result, err := engine.SearchSharded(search.SearchRequest{Index: "products", Query: map[string]interface{}{"text": map[string]interface{}{"query": "widget", "path": "name"}}, Size: 20})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 10 {
+		t.Errorf("Expected the 10 imported documents across the shards, got %d", result.Total)
+	}
+}
+
+func TestServer_handleOptimize(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := engine.IndexDocument("products", "1", map[string]interface{}{"name": "laptop"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	server := &Server{
+		searchEngine: engine,
+		config:       &config.Config{Indexes: []config.IndexConfig{indexCfg}},
+	}
+	router := server.Router()
+
+	req := httptest.NewRequest("POST", "/indexes/products/_optimize", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response["name"] != "products" || response["optimized"] != true {
+		t.Errorf("Unexpected optimize response: %v", response)
+	}
+	for _, field := range []string{"sizeBeforeBytes", "sizeAfterBytes"} {
+		if size, ok := response[field].(float64); !ok || size <= 0 {
+			t.Errorf("Expected positive %s, got %v", field, response[field])
+		}
+	}
+
+	req = httptest.NewRequest("POST", "/indexes/missing/_optimize", nil)
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServer_handleSearch_Profile(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{{Name: "test.index", Status: "active"}},
+	}
+	server := &Server{searchEngine: mockEngine}
+	router := server.Router()
+
+	body := `{"query": {}, "profile": true}`
+	req := httptest.NewRequest("POST", "/indexes/test.index/search", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if !mockEngine.lastRequest.Profile {
+		t.Error("Expected profile to be passed to the search engine")
+	}
+}
+
+func TestServer_handleSearch_MatchedFields(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{{Name: "test.index", Status: "active"}},
+	}
+	server := &Server{searchEngine: mockEngine}
+	router := server.Router()
+
+	req := httptest.NewRequest("POST", "/indexes/test.index/search", strings.NewReader(`{"query": {}, "matched_fields": true}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if !mockEngine.lastRequest.MatchedFields {
+		t.Error("Expected matched_fields to be passed to the search engine")
+	}
+}
+
+func TestServer_handleSearch_TypedSource(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{{Name: "test.index", Status: "active"}},
+	}
+	server := &Server{searchEngine: mockEngine}
+	router := server.Router()
+
+	req := httptest.NewRequest("POST", "/indexes/test.index/search", strings.NewReader(`{"query": {}, "typed_source": true}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if !mockEngine.lastRequest.TypedSource {
+		t.Error("Expected typed_source to be passed to the search engine")
+	}
+}
+
+func TestServer_handleSearch_ResponseFormat(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes:     []search.IndexInfo{{Name: "test.index", Status: "active"}},
+		searchDelay: 20 * time.Millisecond,
+	}
+	server := &Server{searchEngine: mockEngine, config: &config.Config{}}
+	router := server.Router()
+
+	doSearch := func(body string) map[string]interface{} {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/indexes/test.index/search", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var response map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	// The flat format is the search result itself
+	for _, body := range []string{`{"query": {}}`, `{"query": {}, "response_format": "flat"}`} {
+		response := doSearch(body)
+		if _, ok := response["hits"].([]interface{}); !ok || response["total"] != 1.0 {
+			t.Errorf("Expected a flat result for %s, got %v", body, response)
+		}
+		if _, ok := response["took"]; ok {
+			t.Errorf("Expected no took in a flat result, got %v", response)
+		}
+	}
+
+	// The envelope nests the hits and adds took and timedOut
+	response := doSearch(`{"query": {}, "response_format": "envelope"}`)
+	if took, ok := response["took"].(float64); !ok || took < 20 {
+		t.Errorf("Expected took to cover the 20ms search, got %v", response["took"])
+	}
+	if response["timedOut"] != false {
+		t.Errorf("Expected timedOut false, got %v", response["timedOut"])
+	}
+	hits, ok := response["hits"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected hits to be an object, got %v", response["hits"])
+	}
+	if hits["total"] != 1.0 || hits["maxScore"] != 1.0 || len(hits["hits"].([]interface{})) != 1 {
+		t.Errorf("Expected the hits, total and maxScore under hits, got %v", hits)
+	}
+	if _, ok := response["total"]; ok {
+		t.Errorf("Expected total only under hits, got %v", response)
+	}
+
+	// server.response_format sets the default, which requests can override
+	server.config.Server.ResponseFormat = "envelope"
+	if response := doSearch(`{"query": {}}`); response["took"] == nil {
+		t.Errorf("Expected the configured envelope format, got %v", response)
+	}
+	if response := doSearch(`{"query": {}, "response_format": "flat"}`); response["took"] != nil {
+		t.Errorf("Expected the request to override the configured format, got %v", response)
+	}
+
+	req := httptest.NewRequest("POST", "/indexes/test.index/search", strings.NewReader(`{"query": {}, "response_format": "xml"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown response format, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestServer_handleSearch_MinScore(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{{Name: "test.index", Status: "active"}},
+	}
+	server := &Server{searchEngine: mockEngine}
+	router := server.Router()
+
+	req := httptest.NewRequest("POST", "/indexes/test.index/search", strings.NewReader(`{"query": {}, "min_score": 0.5}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if mockEngine.lastRequest.MinScore != 0.5 {
+		t.Errorf("Expected min_score 0.5 to be passed to the search engine, got %v", mockEngine.lastRequest.MinScore)
+	}
+
+	req = httptest.NewRequest("POST", "/indexes/test.index/search", strings.NewReader(`{"query": {}, "min_score": -1}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a negative min_score, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestServer_handleOptimize_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantError  string
+	}{
+		{"in progress", fmt.Errorf("index products: %w", search.ErrOptimizeInProgress), http.StatusConflict, "optimize_in_progress"},
+		// Only the sentinel means a conflict, not a message mentioning one
+		{"internal", errors.New("force merge already in progress"), http.StatusInternalServerError, "optimize_failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &Server{searchEngine: &mockSearchEngine{
+				indexes:     []search.IndexInfo{{Name: "products", Status: "active"}},
+				optimizeErr: tt.err,
+			}}
+
+			w := httptest.NewRecorder()
+			server.Router().ServeHTTP(w, httptest.NewRequest("POST", "/indexes/products/_optimize", nil))
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("Expected %d %s, got %d: %s", tt.wantStatus, tt.wantError, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_handleRepoll_Validation(t *testing.T) {
+	server := &Server{
+		searchEngine: &mockSearchEngine{
+			indexes: []search.IndexInfo{{Name: "products", Status: "active"}},
+		},
+	}
+	router := server.Router()
+
+	tests := []struct {
+		name     string
+		url      string
+		expected int
+	}{
+		{"missing since", "/indexes/products/_repoll", http.StatusBadRequest},
+		{"invalid since", "/indexes/products/_repoll?since=yesterday", http.StatusBadRequest},
+		{"future since", "/indexes/products/_repoll?since=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339), http.StatusBadRequest},
+		{"unknown index", "/indexes/missing/_repoll?since=2024-01-01T00:00:00Z", http.StatusNotFound},
+		{"no indexer", "/indexes/products/_repoll?since=2024-01-01T00:00:00Z", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.url, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status code %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_handleSearch_EngineErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantError  string
+	}{
+		{"index not found", fmt.Errorf("shard lookup: %w", &search.IndexNotFoundError{Index: "test.index"}), http.StatusNotFound, "index_not_found"},
+		{"invalid query", &search.QueryError{Kind: search.ErrInvalidQuery, Msg: "bad clause", Err: errors.New("oops")}, http.StatusBadRequest, "invalid_query"},
+		{"invalid facet", &search.QueryError{Kind: search.ErrInvalidFacet, Msg: "bad clause", Err: errors.New("oops")}, http.StatusBadRequest, "invalid_facet"},
+		{"timeout", fmt.Errorf("%w: %w", search.ErrSearchTimeout, context.DeadlineExceeded), http.StatusGatewayTimeout, "search_timeout"},
+		// Messages mentioning "query" or "not found" are no longer misclassified
+		{"internal", errors.New("query cache not found"), http.StatusInternalServerError, "search_failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockEngine := &mockSearchEngine{
+				indexes:   []search.IndexInfo{{Name: "test.index", Status: "active"}},
+				searchErr: tt.err,
+			}
+			server := &Server{searchEngine: mockEngine}
+			router := server.Router()
+
+			req := httptest.NewRequest("POST", "/indexes/test.index/search", strings.NewReader(`{"query": {}}`))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, w.Code)
+			}
+			var response ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Error != tt.wantError {
+				t.Errorf("Expected error %q, got %q", tt.wantError, response.Error)
+			}
+		})
+	}
+}
+
+func TestServer_Pprof(t *testing.T) {
+	get := func(router http.Handler, path, apiKey string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	disabled := (&Server{searchEngine: &mockSearchEngine{}, config: &config.Config{}}).Router()
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/heap"} {
+		if code := get(disabled, path, ""); code != http.StatusNotFound {
+			t.Errorf("Expected %s to be absent by default, got status code %d", path, code)
+		}
+	}
+
+	enabled := (&Server{
+		searchEngine: &mockSearchEngine{},
+		config: &config.Config{
+			Server: config.ServerConfig{APIKeys: []string{"key-one"}, EnablePprof: true},
+		},
+	}).Router()
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/heap"} {
+		if code := get(enabled, path, "key-one"); code != http.StatusOK {
+			t.Errorf("Expected %s to be served when enabled, got status code %d", path, code)
+		}
+		if code := get(enabled, path, ""); code != http.StatusUnauthorized {
+			t.Errorf("Expected %s to require authentication, got status code %d", path, code)
+		}
+	}
+}
+
+func TestServer_handleRename(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, name := range []string{"products_v2", "orders"} {
+		if err := engine.CreateIndex(config.IndexConfig{Name: name}); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+	if err := engine.IndexDocument("products_v2", "doc1", map[string]interface{}{"name": "widget"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	server := &Server{searchEngine: engine}
+	router := server.Router()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		index      string
+		body       string
+		wantStatus int
+	}{
+		{"products_v2", `{}`, http.StatusBadRequest},
+		{"products_v2", `{"name": "orders"}`, http.StatusConflict},
+		{"products_v2", `{"name": "a/b"}`, http.StatusBadRequest},
+		{"missing", `{"name": "other"}`, http.StatusNotFound},
+		{"products_v2", `{"name": "products"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := post("/indexes/"+tt.index+"/_rename", tt.body); w.Code != tt.wantStatus {
+			t.Errorf("Expected status code %d renaming %s with %s, got %d", tt.wantStatus, tt.index, tt.body, w.Code)
+		}
+	}
+
+	search := `{"query": {"text": {"query": "widget", "path": "name"}}}`
+	if w := post("/indexes/products/search", search); w.Code != http.StatusOK {
+		t.Errorf("Expected search under the new name to succeed, got %d", w.Code)
+	}
+	if w := post("/indexes/products_v2/search", search); w.Code != http.StatusNotFound {
+		t.Errorf("Expected search under the old name to fail with %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServer_PrettyResponses(t *testing.T) {
+	mockEngine := &mockSearchEngine{
+		indexes: []search.IndexInfo{{Name: "test.index", Status: "active"}},
+	}
+	server := &Server{searchEngine: mockEngine}
+	router := server.Router()
+
+	tests := []struct {
+		method string
+		path   string
+		pretty bool
+	}{
+		{"POST", "/indexes/test.index/search", false},
+		{"POST", "/indexes/test.index/search?pretty=false", false},
+		{"POST", "/indexes/test.index/search?pretty=true", true},
+		{"POST", "/indexes/test.index/search?pretty", true},
+		{"GET", "/indexes", false},
+		{"GET", "/indexes?pretty=true", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"query": {}}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d for %s, got %d", http.StatusOK, tt.path, w.Code)
+		}
+		body := w.Body.String()
+		if indented := strings.Contains(body, "\n  "); indented != tt.pretty {
+			t.Errorf("Expected indented=%v for %s, got body %q", tt.pretty, tt.path, body)
+		}
+		if !json.Valid(w.Body.Bytes()) {
+			t.Errorf("Expected valid JSON for %s, got %q", tt.path, body)
+		}
+	}
+}
+
+func TestServer_handleMultiSearch(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	dynamic := config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}
+	for _, name := range []string{"products", "orders"} {
+		if err := engine.CreateIndex(config.IndexConfig{Name: name, Definition: dynamic}); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+	docs := map[string]map[string]map[string]interface{}{
+		"products": {"p1": {"name": "red widget"}, "p2": {"name": "blue widget"}, "p3": {"name": "red gadget"}},
+		"orders":   {"o1": {"status": "shipped"}, "o2": {"status": "pending"}},
+	}
+	for index, indexDocs := range docs {
+		for id, doc := range indexDocs {
+			if err := engine.IndexDocument(index, id, doc); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+	}
+
+	server := &Server{searchEngine: engine}
+	router := server.Router()
+
+	body := `[
+		{"index": "products", "query": {"text": {"query": "widget", "path": "name"}}},
+		{"index": "orders", "query": {"term": {"path": "status", "value": "shipped"}}},
+		{"index": "products", "query": {"text": {"query": "red", "path": "name"}}, "size": 1},
+		{"index": "missing", "query": {}}
+	]`
+	req := httptest.NewRequest("POST", "/_msearch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Responses []struct {
+			Total int                `json:"total"`
+			Hits  []search.SearchHit `json:"hits"`
+			Error string             `json:"error"`
+			Code  int                `json:"code"`
+		} `json:"responses"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Responses) != 4 {
+		t.Fatalf("Expected 4 responses, got %d", len(response.Responses))
+	}
+
+	expected := []struct {
+		total int
+		hits  int
+	}{{2, 2}, {1, 1}, {2, 1}}
+	for i, want := range expected {
+		got := response.Responses[i]
+		if got.Error != "" || got.Total != want.total || len(got.Hits) != want.hits {
+			t.Errorf("Expected response %d to have %d hits of %d total, got %+v", i, want.hits, want.total, got)
+		}
+	}
+	if got := response.Responses[1]; len(got.Hits) == 1 && got.Hits[0].ID != "o1" {
+		t.Errorf("Expected the orders search to find o1, got %s", got.Hits[0].ID)
+	}
+	if got := response.Responses[3]; got.Error != "index_not_found" || got.Code != http.StatusNotFound {
+		t.Errorf("Expected a failed sub-search to report its error in place, got %+v", got)
+	}
+
+	for _, body := range []string{`[]`, `{}`} {
+		req := httptest.NewRequest("POST", "/_msearch", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+}
+
+func TestServer_SlowQueryLog(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	mockEngine := &mockSearchEngine{
+		indexes:     []search.IndexInfo{{Name: "users", Status: "active"}},
+		searchDelay: 20 * time.Millisecond,
+	}
+	server := &Server{
+		searchEngine: mockEngine,
+		config: &config.Config{Server: config.ServerConfig{
+			SlowQueryThreshold:    10,
+			SlowQueryRedactFields: []string{"email"},
+		}},
+	}
+	router := server.Router()
+
+	body := `{"query": {"compound": {"must": [
+		{"text": {"path": "email", "query": "jane@example.com"}},
+		{"text": {"path": "name", "query": "jane"}}
+	]}}}`
+	req := httptest.NewRequest("POST", "/indexes/users/search", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	entry := logs.String()
+	if !strings.Contains(entry, "Slow query on index users took") {
+		t.Fatalf("Expected a slow query log entry, got %q", entry)
+	}
+	if !strings.Contains(entry, `"query":"jane"`) {
+		t.Errorf("Expected the query body in the slow query log, got %q", entry)
+	}
+	if strings.Contains(entry, "jane@example.com") || !strings.Contains(entry, `"query":"[REDACTED]"`) {
+		t.Errorf("Expected the email value to be redacted, got %q", entry)
+	}
+
+	// Searches faster than the threshold aren't logged
+	logs.Reset()
+	mockEngine.searchDelay = 0
+	server.config.Server.SlowQueryThreshold = 1000
+	req = httptest.NewRequest("POST", "/indexes/users/search", strings.NewReader(body))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if strings.Contains(logs.String(), "Slow query") {
+		t.Errorf("Expected no slow query log entry, got %q", logs.String())
+	}
+
+	// Both searches are counted in the index's stats
+	req = httptest.NewRequest("GET", "/indexes/users/stats", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var stats search.IndexStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	if stats.Searches == nil || stats.Searches.Count != 2 || stats.Searches.Errors != 0 {
+		t.Fatalf("Expected 2 successful searches in stats, got %+v", stats.Searches)
+	}
+	if stats.Searches.MaxMs < 20 {
+		t.Errorf("Expected max latency of at least 20ms, got %v", stats.Searches.MaxMs)
+	}
+}
+
+// blockingSearchEngine is a mock search engine whose searches block until released
+type blockingSearchEngine struct {
+	mockSearchEngine
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *blockingSearchEngine) Search(req search.SearchRequest) (*search.SearchResult, error) {
+	m.started <- struct{}{}
+	<-m.release
+	return &search.SearchResult{}, nil
+}
+
+func TestServer_MaxConcurrentSearches(t *testing.T) {
+	mockEngine := &blockingSearchEngine{
+		mockSearchEngine: mockSearchEngine{indexes: []search.IndexInfo{{Name: "products", Status: "active"}}},
+		started:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	cfg := &config.Config{Server: config.ServerConfig{MaxConcurrentSearches: 2}}
+	router := NewServer(mockEngine, nil, nil, cfg, nil).Router()
+
+	runSearch := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/indexes/products/search", strings.NewReader(`{"query": {}}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Saturate the semaphore with searches that block until released
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() { codes <- runSearch().Code }()
+	}
+	for i := 0; i < 2; i++ {
+		<-mockEngine.started
+	}
+
+	w := runSearch()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d while saturated, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header while saturated")
+	}
+	var errResp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil || errResp.Error != "too_many_searches" {
+		t.Errorf("Expected a too_many_searches error, got %+v (%v)", errResp, err)
+	}
+
+	req := httptest.NewRequest("POST", "/_msearch", strings.NewReader(`[{"index": "products", "query": {}}]`))
+	msearch := httptest.NewRecorder()
+	router.ServeHTTP(msearch, req)
+	if !strings.Contains(msearch.Body.String(), `"code":503`) {
+		t.Errorf("Expected the multi-search entry to be rejected with 503, got %s", msearch.Body.String())
+	}
+
+	close(mockEngine.release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("Expected blocked search to complete with status code %d, got %d", http.StatusOK, code)
+		}
+	}
+
+	// Slots are freed once the searches complete
+	go func() { <-mockEngine.started }()
+	if w := runSearch(); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d after searches completed, got %d", http.StatusOK, w.Code)
+	}
+}
+
+// newSyncingIndexer returns an indexer service whose sync state, loaded from
+// disk, has shop.products at status with progress
+func newSyncingIndexer(t *testing.T, cfg *config.Config, status, progress string) *indexer.Service {
+	t.Helper()
+	statePath := t.TempDir() + "/sync_state.json"
+	state := fmt.Sprintf(`{"collections": {"shop.products": {"collectionKey": "shop.products", "syncStatus": %q, "progress": %q}}}`, status, progress)
+	if err := os.WriteFile(statePath, []byte(state), 0644); err != nil {
+		t.Fatalf("Failed to write sync state: %v", err)
+	}
+	cfg.Search.SyncStatePath = statePath
+
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+
+	service, err := indexer.NewService(nil, engine, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create indexer service: %v", err)
+	}
+	return service
+}
+
+func TestServer_handleSearch_InitialSync(t *testing.T) {
+	searchable := false
+	tests := []struct {
+		name       string
+		searchable *bool
+		status     string
+		wantCode   int
+	}{
+		{name: "rejected while syncing", searchable: &searchable, status: "in_progress", wantCode: http.StatusServiceUnavailable},
+		{name: "allowed after syncing", searchable: &searchable, status: "idle", wantCode: http.StatusOK},
+		{name: "allowed while syncing by default", status: "in_progress", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Indexes: []config.IndexConfig{{
+				Name:                    "products",
+				Database:                "shop",
+				Collection:              "products",
+				TimestampField:          "_id",
+				SearchDuringInitialSync: tt.searchable,
+			}}}
+			server := &Server{
+				searchEngine:   &mockSearchEngine{indexes: []search.IndexInfo{{Name: "products", Status: "active"}}},
+				indexerService: newSyncingIndexer(t, cfg, tt.status, "42.0%"),
+				config:         cfg,
+			}
+			router := server.Router()
+
+			req := httptest.NewRequest("POST", "/indexes/products/search", strings.NewReader(`{"query": {}}`))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantCode != http.StatusServiceUnavailable {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Error != "index_not_ready" || !strings.Contains(response.Message, "42.0%") {
+				t.Errorf("Expected index_not_ready with the sync progress, got %+v", response)
+			}
+			if w.Header().Get("Retry-After") != syncRetryAfter {
+				t.Errorf("Expected Retry-After %s, got %q", syncRetryAfter, w.Header().Get("Retry-After"))
+			}
+
+			// Sub-searches of a multi-search are rejected the same way
+			req = httptest.NewRequest("POST", "/_msearch", strings.NewReader(`[{"index": "products", "query": {}}]`))
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if !strings.Contains(w.Body.String(), `"index_not_ready"`) {
+				t.Errorf("Expected the multi-search to report index_not_ready, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_PauseAndResume(t *testing.T) {
+	cfg := &config.Config{Indexes: []config.IndexConfig{
+		{Name: "products", Database: "shop", Collection: "products", TimestampField: "_id"},
+		{Name: "orders", Database: "shop", Collection: "orders", TimestampField: "_id"},
+	}}
+	server := &Server{
+		searchEngine:   &mockSearchEngine{indexes: []search.IndexInfo{{Name: "products", Status: "active"}, {Name: "orders", Status: "active"}}},
+		indexerService: newSyncingIndexer(t, cfg, "idle", "100%"),
+		config:         cfg,
+	}
+	router := server.Router()
+
+	indexStatus := func() string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/indexes/products/status", nil))
+		var response struct {
+			Index search.IndexInfo `json:"index"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode status: %v", err)
+		}
+		return response.Index.Status
+	}
+
+	for _, step := range []struct {
+		path   string
+		paused bool
+		status string
+	}{
+		{path: "/indexes/products/_pause", paused: true, status: "paused"},
+		{path: "/indexes/products/_resume", paused: false, status: "active"},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", step.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d for %s, got %d: %s", http.StatusOK, step.path, w.Code, w.Body.String())
+		}
+		var response map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response["paused"] != step.paused {
+			t.Errorf("Expected paused %v after %s, got %v", step.paused, step.path, response)
+		}
+		if status := indexStatus(); status != step.status {
+			t.Errorf("Expected index status %q after %s, got %q", step.status, step.path, status)
+		}
+
+		// The paused state is persisted with the sync state
+		data, err := os.ReadFile(cfg.Search.SyncStatePath)
+		if err != nil {
+			t.Fatalf("Failed to read sync state: %v", err)
+		}
+		if persisted := strings.Contains(string(data), `"paused": true`); persisted != step.paused {
+			t.Errorf("Expected the saved sync state to record paused %v, got %s", step.paused, data)
+		}
+	}
+
+	// An index whose collection hasn't been polled can't be paused or
+	// re-polled yet
+	for _, path := range []string{"/indexes/orders/_pause", "/indexes/orders/_repoll?since=2024-01-01T00:00:00Z"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "polling_not_started") {
+			t.Errorf("Expected polling_not_started for %s before the first poll, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	// Without an indexer there's nothing to pause
+	server.indexerService = nil
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/indexes/products/_pause", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d without an indexer, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestServer_handleStatus_MongoBreaker(t *testing.T) {
+	cfg := &config.Config{
+		MongoDB: config.MongoDBConfig{BreakerThreshold: 5, BreakerCooldown: 30},
+		Indexes: []config.IndexConfig{{
+			Name:           "products",
+			Database:       "shop",
+			Collection:     "products",
+			TimestampField: "_id",
+		}},
+	}
+	server := &Server{
+		searchEngine:   &mockSearchEngine{indexes: []search.IndexInfo{{Name: "products", Status: "active"}}},
+		indexerService: newSyncingIndexer(t, cfg, "idle", "100.0%"),
+		config:         cfg,
+	}
+
+	req := httptest.NewRequest("GET", "/indexes/products/status", nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		MongoDBBreaker *indexer.BreakerStatus `json:"mongodbBreaker"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.MongoDBBreaker == nil || response.MongoDBBreaker.State != indexer.BreakerClosed {
+		t.Errorf("Expected a closed MongoDB breaker in the status, got %+v", response.MongoDBBreaker)
+	}
+}
+
+// newClusterNode creates the API server of a cluster node serving cluster gRPC
+// on a free port, with a products index holding docs unless docs is nil
+func newClusterNode(t *testing.T, nodeID string, docs map[string]string) (*Server, *cluster.Manager) {
+	t.Helper()
+
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	if docs != nil {
+		indexCfg := config.IndexConfig{
+			Name:       "products",
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		for id, name := range docs {
+			if err := engine.IndexDocument("products", id, map[string]interface{}{"name": name}); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+	}
+
+	cfg := &config.Config{Cluster: config.ClusterConfig{Enabled: true, NodeID: nodeID}}
+	manager, err := cluster.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create cluster manager: %v", err)
+	}
+	server := NewServer(engine, nil, nil, cfg, manager)
+	if err := manager.StartGRPCServer(0); err != nil {
+		t.Fatalf("Failed to start gRPC server: %v", err)
+	}
+	t.Cleanup(manager.StopGRPCServer)
+	return server, manager
+}
+
+func TestServer_handleSearch_ForwardsToPeer(t *testing.T) {
+	owner, ownerManager := newClusterNode(t, "node-1", map[string]string{"1": "red widget", "2": "blue widget", "3": "red gadget"})
+	other, otherManager := newClusterNode(t, "node-2", nil)
+	other.config.Cluster.Peers = []string{ownerManager.GRPCAddr()}
+	owner.config.Cluster.Peers = []string{otherManager.GRPCAddr()}
+
+	doSearch := func(server *Server, index, query string) *httptest.ResponseRecorder {
+		t.Helper()
+		body := `{"query": {"text": {"query": "red", "path": "name"}}}`
+		req := httptest.NewRequest("POST", "/indexes/"+index+"/search"+query, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+	hitIDs := func(w *httptest.ResponseRecorder) []string {
+		t.Helper()
+		var response struct {
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+			Total int `json:"total"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		var ids []string
+		for _, hit := range response.Hits {
+			ids = append(ids, hit.ID)
+		}
+		if response.Total != len(ids) {
+			t.Errorf("Expected total %d to match the hits, got %d", len(ids), response.Total)
+		}
+		return ids
+	}
+
+	// The node without the index answers with the owner's results
+	local := doSearch(owner, "products", "")
+	forwarded := doSearch(other, "products", "?pretty=true")
+	if local.Code != http.StatusOK || forwarded.Code != http.StatusOK {
+		t.Fatalf("Expected both searches to succeed, got %d and %d: %s", local.Code, forwarded.Code, forwarded.Body.String())
+	}
+	want := hitIDs(local)
+	if got := hitIDs(forwarded); len(want) != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the forwarded search to return %v, got %v", want, got)
+	}
+	if !strings.Contains(forwarded.Body.String(), "\n  ") {
+		t.Error("Expected the query string to be forwarded")
+	}
+	if ct := forwarded.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected the owner's Content-Type to be relayed, got %q", ct)
+	}
+
+	// An index no node has isn't forwarded back and forth
+	w := doSearch(other, "missing", "")
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "index_not_found") {
+		t.Errorf("Expected index_not_found for an index no node has, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Searches forwarded to a node aren't forwarded again
+	req := httptest.NewRequest("POST", "/indexes/products/search", strings.NewReader(`{"query": {}}`))
+	req.Header.Set(cluster.ForwardedByHeader, "node-3")
+	w = httptest.NewRecorder()
+	other.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected a forwarded search to be answered locally, got %d", w.Code)
+	}
+
+	// Unreachable peers are reported
+	other.config.Cluster.Peers = []string{"127.0.0.1:1"}
+	if w := doSearch(other, "products", ""); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected %d when the peer is unreachable, got %d: %s", http.StatusBadGateway, w.Code, w.Body.String())
+	}
+}
+
+func TestServer_handleSearch_ForwardsCredentialsOnlyOverTLS(t *testing.T) {
+	owner, ownerManager := newClusterNode(t, "node-1", map[string]string{"1": "red widget"})
+	other, _ := newClusterNode(t, "node-2", nil)
+	other.config.Cluster.Peers = []string{ownerManager.GRPCAddr()}
+	owner.config.Server.APIKeys = []string{"secret"}
+
+	// Cluster gRPC is plaintext, so the API key stays on this node and the
+	// owner rejects the search
+	req := httptest.NewRequest("POST", "/indexes/products/search", strings.NewReader(`{"query": {"text": {"query": "red", "path": "name"}}}`))
+	req.Header.Set("X-API-Key", "secret")
+	w := httptest.NewRecorder()
+	other.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the owner to reject a search forwarded without credentials, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestServer_handleSearch_LeaderOnlyFollowerForwardsToLeader(t *testing.T) {
+	leader, leaderManager := newClusterNode(t, "node-1", map[string]string{"1": "red widget", "2": "red gadget"})
+	follower, _ := newClusterNode(t, "node-2", map[string]string{"1": "red widget"})
+	follower.config.Cluster.Peers = []string{leaderManager.GRPCAddr()}
+	for _, server := range []*Server{leader, follower} {
+		server.config.Cluster.LeaderOnlyIndexing = true
+	}
+
+	doSearch := func() *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/indexes/products/search", strings.NewReader(`{"query": {"text": {"query": "red", "path": "name"}}}`))
+		w := httptest.NewRecorder()
+		follower.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	// Until a leader is elected the follower refuses instead of answering
+	// from its stale index
+	if w := doSearch(); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "not_leader") {
+		t.Fatalf("Expected not_leader before a leader is elected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	leader.config.Cluster.RaftDir = t.TempDir()
+	leader.config.Cluster.DataDir = t.TempDir()
+	leader.config.Cluster.BindAddr = "127.0.0.1:0"
+	leader.config.Cluster.Bootstrap = true
+	if err := leaderManager.Start(); err != nil {
+		t.Fatalf("Failed to start the leader: %v", err)
+	}
+	t.Cleanup(func() { leaderManager.Stop() })
+	deadline := time.Now().Add(15 * time.Second)
+	for !leaderManager.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the leader")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	w := doSearch()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the follower to relay the leader's results, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Total int `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Total != 2 {
+		t.Errorf("Expected the leader's 2 hits rather than the follower's stale index, got %d", response.Total)
+	}
+
+	// Other reads of index contents are refused on the follower
+	req := httptest.NewRequest("POST", "/indexes/products/_count_by", strings.NewReader(`{"path": "name"}`))
+	w = httptest.NewRecorder()
+	follower.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected _count_by to be refused on a follower, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,181 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ForwardedByHeader names the node a search was forwarded from, as gRPC
+// metadata and as the HTTP header of the search it runs. Searches carrying it
+// are never forwarded again.
+const ForwardedByHeader = "X-OAS-Forwarded-By"
+
+// forwardSearchMethod is the full gRPC method name of ForwardSearch
+const forwardSearchMethod = "/" + clusterServiceName + "/ForwardSearch"
+
+// ErrIndexNotOnPeers is returned by ForwardSearch when no peer has the index
+var ErrIndexNotOnPeers = errors.New("no peer has the index")
+
+// ErrNoLeader is returned by ForwardSearchToLeader when no peer is the leader
+var ErrNoLeader = errors.New("no peer is the cluster leader")
+
+// SearchHandler runs a search forwarded from the node forwardedBy and returns
+// its HTTP response
+type SearchHandler func(ctx context.Context, req *ForwardSearchRequest, forwardedBy string) *ForwardSearchResponse
+
+// SetSearchHandler sets the handler running searches forwarded to this node
+func (m *Manager) SetSearchHandler(handler SearchHandler) {
+	m.forwardMutex.Lock()
+	defer m.forwardMutex.Unlock()
+	m.searchHandler = handler
+}
+
+// getSearchHandler returns the handler set by SetSearchHandler
+func (m *Manager) getSearchHandler() SearchHandler {
+	m.forwardMutex.Lock()
+	defer m.forwardMutex.Unlock()
+	return m.searchHandler
+}
+
+// ForwardSearch relays a search on an index this node lacks to the peers in
+// cluster.peers, returning the response of the first one that has the index.
+// The peer that last answered for the index is asked first. It returns
+// ErrIndexNotOnPeers if every peer responded 404 Not Found, and the last
+// error if some could not be reached.
+func (m *Manager) ForwardSearch(ctx context.Context, req *ForwardSearchRequest) (*ForwardSearchResponse, error) {
+	peer, resp, err := m.forwardToPeers(ctx, req, m.searchPeers(req.Index), http.StatusNotFound)
+	if err != nil {
+		if errors.Is(err, errNoPeerAnswered) {
+			return nil, ErrIndexNotOnPeers
+		}
+		return nil, err
+	}
+
+	m.forwardMutex.Lock()
+	m.indexOwners[req.Index] = peer
+	m.forwardMutex.Unlock()
+	return resp, nil
+}
+
+// ForwardSearchToLeader relays a search to the peer in cluster.peers that is
+// the cluster leader, for followers that don't index under
+// leader_only_indexing. Peers that aren't the leader respond 421 Misdirected
+// Request and are skipped; the peer that last answered is asked first. It
+// returns ErrNoLeader if no peer is the leader, and the last error if some
+// could not be reached.
+func (m *Manager) ForwardSearchToLeader(ctx context.Context, req *ForwardSearchRequest) (*ForwardSearchResponse, error) {
+	m.forwardMutex.Lock()
+	leader := m.leaderPeer
+	m.forwardMutex.Unlock()
+
+	req.Leader = true
+	peer, resp, err := m.forwardToPeers(ctx, req, m.orderPeers(leader), http.StatusMisdirectedRequest)
+	if err != nil {
+		if errors.Is(err, errNoPeerAnswered) {
+			return nil, ErrNoLeader
+		}
+		return nil, err
+	}
+
+	m.forwardMutex.Lock()
+	m.leaderPeer = peer
+	m.forwardMutex.Unlock()
+	return resp, nil
+}
+
+// errNoPeerAnswered is returned by forwardToPeers when every peer responded
+// with the skipped status
+var errNoPeerAnswered = errors.New("no peer answered")
+
+// forwardToPeers sends a search to the peers in order and returns the first
+// response whose status isn't skip, with the peer that sent it
+func (m *Manager) forwardToPeers(ctx context.Context, req *ForwardSearchRequest, peers []string, skip int) (string, *ForwardSearchResponse, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, ForwardedByHeader, m.nodeID)
+
+	var lastErr error
+	for _, peer := range peers {
+		conn, err := m.peerConn(peer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		resp := &ForwardSearchResponse{}
+		if err := conn.Invoke(ctx, forwardSearchMethod, req, resp, grpc.ForceCodec(jsonCodec{})); err != nil {
+			if ctx.Err() != nil {
+				return "", nil, ctx.Err()
+			}
+			log.Printf("Failed to forward search on index %s to %s: %v", req.Index, peer, err)
+			lastErr = fmt.Errorf("peer %s: %w", peer, err)
+			continue
+		}
+		if resp.Status == skip {
+			continue
+		}
+		return peer, resp, nil
+	}
+
+	if lastErr != nil {
+		return "", nil, lastErr
+	}
+	return "", nil, errNoPeerAnswered
+}
+
+// searchPeers returns the peers to ask for an index, its last known owner first
+func (m *Manager) searchPeers(indexName string) []string {
+	m.forwardMutex.Lock()
+	owner := m.indexOwners[indexName]
+	m.forwardMutex.Unlock()
+
+	return m.orderPeers(owner)
+}
+
+// orderPeers returns the peers in cluster.peers with first moved to the front
+func (m *Manager) orderPeers(first string) []string {
+	peers := make([]string, 0, len(m.config.Cluster.Peers))
+	for _, peer := range m.config.Cluster.Peers {
+		if peer == first {
+			peers = append([]string{peer}, peers...)
+		} else {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// peerConn returns the client connection to a peer, opening it on first use
+func (m *Manager) peerConn(peer string) (*grpc.ClientConn, error) {
+	m.forwardMutex.Lock()
+	defer m.forwardMutex.Unlock()
+
+	if conn, ok := m.peerConns[peer]; ok {
+		return conn, nil
+	}
+	creds, err := peerCredentials(m.config.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.NewClient(peer, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to peer %s: %w", peer, err)
+	}
+	m.peerConns[peer] = conn
+	return conn, nil
+}
+
+// closePeerConns closes the connections opened by peerConn
+func (m *Manager) closePeerConns() {
+	m.forwardMutex.Lock()
+	defer m.forwardMutex.Unlock()
+
+	for peer, conn := range m.peerConns {
+		conn.Close()
+		delete(m.peerConns, peer)
+	}
+}
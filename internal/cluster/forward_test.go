@@ -0,0 +1,95 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newForwardingManager(t *testing.T, nodeID string) *Manager {
+	t.Helper()
+	m, err := NewManager(&config.Config{Cluster: config.ClusterConfig{Enabled: true, NodeID: nodeID}})
+	assert.NoError(t, err)
+	assert.NoError(t, m.StartGRPCServer(0))
+	t.Cleanup(m.StopGRPCServer)
+	return m
+}
+
+func TestManager_ForwardSearch(t *testing.T) {
+	owner := newForwardingManager(t, "node-1")
+	empty := newForwardingManager(t, "node-2")
+	origin := newForwardingManager(t, "node-3")
+	origin.config.Cluster.Peers = []string{empty.GRPCAddr(), owner.GRPCAddr()}
+
+	var forwardedBy []string
+	owner.SetSearchHandler(func(ctx context.Context, req *ForwardSearchRequest, from string) *ForwardSearchResponse {
+		forwardedBy = append(forwardedBy, from)
+		if req.Index != "products" {
+			return &ForwardSearchResponse{Status: http.StatusNotFound}
+		}
+		return &ForwardSearchResponse{Status: http.StatusOK, Body: append([]byte("echo "), req.Body...)}
+	})
+	empty.SetSearchHandler(func(ctx context.Context, req *ForwardSearchRequest, from string) *ForwardSearchResponse {
+		return &ForwardSearchResponse{Status: http.StatusNotFound}
+	})
+
+	// Peers without the index are skipped
+	resp, err := origin.ForwardSearch(context.Background(), &ForwardSearchRequest{Index: "products", Body: []byte(`{}`)})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.Equal(t, "echo {}", string(resp.Body))
+	assert.Equal(t, []string{"node-3"}, forwardedBy)
+	assert.Equal(t, []string{owner.GRPCAddr(), empty.GRPCAddr()}, origin.searchPeers("products"))
+
+	_, err = origin.ForwardSearch(context.Background(), &ForwardSearchRequest{Index: "missing"})
+	assert.True(t, errors.Is(err, ErrIndexNotOnPeers), "expected ErrIndexNotOnPeers, got %v", err)
+
+	// A search forwarded back to the node it came from is refused
+	owner.config.Cluster.Peers = []string{owner.GRPCAddr()}
+	_, err = owner.ForwardSearch(context.Background(), &ForwardSearchRequest{Index: "products"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(errors.Unwrap(err)))
+
+	// Without a peer list nothing is forwarded
+	_, err = empty.ForwardSearch(context.Background(), &ForwardSearchRequest{Index: "products"})
+	assert.True(t, errors.Is(err, ErrIndexNotOnPeers))
+}
+
+func TestManager_ForwardSearchToLeader(t *testing.T) {
+	leader := newForwardingManager(t, "node-1")
+	follower := newForwardingManager(t, "node-2")
+	origin := newForwardingManager(t, "node-3")
+	origin.config.Cluster.Peers = []string{follower.GRPCAddr(), leader.GRPCAddr()}
+
+	var searched []string
+	for _, m := range []*Manager{leader, follower} {
+		m := m
+		m.SetSearchHandler(func(ctx context.Context, req *ForwardSearchRequest, from string) *ForwardSearchResponse {
+			searched = append(searched, m.nodeID)
+			return &ForwardSearchResponse{Status: http.StatusOK, Body: []byte(m.nodeID)}
+		})
+	}
+
+	// Without a leader every peer refuses the search
+	_, err := origin.ForwardSearchToLeader(context.Background(), &ForwardSearchRequest{Index: "products"})
+	assert.True(t, errors.Is(err, ErrNoLeader), "expected ErrNoLeader, got %v", err)
+	assert.Empty(t, searched)
+
+	// Followers are skipped and the leader is asked first afterwards
+	leader.setLeader(true)
+	resp, err := origin.ForwardSearchToLeader(context.Background(), &ForwardSearchRequest{Index: "products"})
+	assert.NoError(t, err)
+	assert.Equal(t, "node-1", string(resp.Body))
+	assert.Equal(t, []string{"node-1"}, searched)
+	assert.Equal(t, []string{leader.GRPCAddr(), follower.GRPCAddr()}, origin.orderPeers(origin.leaderPeer))
+
+	// Searches for any peer with the index still reach followers
+	resp, err = origin.ForwardSearch(context.Background(), &ForwardSearchRequest{Index: "products"})
+	assert.NoError(t, err)
+	assert.Equal(t, "node-2", string(resp.Body))
+}
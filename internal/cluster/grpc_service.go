@@ -2,11 +2,16 @@ package cluster
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // ServiceServer implements the gRPC cluster service
@@ -42,20 +47,109 @@ func (s *ServiceServer) GetClusterState(ctx context.Context, req *StateRequest)
 	}, nil
 }
 
-// StartGRPCServer starts the gRPC server for cluster communication
+// ForwardSearch runs a search forwarded by a node that lacks its index, or by
+// a follower asking for the leader. The origin node is named by the
+// X-OAS-Forwarded-By metadata, and the search is never forwarded again, so
+// forwarding can't loop. Searches for the leader are answered with 421
+// Misdirected Request unless this node leads.
+func (s *ServiceServer) ForwardSearch(ctx context.Context, req *ForwardSearchRequest) (*ForwardSearchResponse, error) {
+	var forwardedBy string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(ForwardedByHeader); len(values) > 0 {
+			forwardedBy = values[0]
+		}
+	}
+	if forwardedBy == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "forwarded searches must set %s", ForwardedByHeader)
+	}
+	if forwardedBy == s.manager.nodeID {
+		return nil, status.Error(codes.FailedPrecondition, "search was forwarded back to the node it came from")
+	}
+	if req.Leader && !s.manager.IsLeader() {
+		return &ForwardSearchResponse{Status: http.StatusMisdirectedRequest}, nil
+	}
+
+	handler := s.manager.getSearchHandler()
+	if handler == nil {
+		return nil, status.Error(codes.Unavailable, "this node doesn't serve searches")
+	}
+	return handler(ctx, req, forwardedBy), nil
+}
+
+// ClusterServiceServer is the server API of the ClusterService in cluster.proto
+// served over gRPC. JoinCluster and GetClusterState aren't served: grpc_port
+// has no authentication of its own, and JoinCluster would let any host that
+// reaches it add itself to the cluster as a Raft voter.
+type ClusterServiceServer interface {
+	ForwardSearch(context.Context, *ForwardSearchRequest) (*ForwardSearchResponse, error)
+}
+
+// clusterServiceName is the full name of the ClusterService in cluster.proto
+const clusterServiceName = "cluster.ClusterService"
+
+// clusterServiceDesc describes the ClusterService in cluster.proto. Its
+// messages are the plain structs below, sent with jsonCodec instead of
+// protobuf code generated from the .proto file.
+var clusterServiceDesc = grpc.ServiceDesc{
+	ServiceName: clusterServiceName,
+	HandlerType: (*ClusterServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "ForwardSearch", Handler: unaryHandler("ForwardSearch", ClusterServiceServer.ForwardSearch)},
+	},
+	Metadata: "cluster.proto",
+}
+
+// unaryHandler adapts a ClusterServiceServer method to a gRPC method handler
+func unaryHandler[Req, Resp any](method string, call func(ClusterServiceServer, context.Context, *Req) (*Resp, error)) grpc.MethodHandler {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(ClusterServiceServer), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + clusterServiceName + "/" + method,
+		}
+		return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			return call(srv.(ClusterServiceServer), ctx, req.(*Req))
+		})
+	}
+}
+
+// jsonCodec encodes the cluster service's messages as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// StartGRPCServer starts the gRPC server for cluster communication, over TLS
+// if grpc_tls_cert is set. Port 0 picks a free port, reported by GRPCAddr.
 func (m *Manager) StartGRPCServer(port int) error {
+	creds, err := serverCredentials(m.config.Cluster)
+	if err != nil {
+		return err
+	}
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return fmt.Errorf("failed to listen on port %d: %w", port, err)
 	}
 
-	grpcServer := grpc.NewServer()
-	// clusterService := NewServiceServer(m)
-
-	// Register the service (commented out until protobuf is generated)
-	// RegisterClusterServiceServer(grpcServer, clusterService)
+	grpcServer := grpc.NewServer(grpc.Creds(creds), grpc.ForceServerCodec(jsonCodec{}))
+	grpcServer.RegisterService(&clusterServiceDesc, NewServiceServer(m))
 
-	log.Printf("Starting gRPC server on port %d", port)
+	log.Printf("Starting gRPC server on %s", lis.Addr())
 
 	go func() {
 		if err := grpcServer.Serve(lis); err != nil {
@@ -64,14 +158,23 @@ func (m *Manager) StartGRPCServer(port int) error {
 	}()
 
 	m.grpcServer = grpcServer
+	m.grpcAddr = lis.Addr().String()
 	return nil
 }
 
-// StopGRPCServer stops the gRPC server
+// GRPCAddr returns the address the gRPC server listens on, or "" if it isn't running
+func (m *Manager) GRPCAddr() string {
+	return m.grpcAddr
+}
+
+// StopGRPCServer stops the gRPC server and closes the connections to peers
 func (m *Manager) StopGRPCServer() {
 	if m.grpcServer != nil {
 		m.grpcServer.GracefulStop()
+		m.grpcServer = nil
+		m.grpcAddr = ""
 	}
+	m.closePeerConns()
 }
 
 // JoinRequest represents a request to join the cluster
@@ -92,3 +195,19 @@ type StateRequest struct{}
 type StateResponse struct {
 	NodeIDs []string `json:"node_ids"`
 }
+
+// ForwardSearchRequest is a search request relayed to another node
+type ForwardSearchRequest struct {
+	Index  string            `json:"index"`
+	Query  string            `json:"query,omitempty"`  // URL query string, such as pretty=true
+	Header map[string]string `json:"header,omitempty"` // Request headers such as credentials
+	Body   []byte            `json:"body"`
+	Leader bool              `json:"leader,omitempty"` // Run only if the peer is the cluster leader
+}
+
+// ForwardSearchResponse is the HTTP response of a forwarded search
+type ForwardSearchResponse struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   []byte            `json:"body"`
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/davidschrooten/open-atlas-search/config"
@@ -40,6 +41,16 @@ type Manager struct {
 	isRunning  bool
 	grpcServer *grpc.Server
 	transport  raft.Transport
+
+	leaderMutex        sync.Mutex            // Guards isLeader and leadershipHandlers
+	leadershipHandlers []func(isLeader bool) // Registered with OnLeadershipChange
+
+	grpcAddr      string                      // Address the gRPC server listens on
+	forwardMutex  sync.Mutex                  // Guards searchHandler, peerConns, indexOwners and leaderPeer
+	searchHandler SearchHandler               // Runs searches forwarded to this node
+	peerConns     map[string]*grpc.ClientConn // peer address -> connection used to forward searches
+	indexOwners   map[string]string           // index name -> peer that last answered a forwarded search
+	leaderPeer    string                      // Peer that last answered a search forwarded to the leader
 }
 
 // NewManager creates a new cluster manager
@@ -58,12 +69,14 @@ func NewManager(cfg *config.Config) (*Manager, error) {
 	}
 
 	m := &Manager{
-		config:    cfg,
-		nodeID:    nodeID,
-		shards:    make(map[string][]ShardInfo),
-		ctx:       ctx,
-		cancel:    cancel,
-		isRunning: false,
+		config:      cfg,
+		nodeID:      nodeID,
+		shards:      make(map[string][]ShardInfo),
+		ctx:         ctx,
+		cancel:      cancel,
+		isRunning:   false,
+		peerConns:   make(map[string]*grpc.ClientConn),
+		indexOwners: make(map[string]string),
 	}
 
 	return m, nil
@@ -94,6 +107,13 @@ func (m *Manager) Start() error {
 		return fmt.Errorf("failed to initialize sharding: %w", err)
 	}
 
+	// Serve cluster gRPC, such as searches forwarded by other nodes
+	if m.config.Cluster.GRPCPort > 0 {
+		if err := m.StartGRPCServer(m.config.Cluster.GRPCPort); err != nil {
+			return err
+		}
+	}
+
 	// Start leadership monitoring
 	go m.monitorLeadership()
 
@@ -110,6 +130,7 @@ func (m *Manager) Stop() error {
 	}
 
 	m.cancel()
+	m.StopGRPCServer()
 
 	if m.raft != nil {
 		if err := m.raft.Shutdown().Error(); err != nil {
@@ -266,32 +287,68 @@ func (m *Manager) monitorLeadership() {
 		case <-m.ctx.Done():
 			return
 		case <-ticker.C:
-			wasLeader := m.isLeader
-			m.isLeader = m.raft.State() == raft.Leader
-
-			if m.isLeader && !wasLeader {
-				log.Printf("Node %s became leader", m.nodeID)
-				// Handle leadership transition
-				m.onBecomeLeader()
-			} else if !m.isLeader && wasLeader {
-				log.Printf("Node %s lost leadership", m.nodeID)
-				// Handle leadership loss
-				m.onLoseLeadership()
-			}
+			m.setLeader(m.raft.State() == raft.Leader)
 		}
 	}
 }
 
+// setLeader records whether this node is the leader, handling a transition
+func (m *Manager) setLeader(isLeader bool) {
+	m.leaderMutex.Lock()
+	wasLeader := m.isLeader
+	m.isLeader = isLeader
+	m.leaderMutex.Unlock()
+
+	if isLeader && !wasLeader {
+		log.Printf("Node %s became leader", m.nodeID)
+		// Handle leadership transition
+		m.onBecomeLeader()
+	} else if !isLeader && wasLeader {
+		log.Printf("Node %s lost leadership", m.nodeID)
+		// Handle leadership loss
+		m.onLoseLeadership()
+	}
+}
+
 // onBecomeLeader handles becoming the cluster leader
 func (m *Manager) onBecomeLeader() {
 	// Redistribute shards if needed
 	// Sync cluster state
 	log.Printf("Node %s is now the cluster leader", m.nodeID)
+	m.notifyLeadership(true)
 }
 
 // onLoseLeadership handles losing cluster leadership
 func (m *Manager) onLoseLeadership() {
 	log.Printf("Node %s is no longer the cluster leader", m.nodeID)
+	m.notifyLeadership(false)
+}
+
+// OnLeadershipChange registers a handler called with true when this node
+// becomes the leader and false when it loses leadership, such as to run work
+// only on the leader. It is called right away if the node already leads.
+// Handlers run on the goroutine monitoring leadership and may be called twice
+// with the same value, so they should be idempotent.
+func (m *Manager) OnLeadershipChange(handler func(isLeader bool)) {
+	m.leaderMutex.Lock()
+	m.leadershipHandlers = append(m.leadershipHandlers, handler)
+	isLeader := m.isLeader
+	m.leaderMutex.Unlock()
+
+	if isLeader {
+		handler(true)
+	}
+}
+
+// notifyLeadership calls the leadership handlers
+func (m *Manager) notifyLeadership(isLeader bool) {
+	m.leaderMutex.Lock()
+	handlers := append([]func(bool){}, m.leadershipHandlers...)
+	m.leaderMutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(isLeader)
+	}
 }
 
 // GetShardNode returns the node responsible for a given key
@@ -335,6 +392,8 @@ func (m *Manager) IsClusterEnabled() bool {
 
 // IsLeader returns whether this node is the cluster leader
 func (m *Manager) IsLeader() bool {
+	m.leaderMutex.Lock()
+	defer m.leaderMutex.Unlock()
 	return m.isLeader
 }
 
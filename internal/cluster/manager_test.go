@@ -259,3 +259,40 @@ func waitForLeader(t *testing.T, m *Manager, timeout time.Duration) {
 		}
 	}
 }
+
+func TestManager_OnLeadershipChange(t *testing.T) {
+	cfg := &config.Config{
+		Cluster: config.ClusterConfig{
+			Enabled: true,
+			NodeID:  "test-node-1",
+		},
+	}
+	m, err := NewManager(cfg)
+	assert.NoError(t, err)
+
+	var changes []bool
+	m.OnLeadershipChange(func(isLeader bool) {
+		changes = append(changes, isLeader)
+	})
+	assert.Empty(t, changes, "a follower's handler shouldn't be called on registration")
+
+	// Only transitions call the handler
+	m.setLeader(true)
+	m.setLeader(true)
+	assert.True(t, m.IsLeader())
+	m.setLeader(false)
+	m.setLeader(false)
+	assert.False(t, m.IsLeader())
+	m.setLeader(true)
+	assert.Equal(t, []bool{true, false, true}, changes)
+
+	// Handlers registered on the leader are called right away
+	var late []bool
+	m.OnLeadershipChange(func(isLeader bool) {
+		late = append(late, isLeader)
+	})
+	assert.Equal(t, []bool{true}, late)
+	m.setLeader(false)
+	assert.Equal(t, []bool{true, false}, late)
+	assert.Equal(t, []bool{true, false, true, false}, changes)
+}
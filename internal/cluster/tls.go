@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// SecureTransport reports whether cluster gRPC runs over TLS, so credentials
+// can be relayed to peers without exposing them on the network
+func (m *Manager) SecureTransport() bool {
+	return m.config.Cluster.GRPCTLSCert != ""
+}
+
+// serverCredentials returns the transport credentials of the gRPC server. With
+// grpc_tls_ca set, peers must present a certificate signed by it.
+func serverCredentials(cfg config.ClusterConfig) (credentials.TransportCredentials, error) {
+	if cfg.GRPCTLSCert == "" && cfg.GRPCTLSKey == "" {
+		return insecure.NewCredentials(), nil
+	}
+	cert, err := loadKeyPair(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.GRPCTLSCA != "" {
+		if tlsConfig.ClientCAs, err = loadCertPool(cfg.GRPCTLSCA); err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// peerCredentials returns the transport credentials of connections to peers,
+// which present this node's certificate and verify the peer's against
+// grpc_tls_ca, or the system roots if it isn't set
+func peerCredentials(cfg config.ClusterConfig) (credentials.TransportCredentials, error) {
+	if cfg.GRPCTLSCert == "" && cfg.GRPCTLSKey == "" {
+		return insecure.NewCredentials(), nil
+	}
+	cert, err := loadKeyPair(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.GRPCTLSCA != "" {
+		if tlsConfig.RootCAs, err = loadCertPool(cfg.GRPCTLSCA); err != nil {
+			return nil, err
+		}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// loadKeyPair loads this node's certificate and key
+func loadKeyPair(cfg config.ClusterConfig) (tls.Certificate, error) {
+	if cfg.GRPCTLSCert == "" || cfg.GRPCTLSKey == "" {
+		return tls.Certificate{}, fmt.Errorf("grpc_tls_cert and grpc_tls_key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.GRPCTLSCert, cfg.GRPCTLSKey)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load gRPC TLS certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// loadCertPool loads the PEM certificates in path
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gRPC TLS CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in gRPC TLS CA %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// writeTestCert writes a self-signed certificate for localhost, usable as
+// server, client and CA certificate, and returns the paths of it and its key
+func writeTestCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certPath, keyPath
+}
+
+func newTLSManager(t *testing.T, nodeID, cert, key string) *Manager {
+	t.Helper()
+	m, err := NewManager(&config.Config{Cluster: config.ClusterConfig{
+		Enabled: true, NodeID: nodeID, GRPCTLSCert: cert, GRPCTLSKey: key, GRPCTLSCA: cert,
+	}})
+	require.NoError(t, err)
+	require.NoError(t, m.StartGRPCServer(0))
+	t.Cleanup(m.StopGRPCServer)
+	return m
+}
+
+// localAddr returns the localhost address of a manager's gRPC server, which
+// the test certificate is valid for
+func localAddr(t *testing.T, m *Manager) string {
+	t.Helper()
+	_, port, err := net.SplitHostPort(m.GRPCAddr())
+	require.NoError(t, err)
+	return net.JoinHostPort("localhost", port)
+}
+
+func TestManager_ForwardSearch_TLS(t *testing.T) {
+	cert, key := writeTestCert(t)
+	owner := newTLSManager(t, "node-1", cert, key)
+	origin := newTLSManager(t, "node-2", cert, key)
+	origin.config.Cluster.Peers = []string{localAddr(t, owner)}
+	assert.True(t, origin.SecureTransport())
+
+	var header map[string]string
+	owner.SetSearchHandler(func(ctx context.Context, req *ForwardSearchRequest, from string) *ForwardSearchResponse {
+		header = req.Header
+		return &ForwardSearchResponse{Status: http.StatusOK}
+	})
+
+	resp, err := origin.ForwardSearch(context.Background(), &ForwardSearchRequest{
+		Index:  "products",
+		Header: map[string]string{"X-API-Key": "secret"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.Equal(t, "secret", header["X-API-Key"])
+
+	// A node without a certificate can't reach the TLS server
+	plain, err := NewManager(&config.Config{Cluster: config.ClusterConfig{
+		Enabled: true, NodeID: "node-3", Peers: []string{localAddr(t, owner)},
+	}})
+	require.NoError(t, err)
+	t.Cleanup(plain.closePeerConns)
+	assert.False(t, plain.SecureTransport())
+	_, err = plain.ForwardSearch(context.Background(), &ForwardSearchRequest{Index: "products"})
+	assert.Error(t, err)
+}
+
+func TestServerCredentials_RequireKeyPair(t *testing.T) {
+	cert, _ := writeTestCert(t)
+	_, err := serverCredentials(config.ClusterConfig{GRPCTLSCert: cert})
+	assert.Error(t, err)
+	_, err = peerCredentials(config.ClusterConfig{GRPCTLSCert: cert})
+	assert.Error(t, err)
+}
+
+func TestStartGRPCServer_OnlyServesForwardSearch(t *testing.T) {
+	m := newForwardingManager(t, "node-1")
+	conn, err := grpc.NewClient(m.GRPCAddr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Joining would add the caller as a Raft voter without authentication
+	err = conn.Invoke(context.Background(), "/"+clusterServiceName+"/JoinCluster",
+		&JoinRequest{NodeID: "intruder", Address: "10.0.0.1:7946"}, &JoinResponse{}, grpc.ForceCodec(jsonCodec{}))
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
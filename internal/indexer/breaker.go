@@ -0,0 +1,224 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/davidschrooten/open-atlas-search/internal/mongodb"
+)
+
+// ErrCircuitOpen is returned instead of calling MongoDB while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("MongoDB circuit breaker is open")
+
+// States of the MongoDB circuit breaker
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed = "closed"
+	// BreakerOpen fails every call without calling MongoDB until the cooldown ends
+	BreakerOpen = "open"
+	// BreakerHalfOpen lets a single trial call through, closing the breaker if it succeeds
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerStatus is the state of the MongoDB circuit breaker
+type BreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Trips               int64      `json:"trips"`              // Times the breaker has opened
+	OpenedAt            *time.Time `json:"openedAt,omitempty"` // When the breaker last opened, while it isn't closed
+}
+
+// circuitBreaker stops calls to MongoDB after threshold consecutive failures,
+// so a struggling server isn't hammered by every poller and the logs aren't
+// flooded with the same error. After cooldown a single trial call is let
+// through; it closes the breaker if it succeeds and opens it again if not.
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time // Replaced by tests to end the cooldown
+	state     string
+	failures  int // Consecutive failures
+	trips     int64
+	openedAt  time.Time
+	trial     bool // Whether the half-open trial call is in flight
+}
+
+// newCircuitBreaker creates a closed breaker opening after threshold
+// consecutive failures for cooldown
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     BreakerClosed,
+	}
+}
+
+// do calls call unless the breaker is open, recording whether it failed
+func (b *circuitBreaker) do(call func() error) error {
+	if !b.allow() {
+		return ErrCircuitOpen
+	}
+	err := call()
+	b.record(err)
+	return err
+}
+
+// allow reports whether a call may go through, moving an open breaker to half
+// open once its cooldown has ended
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		log.Printf("MongoDB circuit breaker is half open, trying a call")
+	}
+
+	// Half open: only the trial call goes through
+	if b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record updates the breaker with the outcome of a call. Cancelled calls say
+// nothing about MongoDB's health and are ignored.
+func (b *circuitBreaker) record(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trial = false
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	if err == nil {
+		if b.state != BreakerClosed {
+			log.Printf("MongoDB circuit breaker closed")
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			b.trips++
+			log.Printf("MongoDB circuit breaker opened after %d consecutive failures, pausing MongoDB calls for %v: %v", b.failures, b.cooldown, err)
+		}
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// status returns the current state of the breaker
+func (b *circuitBreaker) status() BreakerStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Trips:               b.trips,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// breakerSource calls MongoDB through a circuit breaker. Ping and Reconnect
+// bypass it so the connection can still be checked and replaced while it is
+// open; errors while iterating a returned cursor aren't counted.
+type breakerSource struct {
+	mongoSource
+	breaker *circuitBreaker
+}
+
+func (s *breakerSource) FindDocuments(collection string, filter bson.M, limit int64) (cursor *mongodb.Cursor, err error) {
+	err = s.breaker.do(func() error {
+		cursor, err = s.mongoSource.FindDocuments(collection, filter, limit)
+		return err
+	})
+	return cursor, err
+}
+
+func (s *breakerSource) FindDocumentsSince(collection string, filter bson.M, timestampField string, since time.Time, limit int64) (cursor *mongodb.Cursor, err error) {
+	err = s.breaker.do(func() error {
+		cursor, err = s.mongoSource.FindDocumentsSince(collection, filter, timestampField, since, limit)
+		return err
+	})
+	return cursor, err
+}
+
+func (s *breakerSource) TailDocuments(collection string, filter bson.M, timestampField string, since time.Time) (cursor *mongodb.Cursor, err error) {
+	err = s.breaker.do(func() error {
+		cursor, err = s.mongoSource.TailDocuments(collection, filter, timestampField, since)
+		return err
+	})
+	return cursor, err
+}
+
+func (s *breakerSource) IsCapped(collection string) (capped bool, err error) {
+	err = s.breaker.do(func() error {
+		capped, err = s.mongoSource.IsCapped(collection)
+		return err
+	})
+	return capped, err
+}
+
+func (s *breakerSource) CountDocuments(collection string, filter bson.M) (count int64, err error) {
+	err = s.breaker.do(func() error {
+		count, err = s.mongoSource.CountDocuments(collection, filter)
+		return err
+	})
+	return count, err
+}
+
+func (s *breakerSource) GetLastDocumentTimestamp(collection, timestampField string) (timestamp time.Time, err error) {
+	err = s.breaker.do(func() error {
+		timestamp, err = s.mongoSource.GetLastDocumentTimestamp(collection, timestampField)
+		return err
+	})
+	return timestamp, err
+}
+
+func (s *breakerSource) CheckTimestampField(collection, timestampField string) (exists bool, err error) {
+	err = s.breaker.do(func() error {
+		exists, err = s.mongoSource.CheckTimestampField(collection, timestampField)
+		return err
+	})
+	return exists, err
+}
+
+func (s *breakerSource) AddTimestampField(collection, timestampField string) error {
+	return s.breaker.do(func() error {
+		return s.mongoSource.AddTimestampField(collection, timestampField)
+	})
+}
+
+// MongoBreaker returns the state of the MongoDB circuit breaker. The boolean
+// is false when mongodb.breaker_threshold disables the breaker.
+func (s *Service) MongoBreaker() (BreakerStatus, bool) {
+	if s.breaker == nil {
+		return BreakerStatus{}, false
+	}
+	return s.breaker.status(), true
+}
@@ -0,0 +1,126 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/davidschrooten/open-atlas-search/internal/mongodb"
+)
+
+// failingMongo is a fakeMongo whose queries fail with err while it is set,
+// counting the queries that reach it
+type failingMongo struct {
+	fakeMongo
+	err   error
+	calls int
+}
+
+func (f *failingMongo) FindDocumentsSince(collection string, filter bson.M, timestampField string, since time.Time, limit int64) (*mongodb.Cursor, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.fakeMongo.FindDocumentsSince(collection, filter, timestampField, since, limit)
+}
+
+func (f *failingMongo) CountDocuments(collection string, filter bson.M) (int64, error) {
+	f.calls++
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.fakeMongo.CountDocuments(collection, filter)
+}
+
+func TestService_MongoBreaker(t *testing.T) {
+	s := newPollingTestService(t, nil)
+	fake := &failingMongo{
+		fakeMongo: fakeMongo{docs: []bson.M{{"_id": "doc1", "name": "widget", "updated_at": time.Now().Add(time.Hour)}}},
+		err:       errors.New("connection refused"),
+	}
+	now := time.Now()
+	s.breaker = newCircuitBreaker(3, time.Minute)
+	s.breaker.now = func() time.Time { return now }
+	s.mongoClient = &breakerSource{mongoSource: fake, breaker: s.breaker}
+
+	// Consecutive failures open the breaker
+	for i := 0; i < 3; i++ {
+		if _, err := s.performPoll(context.Background(), s.config.Indexes[0]); !errors.Is(err, fake.err) {
+			t.Fatalf("Poll %d: expected the MongoDB error, got %v", i, err)
+		}
+	}
+	status, enabled := s.MongoBreaker()
+	if !enabled || status.State != BreakerOpen || status.Trips != 1 || status.OpenedAt == nil {
+		t.Fatalf("Expected the breaker to open after 3 failures, got %+v (enabled %t)", status, enabled)
+	}
+
+	// Calls short-circuit while it is open
+	if _, err := s.performPoll(context.Background(), s.config.Indexes[0]); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected polls to fail with ErrCircuitOpen, got %v", err)
+	}
+	if _, err := s.mongoClient.CountDocuments("products", nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected counts to fail with ErrCircuitOpen, got %v", err)
+	}
+	if fake.calls != 3 {
+		t.Errorf("Expected no calls to reach MongoDB while open, got %d in total", fake.calls)
+	}
+
+	// A failed trial after the cooldown opens it again
+	now = now.Add(time.Minute)
+	if _, err := s.performPoll(context.Background(), s.config.Indexes[0]); !errors.Is(err, fake.err) {
+		t.Errorf("Expected the trial call to reach MongoDB, got %v", err)
+	}
+	if status, _ := s.MongoBreaker(); status.State != BreakerOpen || fake.calls != 4 {
+		t.Errorf("Expected a failed trial to reopen the breaker after 4 calls, got %+v after %d", status, fake.calls)
+	}
+
+	// A successful trial closes it
+	now = now.Add(time.Minute)
+	fake.err = nil
+	if count, err := s.performPoll(context.Background(), s.config.Indexes[0]); err != nil || count != 1 {
+		t.Errorf("Expected the trial poll to read the document, got %d (%v)", count, err)
+	}
+	status, _ = s.MongoBreaker()
+	if status.State != BreakerClosed || status.ConsecutiveFailures != 0 || status.OpenedAt != nil {
+		t.Errorf("Expected a successful trial to close the breaker, got %+v", status)
+	}
+}
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(1, time.Second)
+	breaker.now = func() time.Time { return now }
+
+	breaker.record(errors.New("timeout"))
+	if breaker.allow() {
+		t.Fatal("Expected the breaker to be open")
+	}
+
+	// Only one trial call goes through once the cooldown ends
+	now = now.Add(time.Second)
+	if !breaker.allow() {
+		t.Fatal("Expected the trial call to be allowed")
+	}
+	if breaker.allow() {
+		t.Error("Expected calls during the trial to be rejected")
+	}
+	if status := breaker.status(); status.State != BreakerHalfOpen {
+		t.Errorf("Expected the breaker to be half open, got %s", status.State)
+	}
+
+	// A cancelled trial doesn't count, letting the next call try again
+	breaker.record(context.Canceled)
+	if !breaker.allow() {
+		t.Error("Expected another trial call after a cancelled one")
+	}
+}
+
+func TestService_MongoBreaker_Disabled(t *testing.T) {
+	s := newPollingTestService(t, nil)
+	if _, enabled := s.MongoBreaker(); enabled {
+		t.Error("Expected no breaker without mongodb.breaker_threshold")
+	}
+}
@@ -0,0 +1,114 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Document ID strategies selectable per index with id_strategy
+const (
+	// IDStrategyHex renders ObjectIDs as hex strings and other values with %v (default)
+	IDStrategyHex = "hex"
+	// IDStrategyString renders every value with %v
+	IDStrategyString = "string"
+	// IDStrategyJSON serializes the normalized value as JSON with sorted keys, so
+	// structured IDs produce stable strings
+	IDStrategyJSON = "json"
+	// IDStrategyHash uses the hex SHA-256 of the JSON form, giving fixed-length IDs
+	IDStrategyHash = "hash"
+)
+
+// validateIDStrategy checks that strategy is empty or a known ID strategy
+func validateIDStrategy(strategy string) error {
+	switch strategy {
+	case "", IDStrategyHex, IDStrategyString, IDStrategyJSON, IDStrategyHash:
+		return nil
+	default:
+		return fmt.Errorf("unknown id_strategy %q (expected hex, string, json or hash)", strategy)
+	}
+}
+
+// documentID derives the search document ID from a MongoDB ID value
+func documentID(value interface{}, strategy string) (string, error) {
+	switch strategy {
+	case "", IDStrategyHex:
+		if id, ok := value.(primitive.ObjectID); ok {
+			return id.Hex(), nil
+		}
+		return fmt.Sprintf("%v", value), nil
+	case IDStrategyString:
+		return fmt.Sprintf("%v", value), nil
+	case IDStrategyJSON:
+		return jsonDocumentID(value)
+	case IDStrategyHash:
+		id, err := jsonDocumentID(value)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256([]byte(id))
+		return hex.EncodeToString(sum[:]), nil
+	default:
+		return "", validateIDStrategy(strategy)
+	}
+}
+
+// jsonDocumentID serializes an ID value deterministically. BSON values are
+// normalized first and encoding/json sorts map keys, so equal IDs always
+// produce the same string.
+func jsonDocumentID(value interface{}) (string, error) {
+	data, err := json.Marshal(normalizeValue(value))
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize document ID: %w", err)
+	}
+	return string(data), nil
+}
+
+// assignDocumentID replaces the ID field of doc with its derived string ID and
+// mirrors it into _id, which is what the search index is keyed on
+func assignDocumentID(doc map[string]interface{}, idField, strategy string) error {
+	value, exists := doc[idField]
+	if !exists {
+		return fmt.Errorf("document missing ID field '%s'", idField)
+	}
+
+	id, err := documentID(value, strategy)
+	if err != nil {
+		return err
+	}
+
+	doc[idField] = id
+	if idField != "_id" {
+		doc["_id"] = id
+	}
+	return nil
+}
+
+// sourceIDField returns the ID field an index leaves out of the stored
+// document with exclude_id_from_source, or "" if it keeps it. Bleve never
+// returns _id as a stored field, so this only matters for a custom id_field.
+func (s *Service) sourceIDField(indexName string) string {
+	for _, indexCfg := range s.config.Indexes {
+		if indexCfg.Name == indexName && indexCfg.ExcludeIDFromSource {
+			if indexCfg.IDField == "" {
+				return "_id"
+			}
+			return indexCfg.IDField
+		}
+	}
+	return ""
+}
+
+// withoutField returns a copy of doc without field
+func withoutField(doc map[string]interface{}, field string) map[string]interface{} {
+	stripped := make(map[string]interface{}, len(doc))
+	for name, value := range doc {
+		if name != field {
+			stripped[name] = value
+		}
+	}
+	return stripped
+}
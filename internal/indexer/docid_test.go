@@ -0,0 +1,138 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+	"github.com/davidschrooten/open-atlas-search/internal/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDocumentID_Strategies(t *testing.T) {
+	objectID, err := primitive.ObjectIDFromHex("65e1c2a0f1d2c3b4a5968778")
+	if err != nil {
+		t.Fatalf("Failed to parse ObjectID: %v", err)
+	}
+
+	tests := []struct {
+		strategy string
+		value    interface{}
+		expected string
+	}{
+		{"", objectID, "65e1c2a0f1d2c3b4a5968778"},
+		{IDStrategyHex, objectID, "65e1c2a0f1d2c3b4a5968778"},
+		{IDStrategyHex, int32(42), "42"},
+		{IDStrategyString, "sku-1", "sku-1"},
+		{IDStrategyString, objectID, `ObjectID("65e1c2a0f1d2c3b4a5968778")`},
+		{IDStrategyJSON, "sku-1", `"sku-1"`},
+		{IDStrategyJSON, bson.M{"tenant": "acme", "seq": int32(7)}, `{"seq":7,"tenant":"acme"}`},
+		{IDStrategyJSON, bson.M{"owner": objectID}, `{"owner":"65e1c2a0f1d2c3b4a5968778"}`},
+	}
+
+	for _, tt := range tests {
+		id, err := documentID(tt.value, tt.strategy)
+		if err != nil {
+			t.Fatalf("documentID(%v, %q) failed: %v", tt.value, tt.strategy, err)
+		}
+		if id != tt.expected {
+			t.Errorf("documentID(%v, %q) = %s, expected %s", tt.value, tt.strategy, id, tt.expected)
+		}
+	}
+}
+
+func TestDocumentID_MapIDStableAndUnique(t *testing.T) {
+	for _, strategy := range []string{IDStrategyJSON, IDStrategyHash} {
+		// Same logical ID built with different insertion orders and BSON types
+		first, err := documentID(bson.M{"tenant": "acme", "seq": int32(7)}, strategy)
+		if err != nil {
+			t.Fatalf("documentID failed: %v", err)
+		}
+		for i := 0; i < 20; i++ {
+			again, err := documentID(bson.D{{Key: "seq", Value: int32(7)}, {Key: "tenant", Value: "acme"}}, strategy)
+			if err != nil {
+				t.Fatalf("documentID failed: %v", err)
+			}
+			if again != first {
+				t.Errorf("Expected stable %s ID %s, got %s", strategy, first, again)
+			}
+		}
+
+		other, err := documentID(bson.M{"tenant": "acme", "seq": int32(8)}, strategy)
+		if err != nil {
+			t.Fatalf("documentID failed: %v", err)
+		}
+		if other == first {
+			t.Errorf("Expected distinct %s IDs for different map IDs, both were %s", strategy, first)
+		}
+	}
+
+	hashed, _ := documentID(bson.M{"tenant": "acme", "seq": int32(7)}, IDStrategyHash)
+	if len(hashed) != 64 {
+		t.Errorf("Expected 64 character hash ID, got %q", hashed)
+	}
+}
+
+func TestAssignDocumentID(t *testing.T) {
+	doc := map[string]interface{}{"sku": bson.M{"region": "eu", "code": "A1"}, "name": "widget"}
+	if err := assignDocumentID(doc, "sku", IDStrategyJSON); err != nil {
+		t.Fatalf("assignDocumentID failed: %v", err)
+	}
+	expected := `{"code":"A1","region":"eu"}`
+	if doc["sku"] != expected || doc["_id"] != expected {
+		t.Errorf("Expected sku and _id to be %s, got %v and %v", expected, doc["sku"], doc["_id"])
+	}
+
+	if err := assignDocumentID(map[string]interface{}{"name": "no id"}, "_id", IDStrategyHex); err == nil {
+		t.Error("Expected error for document missing its ID field")
+	}
+}
+
+func TestValidateIDStrategy(t *testing.T) {
+	for _, strategy := range []string{"", IDStrategyHex, IDStrategyString, IDStrategyJSON, IDStrategyHash} {
+		if err := validateIDStrategy(strategy); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", strategy, err)
+		}
+	}
+	if err := validateIDStrategy("uuid"); err == nil {
+		t.Error("Expected error for unknown id_strategy")
+	}
+}
+
+func TestService_ExcludeIDFromSource(t *testing.T) {
+	for _, bulk := range []bool{true, false} {
+		for _, exclude := range []bool{true, false} {
+			s := newTestService(t, config.SearchConfig{BulkIndexing: bulk})
+			s.config.Indexes[0].IDField = "sku"
+			s.config.Indexes[0].ExcludeIDFromSource = exclude
+
+			doc := map[string]interface{}{"sku": "sku-1", "name": "widget"}
+			if err := assignDocumentID(doc, "sku", ""); err != nil {
+				t.Fatalf("Failed to assign document ID: %v", err)
+			}
+			s.indexBatch("products", "shop.products", []map[string]interface{}{doc})
+
+			result, err := s.searchEngine.Search(search.SearchRequest{
+				Index: "products",
+				Query: map[string]interface{}{"text": map[string]interface{}{"query": "widget", "path": "name"}},
+				Size:  10,
+			})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if len(result.Hits) != 1 || result.Hits[0].ID != "sku-1" {
+				t.Fatalf("Expected hit sku-1 (bulk=%v, exclude=%v), got %+v", bulk, exclude, result.Hits)
+			}
+			source := result.Hits[0].Source
+			if _, inSource := source["sku"]; inSource == exclude {
+				t.Errorf("Expected sku in source to be %v (bulk=%v, exclude=%v), got %v", !exclude, bulk, exclude, source)
+			}
+			if _, inSource := source["_id"]; inSource {
+				t.Errorf("Expected _id never to be in source, got %v", source)
+			}
+			if source["name"] != "widget" {
+				t.Errorf("Expected the other fields in source, got %v", source)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// validateTTL checks that ttl_field and ttl are set together
+func validateTTL(indexCfg config.IndexConfig) error {
+	switch {
+	case indexCfg.TTL < 0:
+		return fmt.Errorf("ttl must be a non-negative number of seconds, got %d", indexCfg.TTL)
+	case indexCfg.TTL > 0 && indexCfg.TTLField == "":
+		return fmt.Errorf("ttl requires a ttl_field")
+	case indexCfg.TTLField != "" && indexCfg.TTL == 0:
+		return fmt.Errorf("ttl_field %s requires a ttl", indexCfg.TTLField)
+	}
+	return nil
+}
+
+// sweepExpiredDocuments deletes expired documents every ttl_sweep_interval
+// seconds until the service stops
+func (s *Service) sweepExpiredDocuments(ctx context.Context) {
+	defer s.wg.Done()
+
+	s.deleteExpired()
+
+	ticker := time.NewTicker(time.Duration(s.config.Search.TTLSweepInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.deleteExpired()
+
+		case <-ctx.Done():
+			return
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// deleteExpired deletes the documents of each index with a ttl whose
+// ttl_field is more than ttl seconds in the past
+func (s *Service) deleteExpired() {
+	now := time.Now()
+	for _, indexCfg := range s.config.Indexes {
+		if indexCfg.TTLField == "" || indexCfg.TTL <= 0 {
+			continue
+		}
+
+		cutoff := now.Add(-time.Duration(indexCfg.TTL) * time.Second)
+		deleted, err := s.searchEngine.DeleteExpired(indexCfg.Name, indexCfg.TTLField, cutoff)
+		if err != nil {
+			log.Printf("Failed to delete expired documents from index %s: %v", indexCfg.Name, err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("Deleted %d expired documents from index %s", deleted, indexCfg.Name)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+func TestValidateTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   string
+		ttl     int
+		wantErr bool
+	}{
+		{"unset", "", 0, false},
+		{"set", "created_at", 3600, false},
+		{"missing ttl", "created_at", 0, true},
+		{"missing field", "", 3600, true},
+		{"negative", "created_at", -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTTL(config.IndexConfig{TTLField: tt.field, TTL: tt.ttl})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateTTL(%q, %d) error = %v, wantErr %t", tt.field, tt.ttl, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_SweepsExpiredDocuments(t *testing.T) {
+	s := newPollingTestService(t, nil)
+	s.config.Search.TTLSweepInterval = 1
+	s.config.Indexes[0].TTLField = "last_seen"
+	s.config.Indexes[0].TTL = 3600
+
+	now := time.Now().UTC()
+	docs := map[string]time.Time{
+		"expired":     now.Add(-2 * time.Hour),
+		"just-active": now.Add(-50 * time.Minute),
+		"active":      now,
+		"future":      now.Add(time.Hour),
+	}
+	for id, lastSeen := range docs {
+		doc := map[string]interface{}{"name": id, "last_seen": lastSeen.Format(time.RFC3339)}
+		if err := s.searchEngine.IndexDocument("products", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start service: %v", err)
+	}
+	defer s.Stop()
+
+	// Wait for the sweeper to delete the expired document
+	deadline := time.Now().Add(5 * time.Second)
+	for docCount(t, s) == uint64(len(docs)) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the sweeper to delete the expired document")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for id := range docs {
+		_, found, err := s.searchEngine.GetStoredField("products", id, "name")
+		if err != nil {
+			t.Fatalf("Failed to load document %s: %v", id, err)
+		}
+		if wantFound := id != "expired"; found != wantFound {
+			t.Errorf("Document %s: expected found %t, got %t", id, wantFound, found)
+		}
+	}
+	if count := docCount(t, s); count != uint64(len(docs)-1) {
+		t.Errorf("Expected 1 expired document deleted, got %d documents left", count)
+	}
+}
@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// defaultPollInterval is how often an index is polled when neither its
+// poll_interval nor its refresh interval is set
+const defaultPollInterval = 5 * time.Second
+
+// ticker delivers ticks on C until stopped, like *time.Ticker
+type ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// timeTicker adapts *time.Ticker to ticker
+type timeTicker struct {
+	*time.Ticker
+}
+
+func (t timeTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// newTicker starts the tickers driving polling and refreshing, replaced in tests
+var newTicker = func(interval time.Duration) ticker {
+	return timeTicker{time.NewTicker(interval)}
+}
+
+// validateIntervals checks that an index's intervals aren't negative and that
+// it isn't polled less often than its buffered documents are committed, which
+// would leave most refreshes with nothing to commit
+func validateIntervals(indexCfg config.IndexConfig, searchCfg config.SearchConfig) error {
+	if indexCfg.PollInterval < 0 {
+		return fmt.Errorf("invalid poll_interval %d: must not be negative", indexCfg.PollInterval)
+	}
+	if indexCfg.RefreshInterval < 0 {
+		return fmt.Errorf("invalid refresh_interval %d: must not be negative", indexCfg.RefreshInterval)
+	}
+	if searchCfg.FlushInterval < 0 {
+		return fmt.Errorf("invalid flush_interval %d: must not be negative", searchCfg.FlushInterval)
+	}
+
+	refresh := refreshInterval(indexCfg, searchCfg)
+	poll := time.Duration(indexCfg.PollInterval) * time.Second
+	if poll > 0 && refresh > 0 && poll > refresh {
+		return fmt.Errorf("poll_interval %v is longer than refresh interval %v: polling must be at least as frequent as refreshing", poll, refresh)
+	}
+	return nil
+}
+
+// refreshInterval returns how often an index's buffered documents are
+// committed: its refresh_interval, or else flush_interval. Zero means polled
+// documents are committed right away.
+func refreshInterval(indexCfg config.IndexConfig, searchCfg config.SearchConfig) time.Duration {
+	if indexCfg.RefreshInterval > 0 {
+		return time.Duration(indexCfg.RefreshInterval) * time.Second
+	}
+	return time.Duration(max(searchCfg.FlushInterval, 0)) * time.Second
+}
+
+// pollInterval returns how often an index is polled for changes: its
+// poll_interval, or half its refresh interval (at least a second), or else
+// defaultPollInterval
+func (s *Service) pollInterval(indexCfg config.IndexConfig) time.Duration {
+	if indexCfg.PollInterval > 0 {
+		return time.Duration(indexCfg.PollInterval) * time.Second
+	}
+	if refresh := refreshInterval(indexCfg, s.config.Search); refresh > 0 {
+		return max(refresh/2, time.Second)
+	}
+	return defaultPollInterval
+}
+
+// refreshIntervalOf returns the refresh interval of an index by name
+func (s *Service) refreshIntervalOf(indexName string) time.Duration {
+	for _, indexCfg := range s.config.Indexes {
+		if indexCfg.Name == indexName {
+			return refreshInterval(indexCfg, s.config.Search)
+		}
+	}
+	return refreshInterval(config.IndexConfig{}, s.config.Search)
+}
+
+// refreshRoutine commits the buffered documents of an index every interval
+// until the service stops
+func (s *Service) refreshRoutine(ctx context.Context, indexName string, interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := newTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			s.flushBuffer(indexName)
+
+		case <-ctx.Done():
+			return
+		case <-s.stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package indexer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// fakeTicker ticks only when the test sends on it
+type fakeTicker struct {
+	interval time.Duration
+	ticks    chan time.Time
+}
+
+func (f *fakeTicker) C() <-chan time.Time {
+	return f.ticks
+}
+
+func (f *fakeTicker) Stop() {}
+
+// fakeClock replaces newTicker for the duration of a test, recording the
+// tickers started by the service
+type fakeClock struct {
+	mutex   sync.Mutex
+	tickers []*fakeTicker
+}
+
+func useFakeClock(t *testing.T) *fakeClock {
+	t.Helper()
+	clock := &fakeClock{}
+	previous := newTicker
+	newTicker = func(interval time.Duration) ticker {
+		clock.mutex.Lock()
+		defer clock.mutex.Unlock()
+		ticker := &fakeTicker{interval: interval, ticks: make(chan time.Time)}
+		clock.tickers = append(clock.tickers, ticker)
+		return ticker
+	}
+	t.Cleanup(func() { newTicker = previous })
+	return clock
+}
+
+// ticker waits for the service to start a ticker with interval
+func (c *fakeClock) ticker(t *testing.T, interval time.Duration) *fakeTicker {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mutex.Lock()
+		for _, ticker := range c.tickers {
+			if ticker.interval == interval {
+				c.mutex.Unlock()
+				return ticker
+			}
+		}
+		c.mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected a ticker with interval %v", interval)
+	return nil
+}
+
+// intervals returns the intervals of the tickers started so far
+func (c *fakeClock) intervals() []time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	intervals := make([]time.Duration, len(c.tickers))
+	for i, ticker := range c.tickers {
+		intervals[i] = ticker.interval
+	}
+	return intervals
+}
+
+func TestValidateIntervals(t *testing.T) {
+	tests := []struct {
+		name      string
+		poll      int
+		refresh   int
+		flush     int
+		wantError string
+	}{
+		{name: "defaults", flush: 30},
+		{name: "poll faster than refresh", poll: 5, refresh: 10, flush: 30},
+		{name: "poll as fast as refresh", poll: 10, refresh: 10},
+		{name: "poll without refresh", poll: 60},
+		{name: "poll slower than refresh", poll: 20, refresh: 10, wantError: "polling must be at least as frequent as refreshing"},
+		{name: "poll slower than flush", poll: 60, flush: 30, wantError: "polling must be at least as frequent as refreshing"},
+		{name: "negative poll", poll: -1, wantError: "invalid poll_interval"},
+		{name: "negative refresh", refresh: -1, wantError: "invalid refresh_interval"},
+		{name: "negative flush", flush: -1, wantError: "invalid flush_interval"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexCfg := config.IndexConfig{Name: "products", PollInterval: tt.poll, RefreshInterval: tt.refresh}
+			err := validateIntervals(indexCfg, config.SearchConfig{FlushInterval: tt.flush})
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestService_PollInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		poll    int
+		refresh int
+		flush   int
+		want    time.Duration
+	}{
+		{name: "poll_interval", poll: 3, refresh: 10, flush: 30, want: 3 * time.Second},
+		{name: "half the refresh_interval", refresh: 10, flush: 30, want: 5 * time.Second},
+		{name: "half the flush_interval", flush: 30, want: 15 * time.Second},
+		{name: "at least a second", refresh: 1, want: time.Second},
+		{name: "default", want: defaultPollInterval},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{config: &config.Config{Search: config.SearchConfig{FlushInterval: tt.flush}}}
+			indexCfg := config.IndexConfig{PollInterval: tt.poll, RefreshInterval: tt.refresh}
+			if got := s.pollInterval(indexCfg); got != tt.want {
+				t.Errorf("Expected poll interval %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestService_Start_IntervalsDriveTickers(t *testing.T) {
+	clock := useFakeClock(t)
+	s := newPollingTestService(t, nil)
+	s.config.Search.BulkIndexing = true
+	s.config.Search.IndexBufferSize = 1000
+	s.config.Search.FlushInterval = 30
+	s.config.Indexes[0].PollInterval = 3
+	s.config.Indexes[0].RefreshInterval = 7
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start service: %v", err)
+	}
+	defer s.Stop()
+
+	// The index is polled and refreshed on its own tickers; flush_interval is
+	// overridden by refresh_interval
+	clock.ticker(t, 3*time.Second)
+	refresh := clock.ticker(t, 7*time.Second)
+	for _, interval := range clock.intervals() {
+		if interval == 30*time.Second {
+			t.Error("Expected refresh_interval to override flush_interval")
+		}
+	}
+
+	s.bufferDocuments("products", "shop.products", makeDocs(0, 4), time.Time{})
+	if count := docCount(t, s); count != 0 {
+		t.Fatalf("Expected documents to stay buffered until the refresh tick, got %d", count)
+	}
+
+	refresh.ticks <- time.Now()
+	deadline := time.Now().Add(5 * time.Second)
+	for docCount(t, s) != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the refresh tick to commit the buffered documents, got %d", docCount(t, s))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestService_Start_WithoutRefreshInterval(t *testing.T) {
+	clock := useFakeClock(t)
+	s := newPollingTestService(t, nil)
+	s.config.Search.BulkIndexing = true
+	s.config.Search.IndexBufferSize = 1000
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start service: %v", err)
+	}
+	defer s.Stop()
+
+	clock.ticker(t, defaultPollInterval)
+	if intervals := clock.intervals(); len(intervals) != 1 {
+		t.Errorf("Expected only a poll ticker without a refresh interval, got %v", intervals)
+	}
+
+	// Nothing would flush a buffer, so polled documents are committed right away
+	s.bufferDocuments("products", "shop.products", makeDocs(0, 2), time.Time{})
+	if count := docCount(t, s); count != 2 {
+		t.Errorf("Expected documents to be committed immediately, got %d", count)
+	}
+}
+
+func TestService_FlushBuffer_OnlyFlushesIndex(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{BulkIndexing: true, IndexBufferSize: 1000, FlushInterval: 30})
+	s.bufferDocuments("products", "shop.products", makeDocs(0, 3), time.Time{})
+	s.bufferDocuments("orders", "shop.orders", makeDocs(0, 2), time.Time{})
+
+	s.flushBuffer("products")
+	if count := docCount(t, s); count != 3 {
+		t.Errorf("Expected the products buffer to be committed, got %d documents", count)
+	}
+	if _, buffered := s.bulkBuffer["orders"]; !buffered {
+		t.Error("Expected the orders buffer to wait for its own refresh")
+	}
+}
@@ -0,0 +1,32 @@
+package indexer
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// keepMongoAlive pings MongoDB every interval until the service stops, so the
+// connection isn't left idle long enough for a proxy to drop it between polls.
+// A failed ping re-establishes the connection before the next poll needs it.
+func (s *Service) keepMongoAlive(ctx context.Context, interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.mongoClient.Ping(ctx); err != nil {
+				log.Printf("MongoDB keepalive ping failed: %v", err)
+				s.ensureConnection(ctx)
+			}
+
+		case <-ctx.Done():
+			return
+		case <-s.stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// keepaliveMongo counts pings and reconnects, failing the first failedPings pings
+type keepaliveMongo struct {
+	*fakeMongo
+	failedPings int64
+	pings       atomic.Int64
+	reconnects  atomic.Int64
+}
+
+func (f *keepaliveMongo) Ping(ctx context.Context) error {
+	if f.pings.Add(1) <= f.failedPings {
+		return errors.New("connection closed")
+	}
+	return nil
+}
+
+func (f *keepaliveMongo) Reconnect(ctx context.Context) error {
+	f.reconnects.Add(1)
+	return nil
+}
+
+func TestService_KeepMongoAlive(t *testing.T) {
+	s := newPollingTestService(t, nil)
+	// The keepalive ping and the reconnect check both fail
+	source := &keepaliveMongo{fakeMongo: s.mongoClient.(*fakeMongo), failedPings: 2}
+	s.mongoClient = source
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.wg.Add(1)
+	go s.keepMongoAlive(ctx, 5*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for source.pings.Load() < 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected MongoDB to be pinged periodically")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	s.wg.Wait()
+
+	if reconnects := source.reconnects.Load(); reconnects != 1 {
+		t.Errorf("Expected a failed keepalive ping to reconnect once, got %d reconnects", reconnects)
+	}
+}
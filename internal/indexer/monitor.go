@@ -0,0 +1,75 @@
+package indexer
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// IndexSize is the latest measurement of an index's size
+type IndexSize struct {
+	DiskSizeBytes int64     `json:"diskSizeBytes"`
+	DocCount      uint64    `json:"docCount"`
+	MeasuredAt    time.Time `json:"measuredAt"`
+}
+
+// monitorIndexSizes measures every index every size_check_interval seconds
+// until the service stops
+func (s *Service) monitorIndexSizes(ctx context.Context) {
+	defer s.wg.Done()
+
+	s.measureIndexSizes()
+
+	ticker := time.NewTicker(time.Duration(s.config.Search.SizeCheckInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.measureIndexSizes()
+
+		case <-ctx.Done():
+			return
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// measureIndexSizes records the disk size and document count of each index and
+// logs a warning for indexes larger than max_index_size_bytes
+func (s *Service) measureIndexSizes() {
+	maxBytes := s.config.Search.MaxIndexSizeBytes
+	for _, indexCfg := range s.config.Indexes {
+		stats, err := s.searchEngine.GetIndexStats(indexCfg.Name)
+		if err != nil {
+			log.Printf("Failed to measure size of index %s: %v", indexCfg.Name, err)
+			continue
+		}
+
+		s.sizeMutex.Lock()
+		if s.indexSizes == nil {
+			s.indexSizes = make(map[string]IndexSize)
+		}
+		s.indexSizes[indexCfg.Name] = IndexSize{
+			DiskSizeBytes: stats.DiskSizeBytes,
+			DocCount:      stats.DocCount,
+			MeasuredAt:    time.Now(),
+		}
+		s.sizeMutex.Unlock()
+
+		if maxBytes > 0 && stats.DiskSizeBytes > maxBytes {
+			log.Printf("Warning: index %s is %d bytes on disk with %d documents, exceeding max_index_size_bytes %d", indexCfg.Name, stats.DiskSizeBytes, stats.DocCount, maxBytes)
+		}
+	}
+}
+
+// IndexSize returns the latest size measurement of an index. The boolean is
+// false until the index has been measured.
+func (s *Service) IndexSize(indexName string) (IndexSize, bool) {
+	s.sizeMutex.RLock()
+	defer s.sizeMutex.RUnlock()
+
+	size, exists := s.indexSizes[indexName]
+	return size, exists
+}
@@ -0,0 +1,57 @@
+package indexer
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+func TestService_MeasureIndexSizes_WarnsAboveMaxSize(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	s := newTestService(t, config.SearchConfig{MaxIndexSizeBytes: 1})
+
+	if _, measured := s.IndexSize("products"); measured {
+		t.Error("Expected no size before the first measurement")
+	}
+
+	s.indexBatchIndividual("products", "shop.products", makeDocs(0, 5))
+	s.measureIndexSizes()
+
+	size, measured := s.IndexSize("products")
+	if !measured || size.DocCount != 5 || size.DiskSizeBytes <= 0 {
+		t.Errorf("Expected 5 documents with a positive disk size, got %+v", size)
+	}
+	if warnings := strings.Count(logs.String(), "exceeding max_index_size_bytes"); warnings != 1 {
+		t.Errorf("Expected 1 size warning, got %d", warnings)
+	}
+	if !strings.Contains(logs.String(), "index products is") || !strings.Contains(logs.String(), "exceeding max_index_size_bytes 1") {
+		t.Errorf("Expected a size warning in the log, got %q", logs.String())
+	}
+}
+
+func TestService_MeasureIndexSizes_NoWarningBelowMaxSize(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	for _, maxBytes := range []int64{0, 1 << 40} {
+		logs.Reset()
+		s := newTestService(t, config.SearchConfig{MaxIndexSizeBytes: maxBytes})
+		s.indexBatchIndividual("products", "shop.products", makeDocs(0, 5))
+		s.measureIndexSizes()
+
+		if strings.Contains(logs.String(), "exceeding max_index_size_bytes") {
+			t.Errorf("Expected no size warning with max_index_size_bytes %d, got %q", maxBytes, logs.String())
+		}
+		if _, measured := s.IndexSize("products"); !measured {
+			t.Errorf("Expected the index to be measured with max_index_size_bytes %d", maxBytes)
+		}
+	}
+}
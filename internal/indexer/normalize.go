@@ -0,0 +1,148 @@
+package indexer
+
+import (
+	"encoding/base64"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// normalizeBSON recursively converts BSON values in a document into JSON-friendly
+// Go values that Bleve indexes predictably:
+//
+//   - bson.M / map[string]interface{} and bson.D -> map[string]interface{}
+//   - bson.A / []interface{}                     -> []interface{}
+//   - primitive.ObjectID                         -> hex string
+//   - primitive.DateTime, primitive.Timestamp    -> RFC3339 string (indexed as a date)
+//   - primitive.Decimal128                       -> float64 (string if not representable)
+//   - primitive.Binary                           -> base64 string
+//   - primitive.Regex                            -> "/pattern/options" string
+//   - primitive.Symbol, primitive.JavaScript     -> string
+//   - primitive.Null, primitive.Undefined        -> nil
+//
+// All other values are returned unchanged.
+func normalizeBSON(doc map[string]interface{}) map[string]interface{} {
+	for key, value := range doc {
+		doc[key] = normalizeValue(value)
+	}
+	return doc
+}
+
+// normalizeValue converts a single value, descending into sub-documents and arrays
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.M:
+		return normalizeBSON(v)
+	case map[string]interface{}:
+		return normalizeBSON(v)
+	case primitive.D:
+		doc := make(map[string]interface{}, len(v))
+		for _, elem := range v {
+			doc[elem.Key] = normalizeValue(elem.Value)
+		}
+		return doc
+	case primitive.A:
+		return normalizeArray(v)
+	case []interface{}:
+		return normalizeArray(v)
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0).UTC().Format(time.RFC3339Nano)
+	case primitive.Decimal128:
+		return normalizeDecimal(v)
+	case primitive.Binary:
+		return base64.StdEncoding.EncodeToString(v.Data)
+	case primitive.Regex:
+		return "/" + v.Pattern + "/" + v.Options
+	case primitive.Symbol:
+		return string(v)
+	case primitive.JavaScript:
+		return string(v)
+	case primitive.Null, primitive.Undefined:
+		return nil
+	default:
+		return value
+	}
+}
+
+// normalizeArray converts all elements of an array in place
+func normalizeArray(values []interface{}) []interface{} {
+	for i, value := range values {
+		values[i] = normalizeValue(value)
+	}
+	return values
+}
+
+// truncateFields cuts string values, including those in sub-documents and
+// arrays, down to their first maxLength characters so very long text doesn't
+// slow tokenization or bloat the term dictionary. The document ID is never
+// truncated. It returns the paths of the truncated fields.
+func truncateFields(doc map[string]interface{}, maxLength int) []string {
+	var truncated []string
+	for key, value := range doc {
+		if key == "_id" {
+			continue
+		}
+		var cut bool
+		doc[key], cut = truncateValue(value, maxLength, key, &truncated)
+		if cut {
+			truncated = append(truncated, key)
+		}
+	}
+	sort.Strings(truncated)
+	return slices.Compact(truncated)
+}
+
+// truncateValue truncates a string value, or the strings within a
+// sub-document or array, reporting whether the value itself was a truncated
+// string. Truncated sub-document fields are added to truncated by path.
+func truncateValue(value interface{}, maxLength int, path string, truncated *[]string) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		if utf8.RuneCountInString(v) <= maxLength {
+			return v, false
+		}
+		runes := 0
+		for i := range v {
+			if runes == maxLength {
+				return v[:i], true
+			}
+			runes++
+		}
+		return v, false
+	case map[string]interface{}:
+		for _, field := range truncateFields(v, maxLength) {
+			*truncated = append(*truncated, path+"."+field)
+		}
+		return v, false
+	case []interface{}:
+		cut := false
+		for i, elem := range v {
+			var elemCut bool
+			v[i], elemCut = truncateValue(elem, maxLength, path, truncated)
+			cut = cut || elemCut
+		}
+		return v, cut
+	default:
+		return value, false
+	}
+}
+
+// normalizeDecimal converts a Decimal128 to a float64 so it can be indexed as a number,
+// keeping its string form when the value doesn't fit (NaN, Infinity or out of range)
+func normalizeDecimal(d primitive.Decimal128) interface{} {
+	str := d.String()
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return str
+	}
+	return f
+}
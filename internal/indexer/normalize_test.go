@@ -0,0 +1,228 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+	"github.com/davidschrooten/open-atlas-search/internal/search"
+)
+
+func TestNormalizeBSON_ObjectIDAndDateTime(t *testing.T) {
+	ownerID := primitive.NewObjectID()
+	tagID := primitive.NewObjectID()
+	createdAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	doc := bson.M{
+		"ownerId":   ownerID,
+		"createdAt": primitive.NewDateTimeFromTime(createdAt),
+		"owner": bson.M{
+			"id":       ownerID,
+			"joinedAt": primitive.NewDateTimeFromTime(createdAt),
+		},
+		"tags": bson.A{
+			bson.M{"id": tagID},
+			tagID,
+		},
+		"name": "unchanged",
+	}
+
+	normalized := normalizeBSON(doc)
+
+	if normalized["ownerId"] != ownerID.Hex() {
+		t.Errorf("Expected ownerId %s, got %v", ownerID.Hex(), normalized["ownerId"])
+	}
+	if normalized["createdAt"] != "2024-03-01T12:30:00Z" {
+		t.Errorf("Expected createdAt in RFC3339, got %v", normalized["createdAt"])
+	}
+
+	owner := normalized["owner"].(map[string]interface{})
+	if owner["id"] != ownerID.Hex() {
+		t.Errorf("Expected nested owner.id %s, got %v", ownerID.Hex(), owner["id"])
+	}
+	if owner["joinedAt"] != "2024-03-01T12:30:00Z" {
+		t.Errorf("Expected nested owner.joinedAt in RFC3339, got %v", owner["joinedAt"])
+	}
+
+	tags := normalized["tags"].([]interface{})
+	if tags[0].(map[string]interface{})["id"] != tagID.Hex() {
+		t.Errorf("Expected ObjectID in array sub-document to be converted, got %v", tags[0])
+	}
+	if tags[1] != tagID.Hex() {
+		t.Errorf("Expected ObjectID array element to be converted, got %v", tags[1])
+	}
+
+	if normalized["name"] != "unchanged" {
+		t.Errorf("Expected plain values to be unchanged, got %v", normalized["name"])
+	}
+}
+
+func TestNormalizeBSON_NestedDocumentsAndArrays(t *testing.T) {
+	doc := bson.M{
+		"address": bson.D{
+			{Key: "city", Value: "Amsterdam"},
+			{Key: "geo", Value: bson.M{"lat": 52.37, "lon": 4.89}},
+		},
+		"items": bson.A{
+			bson.M{"sku": "A-1", "qty": int32(2)},
+			bson.D{{Key: "sku", Value: "B-2"}, {Key: "tags", Value: bson.A{"red", "blue"}}},
+		},
+	}
+
+	normalized := normalizeBSON(doc)
+
+	address, ok := normalized["address"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected bson.D to become map[string]interface{}, got %T", normalized["address"])
+	}
+	if address["city"] != "Amsterdam" {
+		t.Errorf("Expected address.city Amsterdam, got %v", address["city"])
+	}
+	geo, ok := address["geo"].(map[string]interface{})
+	if !ok || geo["lat"] != 52.37 {
+		t.Errorf("Expected nested address.geo map, got %v", address["geo"])
+	}
+
+	items, ok := normalized["items"].([]interface{})
+	if !ok || len(items) != 2 {
+		t.Fatalf("Expected bson.A to become []interface{} of length 2, got %T", normalized["items"])
+	}
+	first, ok := items[0].(map[string]interface{})
+	if !ok || first["sku"] != "A-1" {
+		t.Errorf("Expected first item sub-document, got %v", items[0])
+	}
+	second, ok := items[1].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected bson.D array element to become a map, got %T", items[1])
+	}
+	if tags, ok := second["tags"].([]interface{}); !ok || len(tags) != 2 || tags[0] != "red" {
+		t.Errorf("Expected nested tags array, got %v", second["tags"])
+	}
+}
+
+func TestNormalizeBSON_Decimal128AndBinary(t *testing.T) {
+	price, err := primitive.ParseDecimal128("19.99")
+	if err != nil {
+		t.Fatalf("Failed to parse decimal: %v", err)
+	}
+	nan, err := primitive.ParseDecimal128("NaN")
+	if err != nil {
+		t.Fatalf("Failed to parse decimal: %v", err)
+	}
+
+	doc := bson.M{
+		"price":   price,
+		"invalid": nan,
+		"payload": primitive.Binary{Subtype: 0x00, Data: []byte("hello")},
+		"lines": bson.A{
+			bson.M{"amount": price},
+		},
+	}
+
+	normalized := normalizeBSON(doc)
+
+	if normalized["price"] != 19.99 {
+		t.Errorf("Expected Decimal128 to become float64 19.99, got %v (%T)", normalized["price"], normalized["price"])
+	}
+	if normalized["invalid"] != "NaN" {
+		t.Errorf("Expected unrepresentable Decimal128 to stay a string, got %v", normalized["invalid"])
+	}
+	if normalized["payload"] != "aGVsbG8=" {
+		t.Errorf("Expected Binary to become base64 string, got %v", normalized["payload"])
+	}
+
+	lines := normalized["lines"].([]interface{})
+	if lines[0].(map[string]interface{})["amount"] != 19.99 {
+		t.Errorf("Expected Decimal128 in array sub-document to be converted, got %v", lines[0])
+	}
+}
+
+func TestNormalizeBSON_Searchable(t *testing.T) {
+	engine, err := search.NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "orders",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	ownerID := primitive.NewObjectID()
+	createdAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	doc := normalizeBSON(bson.M{
+		"owner": bson.M{
+			"id":        ownerID,
+			"createdAt": primitive.NewDateTimeFromTime(createdAt),
+		},
+	})
+	if err := engine.IndexDocument("orders", "order1", doc); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	result, err := engine.Search(search.SearchRequest{
+		Index: "orders",
+		Query: map[string]interface{}{"term": map[string]interface{}{"value": ownerID.Hex(), "path": "owner.id"}},
+		Size:  10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 1 {
+		t.Errorf("Expected nested ObjectID to match as hex string, got %d hits", result.Total)
+	}
+
+	index, _ := engine.GetIndex("orders")
+	dateQuery := bleve.NewDateRangeQuery(createdAt.Add(-time.Hour), createdAt.Add(time.Hour))
+	dateQuery.SetField("owner.createdAt")
+	dateResult, err := index.Search(bleve.NewSearchRequest(dateQuery))
+	if err != nil {
+		t.Fatalf("Date range search failed: %v", err)
+	}
+	if dateResult.Total != 1 {
+		t.Errorf("Expected nested DateTime to be indexed as a date, got %d hits", dateResult.Total)
+	}
+}
+
+func TestTruncateFields(t *testing.T) {
+	doc := normalizeBSON(bson.M{
+		"_id":   "a-very-long-document-id",
+		"title": "abcdefghij",
+		"short": "abc",
+		"name":  "héllo wörld", // Cut by characters, not bytes
+		"count": 12345678,
+		"owner": bson.M{"bio": "0123456789", "_id": "abcdefghij"},
+		"tags":  bson.A{"abcdefgh", "ab", bson.M{"label": "abcdefgh"}, bson.M{"label": "abcdefghi"}},
+	})
+
+	truncated := truncateFields(doc, 5)
+
+	want := []string{"name", "owner.bio", "tags", "tags.label", "title"}
+	if !reflect.DeepEqual(truncated, want) {
+		t.Errorf("Expected truncated fields %v, got %v", want, truncated)
+	}
+	if doc["title"] != "abcde" || doc["short"] != "abc" || doc["name"] != "héllo" {
+		t.Errorf("Expected strings cut to 5 characters, got %q, %q and %q", doc["title"], doc["short"], doc["name"])
+	}
+	if doc["_id"] != "a-very-long-document-id" || doc["count"] != 12345678 {
+		t.Errorf("Expected the ID and non-string values to be kept, got %v and %v", doc["_id"], doc["count"])
+	}
+	if owner := doc["owner"].(map[string]interface{}); owner["bio"] != "01234" {
+		t.Errorf("Expected nested strings to be cut, got %q", owner["bio"])
+	}
+	tags := doc["tags"].([]interface{})
+	if tags[0] != "abcde" || tags[1] != "ab" || tags[3].(map[string]interface{})["label"] != "abcde" {
+		t.Errorf("Expected strings in arrays to be cut, got %v", tags)
+	}
+}
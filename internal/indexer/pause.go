@@ -0,0 +1,73 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/davidschrooten/open-atlas-search/internal/search"
+)
+
+// ErrIndexPaused is returned for syncing work requested on a paused index
+var ErrIndexPaused = errors.New("indexing is paused")
+
+// ErrPollingNotStarted is returned for syncing work requested on an index
+// whose collection hasn't been polled yet
+var ErrPollingNotStarted = errors.New("polling has not started")
+
+// Pause stops syncing the collection of an index until Resume is called,
+// without touching the index itself. A poll in flight finishes first. The
+// paused state is saved right away so it survives a restart.
+func (s *Service) Pause(indexName string) error {
+	return s.setPaused(indexName, true)
+}
+
+// Resume continues syncing the collection of a paused index from where it
+// stopped; documents changed in the meantime are picked up by the next poll
+func (s *Service) Resume(indexName string) error {
+	return s.setPaused(indexName, false)
+}
+
+// Paused reports whether syncing the collection of an index is paused
+func (s *Service) Paused(indexName string) bool {
+	collectionKey, err := s.collectionKeyOf(indexName)
+	return err == nil && s.syncStateManager.IsPaused(collectionKey)
+}
+
+// setPaused pauses or resumes the collection of an index and saves the state
+func (s *Service) setPaused(indexName string, paused bool) error {
+	collectionKey, err := s.collectionKeyOf(indexName)
+	if err != nil {
+		return err
+	}
+	if s.syncStateManager.GetCollectionState(collectionKey) == nil {
+		return fmt.Errorf("%w for %s", ErrPollingNotStarted, collectionKey)
+	}
+
+	// Wait for a poll in flight so nothing is indexed once Pause returns
+	lock := s.pollLock(collectionKey)
+	lock.Lock()
+	s.syncStateManager.SetPaused(collectionKey, paused)
+	lock.Unlock()
+
+	if paused {
+		log.Printf("Paused syncing %s", collectionKey)
+	} else {
+		log.Printf("Resumed syncing %s", collectionKey)
+	}
+
+	if err := s.syncStateManager.Save(); err != nil {
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	return nil
+}
+
+// collectionKeyOf returns the database.collection key of an index's collection
+func (s *Service) collectionKeyOf(indexName string) (string, error) {
+	for _, indexCfg := range s.config.Indexes {
+		if indexCfg.Name == indexName {
+			return fmt.Sprintf("%s.%s", indexCfg.Database, indexCfg.Collection), nil
+		}
+	}
+	return "", &search.IndexNotFoundError{Index: indexName}
+}
@@ -0,0 +1,99 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+	syncstate "github.com/davidschrooten/open-atlas-search/internal/sync"
+)
+
+func TestService_PauseAndResume(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	s := newPollingTestService(t, []bson.M{
+		{"_id": "doc1", "name": "widget", "updated_at": now.Add(-time.Hour)},
+	})
+	s.syncStateManager.SetLastPollTime("shop.products", now.Add(-2*time.Hour))
+
+	// Keep the state in a file the test can reload
+	statePath := filepath.Join(t.TempDir(), "sync_state.json")
+	state := s.syncStateManager.GetCollectionState("shop.products")
+	s.syncStateManager = syncstate.NewStateManager(statePath)
+	s.syncStateManager.UpdateCollectionState("shop.products", state)
+
+	if err := s.Pause("products"); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	if !s.Paused("products") {
+		t.Fatal("Expected the index to be paused")
+	}
+
+	// Polls are skipped without moving the poll position
+	if count, err := s.performPoll(context.Background(), s.config.Indexes[0]); err != nil || count != 0 {
+		t.Errorf("Expected a paused poll to read nothing, got %d (%v)", count, err)
+	}
+	if indexed := docCount(t, s); indexed != 0 {
+		t.Errorf("Expected nothing to be indexed while paused, got %d", indexed)
+	}
+	if state := s.syncStateManager.GetCollectionState("shop.products"); !state.LastPollTime.Equal(now.Add(-2 * time.Hour)) {
+		t.Errorf("Expected the poll position to stay put while paused, got %v", state.LastPollTime)
+	}
+	if _, err := s.Repoll(context.Background(), "products", now.Add(-24*time.Hour)); !errors.Is(err, ErrIndexPaused) {
+		t.Errorf("Expected re-polling a paused index to fail with ErrIndexPaused, got %v", err)
+	}
+
+	// The paused state is saved right away
+	saved := syncstate.NewStateManager(statePath)
+	if err := saved.Load(); err != nil {
+		t.Fatalf("Failed to load saved state: %v", err)
+	}
+	if !saved.IsPaused("shop.products") {
+		t.Error("Expected the paused state to be saved")
+	}
+
+	if err := s.Resume("products"); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if s.Paused("products") {
+		t.Error("Expected the index to be resumed")
+	}
+	if count, err := s.performPoll(context.Background(), s.config.Indexes[0]); err != nil || count != 1 {
+		t.Errorf("Expected the poll after resuming to read the document changed while paused, got %d (%v)", count, err)
+	}
+	if indexed := docCount(t, s); indexed != 1 {
+		t.Errorf("Expected the document to be indexed after resuming, got %d", indexed)
+	}
+}
+
+func TestService_Pause_SkipsInitialIndexing(t *testing.T) {
+	s := newPollingTestService(t, []bson.M{
+		{"_id": "doc1", "name": "widget"},
+		{"_id": "doc2", "name": "gadget"},
+	})
+	if err := s.Pause("products"); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+
+	s.wg.Add(1)
+	s.performInitialIndexing(context.Background(), s.config.Indexes[0])
+	if indexed := docCount(t, s); indexed != 0 {
+		t.Errorf("Expected a paused index to skip its initial indexing, got %d documents", indexed)
+	}
+}
+
+func TestService_Pause_Errors(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{})
+
+	if err := s.Pause("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error for unknown index, got %v", err)
+	}
+	if err := s.Pause("products"); !errors.Is(err, ErrPollingNotStarted) {
+		t.Errorf("Expected ErrPollingNotStarted before polling has started, got %v", err)
+	}
+}
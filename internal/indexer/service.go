@@ -2,9 +2,13 @@ package indexer
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,15 +20,60 @@ import (
 	syncstate "github.com/davidschrooten/open-atlas-search/internal/sync"
 )
 
+// mongoSource is the subset of *mongodb.Client the indexer reads documents with
+type mongoSource interface {
+	FindDocuments(collection string, filter bson.M, limit int64) (*mongodb.Cursor, error)
+	FindDocumentsSince(collection string, filter bson.M, timestampField string, since time.Time, limit int64) (*mongodb.Cursor, error)
+	TailDocuments(collection string, filter bson.M, timestampField string, since time.Time) (*mongodb.Cursor, error)
+	IsCapped(collection string) (bool, error)
+	CountDocuments(collection string, filter bson.M) (int64, error)
+	GetLastDocumentTimestamp(collection, timestampField string) (time.Time, error)
+	ParseTimestamp(timestamp interface{}) (time.Time, error)
+	CheckTimestampField(collection, timestampField string) (bool, error)
+	AddTimestampField(collection, timestampField string) error
+	Ping(ctx context.Context) error
+	Reconnect(ctx context.Context) error
+}
+
+// Delays between MongoDB reconnect attempts, doubling from the initial delay
+// up to the maximum
+var (
+	reconnectBackoff    = time.Second
+	maxReconnectBackoff = time.Minute
+)
+
 // Service manages indexing operations
 type Service struct {
-	mongoClient      *mongodb.Client
+	mongoClient      mongoSource
 	searchEngine     *search.Engine
 	config           *config.Config
 	wg               sync.WaitGroup
 	stopCh           chan struct{}
 	syncStateManager *syncstate.StateManager
-	saveStateCh      chan struct{} // Channel to trigger state saving
+	saveStateCh      chan struct{}                // Channel to trigger state saving
+	bulkBuffer       map[string]*pendingDocuments // index name -> polled documents awaiting commit
+	bufferMutex      sync.Mutex
+	pollLocks        sync.Map // collection key -> *sync.Mutex serializing polls of that collection
+	reconnectMutex   sync.Mutex
+	breaker          *circuitBreaker // Guards calls to MongoDB (nil disables)
+	indexingMutex    sync.Mutex
+	ctx              context.Context    // Context passed to Start, parent of the indexing context
+	indexingCancel   context.CancelFunc // Stops the indexing goroutines (nil while not indexing)
+	indexingWG       sync.WaitGroup     // Indexing goroutines started by StartIndexing
+	warmingUp        atomic.Bool
+	sizeMutex        sync.RWMutex
+	indexSizes       map[string]IndexSize // index name -> latest size measurement
+	verifyMutex      sync.RWMutex
+	verifications    map[string]SyncVerification // index name -> result of verifying its last initial sync
+}
+
+// pendingDocuments holds polled documents for one index until they are
+// committed, with the poll position reached reading them, which is only saved
+// once they are
+type pendingDocuments struct {
+	collectionKey string
+	docs          []map[string]interface{}
+	newest        time.Time // Newest document timestamp read, zero if unknown
 }
 
 // IndexingJob represents a document indexing job
@@ -49,13 +98,41 @@ func NewService(mongoClient *mongodb.Client, searchEngine *search.Engine, cfg *c
 		stopCh:           make(chan struct{}),
 		syncStateManager: syncStateManager,
 		saveStateCh:      make(chan struct{}, 1),
+		bulkBuffer:       make(map[string]*pendingDocuments),
+	}
+	if threshold := cfg.MongoDB.BreakerThreshold; threshold > 0 {
+		service.breaker = newCircuitBreaker(threshold, time.Duration(cfg.MongoDB.BreakerCooldown)*time.Second)
+		service.mongoClient = &breakerSource{mongoSource: mongoClient, breaker: service.breaker}
 	}
 
 	// Create indexes based on configuration
-	for _, indexCfg := range cfg.Indexes {
+	for i, indexCfg := range cfg.Indexes {
+		if err := validateIDStrategy(indexCfg.IDStrategy); err != nil {
+			return nil, fmt.Errorf("invalid index %s: %w", indexCfg.Name, err)
+		}
+		if _, err := mongodb.ParseFilter(indexCfg.Filter); err != nil {
+			return nil, fmt.Errorf("invalid index %s: %w", indexCfg.Name, err)
+		}
+		if err := validateStrictMapping(indexCfg.StrictMapping); err != nil {
+			return nil, fmt.Errorf("invalid index %s: %w", indexCfg.Name, err)
+		}
+		if err := validateIntervals(indexCfg, cfg.Search); err != nil {
+			return nil, fmt.Errorf("invalid index %s: %w", indexCfg.Name, err)
+		}
+		if err := validateTransforms(indexCfg); err != nil {
+			return nil, fmt.Errorf("invalid index %s: %w", indexCfg.Name, err)
+		}
+		if err := validateTTL(indexCfg); err != nil {
+			return nil, fmt.Errorf("invalid index %s: %w", indexCfg.Name, err)
+		}
+		if err := validateSizeLimits(indexCfg); err != nil {
+			return nil, fmt.Errorf("invalid index %s: %w", indexCfg.Name, err)
+		}
 		if err := searchEngine.CreateIndex(indexCfg); err != nil {
 			return nil, fmt.Errorf("failed to create index %s: %w", indexCfg.Name, err)
 		}
+		// Indexes without a definition may have taken one from an index template
+		cfg.Indexes[i].Definition = searchEngine.IndexDefinition(indexCfg.Name)
 	}
 
 	// Validate and setup timestamp fields
@@ -74,7 +151,7 @@ func (s *Service) setupTimestampFields() error {
 	for _, indexCfg := range s.config.Indexes {
 		timestampField := indexCfg.TimestampField
 		if timestampField == "" {
-			timestampField = "updated_at" // Default timestamp field
+			timestampField = config.DefaultTimestampField
 		}
 
 		// Skip _id field validation
@@ -123,28 +200,176 @@ func (s *Service) Start(ctx context.Context) error {
 	s.wg.Add(1)
 	go s.syncStateManager.StartPeriodicSave(30*time.Second, s.stopCh, &s.wg)
 
-	// Start initial bulk indexing for each configured index
-	for _, indexCfg := range s.config.Indexes {
+	// Warm up the indexes before reporting ready
+	s.warmingUp.Store(true)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.warmup()
+	}()
+
+	// Start index size monitoring
+	if s.config.Search.SizeCheckInterval > 0 {
 		s.wg.Add(1)
-		go s.performInitialIndexing(ctx, indexCfg)
+		go s.monitorIndexSizes(ctx)
+	}
 
+	// Start deleting expired documents
+	if s.config.Search.TTLSweepInterval > 0 {
 		s.wg.Add(1)
-		go s.pollForChanges(ctx, indexCfg)
+		go s.sweepExpiredDocuments(ctx)
 	}
 
-	// Start flush routine
-	s.wg.Add(1)
-	go s.flushRoutine(ctx)
+	// Keep the MongoDB connection from going idle
+	if s.config.MongoDB.KeepaliveInterval > 0 {
+		s.wg.Add(1)
+		go s.keepMongoAlive(ctx, time.Duration(s.config.MongoDB.KeepaliveInterval)*time.Second)
+	}
+
+	s.indexingMutex.Lock()
+	s.ctx = ctx
+	s.indexingMutex.Unlock()
+
+	// With leader-only indexing the cluster manager starts indexing once this
+	// node becomes the leader
+	if s.leaderOnlyIndexing() {
+		log.Println("Leader-only indexing enabled, waiting for cluster leadership to start indexing")
+		return nil
+	}
+	s.StartIndexing()
 
 	return nil
 }
 
+// StartIndexing starts the initial sync and change polling of every index.
+// Start calls it unless cluster.leader_only_indexing leaves it to leadership
+// changes. It does nothing while indexing is running, before Start and after Stop.
+func (s *Service) StartIndexing() {
+	s.indexingMutex.Lock()
+	defer s.indexingMutex.Unlock()
+
+	if s.ctx == nil || s.indexingCancel != nil {
+		return
+	}
+	select {
+	case <-s.stopCh:
+		return
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.indexingCancel = cancel
+	log.Println("Starting indexing")
+
+	// Start initial bulk indexing for each configured index
+	for _, indexCfg := range s.config.Indexes {
+		s.goIndexing(func() { s.performInitialIndexing(ctx, indexCfg) })
+		s.goIndexing(func() { s.pollForChanges(ctx, indexCfg) })
+
+		// Without a refresh interval polled documents are committed right away
+		if interval := refreshInterval(indexCfg, s.config.Search); interval > 0 {
+			s.goIndexing(func() { s.refreshRoutine(ctx, indexCfg.Name, interval) })
+		}
+	}
+}
+
+// goIndexing runs one of the indexing goroutines, which call s.wg.Done when
+// they return, tracking it in indexingWG as well so StopIndexing can wait for it
+func (s *Service) goIndexing(run func()) {
+	s.wg.Add(1)
+	s.indexingWG.Add(1)
+	go func() {
+		defer s.indexingWG.Done()
+		run()
+	}()
+}
+
+// StopIndexing stops syncing the indexes from MongoDB, commits the buffered
+// documents and saves the sync state, leaving the indexes searchable. An
+// interrupted initial sync starts over when indexing starts again.
+func (s *Service) StopIndexing() {
+	s.indexingMutex.Lock()
+	defer s.indexingMutex.Unlock()
+
+	if s.indexingCancel == nil {
+		return
+	}
+	log.Println("Stopping indexing")
+	s.indexingCancel()
+	s.indexingCancel = nil
+	s.indexingWG.Wait()
+
+	s.flushBuffers()
+	if err := s.syncStateManager.Save(); err != nil {
+		log.Printf("Failed to save sync state after stopping indexing: %v", err)
+	}
+}
+
+// leaderOnlyIndexing reports whether indexing is left to the cluster leader
+func (s *Service) leaderOnlyIndexing() bool {
+	return s.config.Cluster.Enabled && s.config.Cluster.LeaderOnlyIndexing
+}
+
+// Indexing reports whether the indexes are being synced from MongoDB
+func (s *Service) Indexing() bool {
+	s.indexingMutex.Lock()
+	defer s.indexingMutex.Unlock()
+	return s.indexingCancel != nil
+}
+
+// warmup runs each index's warmup_query once so Bleve loads the index into its
+// caches before the first real search. Failures are logged and otherwise ignored.
+func (s *Service) warmup() {
+	defer s.warmingUp.Store(false)
+
+	for _, indexCfg := range s.config.Indexes {
+		if len(indexCfg.WarmupQuery) == 0 {
+			continue
+		}
+
+		start := time.Now()
+		_, err := s.searchEngine.SearchSharded(search.SearchRequest{
+			Index: indexCfg.Name,
+			Query: indexCfg.WarmupQuery,
+			Size:  10,
+		})
+		if err != nil {
+			log.Printf("Warm-up query for index %s failed: %v", indexCfg.Name, err)
+			continue
+		}
+		log.Printf("Warmed up index %s in %v", indexCfg.Name, time.Since(start))
+	}
+}
+
+// WarmingUp reports whether the warm-up queries run at startup are still in progress
+func (s *Service) WarmingUp() bool {
+	return s.warmingUp.Load()
+}
+
 // Stop stops the indexing service
 func (s *Service) Stop() {
 	log.Println("Stopping indexer service...")
+	// Closed under indexingMutex so StartIndexing can't add goroutines while waiting for them
+	s.indexingMutex.Lock()
 	close(s.stopCh)
+	s.indexingMutex.Unlock()
 	s.wg.Wait()
 
+	// Pick up changes made since the last poll, unless this node is a
+	// follower leaving indexing to the leader, then commit any buffered
+	// documents before persisting the poll position
+	s.indexingMutex.Lock()
+	indexing := s.indexingCancel != nil
+	if indexing {
+		s.indexingCancel()
+		s.indexingCancel = nil
+	}
+	s.indexingMutex.Unlock()
+	if indexing || !s.leaderOnlyIndexing() {
+		s.finalSync()
+	}
+	s.flushBuffers()
+
 	// Final save of sync state
 	if err := s.syncStateManager.Save(); err != nil {
 		log.Printf("Failed to save sync state during shutdown: %v", err)
@@ -161,15 +386,62 @@ func (s *Service) performInitialIndexing(ctx context.Context, indexCfg config.In
 
 	log.Printf("Starting initial indexing for %s.%s", indexCfg.Database, indexCfg.Collection)
 
-	indexName := indexCfg.Name
 	collectionKey := fmt.Sprintf("%s.%s", indexCfg.Database, indexCfg.Collection)
 
+	// Get ID field for this collection
+	idField := indexCfg.IDField
+	if idField == "" {
+		idField = "_id"
+	}
+
+	// Only index documents matching the configured filter
+	filter, err := mongodb.ParseFilter(indexCfg.Filter)
+	if err != nil {
+		log.Printf("Skipping initial indexing for %s: %v", collectionKey, err)
+		return
+	}
+
+	if s.syncStateManager.IsPaused(collectionKey) {
+		log.Printf("Skipping initial indexing for %s: syncing is paused", collectionKey)
+		return
+	}
+
+	// Verify the index holds as many documents as the collection once synced,
+	// syncing again up to initial_sync_retries times while it has fewer
+	for retries := 0; ; retries++ {
+		snapshot, completed := s.syncCollection(ctx, indexCfg, collectionKey, idField, filter)
+		if !completed {
+			return
+		}
+
+		verification, err := s.verifyInitialSync(indexCfg, collectionKey, filter, snapshot, retries)
+		if err != nil {
+			log.Printf("Failed to verify initial indexing for %s: %v", collectionKey, err)
+			return
+		}
+		if verification.Matched || retries >= s.config.Search.InitialSyncRetries {
+			return
+		}
+		if !verification.missingDocuments() {
+			log.Printf("Not retrying initial indexing for %s: index %s has documents the collection no longer has, which another sync wouldn't remove",
+				collectionKey, indexCfg.Name)
+			return
+		}
+		log.Printf("Retrying initial indexing for %s after a document count mismatch (retry %d of %d)",
+			collectionKey, retries+1, s.config.Search.InitialSyncRetries)
+	}
+}
+
+// syncCollection indexes every document of a collection matching filter. It
+// returns the counts taken before the sync started, for verifyInitialSync, and
+// whether every document was read.
+func (s *Service) syncCollection(ctx context.Context, indexCfg config.IndexConfig, collectionKey, idField string, filter bson.M) (syncSnapshot, bool) {
 	// Set initial sync status to in_progress
 	s.syncStateManager.SetSyncStatus(collectionKey, syncstate.StatusInProgress)
 	s.syncStateManager.SetProgress(collectionKey, "0%")
 
 	// Get total document count for progress calculation
-	totalDocs, err := s.mongoClient.CountDocuments(indexCfg.Collection, bson.M{})
+	totalDocs, err := s.mongoClient.CountDocuments(indexCfg.Collection, filter)
 	if err != nil {
 		log.Printf("Failed to count documents in %s: %v", indexCfg.Collection, err)
 		// Set progress to not_available if we can't count
@@ -177,72 +449,165 @@ func (s *Service) performInitialIndexing(ctx context.Context, indexCfg config.In
 	} else {
 		s.syncStateManager.SetTotalDocuments(collectionKey, totalDocs)
 	}
+	snapshot := s.takeSyncSnapshot(collectionKey, totalDocs, err)
 
-	// Get cursor for all documents
-	cursor, err := s.mongoClient.FindDocuments(indexCfg.Collection, bson.M{}, 0)
+	// Get cursor for all matching documents
+	cursor, err := s.mongoClient.FindDocuments(indexCfg.Collection, filter, 0)
 	if err != nil {
 		log.Printf("Failed to get documents for initial indexing: %v", err)
 		s.syncStateManager.SetSyncStatus(collectionKey, syncstate.StatusIdle)
-		return
+		return snapshot, false
 	}
-	defer cursor.Close(ctx)
+	defer func() {
+		// Close with a fresh context so the server-side cursor is released even
+		// when ctx has been cancelled
+		closeCtx, cancel := context.WithTimeout(context.Background(), s.cursorTimeout())
+		defer cancel()
+		cursor.Close(closeCtx)
+	}()
+
+	count, completed := s.indexCursor(ctx, cursor, indexCfg, collectionKey, idField)
+	if !completed {
+		log.Printf("Initial indexing interrupted for %s.%s after %d documents",
+			indexCfg.Database, indexCfg.Collection, count)
+		return snapshot, false
+	}
+
+	log.Printf("Initial indexing completed for %s.%s: %d documents indexed",
+		indexCfg.Database, indexCfg.Collection, count)
+
+	// Set final status to idle with 100% progress now that the cursor is exhausted
+	s.syncStateManager.CompleteProgress(collectionKey)
+
+	// Update the last sync time for the index after initial indexing
+	s.searchEngine.UpdateLastSync(indexCfg.Name, time.Now())
+	return snapshot, true
+}
+
+// documentCursor is the subset of *mongodb.Cursor used for initial indexing
+type documentCursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+}
+
+// cursorTimeout returns the configured MongoDB timeout, which bounds each
+// cursor fetch so a stalled server can't hang initial indexing
+func (s *Service) cursorTimeout() time.Duration {
+	if s.config.MongoDB.Timeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.config.MongoDB.Timeout) * time.Second
+}
+
+// indexCursor indexes every document from cursor in batches. It stops when ctx
+// is cancelled, the service is stopped or a fetch exceeds the MongoDB timeout;
+// documents read so far are still indexed and the sync state is saved. It
+// returns the number of documents indexed and whether the cursor was exhausted.
+func (s *Service) indexCursor(ctx context.Context, cursor documentCursor, indexCfg config.IndexConfig, collectionKey, idField string) (int, bool) {
+	cursorCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// Cancel a blocked fetch as soon as the service is stopped
+	go func() {
+		select {
+		case <-s.stopCh:
+			cancel(nil)
+		case <-cursorCtx.Done():
+		}
+	}()
+
+	// One timer, reset before every fetch, cancels a fetch that takes longer
+	// than the MongoDB timeout
+	fetchTimer := time.AfterFunc(s.cursorTimeout(), func() { cancel(context.DeadlineExceeded) })
+	defer fetchTimer.Stop()
 
 	count := 0
 	batch := make([]map[string]interface{}, 0, s.config.Search.BatchSize)
 
-	for cursor.Next(ctx) {
+	for s.nextDocument(cursorCtx, cursor, fetchTimer) {
 		var doc bson.M
 		if err := cursor.Decode(&doc); err != nil {
 			log.Printf("Failed to decode document: %v", err)
 			continue
 		}
 
-		// Convert ObjectID to string for indexing, but support other ID types
-		if id, ok := doc["_id"].(primitive.ObjectID); ok {
-			doc["_id"] = id.Hex()
-		} else {
-			// Keep other ID types as-is (string, int, etc.)
-			doc["_id"] = fmt.Sprintf("%v", doc["_id"])
+		prepared, ok := s.prepareDocument(doc, indexCfg, idField, collectionKey)
+		if !ok {
+			continue
 		}
 
-		batch = append(batch, doc)
+		batch = append(batch, prepared)
 
 		if len(batch) >= s.config.Search.BatchSize {
-			s.indexBatch(indexName, batch)
+			s.indexBatch(indexCfg.Name, collectionKey, batch)
 			batch = batch[:0] // Reset slice
 			count += s.config.Search.BatchSize
 			// Update progress during initial indexing
 			s.syncStateManager.IncrementDocumentsIndexed(collectionKey, int64(s.config.Search.BatchSize))
+			s.refreshTotalDocuments(indexCfg, collectionKey)
 			s.syncStateManager.UpdateProgress(collectionKey)
 		}
 
-		select {
-		case <-ctx.Done():
-			return
-		case <-s.stopCh:
-			return
-		default:
+		if cursorCtx.Err() != nil {
+			break
 		}
 	}
 
 	// Index remaining documents
 	if len(batch) > 0 {
-		s.indexBatch(indexName, batch)
+		s.indexBatch(indexCfg.Name, collectionKey, batch)
 		count += len(batch)
 		// Update progress for remaining documents
 		s.syncStateManager.IncrementDocumentsIndexed(collectionKey, int64(len(batch)))
 		s.syncStateManager.UpdateProgress(collectionKey)
 	}
 
-	log.Printf("Initial indexing completed for %s.%s: %d documents indexed",
-		indexCfg.Database, indexCfg.Collection, count)
+	err := cursor.Err()
+	if err == nil {
+		err = context.Cause(cursorCtx)
+	}
+	if err != nil {
+		log.Printf("Stopped reading %s: %v", collectionKey, err)
+		// Persist the partial progress right away rather than waiting for the periodic save
+		if saveErr := s.syncStateManager.Save(); saveErr != nil {
+			log.Printf("Failed to save sync state for %s: %v", collectionKey, saveErr)
+		}
+		return count, false
+	}
 
-	// Set final status to idle after completion
-	s.syncStateManager.SetSyncStatus(collectionKey, syncstate.StatusIdle)
-	s.syncStateManager.SetProgress(collectionKey, "100%")
+	return count, true
+}
 
-	// Update the last sync time for the index after initial indexing
-	s.searchEngine.UpdateLastSync(indexName, time.Now())
+// nextDocument advances the cursor, giving up once the MongoDB timeout passes.
+// fetchTimer only runs during the fetch, so indexing a batch doesn't count
+// towards the timeout.
+func (s *Service) nextDocument(ctx context.Context, cursor documentCursor, fetchTimer *time.Timer) bool {
+	fetchTimer.Reset(s.cursorTimeout())
+	defer fetchTimer.Stop()
+	return cursor.Next(ctx)
+}
+
+// refreshTotalDocuments re-counts the collection once the indexed count catches up
+// with the known total, so documents inserted during the initial sync are accounted for
+func (s *Service) refreshTotalDocuments(indexCfg config.IndexConfig, collectionKey string) {
+	indexed, total := s.syncStateManager.GetProgressCounts(collectionKey)
+	if total <= 0 || indexed < total {
+		return
+	}
+
+	filter, err := mongodb.ParseFilter(indexCfg.Filter)
+	if err != nil {
+		log.Printf("Failed to refresh document count for %s: %v", collectionKey, err)
+		return
+	}
+
+	liveTotal, err := s.mongoClient.CountDocuments(indexCfg.Collection, filter)
+	if err != nil {
+		log.Printf("Failed to refresh document count for %s: %v", collectionKey, err)
+		return
+	}
+	s.syncStateManager.SetTotalDocuments(collectionKey, liveTotal)
 }
 
 // pollForChanges polls MongoDB for new/updated documents since last poll
@@ -257,7 +622,7 @@ func (s *Service) pollForChanges(ctx context.Context, indexCfg config.IndexConfi
 	// Get timestamp field for this collection
 	timestampField := indexCfg.TimestampField
 	if timestampField == "" {
-		timestampField = "updated_at"
+		timestampField = config.DefaultTimestampField
 	}
 
 	// Get ID field for this collection
@@ -290,25 +655,28 @@ func (s *Service) pollForChanges(ctx context.Context, indexCfg config.IndexConfi
 		log.Printf("Restored collection state for %s, resuming from %v", collectionKey, collectionState.LastPollTime)
 	}
 
-	// Poll interval (configurable per index, defaulting to 5 seconds)
-	pollInterval := 5 * time.Second
-	if indexCfg.PollInterval > 0 {
-		pollInterval = time.Duration(indexCfg.PollInterval) * time.Second
-	} else if s.config.Search.FlushInterval > 0 {
-		// Use flush interval as a basis, but make polling more frequent
-		pollInterval = time.Duration(s.config.Search.FlushInterval/2) * time.Second
-		if pollInterval < time.Second {
-			pollInterval = time.Second
-		}
+	pollInterval := s.pollInterval(indexCfg)
+
+	// Capped collections can be tailed instead, which falls back to polling
+	// if the collection isn't capped
+	if indexCfg.Tailable && s.tailForChanges(ctx, indexCfg, collectionKey, pollInterval) {
+		return
 	}
 
-	ticker := time.NewTicker(pollInterval)
+	ticker := newTicker(pollInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			s.performPoll(ctx, indexCfg)
+		case <-ticker.C():
+			_, err := s.performPoll(ctx, indexCfg)
+			if errors.Is(err, ErrCircuitOpen) {
+				continue // Logged when the breaker opened; retried after its cooldown
+			}
+			if err != nil {
+				log.Printf("Failed to poll for changes in %s: %v", collectionKey, err)
+				s.ensureConnection(ctx)
+			}
 
 		case <-ctx.Done():
 			return
@@ -318,27 +686,248 @@ func (s *Service) pollForChanges(ctx context.Context, indexCfg config.IndexConfi
 	}
 }
 
+// tailForChanges streams documents inserted into a capped collection from a
+// tailable cursor until the service stops, reopening the cursor from the last
+// indexed document whenever it dies. It returns false without tailing if the
+// collection isn't capped, so the caller can poll instead.
+func (s *Service) tailForChanges(ctx context.Context, indexCfg config.IndexConfig, collectionKey string, retryInterval time.Duration) bool {
+	capped, err := s.mongoClient.IsCapped(indexCfg.Collection)
+	if err != nil {
+		log.Printf("Failed to check whether %s is capped, polling instead of tailing: %v", collectionKey, err)
+		return false
+	}
+	if !capped {
+		log.Printf("Collection %s is not capped, polling instead of tailing", collectionKey)
+		return false
+	}
+
+	filter, err := mongodb.ParseFilter(indexCfg.Filter)
+	if err != nil {
+		log.Printf("Failed to tail %s: %v", collectionKey, err)
+		return false
+	}
+
+	log.Printf("Tailing %s for new documents", collectionKey)
+	for {
+		// A paused collection isn't tailed, only checked again shortly
+		if !s.syncStateManager.IsPaused(collectionKey) {
+			state := s.syncStateManager.GetCollectionState(collectionKey)
+			since := s.readPosition(indexCfg.Name, state.LastPollTime)
+			cursor, err := s.mongoClient.TailDocuments(indexCfg.Collection, filter, state.TimestampField, since)
+			if err == nil {
+				_, err = s.tailCursor(ctx, cursor, indexCfg, collectionKey)
+
+				closeCtx, cancel := context.WithTimeout(context.Background(), s.cursorTimeout())
+				cursor.Close(closeCtx)
+				cancel()
+			}
+			if err != nil {
+				log.Printf("Failed to tail %s: %v", collectionKey, err)
+				s.ensureConnection(ctx)
+			}
+		}
+
+		// The cursor died, e.g. because the collection was empty, so reopen it shortly
+		select {
+		case <-time.After(retryInterval):
+		case <-ctx.Done():
+			return true
+		case <-s.stopCh:
+			return true
+		}
+	}
+}
+
+// tailCursor buffers each document from a tailable cursor as it arrives and
+// moves the poll position past it, until the cursor dies or the service
+// stops. It returns the number of documents read.
+func (s *Service) tailCursor(ctx context.Context, cursor documentCursor, indexCfg config.IndexConfig, collectionKey string) (int, error) {
+	cursorCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// Cancel a blocked fetch as soon as the service is stopped
+	go func() {
+		select {
+		case <-s.stopCh:
+			cancel(nil)
+		case <-cursorCtx.Done():
+		}
+	}()
+
+	// One timer, reset before every fetch, cancels a fetch that takes longer
+	// than the MongoDB timeout
+	fetchTimer := time.AfterFunc(s.cursorTimeout(), func() { cancel(context.DeadlineExceeded) })
+	defer fetchTimer.Stop()
+
+	state := s.syncStateManager.GetCollectionState(collectionKey)
+	timestampField := state.TimestampField
+	idField := state.IDField
+	newestTimestamp := s.readPosition(indexCfg.Name, state.LastPollTime)
+
+	count := 0
+	for cursor.Next(cursorCtx) {
+		// Stop at the first document after a pause, leaving the position
+		// before it so it's read again on resume
+		if s.syncStateManager.IsPaused(collectionKey) {
+			return count, nil
+		}
+
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Failed to decode document: %v", err)
+			continue
+		}
+
+		if docTimestamp, ok := s.documentTimestamp(doc, timestampField); ok && docTimestamp.After(newestTimestamp) {
+			newestTimestamp = docTimestamp
+		}
+
+		prepared, ok := s.prepareDocument(doc, indexCfg, idField, collectionKey)
+		if !ok {
+			// Still move past the skipped document once what was read before it is committed
+			s.bufferDocuments(indexCfg.Name, collectionKey, nil, newestTimestamp)
+			continue
+		}
+
+		s.bufferDocuments(indexCfg.Name, collectionKey, []map[string]interface{}{prepared}, newestTimestamp)
+		s.syncStateManager.IncrementDocumentsIndexed(collectionKey, 1)
+		s.syncStateManager.SetLastSyncTime(collectionKey, time.Now())
+		s.searchEngine.UpdateLastSync(indexCfg.Name, time.Now())
+		count++
+	}
+
+	if cursorCtx.Err() != nil {
+		return count, nil
+	}
+	return count, cursor.Err()
+}
+
+// Repoll moves the poll position of an index back to since and polls
+// immediately, so documents changed after since are indexed again without a
+// full rebuild. It keeps polling batch_size documents at a time until a poll
+// no longer advances the position, and returns the number of documents polled.
+func (s *Service) Repoll(ctx context.Context, indexName string, since time.Time) (int, error) {
+	var indexCfg *config.IndexConfig
+	for i := range s.config.Indexes {
+		if s.config.Indexes[i].Name == indexName {
+			indexCfg = &s.config.Indexes[i]
+			break
+		}
+	}
+	if indexCfg == nil {
+		return 0, &search.IndexNotFoundError{Index: indexName}
+	}
+
+	collectionKey := fmt.Sprintf("%s.%s", indexCfg.Database, indexCfg.Collection)
+	if s.syncStateManager.GetCollectionState(collectionKey) == nil {
+		return 0, fmt.Errorf("%w for %s", ErrPollingNotStarted, collectionKey)
+	}
+	if s.syncStateManager.IsPaused(collectionKey) {
+		return 0, fmt.Errorf("cannot re-poll %s: %w", collectionKey, ErrIndexPaused)
+	}
+
+	// Wait for a poll in flight so it can't advance the position past since,
+	// and commit its buffered documents so they don't either
+	lock := s.pollLock(collectionKey)
+	lock.Lock()
+	s.flushBuffer(indexName)
+	s.syncStateManager.SetLastPollTime(collectionKey, since)
+	lock.Unlock()
+	log.Printf("Re-polling %s from %v", collectionKey, since)
+
+	total := 0
+	for {
+		position := s.pollPosition(indexName, collectionKey)
+		count, err := s.performPoll(ctx, *indexCfg)
+		total += count
+		if err != nil {
+			return total, err
+		}
+		if !s.pollPosition(indexName, collectionKey).After(position) {
+			return total, nil
+		}
+		select {
+		case <-ctx.Done():
+			return total, nil
+		case <-s.stopCh:
+			return total, nil
+		default:
+		}
+	}
+}
+
+// pollPosition returns the timestamp the next poll of an index reads from
+func (s *Service) pollPosition(indexName, collectionKey string) time.Time {
+	var lastPoll time.Time
+	if state := s.syncStateManager.GetCollectionState(collectionKey); state != nil {
+		lastPoll = state.LastPollTime
+	}
+	return s.readPosition(indexName, lastPoll)
+}
+
+// pollLock returns the mutex serializing polls of a collection
+func (s *Service) pollLock(collectionKey string) *sync.Mutex {
+	lock, _ := s.pollLocks.LoadOrStore(collectionKey, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// finalSync polls every index one last time once the pollers have stopped, so
+// documents changed since their last poll are indexed before the sync state is
+// saved on shutdown. The polls are bounded by the MongoDB timeout.
+func (s *Service) finalSync() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cursorTimeout())
+	defer cancel()
+
+	for _, indexCfg := range s.config.Indexes {
+		if _, err := s.poll(ctx, indexCfg, nil); err != nil {
+			log.Printf("Final sync of index %s failed: %v", indexCfg.Name, err)
+		}
+	}
+}
+
 // performPoll performs a single polling operation to check for new documents
-func (s *Service) performPoll(ctx context.Context, indexCfg config.IndexConfig) {
+// and returns the number of documents polled. Documents read before MongoDB
+// fails are still indexed.
+func (s *Service) performPoll(ctx context.Context, indexCfg config.IndexConfig) (int, error) {
+	return s.poll(ctx, indexCfg, s.stopCh)
+}
+
+// poll reads the documents of an index changed since its poll position. It
+// stops early when ctx is cancelled or stopCh is closed; a nil stopCh polls
+// until the cursor is exhausted.
+func (s *Service) poll(ctx context.Context, indexCfg config.IndexConfig, stopCh <-chan struct{}) (int, error) {
 	indexName := indexCfg.Name
 	collectionKey := fmt.Sprintf("%s.%s", indexCfg.Database, indexCfg.Collection)
 
+	lock := s.pollLock(collectionKey)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if s.syncStateManager.IsPaused(collectionKey) {
+		return 0, nil
+	}
+
 	// Get current collection state
 	collectionState := s.syncStateManager.GetCollectionState(collectionKey)
 	if collectionState == nil {
 		log.Printf("No collection state found for %s, skipping poll", collectionKey)
-		return
+		return 0, nil
 	}
 
-	lastPoll := collectionState.LastPollTime
+	// Documents still buffered from earlier polls aren't read again
+	lastPoll := s.readPosition(indexName, collectionState.LastPollTime)
 	timestampField := collectionState.TimestampField
 	idField := collectionState.IDField
 
-	// Find documents created/updated since last poll
-	cursor, err := s.mongoClient.FindDocumentsSince(indexCfg.Collection, timestampField, lastPoll, int64(s.config.Search.BatchSize))
+	filter, err := mongodb.ParseFilter(indexCfg.Filter)
 	if err != nil {
-		log.Printf("Failed to poll for changes in %s: %v", collectionKey, err)
-		return
+		return 0, err
+	}
+
+	// Find documents matching the filter created/updated since last poll
+	cursor, err := s.mongoClient.FindDocumentsSince(indexCfg.Collection, filter, timestampField, lastPoll, int64(s.config.Search.BatchSize))
+	if err != nil {
+		return 0, err
 	}
 	defer cursor.Close(ctx)
 
@@ -354,161 +943,317 @@ func (s *Service) performPoll(ctx context.Context, indexCfg config.IndexConfig)
 		}
 
 		// Track the newest timestamp based on the configured field
-		if timestampField == "" || timestampField == "_id" {
-			// Use ObjectID timestamp
-			if id, ok := doc["_id"].(primitive.ObjectID); ok {
-				docTimestamp := id.Timestamp()
-				if docTimestamp.After(newestTimestamp) {
-					newestTimestamp = docTimestamp
-				}
-			}
-		} else {
-			// Use custom timestamp field
-			if timestampVal, exists := doc[timestampField]; exists {
-				if docTimestamp, err := s.mongoClient.ParseTimestamp(timestampVal); err == nil {
-					if docTimestamp.After(newestTimestamp) {
-						newestTimestamp = docTimestamp
-					}
-				}
-			}
+		if docTimestamp, ok := s.documentTimestamp(doc, timestampField); ok && docTimestamp.After(newestTimestamp) {
+			newestTimestamp = docTimestamp
 		}
 
-		// Handle configurable ID field - convert to string for indexing
-		if idVal, exists := doc[idField]; exists {
-			if id, ok := idVal.(primitive.ObjectID); ok {
-				doc[idField] = id.Hex()
-			} else {
-				// Keep other ID types as-is (string, int, etc.)
-				doc[idField] = fmt.Sprintf("%v", idVal)
-			}
-			// Always ensure _id is set for search indexing
-			if idField != "_id" {
-				doc["_id"] = doc[idField]
-			}
-		} else {
-			log.Printf("Document missing ID field '%s', skipping", idField)
+		prepared, ok := s.prepareDocument(doc, indexCfg, idField, collectionKey)
+		if !ok {
 			continue
 		}
 
-		batch = append(batch, doc)
+		batch = append(batch, prepared)
 		count++
 
 		if len(batch) >= s.config.Search.BatchSize {
-			s.indexBatch(indexName, batch)
+			s.bufferDocuments(indexName, collectionKey, batch, newestTimestamp)
 			batch = batch[:0] // Reset slice
 		}
 
 		select {
 		case <-ctx.Done():
-			return
-		case <-s.stopCh:
-			return
+			return count, nil
+		case <-stopCh:
+			return count, nil
 		default:
 		}
 	}
 
-	// Index remaining documents
-	if len(batch) > 0 {
-		s.indexBatch(indexName, batch)
+	// Buffer remaining documents; the poll position moves past them once they
+	// are committed
+	if len(batch) > 0 || newestTimestamp.After(lastPoll) {
+		s.bufferDocuments(indexName, collectionKey, batch, newestTimestamp)
 	}
 
-	// Update state with new poll time and document count
+	// Update state with the document count
 	if count > 0 {
-		s.syncStateManager.SetLastPollTime(collectionKey, newestTimestamp)
 		s.syncStateManager.IncrementDocumentsIndexed(collectionKey, int64(count))
 		log.Printf("Polled %d new/updated documents from %s using timestamp field '%s'", count, collectionKey, timestampField)
 	}
 
+	if err := cursor.Err(); err != nil {
+		return count, err
+	}
+
 	// Always update the last sync time for the index (even if no new documents)
 	s.syncStateManager.SetLastSyncTime(collectionKey, time.Now())
 	s.searchEngine.UpdateLastSync(indexName, time.Now())
+	return count, nil
+}
+
+// documentTimestamp returns the change timestamp of a document from the
+// timestamp field, or from its ObjectID when the field is _id
+func (s *Service) documentTimestamp(doc bson.M, timestampField string) (time.Time, bool) {
+	if timestampField == "" || timestampField == "_id" {
+		// Use ObjectID timestamp
+		if id, ok := doc["_id"].(primitive.ObjectID); ok {
+			return id.Timestamp(), true
+		}
+		return time.Time{}, false
+	}
+
+	// Use custom timestamp field
+	if timestampVal, exists := doc[timestampField]; exists {
+		if docTimestamp, err := s.mongoClient.ParseTimestamp(timestampVal); err == nil {
+			return docTimestamp, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ensureConnection checks that MongoDB is reachable after a failed poll and,
+// if it isn't, re-establishes the connection, retrying with exponential backoff
+// until it succeeds or the service stops. Pollers failing at the same time
+// wait for a single reconnect.
+func (s *Service) ensureConnection(ctx context.Context) {
+	s.reconnectMutex.Lock()
+	defer s.reconnectMutex.Unlock()
+
+	if err := s.mongoClient.Ping(ctx); err == nil {
+		return // A transient error, or another poller already reconnected
+	}
+
+	delay := reconnectBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.mongoClient.Reconnect(ctx)
+		if err == nil {
+			log.Printf("Reconnected to MongoDB after %d attempt(s)", attempt)
+			return
+		}
+		log.Printf("Failed to reconnect to MongoDB (attempt %d), retrying in %v: %v", attempt, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		case <-s.stopCh:
+			return
+		}
+		delay = min(delay*2, maxReconnectBackoff)
+	}
+}
+
+// prepareDocument derives the document ID, normalizes BSON values, applies
+// the index's transforms and truncates values longer than
+// search.max_field_length for indexing. Documents larger than search.max_document_bytes once normalized, or
+// with unmapped fields when strict_mapping is reject, are skipped and counted
+// as failed. It returns false if the document must be skipped.
+func (s *Service) prepareDocument(doc map[string]interface{}, indexCfg config.IndexConfig, idField, collectionKey string) (map[string]interface{}, bool) {
+	// Derive a string ID for indexing according to the index's id_strategy
+	if err := assignDocumentID(doc, idField, indexCfg.IDStrategy); err != nil {
+		log.Printf("Skipping document: %v", err)
+		return nil, false
+	}
+
+	doc = normalizeBSON(doc)
+	doc = applyTransforms(doc, indexCfg.Transforms)
+
+	if maxLength := s.config.Search.MaxFieldLength; maxLength > 0 {
+		if truncated := truncateFields(doc, maxLength); len(truncated) > 0 {
+			log.Printf("Truncated fields of document %v in %s to max_field_length %d characters: %s", doc["_id"], collectionKey, maxLength, strings.Join(truncated, ", "))
+		}
+	}
+
+	if indexCfg.StrictMapping != "" {
+		if unmapped := unmappedFields(doc, indexCfg.Definition, idField); len(unmapped) > 0 {
+			if indexCfg.StrictMapping == StrictMappingReject {
+				log.Printf("Rejecting document %v in %s: fields not in the mapping: %s", doc["_id"], collectionKey, strings.Join(unmapped, ", "))
+				s.syncStateManager.IncrementDocumentsFailed(collectionKey, 1)
+				return nil, false
+			}
+			log.Printf("Warning: document %v in %s has fields not in the mapping, they won't be searchable: %s", doc["_id"], collectionKey, strings.Join(unmapped, ", "))
+		}
+	}
+
+	if maxBytes := s.config.Search.MaxDocumentBytes; maxBytes > 0 {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			log.Printf("Skipping document %v: failed to measure size: %v", doc["_id"], err)
+			s.syncStateManager.IncrementDocumentsFailed(collectionKey, 1)
+			return nil, false
+		}
+		if len(data) > maxBytes {
+			log.Printf("Warning: skipping document %v in %s: size %d bytes exceeds max_document_bytes %d", doc["_id"], collectionKey, len(data), maxBytes)
+			s.syncStateManager.IncrementDocumentsFailed(collectionKey, 1)
+			return nil, false
+		}
+	}
+
+	return doc, true
+}
+
+// bufferDocuments adds polled documents to the index's bulk buffer and commits the
+// buffer once it holds IndexBufferSize documents. Smaller polls are committed by
+// the index's refresh routine, so frequent polling doesn't commit on every poll batch.
+// newest is the poll position reached reading the documents; it is saved once
+// they are committed, so a crash never skips documents that were only buffered.
+func (s *Service) bufferDocuments(indexName, collectionKey string, batch []map[string]interface{}, newest time.Time) {
+	if s.config.Search.IndexBufferSize <= 0 || s.refreshIntervalOf(indexName) == 0 {
+		// Buffering disabled or nothing would flush the buffer, commit immediately
+		s.commitDocuments(indexName, &pendingDocuments{collectionKey: collectionKey, docs: batch, newest: newest})
+		return
+	}
+
+	s.bufferMutex.Lock()
+	pending, exists := s.bulkBuffer[indexName]
+	if !exists {
+		pending = &pendingDocuments{collectionKey: collectionKey}
+		s.bulkBuffer[indexName] = pending
+	}
+	pending.docs = append(pending.docs, batch...)
+	if newest.After(pending.newest) {
+		pending.newest = newest
+	}
+
+	if len(pending.docs) >= s.config.Search.IndexBufferSize {
+		delete(s.bulkBuffer, indexName)
+	} else {
+		pending = nil
+	}
+	s.bufferMutex.Unlock()
+
+	if pending != nil {
+		s.commitDocuments(indexName, pending)
+	}
+}
+
+// readPosition returns the position to read changes of an index from: the
+// saved poll position, or the position reached by its buffered documents when
+// that is later
+func (s *Service) readPosition(indexName string, lastPoll time.Time) time.Time {
+	s.bufferMutex.Lock()
+	defer s.bufferMutex.Unlock()
+
+	if pending, exists := s.bulkBuffer[indexName]; exists && pending.newest.After(lastPoll) {
+		return pending.newest
+	}
+	return lastPoll
+}
+
+// flushBuffer commits the buffered documents of an index regardless of the buffer size
+func (s *Service) flushBuffer(indexName string) {
+	s.bufferMutex.Lock()
+	pending, exists := s.bulkBuffer[indexName]
+	delete(s.bulkBuffer, indexName)
+	s.bufferMutex.Unlock()
+
+	if exists {
+		s.commitDocuments(indexName, pending)
+	}
+}
+
+// flushBuffers commits all buffered documents regardless of the buffer size
+func (s *Service) flushBuffers() {
+	s.bufferMutex.Lock()
+	buffers := s.bulkBuffer
+	s.bulkBuffer = make(map[string]*pendingDocuments)
+	s.bufferMutex.Unlock()
+
+	for indexName, pending := range buffers {
+		s.commitDocuments(indexName, pending)
+	}
+}
+
+// commitDocuments indexes buffered documents in a single batch, then moves the
+// poll position past them
+func (s *Service) commitDocuments(indexName string, pending *pendingDocuments) {
+	if len(pending.docs) > 0 {
+		s.indexBatch(indexName, pending.collectionKey, pending.docs)
+	}
+	if !pending.newest.IsZero() {
+		s.syncStateManager.AdvanceLastPollTime(pending.collectionKey, pending.newest)
+	}
 }
 
 // indexBatch indexes a batch of documents using bulk operations for better performance
-func (s *Service) indexBatch(indexName string, batch []map[string]interface{}) {
+func (s *Service) indexBatch(indexName, collectionKey string, batch []map[string]interface{}) {
+	// Don't let out-of-order copies overwrite newer versions of a document
+	batch = s.dropStaleDocuments(indexName, batch)
+
 	if s.config.Search.BulkIndexing {
 		// Use bulk indexing for better performance
-		s.indexBatchBulk(indexName, batch)
+		s.indexBatchBulk(indexName, collectionKey, batch)
 	} else {
 		// Use individual indexing for compatibility
-		s.indexBatchIndividual(indexName, batch)
+		s.indexBatchIndividual(indexName, collectionKey, batch)
 	}
 }
 
-// indexBatchBulk indexes documents using bulk operations for optimal performance
-func (s *Service) indexBatchBulk(indexName string, batch []map[string]interface{}) {
-	docs := make([]search.DocumentBatch, 0, len(batch))
-	for _, doc := range batch {
-		if idVal, ok := doc["_id"]; ok {
-			docID := fmt.Sprintf("%v", idVal)
-			docs = append(docs, search.DocumentBatch{
-				ID:  docID,
-				Doc: doc,
-			})
+// indexBatchBulk indexes documents using bulk operations for optimal performance.
+// Documents are written in Bleve batches of at most commit_batch_size documents,
+// or all in one batch when it is unset.
+func (s *Service) indexBatchBulk(indexName, collectionKey string, batch []map[string]interface{}) {
+	excludedField := s.sourceIDField(indexName)
+	for _, chunk := range splitBatch(batch, s.config.Search.CommitBatchSize) {
+		docs := make([]search.DocumentBatch, 0, len(chunk))
+		for _, doc := range chunk {
+			if idVal, ok := doc["_id"]; ok {
+				docID := fmt.Sprintf("%v", idVal)
+				if excludedField != "" {
+					doc = withoutField(doc, excludedField)
+				}
+				docs = append(docs, search.DocumentBatch{
+					ID:  docID,
+					Doc: doc,
+				})
+			}
+		}
+		if len(docs) == 0 {
+			continue
 		}
-	}
 
-	if len(docs) > 0 {
 		if err := s.searchEngine.IndexDocuments(indexName, docs); err != nil {
 			log.Printf("Failed to bulk index %d documents: %v", len(docs), err)
 			// Fallback to individual indexing on error
-			s.indexBatchIndividual(indexName, batch)
+			s.indexBatchIndividual(indexName, collectionKey, chunk)
 		}
 	}
 }
 
+// splitBatch splits documents into consecutive chunks of at most size
+// documents. A size of zero or less keeps them in a single chunk.
+func splitBatch(batch []map[string]interface{}, size int) [][]map[string]interface{} {
+	if size <= 0 || len(batch) <= size {
+		return [][]map[string]interface{}{batch}
+	}
+
+	chunks := make([][]map[string]interface{}, 0, (len(batch)+size-1)/size)
+	for start := 0; start < len(batch); start += size {
+		chunks = append(chunks, batch[start:min(start+size, len(batch))])
+	}
+	return chunks
+}
+
 // indexBatchIndividual indexes documents one by one (fallback method)
-func (s *Service) indexBatchIndividual(indexName string, batch []map[string]interface{}) {
+func (s *Service) indexBatchIndividual(indexName, collectionKey string, batch []map[string]interface{}) {
+	excludedField := s.sourceIDField(indexName)
+	failed := 0
 	for _, doc := range batch {
 		if idVal, ok := doc["_id"]; ok {
 			docID := fmt.Sprintf("%v", idVal)
+			if excludedField != "" {
+				doc = withoutField(doc, excludedField)
+			}
 			if err := s.searchEngine.IndexDocument(indexName, docID, doc); err != nil {
 				log.Printf("Failed to index document %s: %v", docID, err)
+				failed++
 			}
 		}
 	}
-}
 
-// flushRoutine periodically flushes indexes
-func (s *Service) flushRoutine(ctx context.Context) {
-	defer s.wg.Done()
-
-	ticker := time.NewTicker(time.Duration(s.config.Search.FlushInterval) * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			// Note: Bleve automatically handles flushing, but we could add custom logic here
-			log.Println("Periodic flush completed")
-
-		case <-ctx.Done():
-			return
-		case <-s.stopCh:
-			return
-		}
-	}
-}
-
-// GetIndexStats returns statistics about an index
-func (s *Service) GetIndexStats(indexName string) (map[string]interface{}, error) {
-	index, exists := s.searchEngine.GetIndex(indexName)
-	if !exists {
-		return nil, fmt.Errorf("index %s not found", indexName)
+	if failed > 0 {
+		s.syncStateManager.IncrementDocumentsFailed(collectionKey, int64(failed))
 	}
-
-	docCount, err := index.DocCount()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get document count: %w", err)
-	}
-
-	stats := map[string]interface{}{
-		"name":     indexName,
-		"docCount": docCount,
-		"status":   "active",
-	}
-
-	return stats, nil
 }
 
 // GetSyncStates returns the synchronization states for all collections
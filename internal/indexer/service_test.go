@@ -0,0 +1,1026 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+	"github.com/davidschrooten/open-atlas-search/internal/mongodb"
+	"github.com/davidschrooten/open-atlas-search/internal/search"
+	syncstate "github.com/davidschrooten/open-atlas-search/internal/sync"
+)
+
+// newTestService creates a service backed by a real search engine with a single
+// dynamic index named "products", without a MongoDB connection
+func newTestService(t testing.TB, searchCfg config.SearchConfig) *Service {
+	t.Helper()
+
+	searchCfg.IndexPath = t.TempDir()
+	engine, err := search.NewEngine(searchCfg)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Database:   "shop",
+		Collection: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	return &Service{
+		searchEngine:     engine,
+		config:           &config.Config{Search: searchCfg, Indexes: []config.IndexConfig{indexCfg}},
+		stopCh:           make(chan struct{}),
+		syncStateManager: syncstate.NewStateManager(filepath.Join(t.TempDir(), "sync_state.json")),
+		saveStateCh:      make(chan struct{}, 1),
+		bulkBuffer:       make(map[string]*pendingDocuments),
+	}
+}
+
+// makeDocs creates count documents with IDs starting at offset
+func makeDocs(offset, count int) []map[string]interface{} {
+	docs := make([]map[string]interface{}, 0, count)
+	for i := offset; i < offset+count; i++ {
+		docs = append(docs, map[string]interface{}{
+			"_id":  fmt.Sprintf("doc%d", i),
+			"name": fmt.Sprintf("product %d", i),
+		})
+	}
+	return docs
+}
+
+func docCount(t *testing.T, s *Service) uint64 {
+	t.Helper()
+	index, exists := s.searchEngine.GetIndex("products")
+	if !exists {
+		t.Fatal("Expected index to exist")
+	}
+	count, err := index.DocCount()
+	if err != nil {
+		t.Fatalf("Failed to count documents: %v", err)
+	}
+	return count
+}
+
+func TestService_BufferDocuments_CommitsAtBufferSize(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{BulkIndexing: true, IndexBufferSize: 10, FlushInterval: 30})
+
+	// Three small polls stay below the buffer size and are not committed yet
+	for poll := 0; poll < 3; poll++ {
+		s.bufferDocuments("products", "shop.products", makeDocs(poll*3, 3), time.Time{})
+	}
+	if count := docCount(t, s); count != 0 {
+		t.Errorf("Expected 0 committed documents, got %d", count)
+	}
+
+	// The fourth poll reaches the buffer size and commits everything in one batch
+	s.bufferDocuments("products", "shop.products", makeDocs(9, 3), time.Time{})
+	if count := docCount(t, s); count != 12 {
+		t.Errorf("Expected 12 committed documents, got %d", count)
+	}
+	if _, buffered := s.bulkBuffer["products"]; buffered {
+		t.Error("Expected the committed buffer to be emptied")
+	}
+}
+
+func TestService_FlushBuffers_NoDataLoss(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{BulkIndexing: true, IndexBufferSize: 1000, FlushInterval: 30})
+
+	polls := 20
+	for poll := 0; poll < polls; poll++ {
+		s.bufferDocuments("products", "shop.products", makeDocs(poll*5, 5), time.Time{})
+	}
+	if count := docCount(t, s); count != 0 {
+		t.Errorf("Expected buffered documents not to be committed yet, got %d", count)
+	}
+
+	// A flush tick commits all buffered documents at once
+	s.flushBuffers()
+	if count := docCount(t, s); count != uint64(polls*5) {
+		t.Errorf("Expected %d committed documents, got %d", polls*5, count)
+	}
+	if len(s.bulkBuffer) != 0 {
+		t.Errorf("Expected the flush to empty the buffers, got %d", len(s.bulkBuffer))
+	}
+}
+
+func TestService_Poll_SavesPositionOnlyOnceCommitted(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	mongo := &fakeMongo{}
+	s := newPollingTestService(t, nil)
+	s.mongoClient = mongo
+	s.config.Search.BulkIndexing = true
+	s.config.Search.IndexBufferSize = 1000
+	s.config.Search.FlushInterval = 30
+	start := now.Add(-time.Minute)
+	s.syncStateManager.SetLastPollTime("shop.products", start)
+
+	mongo.docs = []bson.M{
+		{"_id": "doc1", "name": "widget", "updated_at": now.Add(-2 * time.Second)},
+		{"_id": "doc2", "name": "gadget", "updated_at": now.Add(-time.Second)},
+	}
+	if count, err := s.performPoll(context.Background(), s.config.Indexes[0]); err != nil || count != 2 {
+		t.Fatalf("Expected 2 polled documents, got %d (%v)", count, err)
+	}
+
+	// A crash now would lose the buffered documents, so the saved position
+	// must not move past them yet
+	if state := s.syncStateManager.GetCollectionState("shop.products"); !state.LastPollTime.Equal(start) {
+		t.Errorf("Expected the poll position to stay at %v while documents are buffered, got %v", start, state.LastPollTime)
+	}
+
+	// The next poll reads on from the buffered documents instead of again
+	if count, err := s.performPoll(context.Background(), s.config.Indexes[0]); err != nil || count != 0 {
+		t.Errorf("Expected the buffered documents not to be polled again, got %d (%v)", count, err)
+	}
+
+	s.flushBuffers()
+	if count := docCount(t, s); count != 2 {
+		t.Errorf("Expected 2 committed documents, got %d", count)
+	}
+	if state := s.syncStateManager.GetCollectionState("shop.products"); !state.LastPollTime.Equal(now.Add(-time.Second)) {
+		t.Errorf("Expected the poll position to move past the committed documents, got %v", state.LastPollTime)
+	}
+}
+
+func TestService_Stop_FlushesBuffer(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{BulkIndexing: true, IndexBufferSize: 1000, FlushInterval: 30})
+
+	s.bufferDocuments("products", "shop.products", makeDocs(0, 7), time.Time{})
+	s.Stop()
+
+	if count := docCount(t, s); count != 7 {
+		t.Errorf("Expected buffered documents to be committed on stop, got %d", count)
+	}
+}
+
+func TestService_Stop_PollsFinalChanges(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	mongo := &fakeMongo{}
+	s := newPollingTestService(t, nil)
+	s.mongoClient = mongo
+	s.syncStateManager.SetLastPollTime("shop.products", now.Add(-time.Minute))
+
+	// Changed after the last poll but before shutdown
+	mongo.docs = []bson.M{
+		{"_id": "late", "name": "late product", "updated_at": now.Add(-time.Second)},
+	}
+	s.Stop()
+
+	if _, found, _ := s.searchEngine.GetStoredField("products", "late", "name"); !found {
+		t.Error("Expected document changed just before shutdown to be indexed")
+	}
+
+	if state := s.syncStateManager.GetCollectionState("shop.products"); !state.LastPollTime.Equal(now.Add(-time.Second)) {
+		t.Errorf("Expected poll position to include the final poll, got %v", state.LastPollTime)
+	}
+}
+
+func TestService_BufferDocuments_Disabled(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{BulkIndexing: true, IndexBufferSize: 0})
+
+	s.bufferDocuments("products", "shop.products", makeDocs(0, 2), time.Time{})
+	if count := docCount(t, s); count != 2 {
+		t.Errorf("Expected documents to be committed immediately when buffering is disabled, got %d", count)
+	}
+}
+
+func BenchmarkService_BufferDocuments(b *testing.B) {
+	for _, bufferSize := range []int{0, 100} {
+		b.Run(fmt.Sprintf("buffer_%d", bufferSize), func(b *testing.B) {
+			s := newTestService(b, config.SearchConfig{BulkIndexing: true, IndexBufferSize: bufferSize, FlushInterval: 30})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.bufferDocuments("products", "shop.products", makeDocs(i*5, 5), time.Time{})
+			}
+			s.flushBuffers()
+		})
+	}
+}
+
+func TestSplitBatch(t *testing.T) {
+	tests := []struct {
+		docs, size int
+		expected   []int
+	}{
+		{docs: 10, size: 0, expected: []int{10}},
+		{docs: 10, size: 10, expected: []int{10}},
+		{docs: 10, size: 4, expected: []int{4, 4, 2}},
+		{docs: 8, size: 4, expected: []int{4, 4}},
+	}
+	for _, tt := range tests {
+		chunks := splitBatch(makeDocs(0, tt.docs), tt.size)
+		sizes := make([]int, 0, len(chunks))
+		for _, chunk := range chunks {
+			sizes = append(sizes, len(chunk))
+		}
+		if fmt.Sprint(sizes) != fmt.Sprint(tt.expected) {
+			t.Errorf("splitBatch(%d docs, %d): expected chunk sizes %v, got %v", tt.docs, tt.size, tt.expected, sizes)
+		}
+	}
+}
+
+// bleveBatches returns the number of batches Bleve has executed on the products index
+func bleveBatches(t *testing.T, s *Service) uint64 {
+	t.Helper()
+	index, _ := s.searchEngine.GetIndex("products")
+	stats, _ := index.StatsMap()["index"].(map[string]interface{})
+	batches, ok := stats["TotBatches"].(uint64)
+	if !ok {
+		t.Fatalf("Expected Bleve to report its batch count, got %v", stats["TotBatches"])
+	}
+	return batches
+}
+
+func TestService_IndexBatchBulk_CommitBatchSize(t *testing.T) {
+	// A fetch of 1000 documents is written in Bleve batches of 250
+	s := newTestService(t, config.SearchConfig{BulkIndexing: true, BatchSize: 1000, CommitBatchSize: 250})
+
+	before := bleveBatches(t, s)
+	s.indexBatch("products", "shop.products", makeDocs(0, 1000))
+	if batches := bleveBatches(t, s) - before; batches != 4 {
+		t.Errorf("Expected 4 Bleve batches, got %d", batches)
+	}
+	if count := docCount(t, s); count != 1000 {
+		t.Errorf("Expected 1000 indexed documents, got %d", count)
+	}
+
+	// Without commit_batch_size the whole fetch is one Bleve batch
+	s = newTestService(t, config.SearchConfig{BulkIndexing: true, BatchSize: 1000})
+	before = bleveBatches(t, s)
+	s.indexBatch("products", "shop.products", makeDocs(0, 1000))
+	if batches := bleveBatches(t, s) - before; batches != 1 {
+		t.Errorf("Expected 1 Bleve batch, got %d", batches)
+	}
+}
+
+func BenchmarkService_IndexBatchBulk(b *testing.B) {
+	for _, commitBatchSize := range []int{0, 250} {
+		b.Run(fmt.Sprintf("commit_batch_%d", commitBatchSize), func(b *testing.B) {
+			s := newTestService(b, config.SearchConfig{BulkIndexing: true, CommitBatchSize: commitBatchSize})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.indexBatch("products", "shop.products", makeDocs(i*1000, 1000))
+			}
+		})
+	}
+}
+
+func TestService_PrepareDocument_MaxDocumentBytes(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{MaxDocumentBytes: 200})
+
+	small := map[string]interface{}{"_id": "small", "name": "widget"}
+	prepared, ok := s.prepareDocument(small, s.config.Indexes[0], "_id", "shop.products")
+	if !ok {
+		t.Fatal("Expected small document to be kept")
+	}
+	if prepared["_id"] != "small" {
+		t.Errorf("Expected _id 'small', got %v", prepared["_id"])
+	}
+
+	large := map[string]interface{}{"_id": "large", "description": strings.Repeat("x", 500)}
+	if _, ok := s.prepareDocument(large, s.config.Indexes[0], "_id", "shop.products"); ok {
+		t.Error("Expected oversized document to be skipped")
+	}
+
+	state := s.syncStateManager.GetCollectionState("shop.products")
+	if state == nil || state.DocumentsFailed != 1 {
+		t.Errorf("Expected oversized document to be counted as failed, got %+v", state)
+	}
+}
+
+func TestService_PrepareDocument_MaxFieldLength(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{MaxFieldLength: 22})
+
+	long := map[string]interface{}{"_id": "long", "description": "alpha bravo charlie delta echo foxtrot"}
+	prepared, ok := s.prepareDocument(long, s.config.Indexes[0], "_id", "shop.products")
+	if !ok {
+		t.Fatal("Expected the document to be kept")
+	}
+	if prepared["description"] != "alpha bravo charlie de" {
+		t.Fatalf("Expected description cut to 22 characters, got %q", prepared["description"])
+	}
+	if err := s.searchEngine.IndexDocument("products", "long", prepared); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	// Words up to the cutoff are searchable, later ones aren't
+	for word, wantHits := range map[string]int{"alpha": 1, "charlie": 1, "delta": 0, "foxtrot": 0} {
+		result, err := s.searchEngine.Search(search.SearchRequest{
+			Index: "products",
+			Query: map[string]interface{}{"text": map[string]interface{}{"query": word, "path": "description"}},
+			Size:  10,
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(result.Hits) != wantHits {
+			t.Errorf("Expected %d hits for %q, got %d", wantHits, word, len(result.Hits))
+		}
+	}
+}
+
+func TestService_PrepareDocument_NoLimit(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{})
+
+	large := map[string]interface{}{"_id": "large", "description": strings.Repeat("x", 1<<20)}
+	if _, ok := s.prepareDocument(large, s.config.Indexes[0], "_id", "shop.products"); !ok {
+		t.Error("Expected document to be kept when max_document_bytes is unset")
+	}
+}
+
+// blockingCursor returns its documents and then blocks until the context passed
+// to Next is done, like a cursor waiting on a stalled server
+type blockingCursor struct {
+	docs    []bson.M
+	pos     int
+	err     error
+	blocked chan struct{}
+}
+
+func (c *blockingCursor) Next(ctx context.Context) bool {
+	if c.pos < len(c.docs) {
+		c.pos++
+		return true
+	}
+	close(c.blocked)
+	<-ctx.Done()
+	c.err = ctx.Err()
+	return false
+}
+
+func (c *blockingCursor) Decode(val interface{}) error {
+	*(val.(*bson.M)) = c.docs[c.pos-1]
+	return nil
+}
+
+func (c *blockingCursor) Err() error {
+	return c.err
+}
+
+func newBlockingCursor(count int) *blockingCursor {
+	cursor := &blockingCursor{blocked: make(chan struct{})}
+	for i := 0; i < count; i++ {
+		cursor.docs = append(cursor.docs, bson.M{"_id": fmt.Sprintf("doc%d", i), "name": fmt.Sprintf("product %d", i)})
+	}
+	return cursor
+}
+
+func TestService_IndexCursor_StopsOnShutdown(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{BatchSize: 100})
+	statePath := filepath.Join(t.TempDir(), "sync_state.json")
+	s.syncStateManager = syncstate.NewStateManager(statePath)
+
+	cursor := newBlockingCursor(3)
+	type indexResult struct {
+		count     int
+		completed bool
+	}
+	done := make(chan indexResult, 1)
+	go func() {
+		count, completed := s.indexCursor(context.Background(), cursor, s.config.Indexes[0], "shop.products", "_id")
+		done <- indexResult{count, completed}
+	}()
+
+	<-cursor.blocked
+	close(s.stopCh)
+
+	var result indexResult
+	select {
+	case result = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected indexing to stop promptly when the service stops")
+	}
+
+	if result.completed {
+		t.Error("Expected interrupted indexing not to be reported as completed")
+	}
+	if result.count != 3 {
+		t.Errorf("Expected 3 documents indexed before shutdown, got %d", result.count)
+	}
+	if count := docCount(t, s); count != 3 {
+		t.Errorf("Expected documents read before shutdown to be indexed, got %d", count)
+	}
+
+	saved := syncstate.NewStateManager(statePath)
+	if err := saved.Load(); err != nil {
+		t.Fatalf("Failed to load saved sync state: %v", err)
+	}
+	if state := saved.GetCollectionState("shop.products"); state == nil || state.DocumentsIndexed != 3 {
+		t.Errorf("Expected partial progress to be saved, got %+v", state)
+	}
+}
+
+func TestService_IndexCursor_FetchTimeout(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{BatchSize: 100})
+	s.config.MongoDB.Timeout = 1
+
+	start := time.Now()
+	count, completed := s.indexCursor(context.Background(), newBlockingCursor(2), s.config.Indexes[0], "shop.products", "_id")
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected stalled fetch to time out after about 1s, took %v", elapsed)
+	}
+	if completed {
+		t.Error("Expected timed out indexing not to be reported as completed")
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 documents indexed before the timeout, got %d", count)
+	}
+}
+
+// slowCursor returns its documents, each after a delay
+type slowCursor struct {
+	blockingCursor
+	delay time.Duration
+}
+
+func (c *slowCursor) Next(ctx context.Context) bool {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		c.err = ctx.Err()
+		return false
+	}
+	if c.pos < len(c.docs) {
+		c.pos++
+		return true
+	}
+	return false
+}
+
+func TestService_IndexCursor_FetchTimeoutPerFetch(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{BatchSize: 100})
+	s.config.MongoDB.Timeout = 1
+
+	// Every fetch finishes within the timeout, though reading them all doesn't
+	cursor := &slowCursor{blockingCursor: *newBlockingCursor(4), delay: 400 * time.Millisecond}
+	count, completed := s.indexCursor(context.Background(), cursor, s.config.Indexes[0], "shop.products", "_id")
+	if !completed || cursor.err != nil {
+		t.Errorf("Expected slow fetches within the timeout to complete, got error %v", cursor.err)
+	}
+	if count != 4 {
+		t.Errorf("Expected all 4 documents indexed, got %d", count)
+	}
+}
+
+// fakeMongo serves documents from memory, filtering FindDocumentsSince on the
+// updated_at field like the real query does
+type fakeMongo struct {
+	docs   []bson.M
+	capped bool
+	tailed int // Number of tailable cursors opened
+}
+
+// newFakeCursor returns a cursor over docs holding no connection
+func newFakeCursor(docs []interface{}) (*mongodb.Cursor, error) {
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return mongodb.NewCursor(cursor), nil
+}
+
+func (f *fakeMongo) FindDocuments(collection string, filter bson.M, limit int64) (*mongodb.Cursor, error) {
+	docs := make([]interface{}, 0, len(f.docs))
+	for _, doc := range f.docs {
+		docs = append(docs, doc)
+	}
+	return newFakeCursor(docs)
+}
+
+func (f *fakeMongo) FindDocumentsSince(collection string, filter bson.M, timestampField string, since time.Time, limit int64) (*mongodb.Cursor, error) {
+	var matches []bson.M
+	for _, doc := range f.docs {
+		if doc[timestampField].(time.Time).After(since) {
+			matches = append(matches, doc)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i][timestampField].(time.Time).Before(matches[j][timestampField].(time.Time))
+	})
+	if limit > 0 && int64(len(matches)) > limit {
+		matches = matches[:limit]
+	}
+	docs := make([]interface{}, len(matches))
+	for i, doc := range matches {
+		docs[i] = doc
+	}
+	return newFakeCursor(docs)
+}
+
+func (f *fakeMongo) TailDocuments(collection string, filter bson.M, timestampField string, since time.Time) (*mongodb.Cursor, error) {
+	f.tailed++
+	return f.FindDocumentsSince(collection, filter, timestampField, since, 0)
+}
+
+func (f *fakeMongo) IsCapped(collection string) (bool, error) {
+	return f.capped, nil
+}
+
+func (f *fakeMongo) CountDocuments(collection string, filter bson.M) (int64, error) {
+	return int64(len(f.docs)), nil
+}
+
+func (f *fakeMongo) GetLastDocumentTimestamp(collection, timestampField string) (time.Time, error) {
+	return time.Now(), nil
+}
+
+func (f *fakeMongo) ParseTimestamp(timestamp interface{}) (time.Time, error) {
+	return (&mongodb.Client{}).ParseTimestamp(timestamp)
+}
+
+func (f *fakeMongo) CheckTimestampField(collection, timestampField string) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeMongo) AddTimestampField(collection, timestampField string) error {
+	return nil
+}
+
+func (f *fakeMongo) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeMongo) Reconnect(ctx context.Context) error {
+	return nil
+}
+
+// newPollingTestService creates a test service reading from fake MongoDB
+// documents whose polling has caught up to now
+func newPollingTestService(t *testing.T, docs []bson.M) *Service {
+	t.Helper()
+	s := newTestService(t, config.SearchConfig{BatchSize: 100})
+	s.mongoClient = &fakeMongo{docs: docs}
+	s.syncStateManager.UpdateCollectionState("shop.products", &syncstate.CollectionState{
+		LastPollTime:   time.Now(),
+		IndexName:      "products",
+		CollectionKey:  "shop.products",
+		TimestampField: "updated_at",
+		IDField:        "_id",
+	})
+	return s
+}
+
+func TestService_Repoll(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	s := newPollingTestService(t, []bson.M{
+		{"_id": "recent", "name": "recent product", "updated_at": now.Add(-2 * time.Hour)},
+		{"_id": "old", "name": "old product", "updated_at": now.Add(-30 * time.Hour)},
+		{"_id": "newest", "name": "newest product", "updated_at": now.Add(-10 * time.Minute)},
+	})
+
+	// A regular poll finds nothing newer than the current position
+	if count, err := s.performPoll(context.Background(), s.config.Indexes[0]); err != nil || count != 0 {
+		t.Fatalf("Expected regular poll to find no documents, got %d (%v)", count, err)
+	}
+
+	count, err := s.Repoll(context.Background(), "products", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("Repoll failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 documents changed in the last 24h to be polled, got %d", count)
+	}
+	if indexed := docCount(t, s); indexed != 2 {
+		t.Errorf("Expected 2 documents to be re-indexed, got %d", indexed)
+	}
+	for docID, expected := range map[string]bool{"recent": true, "newest": true, "old": false} {
+		if _, found, _ := s.searchEngine.GetStoredField("products", docID, "name"); found != expected {
+			t.Errorf("Expected document %s indexed=%v, got %v", docID, expected, found)
+		}
+	}
+
+	state := s.syncStateManager.GetCollectionState("shop.products")
+	if !state.LastPollTime.Equal(now.Add(-10 * time.Minute)) {
+		t.Errorf("Expected poll position to advance to the newest document, got %v", state.LastPollTime)
+	}
+}
+
+func TestService_Repoll_PollsEveryBatch(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	var docs []bson.M
+	for i := 0; i < 25; i++ {
+		docs = append(docs, bson.M{"_id": fmt.Sprintf("doc%d", i), "name": "product", "updated_at": now.Add(-time.Duration(25-i) * time.Minute)})
+	}
+	s := newPollingTestService(t, docs)
+	s.config.Search.BatchSize = 10
+
+	count, err := s.Repoll(context.Background(), "products", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Repoll failed: %v", err)
+	}
+	if count != 25 {
+		t.Errorf("Expected all 25 documents to be polled across batches, got %d", count)
+	}
+	s.flushBuffers()
+	if indexed := docCount(t, s); indexed != 25 {
+		t.Errorf("Expected 25 documents to be re-indexed, got %d", indexed)
+	}
+}
+
+func TestService_Repoll_Errors(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{BatchSize: 100})
+
+	if _, err := s.Repoll(context.Background(), "missing", time.Now()); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error for unknown index, got %v", err)
+	}
+	if _, err := s.Repoll(context.Background(), "products", time.Now()); !errors.Is(err, ErrPollingNotStarted) {
+		t.Errorf("Expected ErrPollingNotStarted before polling has started, got %v", err)
+	}
+}
+
+func TestService_Repoll_ConcurrentWithPolling(t *testing.T) {
+	now := time.Now().UTC()
+	s := newPollingTestService(t, []bson.M{
+		{"_id": "doc1", "updated_at": now.Add(-time.Hour)},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.performPoll(context.Background(), s.config.Indexes[0])
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := s.Repoll(context.Background(), "products", now.Add(-2*time.Hour)); err != nil {
+				t.Errorf("Repoll failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if indexed := docCount(t, s); indexed != 1 {
+		t.Errorf("Expected 1 document, got %d", indexed)
+	}
+}
+
+// flakyMongo is a fake MongoDB whose connection is down until it has been
+// re-established, failing the given number of reconnect attempts first
+type flakyMongo struct {
+	*fakeMongo
+	down             bool
+	failedReconnects int
+	attempts         int
+}
+
+func (f *flakyMongo) FindDocumentsSince(collection string, filter bson.M, timestampField string, since time.Time, limit int64) (*mongodb.Cursor, error) {
+	if f.down {
+		return nil, errors.New("connection closed")
+	}
+	return f.fakeMongo.FindDocumentsSince(collection, filter, timestampField, since, limit)
+}
+
+func (f *flakyMongo) Ping(ctx context.Context) error {
+	if f.down {
+		return errors.New("connection closed")
+	}
+	return nil
+}
+
+func (f *flakyMongo) Reconnect(ctx context.Context) error {
+	f.attempts++
+	if f.attempts <= f.failedReconnects {
+		return errors.New("server selection timeout")
+	}
+	f.down = false
+	return nil
+}
+
+func TestService_PollReconnectsAfterFailure(t *testing.T) {
+	defer func(initial, max time.Duration) {
+		reconnectBackoff, maxReconnectBackoff = initial, max
+	}(reconnectBackoff, maxReconnectBackoff)
+	reconnectBackoff, maxReconnectBackoff = time.Millisecond, 4*time.Millisecond
+
+	now := time.Now().UTC()
+	s := newPollingTestService(t, []bson.M{
+		{"_id": "doc1", "updated_at": now.Add(-time.Hour)},
+	})
+	flaky := &flakyMongo{fakeMongo: s.mongoClient.(*fakeMongo), down: true, failedReconnects: 3}
+	s.mongoClient = flaky
+	s.syncStateManager.SetLastPollTime("shop.products", now.Add(-2*time.Hour))
+
+	if _, err := s.performPoll(context.Background(), s.config.Indexes[0]); err == nil {
+		t.Fatal("Expected poll to fail while MongoDB is down")
+	}
+
+	s.ensureConnection(context.Background())
+	if flaky.attempts != 4 {
+		t.Errorf("Expected 3 failed reconnects and 1 successful one, got %d attempts", flaky.attempts)
+	}
+
+	count, err := s.performPoll(context.Background(), s.config.Indexes[0])
+	if err != nil {
+		t.Fatalf("Expected polling to resume after reconnecting, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 document to be polled, got %d", count)
+	}
+
+	// A healthy connection isn't replaced
+	s.ensureConnection(context.Background())
+	if flaky.attempts != 4 {
+		t.Errorf("Expected no reconnect while MongoDB is reachable, got %d attempts", flaky.attempts)
+	}
+}
+
+func TestService_EnsureConnection_StopsOnShutdown(t *testing.T) {
+	defer func(initial time.Duration) { reconnectBackoff = initial }(reconnectBackoff)
+	reconnectBackoff = time.Hour
+
+	s := newPollingTestService(t, nil)
+	s.mongoClient = &flakyMongo{fakeMongo: s.mongoClient.(*fakeMongo), down: true, failedReconnects: 1}
+	close(s.stopCh)
+
+	done := make(chan struct{})
+	go func() {
+		s.ensureConnection(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected reconnecting to stop when the service stops")
+	}
+}
+
+func TestService_Start_RunsWarmupQueries(t *testing.T) {
+	s := newPollingTestService(t, nil)
+	s.config.Search.FlushInterval = 30
+	s.config.Indexes[0].WarmupQuery = map[string]interface{}{
+		"text": map[string]interface{}{"query": "laptop", "path": "name"},
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start service: %v", err)
+	}
+	defer s.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.WarmingUp() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected warm-up to finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := indexSearches(t, s); count != 1 {
+		t.Errorf("Expected 1 warm-up query during startup, got %d", count)
+	}
+}
+
+// indexSearches returns the number of searches Bleve has run on the products index
+func indexSearches(t *testing.T, s *Service) uint64 {
+	t.Helper()
+	index, _ := s.searchEngine.GetIndex("products")
+	searches, ok := index.StatsMap()["searches"].(uint64)
+	if !ok {
+		t.Fatalf("Expected Bleve to report its search count, got %v", index.StatsMap()["searches"])
+	}
+	return searches
+}
+
+func TestService_Warmup_BestEffort(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{})
+	s.config.Indexes[0].WarmupQuery = map[string]interface{}{"match_all": map[string]interface{}{}}
+	s.config.Indexes = append([]config.IndexConfig{{
+		Name:        "missing",
+		WarmupQuery: map[string]interface{}{"match_all": map[string]interface{}{}},
+	}}, s.config.Indexes...)
+
+	// A failing warm-up query doesn't stop the others or keep the service warming up
+	s.warmingUp.Store(true)
+	s.warmup()
+	if s.WarmingUp() {
+		t.Error("Expected warm-up to be finished")
+	}
+	if count := indexSearches(t, s); count != 1 {
+		t.Errorf("Expected the warm-up query after the failed one to run, got %d searches", count)
+	}
+}
+
+// streamCursor is a tailable cursor delivering documents sent on docs as they
+// arrive. Next blocks until a document is sent, docs is closed or ctx is done.
+type streamCursor struct {
+	docs    chan bson.M
+	current bson.M
+}
+
+func (c *streamCursor) Next(ctx context.Context) bool {
+	select {
+	case doc, ok := <-c.docs:
+		c.current = doc
+		return ok
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *streamCursor) Decode(val interface{}) error {
+	*val.(*bson.M) = c.current
+	return nil
+}
+
+func (c *streamCursor) Err() error {
+	return nil
+}
+
+func TestService_TailCursor_StreamsDocuments(t *testing.T) {
+	start := time.Now().UTC().Truncate(time.Millisecond)
+	s := newPollingTestService(t, nil)
+	s.syncStateManager.SetLastPollTime("shop.products", start)
+
+	cursor := &streamCursor{docs: make(chan bson.M)}
+	done := make(chan int)
+	go func() {
+		count, err := s.tailCursor(context.Background(), cursor, s.config.Indexes[0], "shop.products")
+		if err != nil {
+			t.Errorf("Tailing failed: %v", err)
+		}
+		done <- count
+	}()
+
+	// Each document is buffered as soon as it arrives, before the cursor ends
+	for i := 1; i <= 3; i++ {
+		cursor.docs <- bson.M{"_id": fmt.Sprintf("event%d", i), "name": "event", "updated_at": start.Add(time.Duration(i) * time.Minute)}
+	}
+	cursor.docs <- bson.M{"_id": "event4", "name": "event", "updated_at": start.Add(4 * time.Minute)}
+	s.flushBuffers()
+	if indexed := docCount(t, s); indexed < 3 {
+		t.Errorf("Expected streamed documents to be indexed while the cursor is open, got %d", indexed)
+	}
+
+	close(cursor.docs)
+	if count := <-done; count != 4 {
+		t.Errorf("Expected 4 streamed documents, got %d", count)
+	}
+	s.flushBuffers()
+	if indexed := docCount(t, s); indexed != 4 {
+		t.Errorf("Expected 4 documents to be indexed, got %d", indexed)
+	}
+
+	state := s.syncStateManager.GetCollectionState("shop.products")
+	if !state.LastPollTime.Equal(start.Add(4 * time.Minute)) {
+		t.Errorf("Expected poll position to follow the newest streamed document, got %v", state.LastPollTime)
+	}
+}
+
+func TestService_TailCursor_StopsWithService(t *testing.T) {
+	s := newPollingTestService(t, nil)
+	cursor := &streamCursor{docs: make(chan bson.M)}
+
+	done := make(chan error)
+	go func() {
+		_, err := s.tailCursor(context.Background(), cursor, s.config.Indexes[0], "shop.products")
+		done <- err
+	}()
+
+	close(s.stopCh)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected tailing to stop cleanly, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a blocked tailable cursor to be released when the service stops")
+	}
+}
+
+func TestService_TailForChanges(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	s := newPollingTestService(t, []bson.M{
+		{"_id": "new", "name": "new event", "updated_at": now.Add(time.Minute)},
+	})
+	fake := s.mongoClient.(*fakeMongo)
+
+	// Collections that aren't capped can't be tailed, so they're polled instead
+	if s.tailForChanges(context.Background(), s.config.Indexes[0], "shop.products", time.Millisecond) {
+		t.Error("Expected tailing a collection that isn't capped to fall back to polling")
+	}
+	if fake.tailed != 0 {
+		t.Errorf("Expected no tailable cursor on a collection that isn't capped, got %d", fake.tailed)
+	}
+
+	fake.capped = true
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		done <- s.tailForChanges(ctx, s.config.Indexes[0], "shop.products", 10*time.Millisecond)
+	}()
+
+	// The fake cursor dies after its documents, so the tail is reopened from the new position
+	deadline := time.Now().Add(5 * time.Second)
+	for docCount(t, s) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		s.flushBuffers()
+	}
+	cancel()
+	if tailed := <-done; !tailed {
+		t.Error("Expected a capped collection to be tailed")
+	}
+	if indexed := docCount(t, s); indexed != 1 {
+		t.Errorf("Expected the tailed document to be indexed, got %d", indexed)
+	}
+	if fake.tailed < 1 {
+		t.Error("Expected a tailable cursor to be opened")
+	}
+}
+
+func TestService_LeaderOnlyIndexing(t *testing.T) {
+	s := newPollingTestService(t, nil)
+	fake := &failingMongo{fakeMongo: fakeMongo{docs: []bson.M{
+		{"_id": "doc1", "name": "widget", "updated_at": time.Now().Add(time.Hour)},
+	}}}
+	s.mongoClient = fake
+	s.config.Search.FlushInterval = 1
+	s.config.Cluster = config.ClusterConfig{Enabled: true, LeaderOnlyIndexing: true}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start service: %v", err)
+	}
+	defer s.Stop()
+
+	// A follower doesn't index until it becomes the leader
+	if s.Indexing() {
+		t.Fatal("Expected no indexing before becoming leader")
+	}
+
+	// Becoming leader starts indexing, and losing leadership stops it, as
+	// often as leadership changes
+	for term := 1; term <= 2; term++ {
+		if term == 2 {
+			// Added to MongoDB while this node was a follower
+			fake.docs = append(fake.docs, bson.M{"_id": "doc2", "name": "gadget", "updated_at": time.Now().Add(time.Hour)})
+		}
+
+		s.StartIndexing()
+		s.StartIndexing()
+		if !s.Indexing() {
+			t.Fatalf("Term %d: expected indexing after becoming leader", term)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for docCount(t, s) != uint64(term) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Term %d: expected the leader to index %d documents", term, term)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		s.StopIndexing()
+		s.StopIndexing()
+		if s.Indexing() {
+			t.Fatalf("Term %d: expected indexing to stop after losing leadership", term)
+		}
+		calls := fake.calls
+		time.Sleep(1500 * time.Millisecond)
+		if fake.calls != calls {
+			t.Errorf("Term %d: expected no MongoDB queries after losing leadership, got %d", term, fake.calls-calls)
+		}
+
+		// Documents indexed while leading stay searchable
+		if count := docCount(t, s); count != uint64(term) {
+			t.Errorf("Term %d: expected %d searchable documents, got %d", term, term, count)
+		}
+	}
+}
+
+func TestService_Stop_FollowerSkipsFinalSync(t *testing.T) {
+	s := newPollingTestService(t, nil)
+	fake := &failingMongo{}
+	s.mongoClient = fake
+	s.config.Cluster = config.ClusterConfig{Enabled: true, LeaderOnlyIndexing: true}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start service: %v", err)
+	}
+	s.Stop()
+
+	if fake.calls != 0 {
+		t.Errorf("Expected a follower to stop without querying MongoDB, got %d queries", fake.calls)
+	}
+
+	// Indexing can't start once the service has stopped
+	s.StartIndexing()
+	if s.Indexing() {
+		t.Error("Expected no indexing after Stop")
+	}
+}
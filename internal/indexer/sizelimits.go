@@ -0,0 +1,22 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// validateSizeLimits checks that default_size and max_size aren't negative and
+// that the default size is within the maximum
+func validateSizeLimits(indexCfg config.IndexConfig) error {
+	if indexCfg.DefaultSize < 0 {
+		return fmt.Errorf("invalid default_size %d: must not be negative", indexCfg.DefaultSize)
+	}
+	if indexCfg.MaxSize < 0 {
+		return fmt.Errorf("invalid max_size %d: must not be negative", indexCfg.MaxSize)
+	}
+	if defaultSize, maxSize := indexCfg.SearchSizeLimits(); defaultSize > maxSize {
+		return fmt.Errorf("default_size %d is larger than max_size %d", defaultSize, maxSize)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+func TestValidateSizeLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultSize int
+		maxSize     int
+		wantErr     bool
+	}{
+		{"unset", 0, 0, false},
+		{"both set", 5, 20, false},
+		{"default at max", 20, 20, false},
+		{"only max below global default", 0, 3, false},
+		{"default above max", 21, 20, true},
+		{"default above global max", 2000, 0, true},
+		{"negative default", -1, 0, true},
+		{"negative max", 0, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSizeLimits(config.IndexConfig{DefaultSize: tt.defaultSize, MaxSize: tt.maxSize})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSizeLimits(%d, %d) error = %v, wantErr %t", tt.defaultSize, tt.maxSize, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// Strict mapping modes selectable per index with strict_mapping. They only
+// apply to indexes with a static (dynamic: false) mapping.
+const (
+	// StrictMappingWarn logs documents carrying fields that aren't mapped
+	StrictMappingWarn = "warn"
+	// StrictMappingReject skips such documents and counts them as failed
+	StrictMappingReject = "reject"
+)
+
+// validateStrictMapping checks that mode is empty or a known strict mapping mode
+func validateStrictMapping(mode string) error {
+	switch mode {
+	case "", StrictMappingWarn, StrictMappingReject:
+		return nil
+	default:
+		return fmt.Errorf("unknown strict_mapping %q (expected warn or reject)", mode)
+	}
+}
+
+// unmappedFields returns the sorted dotted paths of document fields that a
+// static mapping doesn't cover. Fields below a mapped path count as mapped, and
+// the ID fields are always allowed. Dynamic mappings cover every field.
+func unmappedFields(doc map[string]interface{}, def config.IndexDefinition, idField string) []string {
+	if def.Mappings.Dynamic {
+		return nil
+	}
+
+	mapped := map[string]bool{"_id": true, idField: true}
+	for _, field := range def.Mappings.Fields {
+		mapped[field.Name] = true
+		if field.Field != "" {
+			mapped[field.Field] = true
+		}
+	}
+
+	var unmapped []string
+	collectUnmappedFields(doc, "", mapped, &unmapped)
+	sort.Strings(unmapped)
+	return unmapped
+}
+
+// collectUnmappedFields walks a (sub-)document and records leaf paths that
+// neither are nor lie below a mapped path
+func collectUnmappedFields(value interface{}, path string, mapped map[string]bool, unmapped *[]string) {
+	if path != "" && mapped[path] {
+		return
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			collectUnmappedFields(child, childPath, mapped, unmapped)
+		}
+	case []interface{}:
+		// Array elements share the array's path
+		for _, element := range typed {
+			collectUnmappedFields(element, path, mapped, unmapped)
+		}
+	default:
+		if path != "" && !slices.Contains(*unmapped, path) {
+			*unmapped = append(*unmapped, path)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// staticDefinition maps title, a nested author.name field and tags
+func staticDefinition() config.IndexDefinition {
+	return config.IndexDefinition{
+		Mappings: config.IndexMappings{
+			Dynamic: false,
+			Fields: []config.FieldConfig{
+				{Name: "title", Type: "text"},
+				{Name: "author_name", Field: "author.name", Type: "text"},
+				{Name: "tags", Type: "token"},
+			},
+		},
+	}
+}
+
+func TestUnmappedFields(t *testing.T) {
+	doc := map[string]interface{}{
+		"_id":   "1",
+		"sku":   "A-1",
+		"title": "Go in Action",
+		"author": map[string]interface{}{
+			"name":    "Jane",
+			"country": "NL",
+		},
+		"tags": []interface{}{"go", "books"},
+		"reviews": []interface{}{
+			map[string]interface{}{"rating": 5},
+			map[string]interface{}{"rating": 4, "text": "good"},
+		},
+	}
+
+	got := unmappedFields(doc, staticDefinition(), "sku")
+	want := []string{"author.country", "reviews.rating", "reviews.text"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected unmapped fields %v, got %v", want, got)
+	}
+}
+
+func TestUnmappedFields_Dynamic(t *testing.T) {
+	def := config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}
+	doc := map[string]interface{}{"_id": "1", "anything": "goes"}
+
+	if got := unmappedFields(doc, def, "_id"); got != nil {
+		t.Errorf("Expected no unmapped fields for a dynamic mapping, got %v", got)
+	}
+}
+
+func TestValidateStrictMapping(t *testing.T) {
+	for _, mode := range []string{"", StrictMappingWarn, StrictMappingReject} {
+		if err := validateStrictMapping(mode); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", mode, err)
+		}
+	}
+	if err := validateStrictMapping("strict"); err == nil {
+		t.Error("Expected an error for an unknown strict_mapping mode")
+	}
+}
+
+func TestService_PrepareDocument_StrictMapping(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{})
+
+	indexCfg := s.config.Indexes[0]
+	indexCfg.Definition = staticDefinition()
+
+	mapped := map[string]interface{}{"_id": "mapped", "title": "widget"}
+	extra := func() map[string]interface{} {
+		return map[string]interface{}{"_id": "extra", "title": "widget", "color": "red"}
+	}
+
+	indexCfg.StrictMapping = StrictMappingWarn
+	if _, ok := s.prepareDocument(extra(), indexCfg, "_id", "shop.products"); !ok {
+		t.Error("Expected document with unmapped fields to be kept in warn mode")
+	}
+
+	indexCfg.StrictMapping = StrictMappingReject
+	if _, ok := s.prepareDocument(mapped, indexCfg, "_id", "shop.products"); !ok {
+		t.Error("Expected fully mapped document to be kept in reject mode")
+	}
+	if _, ok := s.prepareDocument(extra(), indexCfg, "_id", "shop.products"); ok {
+		t.Error("Expected document with unmapped fields to be rejected")
+	}
+
+	state := s.syncStateManager.GetCollectionState("shop.products")
+	if state == nil || state.DocumentsFailed != 1 {
+		t.Errorf("Expected the rejected document to be counted as failed, got %+v", state)
+	}
+}
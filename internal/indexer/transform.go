@@ -0,0 +1,125 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// Transform types selectable per index in transforms
+const (
+	// TransformRename moves field to target, replacing any value there
+	TransformRename = "rename"
+	// TransformConcat joins the values of fields with separator into target
+	TransformConcat = "concat"
+	// TransformLowercase lowercases the string values of field
+	TransformLowercase = "lowercase"
+	// TransformDrop removes field
+	TransformDrop = "drop"
+)
+
+// validateTransforms checks that every transform of an index has a known type
+// and the fields its type needs, and that none of them changes the ID fields
+func validateTransforms(indexCfg config.IndexConfig) error {
+	idField := indexCfg.IDField
+	if idField == "" {
+		idField = "_id"
+	}
+	isIDField := func(field string) bool {
+		return field == "_id" || field == idField
+	}
+
+	for i, transform := range indexCfg.Transforms {
+		var written []string
+		switch transform.Type {
+		case TransformRename:
+			if transform.Field == "" || transform.Target == "" {
+				return fmt.Errorf("transform %d: rename requires field and target", i)
+			}
+			written = []string{transform.Field, transform.Target}
+		case TransformConcat:
+			if len(transform.Fields) == 0 || transform.Target == "" {
+				return fmt.Errorf("transform %d: concat requires fields and target", i)
+			}
+			written = []string{transform.Target}
+		case TransformLowercase, TransformDrop:
+			if transform.Field == "" {
+				return fmt.Errorf("transform %d: %s requires field", i, transform.Type)
+			}
+			written = []string{transform.Field}
+		default:
+			return fmt.Errorf("transform %d: unknown type %q (expected rename, concat, lowercase or drop)", i, transform.Type)
+		}
+
+		for _, field := range written {
+			if isIDField(field) {
+				return fmt.Errorf("transform %d: %s must not change the ID field '%s'", i, transform.Type, field)
+			}
+		}
+	}
+	return nil
+}
+
+// applyTransforms applies the transforms of an index to a normalized document
+// in order, so later transforms see the fields written by earlier ones
+func applyTransforms(doc map[string]interface{}, transforms []config.TransformConfig) map[string]interface{} {
+	for _, transform := range transforms {
+		switch transform.Type {
+		case TransformRename:
+			if value, exists := doc[transform.Field]; exists {
+				delete(doc, transform.Field)
+				doc[transform.Target] = value
+			}
+		case TransformConcat:
+			if joined, ok := concatFields(doc, transform.Fields, transform.Separator); ok {
+				doc[transform.Target] = joined
+			}
+		case TransformLowercase:
+			if value, exists := doc[transform.Field]; exists {
+				doc[transform.Field] = lowercaseValue(value)
+			}
+		case TransformDrop:
+			delete(doc, transform.Field)
+		}
+	}
+	return doc
+}
+
+// concatFields joins the values of fields with separator, skipping fields that
+// are missing or null. It returns false if none of the fields has a value.
+func concatFields(doc map[string]interface{}, fields []string, separator string) (string, bool) {
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		value, exists := doc[field]
+		if !exists || value == nil {
+			continue
+		}
+		if str, ok := value.(string); ok {
+			parts = append(parts, str)
+		} else {
+			parts = append(parts, fmt.Sprintf("%v", value))
+		}
+	}
+	if len(parts) == 0 {
+		return "", false
+	}
+	return strings.Join(parts, separator), true
+}
+
+// lowercaseValue lowercases a string, or the strings in an array, leaving
+// other values unchanged
+func lowercaseValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.ToLower(v)
+	case []interface{}:
+		lowered := make([]interface{}, len(v))
+		for i, elem := range v {
+			lowered[i] = lowercaseValue(elem)
+		}
+		return lowered
+	default:
+		return value
+	}
+}
@@ -0,0 +1,165 @@
+package indexer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// sampleCustomer is a normalized document the transforms are applied to
+func sampleCustomer() map[string]interface{} {
+	return map[string]interface{}{
+		"_id":      "c1",
+		"first":    "Ada",
+		"last":     "Lovelace",
+		"email":    "Ada@Example.COM",
+		"tags":     []interface{}{"VIP", "Newsletter", 3.0},
+		"age":      36.0,
+		"password": "secret",
+	}
+}
+
+func TestApplyTransforms(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms []config.TransformConfig
+		want       map[string]interface{} // Fields expected after the transforms
+		missing    []string               // Fields expected to be gone
+	}{
+		{
+			name:       "rename",
+			transforms: []config.TransformConfig{{Type: TransformRename, Field: "first", Target: "first_name"}},
+			want:       map[string]interface{}{"first_name": "Ada"},
+			missing:    []string{"first"},
+		},
+		{
+			name:       "rename of a missing field",
+			transforms: []config.TransformConfig{{Type: TransformRename, Field: "middle", Target: "middle_name"}},
+			missing:    []string{"middle", "middle_name"},
+		},
+		{
+			name:       "concat",
+			transforms: []config.TransformConfig{{Type: TransformConcat, Fields: []string{"first", "last"}, Target: "full_name", Separator: " "}},
+			want:       map[string]interface{}{"full_name": "Ada Lovelace", "first": "Ada", "last": "Lovelace"},
+		},
+		{
+			name:       "concat skips missing fields and formats other values",
+			transforms: []config.TransformConfig{{Type: TransformConcat, Fields: []string{"last", "middle", "age"}, Target: "label", Separator: "-"}},
+			want:       map[string]interface{}{"label": "Lovelace-36"},
+		},
+		{
+			name:       "concat without values",
+			transforms: []config.TransformConfig{{Type: TransformConcat, Fields: []string{"middle"}, Target: "label"}},
+			missing:    []string{"label"},
+		},
+		{
+			name: "lowercase",
+			transforms: []config.TransformConfig{
+				{Type: TransformLowercase, Field: "email"},
+				{Type: TransformLowercase, Field: "tags"},
+				{Type: TransformLowercase, Field: "age"},
+			},
+			want: map[string]interface{}{"email": "ada@example.com", "tags": []interface{}{"vip", "newsletter", 3.0}, "age": 36.0},
+		},
+		{
+			name:       "drop",
+			transforms: []config.TransformConfig{{Type: TransformDrop, Field: "password"}},
+			missing:    []string{"password"},
+		},
+		{
+			name: "applied in order",
+			transforms: []config.TransformConfig{
+				{Type: TransformConcat, Fields: []string{"first", "last"}, Target: "full_name", Separator: " "},
+				{Type: TransformLowercase, Field: "full_name"},
+				{Type: TransformDrop, Field: "first"},
+				{Type: TransformDrop, Field: "last"},
+			},
+			want:    map[string]interface{}{"full_name": "ada lovelace"},
+			missing: []string{"first", "last"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := applyTransforms(sampleCustomer(), tt.transforms)
+			for field, want := range tt.want {
+				if got := doc[field]; !reflect.DeepEqual(got, want) {
+					t.Errorf("Expected %s to be %v, got %v", field, want, got)
+				}
+			}
+			for _, field := range tt.missing {
+				if value, exists := doc[field]; exists {
+					t.Errorf("Expected %s to be absent, got %v", field, value)
+				}
+			}
+			if doc["_id"] != "c1" {
+				t.Errorf("Expected the ID to be unchanged, got %v", doc["_id"])
+			}
+		})
+	}
+}
+
+func TestValidateTransforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		idField   string
+		transform config.TransformConfig
+		wantError string
+	}{
+		{name: "rename", transform: config.TransformConfig{Type: TransformRename, Field: "a", Target: "b"}},
+		{name: "concat", transform: config.TransformConfig{Type: TransformConcat, Fields: []string{"a", "b"}, Target: "c"}},
+		{name: "lowercase", transform: config.TransformConfig{Type: TransformLowercase, Field: "a"}},
+		{name: "drop", transform: config.TransformConfig{Type: TransformDrop, Field: "a"}},
+		{name: "unknown type", transform: config.TransformConfig{Type: "script", Field: "a"}, wantError: "unknown type"},
+		{name: "rename without target", transform: config.TransformConfig{Type: TransformRename, Field: "a"}, wantError: "requires field and target"},
+		{name: "concat without fields", transform: config.TransformConfig{Type: TransformConcat, Target: "c"}, wantError: "requires fields and target"},
+		{name: "drop without field", transform: config.TransformConfig{Type: TransformDrop}, wantError: "requires field"},
+		{name: "drop _id", transform: config.TransformConfig{Type: TransformDrop, Field: "_id"}, wantError: "must not change the ID field"},
+		{name: "rename id_field", idField: "sku", transform: config.TransformConfig{Type: TransformRename, Field: "sku", Target: "code"}, wantError: "must not change the ID field"},
+		{name: "concat into id_field", idField: "sku", transform: config.TransformConfig{Type: TransformConcat, Fields: []string{"a"}, Target: "sku"}, wantError: "must not change the ID field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexCfg := config.IndexConfig{IDField: tt.idField, Transforms: []config.TransformConfig{tt.transform}}
+			err := validateTransforms(indexCfg)
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestService_PrepareDocument_Transforms(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{})
+
+	indexCfg := s.config.Indexes[0]
+	indexCfg.Definition = config.IndexDefinition{Mappings: config.IndexMappings{
+		Fields: []config.FieldConfig{{Name: "full_name", Type: "text"}},
+	}}
+	indexCfg.StrictMapping = StrictMappingReject
+	indexCfg.Transforms = []config.TransformConfig{
+		{Type: TransformConcat, Fields: []string{"first", "last"}, Target: "full_name", Separator: " "},
+		{Type: TransformDrop, Field: "first"},
+		{Type: TransformDrop, Field: "last"},
+	}
+
+	// The mapping is checked against the transformed document
+	doc := map[string]interface{}{"_id": "c1", "first": "Ada", "last": "Lovelace"}
+	prepared, ok := s.prepareDocument(doc, indexCfg, "_id", "shop.products")
+	if !ok {
+		t.Fatal("Expected the transformed document to be kept")
+	}
+	want := map[string]interface{}{"_id": "c1", "full_name": "Ada Lovelace"}
+	if !reflect.DeepEqual(prepared, want) {
+		t.Errorf("Expected %v, got %v", want, prepared)
+	}
+}
@@ -0,0 +1,122 @@
+package indexer
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SyncVerification is the result of comparing an index's document count with
+// its collection's after an initial sync
+type SyncVerification struct {
+	IndexedDocuments uint64    `json:"indexedDocuments"` // Unexpired documents in the index, each counted on its own shard only
+	SourceDocuments  int64     `json:"sourceDocuments"`  // Unexpired documents matching the index's filter once the sync finished
+	Tolerance        int64     `json:"tolerance"`        // Difference explained by documents changed or skipped during the sync
+	Matched          bool      `json:"matched"`          // Whether the counts differ by no more than the tolerance
+	Retries          int       `json:"retries"`          // Times the sync was rerun after a mismatch
+	VerifiedAt       time.Time `json:"verifiedAt"`
+}
+
+// syncSnapshot holds the counts an initial sync is verified against, taken
+// before it starts
+type syncSnapshot struct {
+	sourceDocuments int64 // -1 if the collection couldn't be counted
+	failedDocuments int64
+}
+
+// takeSyncSnapshot records the collection's document count and the documents
+// failed so far before an initial sync
+func (s *Service) takeSyncSnapshot(collectionKey string, sourceDocuments int64, countErr error) syncSnapshot {
+	snapshot := syncSnapshot{
+		sourceDocuments: sourceDocuments,
+		failedDocuments: s.syncStateManager.GetDocumentsFailed(collectionKey),
+	}
+	if countErr != nil {
+		snapshot.sourceDocuments = -1
+	}
+	return snapshot
+}
+
+// verifyInitialSync compares the document count of an index with its
+// collection's after an initial sync. Documents expired by the index's ttl are
+// left out of both counts, since the sweep may not have deleted them yet, and
+// stale copies on shards a document isn't routed to are not counted. Documents
+// inserted or deleted while the sync ran, and documents it skipped, may be
+// missing from or left in the index until the next poll, so the counts may
+// differ by that many. The result is recorded for SyncVerification and a
+// mismatch is logged.
+func (s *Service) verifyInitialSync(indexCfg config.IndexConfig, collectionKey string, filter bson.M, snapshot syncSnapshot, retries int) (SyncVerification, error) {
+	var ttlField string
+	var cutoff time.Time
+	if indexCfg.TTLField != "" && indexCfg.TTL > 0 {
+		ttlField = indexCfg.TTLField
+		cutoff = time.Now().Add(-time.Duration(indexCfg.TTL) * time.Second)
+		// Documents without the field never expire, as in the index
+		filter = bson.M{"$and": bson.A{filter, bson.M{ttlField: bson.M{"$not": bson.M{"$lt": cutoff}}}}}
+	}
+
+	sourceDocuments, err := s.mongoClient.CountDocuments(indexCfg.Collection, filter)
+	if err != nil {
+		return SyncVerification{}, fmt.Errorf("failed to count documents in %s: %w", collectionKey, err)
+	}
+	indexedDocuments, err := s.searchEngine.CountLiveDocuments(indexCfg.Name, ttlField, cutoff)
+	if err != nil {
+		return SyncVerification{}, fmt.Errorf("failed to count documents in index %s: %w", indexCfg.Name, err)
+	}
+
+	var tolerance int64
+	if snapshot.sourceDocuments >= 0 {
+		tolerance = abs(sourceDocuments - snapshot.sourceDocuments)
+	}
+	tolerance += s.syncStateManager.GetDocumentsFailed(collectionKey) - snapshot.failedDocuments
+
+	verification := SyncVerification{
+		IndexedDocuments: indexedDocuments,
+		SourceDocuments:  sourceDocuments,
+		Tolerance:        tolerance,
+		Matched:          abs(int64(indexedDocuments)-sourceDocuments) <= tolerance,
+		Retries:          retries,
+		VerifiedAt:       time.Now(),
+	}
+	if !verification.Matched {
+		log.Printf("Document count mismatch after initial sync of %s: index %s has %d documents, collection has %d (tolerance %d)",
+			collectionKey, indexCfg.Name, verification.IndexedDocuments, verification.SourceDocuments, verification.Tolerance)
+	}
+
+	s.verifyMutex.Lock()
+	if s.verifications == nil {
+		s.verifications = make(map[string]SyncVerification)
+	}
+	s.verifications[indexCfg.Name] = verification
+	s.verifyMutex.Unlock()
+
+	return verification, nil
+}
+
+// missingDocuments reports whether the index was short of documents, which
+// syncing again can fix. Surplus documents are ones the collection no longer
+// has, and another sync would leave them in place.
+func (v SyncVerification) missingDocuments() bool {
+	return int64(v.IndexedDocuments)+v.Tolerance < v.SourceDocuments
+}
+
+// SyncVerification returns the result of verifying an index's document count
+// after its last initial sync, and false if it wasn't verified
+func (s *Service) SyncVerification(indexName string) (SyncVerification, bool) {
+	s.verifyMutex.RLock()
+	defer s.verifyMutex.RUnlock()
+
+	verification, exists := s.verifications[indexName]
+	return verification, exists
+}
+
+// abs returns the absolute value of n
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
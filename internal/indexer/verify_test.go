@@ -0,0 +1,158 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/davidschrooten/open-atlas-search/internal/mongodb"
+)
+
+// miscountingMongo serves fakeMongo documents but reports the collection
+// counts in counts, one per call, repeating the last
+type miscountingMongo struct {
+	*fakeMongo
+	counts     []int64
+	calls      int
+	finds      int    // Number of FindDocuments calls, one per initial sync
+	lastFilter bson.M // Filter of the last CountDocuments call
+}
+
+func (f *miscountingMongo) CountDocuments(collection string, filter bson.M) (int64, error) {
+	count := f.counts[min(f.calls, len(f.counts)-1)]
+	f.calls++
+	f.lastFilter = filter
+	return count, nil
+}
+
+func (f *miscountingMongo) FindDocuments(collection string, filter bson.M, limit int64) (*mongodb.Cursor, error) {
+	f.finds++
+	return f.fakeMongo.FindDocuments(collection, filter, limit)
+}
+
+func TestService_VerifyInitialSync(t *testing.T) {
+	docs := []bson.M{
+		{"_id": "doc1", "name": "widget"},
+		{"_id": "doc2", "name": "gadget"},
+		{"_id": "doc3", "name": "gizmo"},
+	}
+
+	tests := []struct {
+		name          string
+		counts        []int64
+		retries       int
+		expectMatched bool
+		expectSource  int64
+		expectRetries int
+	}{
+		{"counts match", []int64{3}, 0, true, 3, 0},
+		{"index is short", []int64{5}, 0, false, 5, 0},
+		{"index is short after retries", []int64{5}, 2, false, 5, 2},
+		// A document inserted while the sync ran isn't a mismatch
+		{"collection changed during sync", []int64{3, 4}, 0, true, 4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newPollingTestService(t, nil)
+			source := &miscountingMongo{fakeMongo: &fakeMongo{docs: docs}, counts: tt.counts}
+			s.mongoClient = source
+			s.config.Search.InitialSyncRetries = tt.retries
+
+			s.wg.Add(1)
+			s.performInitialIndexing(context.Background(), s.config.Indexes[0])
+
+			verification, verified := s.SyncVerification("products")
+			if !verified {
+				t.Fatal("Expected the initial sync to be verified")
+			}
+			if verification.Matched != tt.expectMatched {
+				t.Errorf("Expected matched %t, got %+v", tt.expectMatched, verification)
+			}
+			if verification.IndexedDocuments != 3 || verification.SourceDocuments != tt.expectSource {
+				t.Errorf("Expected 3 indexed and %d source documents, got %+v", tt.expectSource, verification)
+			}
+			if verification.Retries != tt.expectRetries || source.finds != tt.expectRetries+1 {
+				t.Errorf("Expected %d retries, got %+v after %d syncs", tt.expectRetries, verification, source.finds)
+			}
+		})
+	}
+}
+
+func TestService_VerifyInitialSync_SkippedDocuments(t *testing.T) {
+	s := newPollingTestService(t, []bson.M{
+		{"_id": "doc1", "name": "widget"},
+		{"_id": "doc2", "name": "a much longer document than the limit allows"},
+	})
+	s.config.Search.MaxDocumentBytes = 40
+
+	s.wg.Add(1)
+	s.performInitialIndexing(context.Background(), s.config.Indexes[0])
+
+	verification, verified := s.SyncVerification("products")
+	if !verified {
+		t.Fatal("Expected the initial sync to be verified")
+	}
+	if !verification.Matched || verification.Tolerance != 1 {
+		t.Errorf("Expected the skipped document to be tolerated, got %+v", verification)
+	}
+}
+
+func TestService_VerifyInitialSync_StaleDocuments(t *testing.T) {
+	s := newPollingTestService(t, nil)
+	source := &miscountingMongo{fakeMongo: &fakeMongo{docs: []bson.M{
+		{"_id": "doc1", "name": "widget"},
+		{"_id": "doc2", "name": "gadget"},
+	}}, counts: []int64{2}}
+	s.mongoClient = source
+	s.config.Search.InitialSyncRetries = 2
+
+	// A document deleted from the collection before the sync is left in the index
+	if err := s.searchEngine.IndexDocument("products", "deleted", map[string]interface{}{"name": "gone"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	s.wg.Add(1)
+	s.performInitialIndexing(context.Background(), s.config.Indexes[0])
+
+	verification, verified := s.SyncVerification("products")
+	if !verified {
+		t.Fatal("Expected the initial sync to be verified")
+	}
+	if verification.Matched || verification.IndexedDocuments != 3 || verification.SourceDocuments != 2 {
+		t.Errorf("Expected a mismatch of 3 indexed and 2 source documents, got %+v", verification)
+	}
+	// Syncing again can't remove the stale document, so it isn't retried
+	if verification.Retries != 0 || source.finds != 1 {
+		t.Errorf("Expected no retries for surplus documents, got %+v after %d syncs", verification, source.finds)
+	}
+}
+
+func TestService_VerifyInitialSync_ExpiredDocuments(t *testing.T) {
+	now := time.Now()
+	s := newPollingTestService(t, nil)
+	// The collection count leaves out the expired document
+	source := &miscountingMongo{fakeMongo: &fakeMongo{docs: []bson.M{
+		{"_id": "doc1", "name": "widget", "expires_at": now},
+		{"_id": "doc2", "name": "gadget"},
+		{"_id": "doc3", "name": "gizmo", "expires_at": now.Add(-2 * time.Hour)},
+	}}, counts: []int64{2}}
+	s.mongoClient = source
+	s.config.Indexes[0].TTLField = "expires_at"
+	s.config.Indexes[0].TTL = 3600
+
+	s.wg.Add(1)
+	s.performInitialIndexing(context.Background(), s.config.Indexes[0])
+
+	verification, verified := s.SyncVerification("products")
+	if !verified {
+		t.Fatal("Expected the initial sync to be verified")
+	}
+	if !verification.Matched || verification.IndexedDocuments != 2 || verification.SourceDocuments != 2 {
+		t.Errorf("Expected the expired document to be left out of both counts, got %+v", verification)
+	}
+	if _, ok := source.lastFilter["$and"]; !ok {
+		t.Errorf("Expected the collection count to exclude expired documents, got filter %v", source.lastFilter)
+	}
+}
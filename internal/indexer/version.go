@@ -0,0 +1,144 @@
+package indexer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// dropStaleDocuments removes documents from batch whose version_field value is
+// older than the version already indexed, or than a later copy of the same
+// document in the batch. Documents without a comparable version are kept.
+func (s *Service) dropStaleDocuments(indexName string, batch []map[string]interface{}) []map[string]interface{} {
+	versionField := s.versionField(indexName)
+	if versionField == "" {
+		return batch
+	}
+
+	// Keep only the newest copy of each document within the batch
+	newest := make(map[string]int, len(batch))
+	kept := make([]map[string]interface{}, 0, len(batch))
+	for _, doc := range batch {
+		idVal, ok := doc["_id"]
+		if !ok {
+			kept = append(kept, doc)
+			continue
+		}
+		docID := fmt.Sprintf("%v", idVal)
+		if i, seen := newest[docID]; seen {
+			if cmp, ok := compareVersions(doc[versionField], kept[i][versionField]); !ok || cmp >= 0 {
+				kept[i] = doc
+			}
+			continue
+		}
+		newest[docID] = len(kept)
+		kept = append(kept, doc)
+	}
+
+	fresh := kept[:0]
+	for _, doc := range kept {
+		if s.isStale(indexName, versionField, doc) {
+			log.Printf("Skipping document %v in %s: %s is older than the indexed version", doc["_id"], indexName, versionField)
+			continue
+		}
+		fresh = append(fresh, doc)
+	}
+	return fresh
+}
+
+// isStale reports whether the indexed copy of doc has a newer version
+func (s *Service) isStale(indexName, versionField string, doc map[string]interface{}) bool {
+	incoming, ok := doc[versionField]
+	if !ok {
+		return false
+	}
+	idVal, ok := doc["_id"]
+	if !ok {
+		return false
+	}
+
+	stored, found, err := s.searchEngine.GetStoredField(indexName, fmt.Sprintf("%v", idVal), versionField)
+	if err != nil {
+		log.Printf("Failed to read indexed version of %v in %s: %v", idVal, indexName, err)
+		return false
+	}
+	if !found {
+		return false
+	}
+
+	cmp, ok := compareVersions(incoming, stored)
+	return ok && cmp < 0
+}
+
+// versionField returns the version_field configured for an index
+func (s *Service) versionField(indexName string) string {
+	for _, indexCfg := range s.config.Indexes {
+		if indexCfg.Name == indexName {
+			return indexCfg.VersionField
+		}
+	}
+	return ""
+}
+
+// compareVersions compares two version values, returning -1, 0 or 1. Numbers
+// compare numerically, dates (time.Time or RFC3339 strings) chronologically and
+// other strings lexically. The boolean is false when the values can't be compared.
+func compareVersions(a, b interface{}) (int, bool) {
+	a, b = versionValue(a), versionValue(b)
+
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		default:
+			return 0, true
+		}
+	case time.Time:
+		y, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		return x.Compare(y), true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	default:
+		return 0, false
+	}
+}
+
+// versionValue converts a version to float64, time.Time or string for comparison
+func versionValue(v interface{}) interface{} {
+	switch typed := v.(type) {
+	case int:
+		return float64(typed)
+	case int32:
+		return float64(typed)
+	case int64:
+		return float64(typed)
+	case float32:
+		return float64(typed)
+	case float64:
+		return typed
+	case time.Time:
+		return typed
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, typed); err == nil {
+			return t
+		}
+		return typed
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,159 @@
+package indexer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+func TestCompareVersions(t *testing.T) {
+	earlier := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		a, b       interface{}
+		expected   int
+		comparable bool
+	}{
+		{"older number", int32(1), float64(2), -1, true},
+		{"newer number", int64(3), float64(2), 1, true},
+		{"equal numbers", 2, float64(2), 0, true},
+		{"older date string", earlier.Format(time.RFC3339), later, -1, true},
+		{"newer date string", later.Format(time.RFC3339), earlier, 1, true},
+		{"strings", "v1", "v2", -1, true},
+		{"mismatched types", "v1", float64(2), 0, false},
+		{"missing", nil, float64(2), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmp, ok := compareVersions(tt.a, tt.b)
+			if ok != tt.comparable || cmp != tt.expected {
+				t.Errorf("compareVersions(%v, %v) = %d, %v; expected %d, %v", tt.a, tt.b, cmp, ok, tt.expected, tt.comparable)
+			}
+		})
+	}
+}
+
+func newVersionedTestService(t *testing.T) *Service {
+	t.Helper()
+	s := newTestService(t, config.SearchConfig{BulkIndexing: true})
+	s.config.Indexes[0].VersionField = "version"
+	return s
+}
+
+func indexedVersion(t *testing.T, s *Service, docID string) interface{} {
+	t.Helper()
+	value, found, err := s.searchEngine.GetStoredField("products", docID, "version")
+	if err != nil {
+		t.Fatalf("Failed to read stored version: %v", err)
+	}
+	if !found {
+		t.Fatalf("Expected document %s to have a stored version", docID)
+	}
+	return value
+}
+
+func TestService_IndexBatch_VersionField(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []int
+	}{
+		{"older then newer", []int{1, 2}},
+		{"newer then older", []int{2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newVersionedTestService(t)
+
+			for _, version := range tt.versions {
+				doc := map[string]interface{}{"_id": "doc1", "name": "product", "version": version}
+				s.indexBatch("products", "shop.products", []map[string]interface{}{doc})
+			}
+
+			if version := indexedVersion(t, s, "doc1"); version != float64(2) {
+				t.Errorf("Expected newest version 2 to win, got %v", version)
+			}
+		})
+	}
+}
+
+func TestService_IndexBatch_VersionFieldSharded(t *testing.T) {
+	s := newVersionedTestService(t)
+	indexCfg := config.IndexConfig{
+		Name:         "catalog",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		Distribution: config.IndexDistribution{Shards: 3},
+		VersionField: "version",
+	}
+	if err := s.searchEngine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	s.config.Indexes = append(s.config.Indexes, indexCfg)
+
+	for _, version := range []int{2, 1} {
+		var docs []map[string]interface{}
+		for i := 0; i < 10; i++ {
+			docs = append(docs, map[string]interface{}{"_id": fmt.Sprintf("doc%d", i), "version": version})
+		}
+		s.indexBatch("catalog", "shop.catalog", docs)
+	}
+
+	// The stale copies are dropped whichever shard the document is on
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("doc%d", i)
+		if version, found, err := s.searchEngine.GetStoredField("catalog", id, "version"); err != nil || !found || version != float64(2) {
+			t.Errorf("Expected %s to keep version 2, got %v (found %t, err %v)", id, version, found, err)
+		}
+	}
+}
+
+func TestService_IndexBatch_VersionFieldWithinBatch(t *testing.T) {
+	s := newVersionedTestService(t)
+
+	s.indexBatch("products", "shop.products", []map[string]interface{}{
+		{"_id": "doc1", "version": 3},
+		{"_id": "doc2", "version": 1},
+		{"_id": "doc1", "version": 2},
+	})
+
+	if version := indexedVersion(t, s, "doc1"); version != float64(3) {
+		t.Errorf("Expected newest copy in the batch to win, got %v", version)
+	}
+	if count := docCount(t, s); count != 2 {
+		t.Errorf("Expected 2 documents, got %d", count)
+	}
+}
+
+func TestService_IndexBatch_VersionFieldDates(t *testing.T) {
+	s := newVersionedTestService(t)
+	newer := time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC)
+	older := newer.Add(-time.Hour)
+
+	for _, version := range []time.Time{newer, older} {
+		doc := map[string]interface{}{"_id": "doc1", "version": version.Format(time.RFC3339)}
+		s.indexBatch("products", "shop.products", []map[string]interface{}{doc})
+	}
+
+	version, ok := indexedVersion(t, s, "doc1").(time.Time)
+	if !ok || !version.Equal(newer) {
+		t.Errorf("Expected newest date version to win, got %v", version)
+	}
+}
+
+func TestService_IndexBatch_NoVersionField(t *testing.T) {
+	s := newTestService(t, config.SearchConfig{BulkIndexing: true})
+
+	for _, version := range []int{2, 1} {
+		doc := map[string]interface{}{"_id": "doc1", "version": version}
+		s.indexBatch("products", "shop.products", []map[string]interface{}{doc})
+	}
+
+	if version := indexedVersion(t, s, "doc1"); version != float64(1) {
+		t.Errorf("Expected last write to win without version_field, got %v", version)
+	}
+}
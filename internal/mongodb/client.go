@@ -3,6 +3,9 @@ package mongodb
 import (
 	"context"
 	"fmt"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,54 +18,234 @@ import (
 
 // Client wraps MongoDB client with additional functionality
 type Client struct {
-	client   *mongo.Client
+	current  *connection
+	retired  map[*connection]bool   // Retired connections still in use, which Disconnect closes
+	opts     *options.ClientOptions // Reused by Reconnect
 	database string
 	timeout  time.Duration
+	mutex    sync.Mutex // Guards current, which Reconnect replaces, retired and the connections' users
 }
 
-// NewClient creates a new MongoDB client
+// connection is a MongoDB connection and the operations and cursors using it.
+// A connection replaced by Reconnect is retired and disconnected once its last
+// user is done.
+type connection struct {
+	client  *mongo.Client
+	users   int
+	retired bool
+}
+
+// dial opens a verified MongoDB connection; tests replace it to simulate an
+// unreachable server
+var dial = connect
+
+// disconnect closes a MongoDB connection; tests replace it to observe when a
+// retired connection is closed
+var disconnect = func(ctx context.Context, client *mongo.Client) error {
+	return client.Disconnect(ctx)
+}
+
+// NewClient creates a new MongoDB client. When MongoDB isn't reachable yet,
+// e.g. because both are starting together, the connection is retried up to
+// connect_retries times, connect_backoff seconds apart.
 func NewClient(cfg config.MongoDBConfig) (*Client, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Timeout)*time.Second)
-	defer cancel()
+	backoff := time.Duration(cfg.ConnectBackoff) * time.Second
+	attempts := max(cfg.ConnectRetries, 0) + 1
+	opts := clientOptions(cfg)
+
+	var client *mongo.Client
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Timeout)*time.Second)
+		var err error
+		client, err = dial(ctx, opts)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("Connected to MongoDB after %d attempts", attempt)
+			}
+			break
+		}
+		if attempt == attempts {
+			return nil, err
+		}
+		log.Printf("Failed to connect to MongoDB (attempt %d of %d), retrying in %v: %v", attempt, attempts, backoff, err)
+		time.Sleep(backoff)
+	}
 
-	clientOptions := options.Client().ApplyURI(cfg.GetMongoURI())
+	return &Client{
+		current:  &connection{client: client},
+		retired:  make(map[*connection]bool),
+		opts:     opts,
+		database: cfg.Database,
+		timeout:  time.Duration(cfg.Timeout) * time.Second,
+	}, nil
+}
+
+// clientOptions builds the driver options for a connection. Pooled connections
+// idle for longer than max_conn_idle_time are closed rather than reused, since
+// proxies in front of MongoDB may have silently dropped them.
+func clientOptions(cfg config.MongoDBConfig) *options.ClientOptions {
+	opts := options.Client().ApplyURI(cfg.GetMongoURI())
+	if cfg.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(time.Duration(cfg.MaxConnIdleTime) * time.Second)
+	}
+	return opts
+}
 
-	client, err := mongo.Connect(ctx, clientOptions)
+// connect opens a MongoDB connection and pings it to verify it works
+func connect(ctx context.Context, opts *options.ClientOptions) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
 
 	// Ping the database to verify connection
 	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(ctx)
 		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
+	return client, nil
+}
 
-	return &Client{
-		client:   client,
-		database: cfg.Database,
-		timeout:  time.Duration(cfg.Timeout) * time.Second,
-	}, nil
+// Reconnect replaces the underlying connection with a new one. The current
+// connection is kept if a new one can't be made. The old connection is closed
+// once the operations and cursors using it are done, so an initial sync
+// reading a cursor isn't cut off by a poller reconnecting.
+func (c *Client) Reconnect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	client, err := dial(ctx, c.opts)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	old := c.current
+	c.current = &connection{client: client}
+	old.retired = true
+	idle := old.users == 0
+	if !idle {
+		c.retired[old] = true
+	}
+	c.mutex.Unlock()
+
+	if idle {
+		c.close(old)
+	}
+	return nil
+}
+
+// acquire returns the current MongoDB connection and a function releasing it,
+// which must be called once the connection is no longer used
+func (c *Client) acquire() (*mongo.Client, func()) {
+	c.mutex.Lock()
+	conn := c.current
+	conn.users++
+	c.mutex.Unlock()
+
+	var once sync.Once
+	return conn.client, func() {
+		once.Do(func() {
+			c.mutex.Lock()
+			conn.users--
+			// Disconnect may have closed the connection already
+			idle := conn.retired && conn.users == 0 && c.retired[conn]
+			if idle {
+				delete(c.retired, conn)
+			}
+			c.mutex.Unlock()
+
+			if idle {
+				c.close(conn)
+			}
+		})
+	}
+}
+
+// close disconnects a retired connection. It is dead or dying, so errors
+// closing it don't matter.
+func (c *Client) close(conn *connection) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	disconnect(ctx, conn.client)
+}
+
+// conn returns the current MongoDB connection
+func (c *Client) conn() *mongo.Client {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.current.client
 }
 
-// Disconnect closes the MongoDB connection
+// Disconnect closes the MongoDB connection, along with connections replaced
+// by Reconnect that cursors still use. Operations and cursors still running
+// fail, and releasing them doesn't close the connections again.
 func (c *Client) Disconnect() error {
+	c.mutex.Lock()
+	current := c.current
+	current.retired = true
+	retired := make([]*connection, 0, len(c.retired))
+	for conn := range c.retired {
+		retired = append(retired, conn)
+	}
+	clear(c.retired)
+	c.mutex.Unlock()
+
+	for _, conn := range retired {
+		c.close(conn)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
-	return c.client.Disconnect(ctx)
+	return disconnect(ctx, current.client)
 }
 
-// Database returns the configured database
-func (c *Client) Database() *mongo.Database {
-	return c.client.Database(c.database)
+// Ping verifies that the MongoDB server is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	client, release := c.acquire()
+	defer release()
+	if err := client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+	return nil
 }
 
-// Collection returns a collection from the configured database
-func (c *Client) Collection(name string) *mongo.Collection {
-	return c.Database().Collection(name)
+// Cursor is a MongoDB cursor holding the connection it was opened on, which
+// Reconnect keeps open until the cursor is closed
+type Cursor struct {
+	*mongo.Cursor
+	release func()
+}
+
+// NewCursor wraps a cursor that holds no connection, such as one created from
+// documents in tests
+func NewCursor(cursor *mongo.Cursor) *Cursor {
+	return &Cursor{Cursor: cursor, release: func() {}}
+}
+
+// Close closes the cursor and releases its connection
+func (c *Cursor) Close(ctx context.Context) error {
+	defer c.release()
+	return c.Cursor.Close(ctx)
+}
+
+// find opens a cursor holding the current connection until it is closed
+func (c *Client) find(ctx context.Context, collection string, filter interface{}, opts *options.FindOptions) (*Cursor, error) {
+	client, release := c.acquire()
+	cursor, err := client.Database(c.database).Collection(collection).Find(ctx, filter, opts)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &Cursor{Cursor: cursor, release: release}, nil
 }
 
 // FindDocuments retrieves documents from a collection with optional filter and projection
-func (c *Client) FindDocuments(collection string, filter bson.M, limit int64) (*mongo.Cursor, error) {
+func (c *Client) FindDocuments(collection string, filter bson.M, limit int64) (*Cursor, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
@@ -75,7 +258,7 @@ func (c *Client) FindDocuments(collection string, filter bson.M, limit int64) (*
 	opts.SetBatchSize(1000)       // Fetch more documents per round trip
 	opts.SetNoCursorTimeout(true) // Prevent cursor timeout for large datasets
 
-	cursor, err := c.Collection(collection).Find(ctx, filter, opts)
+	cursor, err := c.find(ctx, collection, filter, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find documents: %w", err)
 	}
@@ -83,40 +266,99 @@ func (c *Client) FindDocuments(collection string, filter bson.M, limit int64) (*
 	return cursor, nil
 }
 
-// FindDocumentsSince finds documents modified since a given timestamp using a custom timestamp field
-func (c *Client) FindDocumentsSince(collection, timestampField string, since time.Time, limit int64) (*mongo.Cursor, error) {
+// FindDocumentsSince finds documents matching filter that were modified since a given timestamp using a custom timestamp field
+func (c *Client) FindDocumentsSince(collection string, filter bson.M, timestampField string, since time.Time, limit int64) (*Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	query, sortField := sinceQuery(filter, timestampField, since)
+
+	opts := options.Find().SetSort(bson.D{{Key: sortField, Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	// Optimize cursor for incremental sync operations
+	opts.SetBatchSize(500) // Smaller batch size for incremental updates
+	opts.SetNoCursorTimeout(true)
+
+	cursor, err := c.find(ctx, collection, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find documents since %v: %w", since, err)
+	}
+
+	return cursor, nil
+}
+
+// TailDocuments opens a tailable-await cursor on a capped collection returning
+// documents matching filter inserted after since, in insertion order. Next on
+// the cursor blocks until a new document is inserted. The cursor dies if the
+// collection is empty or its position is overwritten, and must be reopened.
+func (c *Client) TailDocuments(collection string, filter bson.M, timestampField string, since time.Time) (*Cursor, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
-	var filter bson.M
+	// Tailable cursors follow the natural order of a capped collection and can't be sorted
+	query, _ := sinceQuery(filter, timestampField, since)
+
+	opts := options.Find().SetCursorType(options.TailableAwait)
+	opts.SetBatchSize(500)
+	opts.SetNoCursorTimeout(true)
+
+	cursor, err := c.find(ctx, collection, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tail documents since %v: %w", since, err)
+	}
+
+	return cursor, nil
+}
+
+// IsCapped reports whether a collection is a capped collection
+func (c *Client) IsCapped(collection string) (bool, error) {
+	stats, err := c.GetCollectionStats(collection)
+	if err != nil {
+		return false, err
+	}
+	capped, _ := stats["capped"].(bool)
+	return capped, nil
+}
+
+// sinceQuery builds the query and sort field for documents modified after since,
+// combining the timestamp predicate with filter when one is set
+func sinceQuery(filter bson.M, timestampField string, since time.Time) (bson.M, string) {
+	var query bson.M
 	var sortField string
 
 	if timestampField == "" || timestampField == "_id" {
 		// Use ObjectID timestamp (default behavior)
 		sinceObjectID := primitive.NewObjectIDFromTimestamp(since)
-		filter = bson.M{"_id": bson.M{"$gt": sinceObjectID}}
+		query = bson.M{"_id": bson.M{"$gt": sinceObjectID}}
 		sortField = "_id"
 	} else {
 		// Use custom timestamp field
-		filter = bson.M{timestampField: bson.M{"$gt": since}}
+		query = bson.M{timestampField: bson.M{"$gt": since}}
 		sortField = timestampField
 	}
 
-	opts := options.Find().SetSort(bson.D{{Key: sortField, Value: 1}})
-	if limit > 0 {
-		opts.SetLimit(limit)
+	if len(filter) > 0 {
+		query = bson.M{"$and": bson.A{filter, query}}
 	}
 
-	// Optimize cursor for incremental sync operations
-	opts.SetBatchSize(500) // Smaller batch size for incremental updates
-	opts.SetNoCursorTimeout(true)
+	return query, sortField
+}
 
-	cursor, err := c.Collection(collection).Find(ctx, filter, opts)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find documents since %v: %w", since, err)
+// ParseFilter parses a MongoDB query filter written as relaxed Extended JSON,
+// e.g. `{"status": "active"}`. An empty filter matches every document.
+func ParseFilter(filter string) (bson.M, error) {
+	if strings.TrimSpace(filter) == "" {
+		return bson.M{}, nil
 	}
 
-	return cursor, nil
+	var parsed bson.M
+	if err := bson.UnmarshalExtJSON([]byte(filter), false, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return parsed, nil
 }
 
 // GetLastDocumentTimestamp gets the timestamp of the most recent document using a custom timestamp field
@@ -133,7 +375,9 @@ func (c *Client) GetLastDocumentTimestamp(collection, timestampField string) (ti
 
 	opts := options.FindOne().SetSort(bson.D{{Key: sortField, Value: -1}})
 	var result bson.M
-	err := c.Collection(collection).FindOne(ctx, bson.M{}, opts).Decode(&result)
+	client, release := c.acquire()
+	defer release()
+	err := client.Database(c.database).Collection(collection).FindOne(ctx, bson.M{}, opts).Decode(&result)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return time.Time{}, nil // Return zero time if no documents
@@ -202,7 +446,9 @@ func (c *Client) CheckTimestampField(collection, timestampField string) (bool, e
 
 	// Check if any document has this field
 	filter := bson.M{timestampField: bson.M{"$exists": true}}
-	count, err := c.Collection(collection).CountDocuments(ctx, filter)
+	client, release := c.acquire()
+	defer release()
+	count, err := client.Database(c.database).Collection(collection).CountDocuments(ctx, filter)
 	if err != nil {
 		return false, fmt.Errorf("failed to check timestamp field: %w", err)
 	}
@@ -224,7 +470,9 @@ func (c *Client) AddTimestampField(collection, timestampField string) error {
 	filter := bson.M{timestampField: bson.M{"$exists": false}}
 	update := bson.M{"$set": bson.M{timestampField: time.Now()}}
 
-	result, err := c.Collection(collection).UpdateMany(ctx, filter, update)
+	client, release := c.acquire()
+	defer release()
+	result, err := client.Database(c.database).Collection(collection).UpdateMany(ctx, filter, update)
 	if err != nil {
 		return fmt.Errorf("failed to add timestamp field: %w", err)
 	}
@@ -242,7 +490,9 @@ func (c *Client) GetCollectionStats(collection string) (bson.M, error) {
 	defer cancel()
 
 	var result bson.M
-	err := c.Database().RunCommand(ctx, bson.D{
+	client, release := c.acquire()
+	defer release()
+	err := client.Database(c.database).RunCommand(ctx, bson.D{
 		{Key: "collStats", Value: collection},
 	}).Decode(&result)
 
@@ -258,7 +508,9 @@ func (c *Client) CountDocuments(collection string, filter bson.M) (int64, error)
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
-	count, err := c.Collection(collection).CountDocuments(ctx, filter)
+	client, release := c.acquire()
+	defer release()
+	count, err := client.Database(c.database).Collection(collection).CountDocuments(ctx, filter)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count documents: %w", err)
 	}
@@ -0,0 +1,281 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// failingDialer fails the first failures connection attempts and then succeeds
+func failingDialer(failures int, attempts *int) func(ctx context.Context, opts *options.ClientOptions) (*mongo.Client, error) {
+	return func(ctx context.Context, opts *options.ClientOptions) (*mongo.Client, error) {
+		*attempts++
+		if *attempts <= failures {
+			return nil, errors.New("failed to ping MongoDB: connection refused")
+		}
+		return &mongo.Client{}, nil
+	}
+}
+
+func TestNewClient_RetriesUntilConnected(t *testing.T) {
+	defer func(original func(context.Context, *options.ClientOptions) (*mongo.Client, error)) { dial = original }(dial)
+
+	attempts := 0
+	dial = failingDialer(3, &attempts)
+
+	client, err := NewClient(config.MongoDBConfig{URI: "mongodb://localhost:27017", ConnectRetries: 5})
+	if err != nil {
+		t.Fatalf("Expected NewClient to connect after retrying, got %v", err)
+	}
+	if client == nil || client.conn() == nil {
+		t.Error("Expected a connected client")
+	}
+	if attempts != 4 {
+		t.Errorf("Expected 4 connection attempts, got %d", attempts)
+	}
+}
+
+func TestNewClient_GivesUpAfterRetries(t *testing.T) {
+	defer func(original func(context.Context, *options.ClientOptions) (*mongo.Client, error)) { dial = original }(dial)
+
+	for _, retries := range []int{0, 2} {
+		attempts := 0
+		dial = failingDialer(10, &attempts)
+
+		if _, err := NewClient(config.MongoDBConfig{URI: "mongodb://localhost:27017", ConnectRetries: retries}); err == nil {
+			t.Errorf("Expected NewClient to fail with %d retries", retries)
+		}
+		if attempts != retries+1 {
+			t.Errorf("Expected %d connection attempts with %d retries, got %d", retries+1, retries, attempts)
+		}
+	}
+}
+
+func TestClientOptions_MaxConnIdleTime(t *testing.T) {
+	opts := clientOptions(config.MongoDBConfig{URI: "mongodb://localhost:27017", MaxConnIdleTime: 240})
+	if opts.MaxConnIdleTime == nil || *opts.MaxConnIdleTime != 240*time.Second {
+		t.Errorf("Expected max idle time 4m0s, got %v", opts.MaxConnIdleTime)
+	}
+	if len(opts.Hosts) != 1 || opts.Hosts[0] != "localhost:27017" {
+		t.Errorf("Expected the URI to be applied, got hosts %v", opts.Hosts)
+	}
+
+	// Zero leaves idle connections to the driver's default
+	opts = clientOptions(config.MongoDBConfig{URI: "mongodb://localhost:27017"})
+	if opts.MaxConnIdleTime != nil {
+		t.Errorf("Expected no max idle time, got %v", *opts.MaxConnIdleTime)
+	}
+}
+
+func TestNewClient_UsesClientOptions(t *testing.T) {
+	defer func(original func(context.Context, *options.ClientOptions) (*mongo.Client, error)) { dial = original }(dial)
+
+	var dialed *options.ClientOptions
+	dial = func(ctx context.Context, opts *options.ClientOptions) (*mongo.Client, error) {
+		dialed = opts
+		return &mongo.Client{}, nil
+	}
+
+	client, err := NewClient(config.MongoDBConfig{URI: "mongodb://localhost:27017", MaxConnIdleTime: 90})
+	if err != nil {
+		t.Fatalf("Expected NewClient to connect, got %v", err)
+	}
+	if dialed == nil || dialed.MaxConnIdleTime == nil || *dialed.MaxConnIdleTime != 90*time.Second {
+		t.Errorf("Expected the connection to be dialed with a 1m30s max idle time, got %+v", dialed)
+	}
+	if client.opts != dialed {
+		t.Error("Expected Reconnect to reuse the dialed options")
+	}
+}
+
+func TestClient_ReconnectKeepsOpenCursors(t *testing.T) {
+	defer func(original func(context.Context, *options.ClientOptions) (*mongo.Client, error)) { dial = original }(dial)
+	defer func(original func(context.Context, *mongo.Client) error) { disconnect = original }(disconnect)
+
+	dial = func(ctx context.Context, opts *options.ClientOptions) (*mongo.Client, error) {
+		return &mongo.Client{}, nil
+	}
+	disconnected := map[*mongo.Client]int{}
+	disconnect = func(ctx context.Context, client *mongo.Client) error {
+		disconnected[client]++
+		return nil
+	}
+
+	client, err := NewClient(config.MongoDBConfig{URI: "mongodb://localhost:27017"})
+	if err != nil {
+		t.Fatalf("Expected NewClient to connect, got %v", err)
+	}
+	old := client.conn()
+
+	// Open a cursor on the first connection, as an initial sync does
+	_, release := client.acquire()
+	docs, err := mongo.NewCursorFromDocuments([]interface{}{bson.M{"_id": "doc1"}, bson.M{"_id": "doc2"}}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create cursor: %v", err)
+	}
+	cursor := &Cursor{Cursor: docs, release: release}
+
+	if err := client.Reconnect(context.Background()); err != nil {
+		t.Fatalf("Reconnect failed: %v", err)
+	}
+	if client.conn() == old {
+		t.Fatal("Expected Reconnect to replace the connection")
+	}
+	if disconnected[old] != 0 {
+		t.Fatal("Expected the old connection to stay open while a cursor uses it")
+	}
+
+	read := 0
+	for cursor.Next(context.Background()) {
+		read++
+	}
+	if read != 2 || cursor.Err() != nil {
+		t.Errorf("Expected the cursor to read 2 documents after reconnecting, got %d (%v)", read, cursor.Err())
+	}
+
+	cursor.Close(context.Background())
+	cursor.Close(context.Background())
+	if disconnected[old] != 1 {
+		t.Errorf("Expected the old connection to be closed once with its last cursor, got %d", disconnected[old])
+	}
+
+	// Without cursors the replaced connection is closed right away
+	current := client.conn()
+	if err := client.Reconnect(context.Background()); err != nil {
+		t.Fatalf("Reconnect failed: %v", err)
+	}
+	if disconnected[current] != 1 {
+		t.Errorf("Expected an unused connection to be closed on reconnect, got %d", disconnected[current])
+	}
+}
+
+func TestClient_DisconnectClosesRetiredConnections(t *testing.T) {
+	defer func(original func(context.Context, *options.ClientOptions) (*mongo.Client, error)) { dial = original }(dial)
+	defer func(original func(context.Context, *mongo.Client) error) { disconnect = original }(disconnect)
+
+	dial = func(ctx context.Context, opts *options.ClientOptions) (*mongo.Client, error) {
+		return &mongo.Client{}, nil
+	}
+	disconnected := map[*mongo.Client]int{}
+	disconnect = func(ctx context.Context, client *mongo.Client) error {
+		disconnected[client]++
+		return nil
+	}
+
+	client, err := NewClient(config.MongoDBConfig{URI: "mongodb://localhost:27017"})
+	if err != nil {
+		t.Fatalf("Expected NewClient to connect, got %v", err)
+	}
+
+	// A cursor keeps the first connection open across a reconnect, and an
+	// operation is still running on the second one
+	old := client.conn()
+	_, releaseOld := client.acquire()
+	if err := client.Reconnect(context.Background()); err != nil {
+		t.Fatalf("Reconnect failed: %v", err)
+	}
+	current := client.conn()
+	_, releaseCurrent := client.acquire()
+
+	if err := client.Disconnect(); err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+	if disconnected[old] != 1 || disconnected[current] != 1 {
+		t.Errorf("Expected Disconnect to close the retired and current connections once, got %d and %d", disconnected[old], disconnected[current])
+	}
+
+	// Releasing the users afterwards doesn't close the connections again
+	releaseOld()
+	releaseCurrent()
+	if disconnected[old] != 1 || disconnected[current] != 1 {
+		t.Errorf("Expected released connections not to be closed again, got %d and %d", disconnected[old], disconnected[current])
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter(`{"status": "active", "stock": {"$gt": 0}, "createdAt": {"$gte": {"$date": "2024-01-01T00:00:00Z"}}}`)
+	if err != nil {
+		t.Fatalf("ParseFilter failed: %v", err)
+	}
+
+	if filter["status"] != "active" {
+		t.Errorf("Expected status 'active', got %v", filter["status"])
+	}
+	stock, ok := filter["stock"].(bson.M)
+	if !ok || stock["$gt"] != int32(0) {
+		t.Errorf("Expected stock {$gt: 0}, got %v", filter["stock"])
+	}
+	createdAt, ok := filter["createdAt"].(bson.M)
+	if !ok {
+		t.Fatalf("Expected createdAt operator document, got %v", filter["createdAt"])
+	}
+	expected := primitive.NewDateTimeFromTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if createdAt["$gte"] != expected {
+		t.Errorf("Expected Extended JSON $date to parse as DateTime %v, got %v", expected, createdAt["$gte"])
+	}
+}
+
+func TestParseFilter_Empty(t *testing.T) {
+	for _, raw := range []string{"", "  "} {
+		filter, err := ParseFilter(raw)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q) failed: %v", raw, err)
+		}
+		if len(filter) != 0 {
+			t.Errorf("Expected empty filter to match everything, got %v", filter)
+		}
+	}
+}
+
+func TestParseFilter_Invalid(t *testing.T) {
+	if _, err := ParseFilter(`{"status": `); err == nil {
+		t.Error("Expected error for malformed filter")
+	}
+}
+
+func TestSinceQuery(t *testing.T) {
+	since := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	query, sortField := sinceQuery(bson.M{}, "updated_at", since)
+	if sortField != "updated_at" {
+		t.Errorf("Expected sort on updated_at, got %s", sortField)
+	}
+	if !reflect.DeepEqual(query, bson.M{"updated_at": bson.M{"$gt": since}}) {
+		t.Errorf("Expected plain timestamp predicate without filter, got %v", query)
+	}
+
+	filter := bson.M{"status": "active"}
+	query, sortField = sinceQuery(filter, "updated_at", since)
+	expected := bson.M{"$and": bson.A{
+		bson.M{"status": "active"},
+		bson.M{"updated_at": bson.M{"$gt": since}},
+	}}
+	if sortField != "updated_at" {
+		t.Errorf("Expected sort on updated_at, got %s", sortField)
+	}
+	if !reflect.DeepEqual(query, expected) {
+		t.Errorf("Expected filter combined with timestamp predicate, got %v", query)
+	}
+
+	query, sortField = sinceQuery(filter, "_id", since)
+	if sortField != "_id" {
+		t.Errorf("Expected sort on _id, got %s", sortField)
+	}
+	clauses, ok := query["$and"].(bson.A)
+	if !ok || len(clauses) != 2 || !reflect.DeepEqual(clauses[0], filter) {
+		t.Fatalf("Expected filter combined with ObjectID predicate, got %v", query)
+	}
+	idPredicate := clauses[1].(bson.M)["_id"].(bson.M)
+	if id, ok := idPredicate["$gt"].(primitive.ObjectID); !ok || !id.Timestamp().Equal(since) {
+		t.Errorf("Expected _id predicate from ObjectID at %v, got %v", since, idPredicate)
+	}
+}
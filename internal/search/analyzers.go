@@ -0,0 +1,245 @@
+package search
+
+// Register the analyzers that can be referenced by name from index definitions.
+// Bleve only registers an analyzer once its package is imported.
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	_ "github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	_ "github.com/blevesearch/bleve/v2/analysis/analyzer/simple"
+	_ "github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	_ "github.com/blevesearch/bleve/v2/analysis/analyzer/web"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ar"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ckb"
+	"github.com/blevesearch/bleve/v2/analysis/lang/da"
+	"github.com/blevesearch/bleve/v2/analysis/lang/de"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/lang/es"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fa"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fi"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	"github.com/blevesearch/bleve/v2/analysis/lang/hi"
+	"github.com/blevesearch/bleve/v2/analysis/lang/hr"
+	"github.com/blevesearch/bleve/v2/analysis/lang/hu"
+	"github.com/blevesearch/bleve/v2/analysis/lang/it"
+	"github.com/blevesearch/bleve/v2/analysis/lang/nl"
+	"github.com/blevesearch/bleve/v2/analysis/lang/no"
+	"github.com/blevesearch/bleve/v2/analysis/lang/pt"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ro"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ru"
+	"github.com/blevesearch/bleve/v2/analysis/lang/sv"
+	"github.com/blevesearch/bleve/v2/analysis/lang/tr"
+	"github.com/blevesearch/bleve/v2/analysis/token/edgengram"
+	"github.com/blevesearch/bleve/v2/analysis/token/hierarchy"
+	"github.com/blevesearch/bleve/v2/analysis/token/length"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/token/ngram"
+	"github.com/blevesearch/bleve/v2/analysis/token/stop"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/single"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/v2/analysis/tokenmap"
+	"github.com/blevesearch/bleve/v2/mapping"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// languageAnalyzers maps the language codes accepted in field configuration
+// to the Bleve analyzer providing stemming and stopwords for that language
+var languageAnalyzers = map[string]string{
+	"ar":  ar.AnalyzerName,
+	"cjk": cjk.AnalyzerName,
+	"ckb": ckb.AnalyzerName,
+	"da":  da.AnalyzerName,
+	"de":  de.AnalyzerName,
+	"en":  en.AnalyzerName,
+	"es":  es.AnalyzerName,
+	"fa":  fa.AnalyzerName,
+	"fi":  fi.AnalyzerName,
+	"fr":  fr.AnalyzerName,
+	"hi":  hi.AnalyzerName,
+	"hr":  hr.AnalyzerName,
+	"hu":  hu.AnalyzerName,
+	"it":  it.AnalyzerName,
+	"nl":  nl.AnalyzerName,
+	"no":  no.AnalyzerName,
+	"pt":  pt.AnalyzerName,
+	"ro":  ro.AnalyzerName,
+	"ru":  ru.AnalyzerName,
+	"sv":  sv.AnalyzerName,
+	"tr":  tr.AnalyzerName,
+}
+
+// addStopWordsAnalyzer registers an analyzer on the index mapping that works
+// like the standard analyzer but also drops the field's stop_words, and returns
+// its name. The analyzer is stored with the mapping, so queries against the
+// field drop the same words.
+func addStopWordsAnalyzer(indexMapping *mapping.IndexMappingImpl, cfg config.FieldConfig) (string, error) {
+	if cfg.Type != "" && cfg.Type != "text" {
+		return "", fmt.Errorf("stop_words requires a text field, got %q", cfg.Type)
+	}
+	if cfg.Analyzer != "" || cfg.Language != "" || cfg.IndexAnalyzer != "" {
+		return "", fmt.Errorf("stop_words can't be combined with analyzer, index_analyzer or language")
+	}
+
+	// Tokens are lowercased before the stop filter runs
+	tokens := make([]interface{}, 0, len(cfg.StopWords))
+	for _, word := range cfg.StopWords {
+		tokens = append(tokens, strings.ToLower(word))
+	}
+
+	name := stopWordsAnalyzerName(cfg.Name)
+	if err := indexMapping.AddCustomTokenMap(name, map[string]interface{}{
+		"type":   tokenmap.Name,
+		"tokens": tokens,
+	}); err != nil {
+		return "", fmt.Errorf("invalid stop_words: %w", err)
+	}
+	if err := indexMapping.AddCustomTokenFilter(name, map[string]interface{}{
+		"type":           stop.Name,
+		"stop_token_map": name,
+	}); err != nil {
+		return "", fmt.Errorf("invalid stop_words: %w", err)
+	}
+	if err := indexMapping.AddCustomAnalyzer(name, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{lowercase.Name, en.StopName, name},
+	}); err != nil {
+		return "", fmt.Errorf("invalid stop_words: %w", err)
+	}
+	return name, nil
+}
+
+// stopWordsAnalyzerName names the stop_words analyzer of a field
+func stopWordsAnalyzerName(field string) string {
+	return "stop_words_" + field
+}
+
+// maxPathLevels is the deepest level of a path_delimiter field that is indexed
+const maxPathLevels = 32
+
+// addPathHierarchyAnalyzer registers an analyzer on the index mapping that
+// indexes a keyword field's value together with each of its ancestor paths, so
+// "a/b/c" with path_delimiter "/" produces the terms a, a/b and a/b/c. A term
+// facet on the field then counts documents at every level of the hierarchy,
+// and a term query for a path matches everything below it.
+func addPathHierarchyAnalyzer(indexMapping *mapping.IndexMappingImpl, cfg config.FieldConfig) error {
+	if cfg.Type != "keyword" {
+		return fmt.Errorf("path_delimiter requires a keyword field, got %q", cfg.Type)
+	}
+	if cfg.Analyzer != "" || cfg.IndexAnalyzer != "" || cfg.Language != "" || len(cfg.StopWords) > 0 {
+		return fmt.Errorf("path_delimiter can't be combined with analyzer, index_analyzer, language or stop_words")
+	}
+
+	name := pathHierarchyAnalyzerName(cfg.Name)
+	if err := indexMapping.AddCustomTokenFilter(name, map[string]interface{}{
+		"type":      hierarchy.Name,
+		"delimiter": cfg.PathDelimiter,
+		"max":       float64(maxPathLevels), // Bleve preallocates a token per level, so it needs a bound
+	}); err != nil {
+		return fmt.Errorf("invalid path_delimiter: %w", err)
+	}
+	// A leading or doubled delimiter would otherwise index an empty path
+	if err := indexMapping.AddCustomTokenFilter(name+"_non_empty", map[string]interface{}{
+		"type": length.Name,
+		"min":  1.0,
+	}); err != nil {
+		return fmt.Errorf("invalid path_delimiter: %w", err)
+	}
+	if err := indexMapping.AddCustomAnalyzer(name, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     single.Name,
+		"token_filters": []string{name, name + "_non_empty"},
+	}); err != nil {
+		return fmt.Errorf("invalid path_delimiter: %w", err)
+	}
+	return nil
+}
+
+// pathHierarchyAnalyzerName names the path_delimiter analyzer of a field
+func pathHierarchyAnalyzerName(field string) string {
+	return "path_hierarchy_" + field
+}
+
+// Gram sizes of ngram fields that don't set min_gram or max_gram
+const (
+	defaultMinGram = 3
+	defaultMaxGram = 10
+)
+
+// ngramSizes returns the gram sizes of an ngram field
+func ngramSizes(cfg config.FieldConfig) (int, int) {
+	minGram, maxGram := cfg.MinGram, cfg.MaxGram
+	if minGram == 0 {
+		minGram = defaultMinGram
+	}
+	if maxGram == 0 {
+		maxGram = max(defaultMaxGram, minGram)
+	}
+	return minGram, maxGram
+}
+
+// addNgramAnalyzer registers an analyzer on the index mapping that indexes
+// every substring of each lowercased word from min_gram up to max_gram
+// characters, so "laptop" is found by "lap" or "top". Queries on the field use
+// the standard analyzer instead, see searchAnalyzer, since splitting the query
+// into grams as well would match any document sharing a single gram with it.
+func addNgramAnalyzer(indexMapping *mapping.IndexMappingImpl, cfg config.FieldConfig) error {
+	if cfg.Analyzer != "" || cfg.IndexAnalyzer != "" || cfg.Language != "" || len(cfg.StopWords) > 0 || cfg.PathDelimiter != "" {
+		return fmt.Errorf("ngram fields can't be combined with analyzer, index_analyzer, language, stop_words or path_delimiter")
+	}
+	minGram, maxGram := ngramSizes(cfg)
+	if minGram < 1 || maxGram < minGram {
+		return fmt.Errorf("invalid gram sizes: min_gram %d must be at least 1 and at most max_gram %d", minGram, maxGram)
+	}
+
+	name := ngramAnalyzerName(cfg.Name)
+	if err := indexMapping.AddCustomTokenFilter(name, map[string]interface{}{
+		"type": ngram.Name,
+		"min":  float64(minGram),
+		"max":  float64(maxGram),
+	}); err != nil {
+		return fmt.Errorf("invalid ngram field: %w", err)
+	}
+	if err := indexMapping.AddCustomAnalyzer(name, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{lowercase.Name, name},
+	}); err != nil {
+		return fmt.Errorf("invalid ngram field: %w", err)
+	}
+	return nil
+}
+
+// ngramAnalyzerName names the analyzer of an ngram field
+func ngramAnalyzerName(field string) string {
+	return "ngram_" + field
+}
+
+// autocompleteAnalyzer indexes every prefix of each lowercased word from 2 up
+// to 20 characters, so a field indexed with it matches partially typed words
+// queried with a plain analyzer such as standard
+const autocompleteAnalyzer = "autocomplete"
+
+// addAutocompleteAnalyzer registers the autocomplete analyzer on the index mapping
+func addAutocompleteAnalyzer(indexMapping *mapping.IndexMappingImpl) error {
+	if err := indexMapping.AddCustomTokenFilter(autocompleteAnalyzer, map[string]interface{}{
+		"type": edgengram.Name,
+		"back": false,
+		"min":  2.0,
+		"max":  20.0,
+	}); err != nil {
+		return fmt.Errorf("invalid autocomplete analyzer: %w", err)
+	}
+	if err := indexMapping.AddCustomAnalyzer(autocompleteAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{lowercase.Name, autocompleteAnalyzer},
+	}); err != nil {
+		return fmt.Errorf("invalid autocomplete analyzer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// maxCountByGroups caps the number of groups CountBy returns
+const maxCountByGroups = 1000
+
+// CountBy counts the documents matching an Atlas Search query grouped by the
+// terms of a field, without fetching any hits. Only the maxCountByGroups
+// largest groups are returned. For sharded indexes each shard's groups are
+// counted separately and summed.
+func (e *Engine) CountBy(indexName, field string, atlasQuery map[string]interface{}) (map[string]int, error) {
+	indexes := e.indexesFor(indexName)
+	if len(indexes) == 0 {
+		return nil, indexNotFound(indexName)
+	}
+
+	bleveQuery, err := e.convertQuery(atlasQuery, e.queryOptions(indexName))
+	if err != nil {
+		return nil, invalidQuery("failed to convert query", err)
+	}
+
+	counts := make(map[string]int)
+	for _, index := range indexes {
+		searchReq := bleve.NewSearchRequest(bleveQuery)
+		searchReq.Size = 0
+		searchReq.AddFacet(field, bleve.NewFacetRequest(field, maxCountByGroups))
+
+		result, err := index.Search(searchReq)
+		if err != nil {
+			return nil, searchFailed(err)
+		}
+		if facet, ok := result.Facets[field]; ok && facet.Terms != nil {
+			for _, term := range facet.Terms.Terms() {
+				counts[term.Term] += term.Count
+			}
+		}
+	}
+
+	if len(counts) <= maxCountByGroups {
+		return counts, nil
+	}
+
+	// Shards may each contribute different groups, so keep the largest overall
+	terms := make([]string, 0, len(counts))
+	for term := range counts {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if counts[terms[i]] != counts[terms[j]] {
+			return counts[terms[i]] > counts[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	for _, term := range terms[maxCountByGroups:] {
+		delete(counts, term)
+	}
+	return counts, nil
+}
+
+// CountLiveDocuments returns the number of documents of an index that searches
+// can find. Unless field is empty, documents whose date field is before cutoff
+// count as expired and are left out, like DeleteExpired would delete
+// them. On sharded indexes a document only counts on the shard it is routed
+// to, not on shards holding a stale copy of it.
+func (e *Engine) CountLiveDocuments(indexName, field string, cutoff time.Time) (uint64, error) {
+	if index, exists := e.GetIndex(indexName); exists {
+		return liveDocuments(index, field, cutoff, nil)
+	}
+
+	shards := e.getShardsForIndex(indexName)
+	if len(shards) == 0 {
+		return 0, indexNotFound(indexName)
+	}
+	ring := e.shardRingFor(indexName, len(shards))
+	var total uint64
+	for _, shard := range shards {
+		index, exists := e.GetIndex(shard)
+		if !exists {
+			continue
+		}
+		count, err := liveDocuments(index, field, cutoff, func(id string) bool { return ring.shardFor(id) == shard })
+		if err != nil {
+			return 0, fmt.Errorf("failed to count documents of shard %s: %w", shard, err)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// liveDocuments counts the documents of an index or shard not expired by
+// field. When owned is set only the documents it reports as belonging to the
+// shard are counted, walking every document ID.
+func liveDocuments(index bleve.Index, field string, cutoff time.Time, owned func(id string) bool) (uint64, error) {
+	expired, err := expiredIDs(index, field, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if owned == nil {
+		docCount, err := index.DocCount()
+		if err != nil {
+			return 0, err
+		}
+		return docCount - uint64(len(expired)), nil
+	}
+
+	advanced, err := index.Advanced()
+	if err != nil {
+		return 0, err
+	}
+	reader, err := advanced.Reader()
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	ids, err := reader.DocIDReaderAll()
+	if err != nil {
+		return 0, err
+	}
+	defer ids.Close()
+
+	var count uint64
+	for {
+		internalID, err := ids.Next()
+		if err != nil {
+			return 0, err
+		}
+		if internalID == nil {
+			return count, nil
+		}
+		id, err := reader.ExternalID(internalID)
+		if err != nil {
+			return 0, err
+		}
+		if owned(id) && !expired[id] {
+			count++
+		}
+	}
+}
+
+// expiredIDs returns the IDs of the documents of an index or shard whose date
+// field is before cutoff, or nil if field is empty
+func expiredIDs(index bleve.Index, field string, cutoff time.Time) (map[string]bool, error) {
+	if field == "" {
+		return nil, nil
+	}
+	exclusive := false
+	rangeQuery := bleve.NewDateRangeInclusiveQuery(time.Time{}, cutoff, nil, &exclusive)
+	rangeQuery.SetField(field)
+
+	result, err := index.Search(bleve.NewSearchRequestOptions(rangeQuery, 0, 0, false))
+	if err != nil || result.Total == 0 {
+		return nil, err
+	}
+	result, err = index.Search(bleve.NewSearchRequestOptions(rangeQuery, int(result.Total), 0, false))
+	if err != nil {
+		return nil, err
+	}
+	expired := make(map[string]bool, len(result.Hits))
+	for _, hit := range result.Hits {
+		expired[hit.ID] = true
+	}
+	return expired, nil
+}
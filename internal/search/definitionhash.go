@@ -0,0 +1,96 @@
+package search
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// definitionHashKey is the internal key under which an index stores the hash
+// of the definition it was created with
+var definitionHashKey = []byte("_definition_hash")
+
+// definitionHash returns the SHA-256 hash of an index definition
+func definitionHash(def config.IndexDefinition) ([]byte, error) {
+	data, err := json.Marshal(def)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// openIndex opens the index at path, or creates it with indexMapping if it
+// doesn't exist, and applies index_dir_mode to its directory. An existing
+// index created from a definition with a different hash is rebuilt empty with
+// the new mapping if reindex is set, to be filled again by the initial sync,
+// and otherwise kept and reported as outdated.
+func (e *Engine) openIndex(name, path string, indexMapping mapping.IndexMapping, hash []byte, reindex bool) (bleve.Index, bool, error) {
+	index, outdated, err := e.openOrCreateIndex(name, path, indexMapping, hash, reindex)
+	if err != nil {
+		return nil, false, err
+	}
+	if e.dirMode != 0 {
+		if err := os.Chmod(path, e.dirMode); err != nil {
+			index.Close()
+			return nil, false, fmt.Errorf("failed to set directory mode: %w", err)
+		}
+	}
+	return index, outdated, nil
+}
+
+// openOrCreateIndex opens or creates the index at path for openIndex
+func (e *Engine) openOrCreateIndex(name, path string, indexMapping mapping.IndexMapping, hash []byte, reindex bool) (bleve.Index, bool, error) {
+	index, err := bleve.Open(path)
+	if err == nil {
+		stored, err := index.GetInternal(definitionHashKey)
+		switch {
+		case err != nil:
+			index.Close()
+			return nil, false, err
+		case stored == nil:
+			// Indexes created before the hash was stored are taken to be current
+			return index, false, index.SetInternal(definitionHashKey, hash)
+		case bytes.Equal(stored, hash):
+			return index, false, nil
+		case !reindex:
+			log.Printf("Warning: the definition of index %s changed since it was created; its mapping is unchanged until it is rebuilt (set reindex_on_mapping_change to rebuild it at startup)", name)
+			return index, true, nil
+		}
+
+		log.Printf("The definition of index %s changed since it was created, rebuilding it", name)
+		if err := index.Close(); err != nil {
+			return nil, false, err
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return nil, false, err
+		}
+	}
+
+	index, err = bleve.NewUsing(path, indexMapping, e.indexType, e.kvStore, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := index.SetInternal(definitionHashKey, hash); err != nil {
+		index.Close()
+		return nil, false, err
+	}
+	return index, false, nil
+}
+
+// MappingOutdated reports whether an index, or any of its shards, was opened
+// with a mapping older than its configured definition, or has shards whose
+// documents were routed with another scheme
+func (e *Engine) MappingOutdated(indexName string) bool {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.outdated[indexName]
+}
@@ -0,0 +1,192 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// QueryDescription is a JSON-friendly view of the Bleve query an Atlas Search
+// query converts to, used to debug query parsing and relevance
+type QueryDescription struct {
+	Type      string              `json:"type"`
+	Field     string              `json:"field,omitempty"`
+	Analyzer  string              `json:"analyzer,omitempty"`
+	Terms     []string            `json:"terms,omitempty"`
+	Boost     float64             `json:"boost,omitempty"`
+	MinShould float64             `json:"minShould,omitempty"`
+	Must      []*QueryDescription `json:"must,omitempty"`
+	Should    []*QueryDescription `json:"should,omitempty"`
+	MustNot   []*QueryDescription `json:"mustNot,omitempty"`
+	Clauses   []*QueryDescription `json:"clauses,omitempty"`
+}
+
+// AnalyzedToken is a single token produced by an analyzer
+type AnalyzedToken struct {
+	Token       string `json:"token"`
+	Position    int    `json:"position"`
+	StartOffset int    `json:"startOffset"`
+	EndOffset   int    `json:"endOffset"`
+}
+
+// AnalyzeText tokenizes text with the named analyzer as resolved by the index
+// mapping, so custom and language analyzers can be inspected. An empty name
+// uses the index's default analyzer.
+func (e *Engine) AnalyzeText(indexName, analyzerName, text string) ([]AnalyzedToken, error) {
+	index, err := e.indexOrFirstShard(indexName)
+	if err != nil {
+		return nil, err
+	}
+
+	indexMapping := index.Mapping()
+	if analyzerName == "" {
+		analyzerName = indexMapping.AnalyzerNameForPath("")
+	}
+	analyzer := indexMapping.AnalyzerNamed(analyzerName)
+	if analyzer == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownAnalyzer, analyzerName)
+	}
+
+	tokens := analyzer.Analyze([]byte(text))
+	analyzed := make([]AnalyzedToken, 0, len(tokens))
+	for _, token := range tokens {
+		analyzed = append(analyzed, AnalyzedToken{
+			Token:       string(token.Term),
+			Position:    token.Position,
+			StartOffset: token.Start,
+			EndOffset:   token.End,
+		})
+	}
+	return analyzed, nil
+}
+
+// DescribeQuery converts an Atlas Search query and describes the resulting
+// Bleve query tree without executing it. Match queries list the terms produced
+// by the field's analyzer in the index mapping.
+func (e *Engine) DescribeQuery(indexName string, atlasQuery map[string]interface{}) (*QueryDescription, error) {
+	index, err := e.indexOrFirstShard(indexName)
+	if err != nil {
+		return nil, err
+	}
+
+	bleveQuery, err := e.convertQuery(atlasQuery, e.queryOptions(indexName))
+	if err != nil {
+		return nil, invalidQuery("failed to convert query", err)
+	}
+
+	return describeQuery(bleveQuery, index.Mapping()), nil
+}
+
+// ValidateQuery checks that an Atlas Search query converts to a Bleve query
+// for an index without executing it. Conversion failures match ErrInvalidQuery.
+func (e *Engine) ValidateQuery(indexName string, atlasQuery map[string]interface{}) error {
+	if _, err := e.indexOrFirstShard(indexName); err != nil {
+		return err
+	}
+
+	if _, err := e.convertQuery(atlasQuery, e.queryOptions(indexName)); err != nil {
+		return invalidQuery("failed to convert query", err)
+	}
+	return nil
+}
+
+// indexOrFirstShard returns the named index, or its first shard for sharded
+// indexes. Shards share the same mapping, so either serves mapping lookups.
+func (e *Engine) indexOrFirstShard(indexName string) (bleve.Index, error) {
+	if index, exists := e.GetIndex(indexName); exists {
+		return index, nil
+	}
+	for _, shard := range e.getShardsForIndex(indexName) {
+		if index, exists := e.GetIndex(shard); exists {
+			return index, nil
+		}
+	}
+	return nil, indexNotFound(indexName)
+}
+
+// describeQuery recursively describes a Bleve query
+func describeQuery(q query.Query, indexMapping mapping.IndexMapping) *QueryDescription {
+	switch typed := q.(type) {
+	case *query.BooleanQuery:
+		desc := &QueryDescription{Type: "boolean"}
+		if must, ok := typed.Must.(*query.ConjunctionQuery); ok {
+			desc.Must = describeQueries(must.Conjuncts, indexMapping)
+		}
+		if should, ok := typed.Should.(*query.DisjunctionQuery); ok {
+			desc.Should = describeQueries(should.Disjuncts, indexMapping)
+			desc.MinShould = should.Min
+		}
+		if mustNot, ok := typed.MustNot.(*query.DisjunctionQuery); ok {
+			desc.MustNot = describeQueries(mustNot.Disjuncts, indexMapping)
+		}
+		return desc
+	case *query.ConjunctionQuery:
+		return &QueryDescription{Type: "conjunction", Clauses: describeQueries(typed.Conjuncts, indexMapping)}
+	case *query.DisjunctionQuery:
+		return &QueryDescription{Type: "disjunction", MinShould: typed.Min, Clauses: describeQueries(typed.Disjuncts, indexMapping)}
+	case *query.MatchQuery:
+		analyzer := typed.Analyzer
+		if analyzer == "" {
+			analyzer = indexMapping.AnalyzerNameForPath(typed.FieldVal)
+		}
+		return &QueryDescription{
+			Type:     "match",
+			Field:    typed.FieldVal,
+			Analyzer: analyzer,
+			Terms:    analyzeTerms(indexMapping, analyzer, typed.Match),
+			Boost:    typed.Boost(),
+		}
+	case *query.QueryStringQuery:
+		return &QueryDescription{Type: "query_string", Terms: []string{typed.Query}, Boost: typed.Boost()}
+	case *query.TermQuery:
+		return &QueryDescription{Type: "term", Field: typed.FieldVal, Terms: []string{typed.Term}, Boost: typed.Boost()}
+	case *query.NumericRangeQuery:
+		desc := &QueryDescription{Type: "numeric_range", Field: typed.FieldVal, Boost: typed.Boost()}
+		for _, bound := range []*float64{typed.Min, typed.Max} {
+			if bound != nil {
+				desc.Terms = append(desc.Terms, strconv.FormatFloat(*bound, 'f', -1, 64))
+			}
+		}
+		return desc
+	case *query.BoolFieldQuery:
+		return &QueryDescription{Type: "bool", Field: typed.FieldVal, Terms: []string{strconv.FormatBool(typed.Bool)}, Boost: typed.Boost()}
+	case *query.WildcardQuery:
+		return &QueryDescription{Type: "wildcard", Field: typed.FieldVal, Terms: []string{typed.Wildcard}, Boost: typed.Boost()}
+	case *forwardOnlyQuery:
+		return describeQuery(typed.Query, indexMapping)
+	case *query.MatchAllQuery:
+		return &QueryDescription{Type: "match_all"}
+	case *query.MatchNoneQuery:
+		return &QueryDescription{Type: "match_none"}
+	default:
+		return &QueryDescription{Type: fmt.Sprintf("%T", q)}
+	}
+}
+
+// describeQueries describes each query in a list of clauses
+func describeQueries(queries []query.Query, indexMapping mapping.IndexMapping) []*QueryDescription {
+	descs := make([]*QueryDescription, 0, len(queries))
+	for _, q := range queries {
+		descs = append(descs, describeQuery(q, indexMapping))
+	}
+	return descs
+}
+
+// analyzeTerms runs text through the named analyzer and returns the token terms.
+// If the analyzer can't be resolved the text is returned as a single term.
+func analyzeTerms(indexMapping mapping.IndexMapping, analyzerName, text string) []string {
+	analyzer := indexMapping.AnalyzerNamed(analyzerName)
+	if analyzer == nil {
+		return []string{text}
+	}
+
+	tokens := analyzer.Analyze([]byte(text))
+	terms := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		terms = append(terms, string(token.Term))
+	}
+	return terms
+}
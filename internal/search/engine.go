@@ -1,35 +1,89 @@
 package search
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/index/scorch"
+	"github.com/blevesearch/bleve/v2/index/upsidedown"
+	"github.com/blevesearch/bleve/v2/index/upsidedown/store/boltdb"
 	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/numeric"
+	"github.com/blevesearch/bleve/v2/search"
 	"github.com/blevesearch/bleve/v2/search/query"
+	bleveindex "github.com/blevesearch/bleve_index_api"
 
 	"github.com/davidschrooten/open-atlas-search/config"
 )
 
 // Engine manages multiple Bleve indexes
 type Engine struct {
-	indexes   map[string]bleve.Index
-	indexPath string
-	mutex     sync.RWMutex
-	lastSync  map[string]time.Time // Track last sync time for each index
-	syncMutex sync.RWMutex         // Separate mutex for sync times
+	indexes      map[string]bleve.Index
+	definitions  map[string]config.IndexDefinition // Configured definition per logical index name
+	replicas     map[string]int                    // Configured replica count per logical index name
+	timestamps   map[string]string                 // Poll timestamp field per logical index name
+	outdated     map[string]bool                   // Logical index names opened with an older definition's mapping
+	indexPath    string
+	indexType    string      // Bleve index implementation used for new indexes
+	kvStore      string      // Key/value store backing upsidedown indexes
+	dirMode      os.FileMode // Mode of the index directories (0 leaves the defaults)
+	shardWorkers int         // Number of shards opened or created in parallel
+	mutex        sync.RWMutex
+	lastSync     map[string]time.Time // Track last sync time for each index
+	syncMutex    sync.RWMutex         // Separate mutex for sync times
+
+	suggestThreshold   int                    // Searches with fewer hits get a did-you-mean suggestion (0 disables)
+	highlightFragments int                    // Fragments returned per highlighted field by default
+	templates          []config.IndexTemplate // Definitions for indexes created without one
+	filterCache        *filterCache           // Documents matching compound filter clauses (nil disables)
+	resultCache        *resultCache           // Results of repeated identical searches (nil disables)
+	suggestionCache    *suggestionCache       // Did-you-mean suggestions of query strings
+
+	shardVirtualNodes int                   // Points each shard owns on its index's hash ring
+	shardRings        map[string]*shardRing // Hash ring per sharded logical index name
+	ringMutex         sync.Mutex
+
+	optimizing    map[string]bool // Index and shard names being optimized
+	optimizeMutex sync.Mutex
 }
 
 // SearchResult represents search results with Atlas Search compatibility
 type SearchResult struct {
-	Hits     []SearchHit            `json:"hits"`
-	Total    int                    `json:"total"`
-	Facets   map[string]interface{} `json:"facets,omitempty"`
-	MaxScore float64                `json:"maxScore"`
+	Hits       []SearchHit            `json:"hits"`
+	Total      int                    `json:"total"`
+	Facets     map[string]interface{} `json:"facets,omitempty"`
+	MaxScore   float64                `json:"maxScore"`
+	Suggestion string                 `json:"suggestion,omitempty"` // Corrected query text when few hits were found
+	Profile    *SearchProfile         `json:"profile,omitempty"`
+}
+
+// SearchProfile is the wall-clock time in milliseconds a search spent in each
+// phase, returned when the request sets profile
+type SearchProfile struct {
+	QueryConversionMs  float64 `json:"queryConversionMs"`  // Converting the Atlas Search query and facet filters
+	SearchMs           float64 `json:"searchMs"`           // Preparing and executing the Bleve searches
+	ResultConversionMs float64 `json:"resultConversionMs"` // Converting Bleve results to the response format
+	TotalMs            float64 `json:"totalMs"`
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
 }
 
 // SearchHit represents a single search result
@@ -38,15 +92,23 @@ type SearchHit struct {
 	Score     float64                `json:"score"`
 	Source    map[string]interface{} `json:"source"`
 	Highlight map[string][]string    `json:"highlight,omitempty"`
+	// Fields the hit matched query terms in, when the request sets matched_fields
+	MatchedFields []string `json:"matchedFields,omitempty"`
 }
 
 // FacetRequest represents a facet aggregation request
 type FacetRequest struct {
-	Type  string `json:"type"`
-	Field string `json:"field"`
-	Size  int    `json:"size,omitempty"`
+	Type     string `json:"type"`
+	Field    string `json:"field"`
+	Size     int    `json:"size,omitempty"`
+	Interval string `json:"interval,omitempty"` // day, month or year for date_histogram facets
+	// Ranges buckets a numeric facet by named value ranges instead of by value
+	Ranges []NumericRange `json:"ranges,omitempty"`
 }
 
+// maxDateHistogramBuckets limits how many periods a date_histogram facet may span
+const maxDateHistogramBuckets = 1000
+
 // SearchRequest represents a search query request
 type SearchRequest struct {
 	Index     string                  `json:"index"`
@@ -55,33 +117,143 @@ type SearchRequest struct {
 	Facets    map[string]FacetRequest `json:"facets,omitempty"`
 	Size      int                     `json:"size"`
 	From      int                     `json:"from"`
+	ScoreMode string                  `json:"score_mode,omitempty"`
+	Fields    []string                `json:"fields,omitempty"`    // Stored fields to return in each hit's source (all when empty)
+	Profile   bool                    `json:"profile,omitempty"`   // Report time spent per search phase in the result
+	MinScore  float64                 `json:"min_score,omitempty"` // Drop hits scoring below this from the returned page
+	// MatchedFields reports the fields each hit matched query terms in
+	MatchedFields bool `json:"matched_fields,omitempty"`
+	// TypedSource tags date and numeric source values with their mapped type in Extended JSON
+	TypedSource bool `json:"typed_source,omitempty"`
+
+	// FacetFilters maps a facet name to a query selecting values of that facet,
+	// or to {"bucket": name} selecting a range of a numeric range facet.
+	// Every filter narrows the hits, but a facet's own filter is left out when
+	// counting that facet (post-filter semantics).
+	FacetFilters map[string]map[string]interface{} `json:"facet_filters,omitempty"`
+}
+
+// Score modes control how hit scores from different shards are combined
+const (
+	// ScoreModeRaw merges shard hits using the scores Bleve returned as-is
+	ScoreModeRaw = "raw"
+	// ScoreModeNormalized scales each shard's scores by that shard's max score before merging
+	ScoreModeNormalized = "normalized"
+)
+
+// defaultShardWorkers is the number of shards opened in parallel when shard_workers is unset
+const defaultShardWorkers = 4
+
+// Index types selectable with index_type
+const (
+	// IndexTypeScorch is Bleve's segment-based index (default)
+	IndexTypeScorch = "scorch"
+	// IndexTypeUpsidedown is Bleve's older key/value index, stored in BoltDB
+	IndexTypeUpsidedown = "upsidedown"
+)
+
+// bleveIndexType resolves an index_type setting to the Bleve index type and
+// key/value store names passed to bleve.NewUsing
+func bleveIndexType(indexType string) (string, string, error) {
+	switch indexType {
+	case "", IndexTypeScorch:
+		return scorch.Name, bleve.Config.DefaultKVStore, nil
+	case IndexTypeUpsidedown:
+		return upsidedown.Name, boltdb.Name, nil
+	default:
+		return "", "", fmt.Errorf("unsupported index_type %q (expected scorch or upsidedown)", indexType)
+	}
+}
+
+// indexDirMode parses an index_dir_mode setting such as "0700". An empty
+// setting returns 0, leaving directory permissions to the defaults.
+func indexDirMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, fmt.Errorf("invalid index_dir_mode %q (expected octal permissions such as 0700)", mode)
+	}
+	// The engine creates and traverses files in its directories
+	if perm&0700 != 0700 {
+		return 0, fmt.Errorf("invalid index_dir_mode %q: the owner needs read, write and execute permission", mode)
+	}
+	return os.FileMode(perm), nil
 }
 
 // NewEngine creates a new search engine
 func NewEngine(cfg config.SearchConfig) (*Engine, error) {
+	indexType, kvStore, err := bleveIndexType(cfg.IndexType)
+	if err != nil {
+		return nil, err
+	}
+
+	dirMode, err := indexDirMode(cfg.IndexDirMode)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := os.MkdirAll(cfg.IndexPath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create index directory: %w", err)
 	}
+	// Set the mode explicitly, as MkdirAll's is reduced by the umask
+	if dirMode != 0 {
+		if err := os.Chmod(cfg.IndexPath, dirMode); err != nil {
+			return nil, fmt.Errorf("failed to set index directory mode: %w", err)
+		}
+	}
 
 	return &Engine{
-		indexes:   make(map[string]bleve.Index),
-		indexPath: cfg.IndexPath,
-		lastSync:  make(map[string]time.Time),
+		indexes:      make(map[string]bleve.Index),
+		definitions:  make(map[string]config.IndexDefinition),
+		replicas:     make(map[string]int),
+		timestamps:   make(map[string]string),
+		outdated:     make(map[string]bool),
+		indexPath:    cfg.IndexPath,
+		indexType:    indexType,
+		kvStore:      kvStore,
+		dirMode:      dirMode,
+		shardWorkers: cfg.ShardWorkers,
+		lastSync:     make(map[string]time.Time),
+
+		suggestThreshold:   cfg.SuggestThreshold,
+		highlightFragments: max(cfg.MaxHighlightFragments, 1),
+		filterCache:        newFilterCache(cfg.FilterCacheSize),
+		resultCache:        newResultCache(cfg.ResultCacheSize, time.Duration(cfg.ResultCacheTTL)*time.Second),
+		suggestionCache:    newSuggestionCache(),
+		shardVirtualNodes:  cfg.ShardVirtualNodes,
 	}, nil
 }
 
-// CreateIndex creates a new Bleve index based on configuration
+// CreateIndex creates a new Bleve index based on configuration. An index
+// without a definition takes the definition of a matching index template.
 func (e *Engine) CreateIndex(indexCfg config.IndexConfig) error {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
-	// In cluster mode with multiple shards, create separate indexes for each shard
+	indexCfg = e.applyIndexTemplate(indexCfg)
+
+	var err error
 	if indexCfg.Distribution.Shards > 1 {
-		return e.createShardedIndex(indexCfg)
+		// In cluster mode with multiple shards, create separate indexes for each shard
+		err = e.createShardedIndex(indexCfg)
+	} else {
+		// Single shard index
+		err = e.createSingleIndex(indexCfg)
+	}
+	if err != nil {
+		return err
 	}
 
-	// Single shard index
-	return e.createSingleIndex(indexCfg)
+	// Keep the definition so the mapping can be reported as configured
+	e.definitions[indexCfg.Name] = indexCfg.Definition
+	e.replicas[indexCfg.Name] = indexCfg.Distribution.Replicas
+	e.timestamps[indexCfg.Name] = indexCfg.TimestampField
+	if indexCfg.TimestampField == "" {
+		e.timestamps[indexCfg.Name] = config.DefaultTimestampField
+	}
+	return nil
 }
 
 // createSingleIndex creates a single non-sharded index
@@ -90,57 +262,112 @@ func (e *Engine) createSingleIndex(indexCfg config.IndexConfig) error {
 	indexPath := filepath.Join(e.indexPath, indexName)
 
 	// Create mapping based on configuration
-	indexMapping := e.createMapping(indexCfg.Definition)
+	indexMapping, err := e.createMapping(indexCfg.Definition)
+	if err != nil {
+		return fmt.Errorf("invalid mapping for index %s: %w", indexName, err)
+	}
+
+	hash, err := definitionHash(indexCfg.Definition)
+	if err != nil {
+		return fmt.Errorf("failed to hash definition of index %s: %w", indexName, err)
+	}
 
 	// Check if index already exists
 	if _, exists := e.indexes[indexName]; exists {
 		return nil // Index already exists
 	}
 
-	// Try to open existing index first
-	index, err := bleve.Open(indexPath)
+	// Open the existing index, or create it if it doesn't exist
+	index, outdated, err := e.openIndex(indexName, indexPath, indexMapping, hash, indexCfg.ReindexOnMappingChange)
 	if err != nil {
-		// Create new index if it doesn't exist
-		index, err = bleve.New(indexPath, indexMapping)
-		if err != nil {
-			return fmt.Errorf("failed to create index %s: %w", indexName, err)
-		}
+		return fmt.Errorf("failed to create index %s: %w", indexName, err)
 	}
 
 	e.indexes[indexName] = index
+	if outdated {
+		e.outdated[indexName] = true
+	}
 	return nil
 }
 
-// createShardedIndex creates multiple shard indexes for a single logical index
+// createShardedIndex creates multiple shard indexes for a single logical index.
+// Shards are opened or created in parallel by up to shardWorkers goroutines and
+// registered afterwards by the caller's goroutine, which holds e.mutex.
 func (e *Engine) createShardedIndex(indexCfg config.IndexConfig) error {
 	indexName := indexCfg.Name
 
 	// Create mapping based on configuration
-	indexMapping := e.createMapping(indexCfg.Definition)
+	indexMapping, err := e.createMapping(indexCfg.Definition)
+	if err != nil {
+		return fmt.Errorf("invalid mapping for index %s: %w", indexName, err)
+	}
+	hash, err := definitionHash(indexCfg.Definition)
+	if err != nil {
+		return fmt.Errorf("failed to hash definition of index %s: %w", indexName, err)
+	}
 
+	type shardResult struct {
+		name     string
+		index    bleve.Index
+		outdated bool
+		err      error
+	}
+
+	var shardNames []string
 	for shard := 0; shard < indexCfg.Distribution.Shards; shard++ {
 		shardName := fmt.Sprintf("%s_shard_%d", indexName, shard)
-		shardPath := filepath.Join(e.indexPath, shardName)
 
 		// Check if shard already exists
 		if _, exists := e.indexes[shardName]; exists {
 			continue // Shard already exists
 		}
+		shardNames = append(shardNames, shardName)
+	}
 
-		// Try to open existing shard first
-		index, err := bleve.Open(shardPath)
-		if err != nil {
-			// Create new shard if it doesn't exist
-			index, err = bleve.New(shardPath, indexMapping)
-			if err != nil {
-				return fmt.Errorf("failed to create shard %s: %w", shardName, err)
+	workers := e.shardWorkers
+	if workers <= 0 {
+		workers = defaultShardWorkers
+	}
+
+	jobs := make(chan string)
+	results := make(chan shardResult, len(shardNames))
+	var wg sync.WaitGroup
+	for worker := 0; worker < min(workers, len(shardNames)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for shardName := range jobs {
+				shardPath := filepath.Join(e.indexPath, shardName)
+
+				// Open the existing shard, or create it if it doesn't exist
+				index, outdated, err := e.openShard(shardName, shardPath, indexMapping, hash, indexCfg.ReindexOnMappingChange)
+				if err != nil {
+					err = fmt.Errorf("failed to create shard %s: %w", shardName, err)
+				}
+				results <- shardResult{name: shardName, index: index, outdated: outdated, err: err}
 			}
+		}()
+	}
+	for _, shardName := range shardNames {
+		jobs <- shardName
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+
+	var errs []error
+	for result := range results {
+		if result.err != nil {
+			errs = append(errs, result.err)
+			continue
+		}
+		e.indexes[result.name] = result.index
+		if result.outdated {
+			e.outdated[indexName] = true
 		}
-
-		e.indexes[shardName] = index
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // GetIndex returns an index by name
@@ -155,18 +382,54 @@ func (e *Engine) GetIndex(indexName string) (bleve.Index, bool) {
 // IndexInfo represents information about an index
 type IndexInfo struct {
 	Name         string     `json:"name"`
-	DocCount     uint64     `json:"docCount"`
+	DocCount     uint64     `json:"docCount"` // Summed across shards for sharded indexes
+	Shards       int        `json:"shards"`
+	Replicas     int        `json:"replicas"`
+	ShardOf      string     `json:"shardOf,omitempty"` // Logical index name when this entry is a single shard
 	Status       string     `json:"status"`
 	LastSync     *time.Time `json:"lastSync,omitempty"`
 	SyncProgress string     `json:"sync_progress,omitempty"`
 }
 
-// ListIndexes returns information about all indexes
+// IndexStats represents detailed statistics about an index
+type IndexStats struct {
+	Name             string                 `json:"name"`
+	DocCount         uint64                 `json:"docCount"`
+	DiskSizeBytes    int64                  `json:"diskSizeBytes"`
+	LastSync         *time.Time             `json:"lastSync,omitempty"`
+	DocumentsIndexed int64                  `json:"documentsIndexed"`
+	DocumentsFailed  int64                  `json:"documentsFailed"`
+	Searches         *SearchLatency         `json:"searches,omitempty"`
+	FilterCache      *FilterCacheStats      `json:"filterCache,omitempty"`
+	ResultCache      *ResultCacheStats      `json:"resultCache,omitempty"`
+	Storage          *IndexStorage          `json:"storage,omitempty"`
+	BleveStats       map[string]interface{} `json:"bleveStats"`
+}
+
+// IndexStorage describes how an index stores field values
+type IndexStorage struct {
+	IndexType              string   `json:"indexType"`              // scorch or upsidedown
+	StoredFieldCompression string   `json:"storedFieldCompression"` // snappy for scorch, which always compresses stored fields, none for upsidedown
+	UnstoredFields         []string `json:"unstoredFields"`         // Fields indexed without storing them (exclude_from_source)
+}
+
+// SearchLatency summarizes the searches run against an index since the server started
+type SearchLatency struct {
+	Count  int64   `json:"count"`
+	Errors int64   `json:"errors"`
+	AvgMs  float64 `json:"avgMs"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+// ListIndexes returns information about all indexes. Each sharded index is
+// listed under its logical name with the document count summed across its
+// shards, and every shard is also listed with ShardOf set.
 func (e *Engine) ListIndexes() ([]IndexInfo, error) {
 	e.mutex.RLock()
 	defer e.mutex.RUnlock()
 
 	indexes := make([]IndexInfo, 0, len(e.indexes))
+	sharded := make(map[string]*IndexInfo)
 
 	for name, index := range e.indexes {
 		docCount, err := index.DocCount()
@@ -178,22 +441,75 @@ func (e *Engine) ListIndexes() ([]IndexInfo, error) {
 		indexInfo := IndexInfo{
 			Name:     name,
 			DocCount: docCount,
+			Shards:   1,
+			Replicas: e.replicaCount(name),
 			Status:   "active",
 		}
-
-		// Get last sync time if available
-		e.syncMutex.RLock()
-		if lastSync, exists := e.lastSync[name]; exists {
-			indexInfo.LastSync = &lastSync
+		e.setLastSync(&indexInfo)
+
+		if parent, ok := shardParent(name); ok {
+			indexInfo.ShardOf = parent
+			logical, exists := sharded[parent]
+			if !exists {
+				logical = &IndexInfo{
+					Name:     parent,
+					Replicas: e.replicaCount(parent),
+					Status:   "active",
+				}
+				e.setLastSync(logical)
+				sharded[parent] = logical
+			}
+			logical.DocCount += docCount
+			logical.Shards++
 		}
-		e.syncMutex.RUnlock()
 
 		indexes = append(indexes, indexInfo)
 	}
 
+	for _, logical := range sharded {
+		indexes = append(indexes, *logical)
+	}
+
 	return indexes, nil
 }
 
+// setLastSync fills in the last sync time of an index if one was recorded
+func (e *Engine) setLastSync(indexInfo *IndexInfo) {
+	e.syncMutex.RLock()
+	defer e.syncMutex.RUnlock()
+
+	if lastSync, exists := e.lastSync[indexInfo.Name]; exists {
+		indexInfo.LastSync = &lastSync
+	}
+}
+
+// replicaCount returns the configured replica count of an index or one of its
+// shards, defaulting to 1. The caller must hold e.mutex.
+func (e *Engine) replicaCount(indexName string) int {
+	replicas, exists := e.replicas[indexName]
+	if !exists {
+		if parent, ok := shardParent(indexName); ok {
+			replicas = e.replicas[parent]
+		}
+	}
+	if replicas < 1 {
+		return 1
+	}
+	return replicas
+}
+
+// shardParent returns the logical index name of a name_shard_N shard name
+func shardParent(name string) (string, bool) {
+	i := strings.LastIndex(name, "_shard_")
+	if i <= 0 {
+		return "", false
+	}
+	if _, err := strconv.Atoi(name[i+len("_shard_"):]); err != nil {
+		return "", false
+	}
+	return name[:i], true
+}
+
 // RemoveIndex removes an index from memory and disk
 func (e *Engine) RemoveIndex(indexName string) error {
 	e.mutex.Lock()
@@ -201,7 +517,7 @@ func (e *Engine) RemoveIndex(indexName string) error {
 
 	index, exists := e.indexes[indexName]
 	if !exists {
-		return fmt.Errorf("index %s not found", indexName)
+		return indexNotFound(indexName)
 	}
 
 	// Close index
@@ -211,6 +527,11 @@ func (e *Engine) RemoveIndex(indexName string) error {
 
 	// Remove index from the map
 	delete(e.indexes, indexName)
+	delete(e.definitions, indexName)
+	delete(e.outdated, indexName)
+	delete(e.replicas, indexName)
+	delete(e.timestamps, indexName)
+	e.invalidateCaches(indexName)
 
 	// Remove sync tracking
 	e.syncMutex.Lock()
@@ -260,7 +581,7 @@ func (e *Engine) removeIndexInternal(indexName string) error {
 
 	index, exists := e.indexes[indexName]
 	if !exists {
-		return fmt.Errorf("index %s not found", indexName)
+		return indexNotFound(indexName)
 	}
 
 	// Close index
@@ -270,6 +591,11 @@ func (e *Engine) removeIndexInternal(indexName string) error {
 
 	// Remove index from the map
 	delete(e.indexes, indexName)
+	delete(e.definitions, indexName)
+	delete(e.outdated, indexName)
+	delete(e.replicas, indexName)
+	delete(e.timestamps, indexName)
+	e.invalidateCaches(indexName)
 
 	// Remove sync tracking
 	e.syncMutex.Lock()
@@ -295,20 +621,50 @@ func (e *Engine) IndexDocument(indexName, docID string, doc map[string]interface
 	e.mutex.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("index/shard %s not found", shardName)
+		return indexNotFound(shardName)
 	}
 
+	defer e.invalidateCaches(shardName)
 	return index.Index(docID, doc)
 }
 
-// IndexDocuments indexes multiple documents in a batch for better performance
+// IndexDocuments indexes multiple documents in a batch for better performance.
+// Sharded indexes get a batch per shard holding the documents routed to it.
 func (e *Engine) IndexDocuments(indexName string, docs []DocumentBatch) error {
+	e.mutex.RLock()
+	_, exists := e.indexes[indexName]
+	e.mutex.RUnlock()
+
+	if exists {
+		return e.indexBatch(indexName, docs)
+	}
+
+	shards := e.getShardsForIndex(indexName)
+	if len(shards) == 0 {
+		return indexNotFound(indexName)
+	}
+	ring := e.shardRingFor(indexName, len(shards))
+	shardDocs := make(map[string][]DocumentBatch, len(shards))
+	for _, doc := range docs {
+		shardName := ring.shardFor(doc.ID)
+		shardDocs[shardName] = append(shardDocs[shardName], doc)
+	}
+	for shardName, docs := range shardDocs {
+		if err := e.indexBatch(shardName, docs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexBatch indexes documents into an index or shard in a single batch
+func (e *Engine) indexBatch(indexName string, docs []DocumentBatch) error {
 	e.mutex.RLock()
 	index, exists := e.indexes[indexName]
 	e.mutex.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("index %s not found", indexName)
+		return indexNotFound(indexName)
 	}
 
 	// Create a batch for bulk indexing
@@ -318,9 +674,59 @@ func (e *Engine) IndexDocuments(indexName string, docs []DocumentBatch) error {
 	}
 
 	// Execute the batch
+	defer e.invalidateCaches(indexName)
 	return index.Batch(batch)
 }
 
+// GetStoredField returns the stored value of a field of an indexed document as
+// a float64, time.Time, bool or string. The boolean result is false when the
+// document doesn't exist or doesn't have the field stored.
+func (e *Engine) GetStoredField(indexName, docID, field string) (interface{}, bool, error) {
+	// Sharded indexes hold the document on the shard it was routed to
+	shardName := e.getShardForDocument(indexName, docID)
+
+	e.mutex.RLock()
+	index, exists := e.indexes[shardName]
+	e.mutex.RUnlock()
+
+	if !exists {
+		return nil, false, indexNotFound(shardName)
+	}
+
+	doc, err := index.Document(docID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load document %s: %w", docID, err)
+	}
+	if doc == nil {
+		return nil, false, nil
+	}
+
+	var value interface{}
+	found := false
+	doc.VisitFields(func(f bleveindex.Field) {
+		if found || f.Name() != field {
+			return
+		}
+		switch typed := f.(type) {
+		case bleveindex.NumericField:
+			if number, err := typed.Number(); err == nil {
+				value, found = number, true
+			}
+		case bleveindex.DateTimeField:
+			if dateTime, _, err := typed.DateTime(); err == nil {
+				value, found = dateTime, true
+			}
+		case bleveindex.BooleanField:
+			if boolean, err := typed.Boolean(); err == nil {
+				value, found = boolean, true
+			}
+		default:
+			value, found = string(f.Value()), true
+		}
+	})
+	return value, found, nil
+}
+
 // DeleteDocument removes a document from the index
 func (e *Engine) DeleteDocument(indexName, docID string) error {
 	e.mutex.RLock()
@@ -328,55 +734,210 @@ func (e *Engine) DeleteDocument(indexName, docID string) error {
 	e.mutex.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("index %s not found", indexName)
+		return indexNotFound(indexName)
 	}
 
+	defer e.invalidateCaches(indexName)
 	return index.Delete(docID)
 }
 
-// Search performs a search query
+// Search performs a search query, serving repeated identical searches from
+// the result cache when one is configured
 func (e *Engine) Search(req SearchRequest) (*SearchResult, error) {
+	return e.cachedSearch(req, e.search)
+}
+
+// search performs a search query without the result cache
+func (e *Engine) search(req SearchRequest) (*SearchResult, error) {
+	result, err := e.searchIndex(req)
+	if err != nil {
+		return nil, err
+	}
+
+	e.addSuggestion(req, result)
+	return result, nil
+}
+
+// searchIndex performs a search query against a single Bleve index
+func (e *Engine) searchIndex(req SearchRequest) (*SearchResult, error) {
 	e.mutex.RLock()
 	index, exists := e.indexes[req.Index]
 	e.mutex.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("index %s not found", req.Index)
+		return nil, indexNotFound(req.Index)
 	}
 
+	start := time.Now()
+
 	// Convert query to Bleve query
-	bleveQuery, err := e.convertQuery(req.Query)
+	opts := e.queryOptions(req.Index)
+	opts.cachedFilter = func(clause map[string]interface{}, filter query.Query) query.Query {
+		return e.cachedFilter(req.Index, clause, filter)
+	}
+	bleveQuery, err := e.convertQuery(req.Query, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert query: %w", err)
+		return nil, invalidQuery("failed to convert query", err)
 	}
 
+	// Convert facet filters, which narrow the hits but not their own facet's counts
+	facetFilters := make(map[string]query.Query, len(req.FacetFilters))
+	for name, filter := range req.FacetFilters {
+		var filterQuery query.Query
+		bucket, isBucket, err := bucketFilter(filter)
+		if err == nil && isBucket {
+			filterQuery, err = facetBucketQuery(req.Facets[name], bucket)
+		} else if err == nil {
+			filterQuery, err = e.convertQuery(filter, opts)
+		}
+		if err != nil {
+			return nil, invalidQuery("failed to convert query for facet filter "+name, err)
+		}
+		facetFilters[name] = filterQuery
+	}
+	converted := time.Now()
+
 	// Create search request
-	searchReq := bleve.NewSearchRequest(bleveQuery)
+	searchReq := bleve.NewSearchRequest(filteredQuery(bleveQuery, facetFilters, ""))
 	searchReq.Size = req.Size
 	searchReq.From = req.From
 
-	// Include all stored fields in results
-	searchReq.Fields = []string{"*"}
-	searchReq.IncludeLocations = false // We don't need location info
-
-	// Add highlighting if requested
+	// Include the requested stored fields in results, or all of them by default
+	if len(req.Fields) > 0 {
+		searchReq.Fields = req.Fields
+	} else {
+		searchReq.Fields = []string{"*"}
+	}
+	// Highlighting marks terms by their locations, which are only collected
+	// when needed since they're costly. Matched fields are read from the same
+	// locations.
+	searchReq.IncludeLocations = req.Highlight != nil || req.MatchedFields
+	var highlightOpts highlightOptions
 	if req.Highlight != nil {
-		e.addHighlighting(searchReq, req.Highlight)
+		if highlightOpts, err = e.parseHighlight(req.Highlight); err != nil {
+			return nil, invalidQuery("invalid highlight", err)
+		}
 	}
 
-	// Add facets if requested
-	if req.Facets != nil {
-		e.addFacets(searchReq, req.Facets)
+	// Facets without a filter of their own are counted over the filtered hits
+	mainFacets := make(map[string]FacetRequest, len(req.Facets))
+	for name, facet := range req.Facets {
+		if _, filtered := facetFilters[name]; !filtered {
+			mainFacets[name] = facet
+		}
+	}
+	if len(mainFacets) > 0 {
+		if err := e.addFacets(index, searchReq, mainFacets); err != nil {
+			return nil, invalidFacet(err)
+		}
 	}
 
 	// Execute search
 	searchResult, err := index.Search(searchReq)
 	if err != nil {
-		return nil, fmt.Errorf("search failed: %w", err)
+		return nil, searchFailed(err)
+	}
+
+	searched := time.Now()
+
+	// Bleve can't filter on score, so low-scoring hits are dropped from the
+	// page. Total still counts every match.
+	if req.MinScore > 0 {
+		kept := searchResult.Hits[:0]
+		for _, hit := range searchResult.Hits {
+			if hit.Score >= req.MinScore {
+				kept = append(kept, hit)
+			}
+		}
+		searchResult.Hits = kept
+	}
+
+	if req.Highlight != nil {
+		if err := highlightHits(index, searchResult.Hits, highlightOpts); err != nil {
+			return nil, searchFailed(err)
+		}
 	}
 
 	// Convert to our result format
-	return e.convertSearchResult(searchResult), nil
+	result := e.convertSearchResult(searchResult)
+	if req.MatchedFields {
+		for i, hit := range searchResult.Hits {
+			result.Hits[i].MatchedFields = matchedFields(hit.Locations)
+		}
+	}
+	if req.TypedSource {
+		fieldTypes := sourceFieldTypes(e.IndexDefinition(req.Index))
+		for _, hit := range result.Hits {
+			typeSource(hit.Source, fieldTypes)
+		}
+	}
+	resultConversion := time.Since(searched)
+
+	// Facets with a filter are counted with every filter applied except their own,
+	// so the unselected values of that facet keep their counts
+	for name, facet := range req.Facets {
+		if _, filtered := facetFilters[name]; !filtered {
+			continue
+		}
+		facetResult, err := e.searchFacet(index, filteredQuery(bleveQuery, facetFilters, name), name, facet)
+		if err != nil {
+			return nil, err
+		}
+		if facetResult != nil {
+			if result.Facets == nil {
+				result.Facets = make(map[string]interface{})
+			}
+			result.Facets[name] = facetResult
+		}
+	}
+
+	if req.Profile {
+		total := time.Since(start)
+		queryConversion := converted.Sub(start)
+		result.Profile = &SearchProfile{
+			QueryConversionMs:  durationMs(queryConversion),
+			SearchMs:           durationMs(total - queryConversion - resultConversion),
+			ResultConversionMs: durationMs(resultConversion),
+			TotalMs:            durationMs(total),
+		}
+	}
+
+	return result, nil
+}
+
+// filteredQuery combines the base query with every facet filter except exclude
+func filteredQuery(base query.Query, facetFilters map[string]query.Query, exclude string) query.Query {
+	names := make([]string, 0, len(facetFilters))
+	for name := range facetFilters {
+		if name != exclude {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return base
+	}
+	sort.Strings(names)
+
+	conjuncts := []query.Query{base}
+	for _, name := range names {
+		conjuncts = append(conjuncts, facetFilters[name])
+	}
+	return bleve.NewConjunctionQuery(conjuncts...)
+}
+
+// searchFacet computes a single facet over the documents matching q without fetching hits
+func (e *Engine) searchFacet(index bleve.Index, q query.Query, name string, facet FacetRequest) (interface{}, error) {
+	facetReq := bleve.NewSearchRequestOptions(q, 0, 0, false)
+	if err := e.addFacets(index, facetReq, map[string]FacetRequest{name: facet}); err != nil {
+		return nil, invalidFacet(err)
+	}
+
+	facetResult, err := index.Search(facetReq)
+	if err != nil {
+		return nil, searchFailed(err)
+	}
+
+	return e.convertSearchResult(facetResult).Facets[name], nil
 }
 
 // Close closes all indexes
@@ -399,8 +960,22 @@ func (e *Engine) Close() error {
 }
 
 // createMapping creates a Bleve mapping from configuration
-func (e *Engine) createMapping(def config.IndexDefinition) mapping.IndexMapping {
+func (e *Engine) createMapping(def config.IndexDefinition) (mapping.IndexMapping, error) {
 	indexMapping := bleve.NewIndexMapping()
+	if err := addAutocompleteAnalyzer(indexMapping); err != nil {
+		return nil, err
+	}
+
+	if def.DefaultAnalyzer != "" {
+		if indexMapping.AnalyzerNamed(def.DefaultAnalyzer) == nil {
+			return nil, fmt.Errorf("unknown default analyzer %q", def.DefaultAnalyzer)
+		}
+		indexMapping.DefaultAnalyzer = def.DefaultAnalyzer
+	}
+
+	if _, err := parseMatchOperator(def.DefaultOperator); err != nil {
+		return nil, fmt.Errorf("invalid default_operator: %w", err)
+	}
 
 	if def.Mappings.Dynamic {
 		indexMapping.DefaultMapping.Dynamic = true
@@ -410,15 +985,45 @@ func (e *Engine) createMapping(def config.IndexDefinition) mapping.IndexMapping
 
 	// Configure field mappings
 	for _, fieldCfg := range def.Mappings.Fields {
-		fieldMapping := e.createFieldMapping(fieldCfg)
-		indexMapping.DefaultMapping.AddFieldMappingsAt(fieldCfg.Name, fieldMapping)
+		fieldMapping, err := e.createFieldMapping(fieldCfg)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", fieldCfg.Name, err)
+		}
+		if len(fieldCfg.StopWords) > 0 {
+			fieldMapping.Analyzer, err = addStopWordsAnalyzer(indexMapping, fieldCfg)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", fieldCfg.Name, err)
+			}
+		}
+		if fieldCfg.PathDelimiter != "" {
+			if err := addPathHierarchyAnalyzer(indexMapping, fieldCfg); err != nil {
+				return nil, fmt.Errorf("field %s: %w", fieldCfg.Name, err)
+			}
+		}
+		if fieldCfg.Type == "ngram" {
+			if err := addNgramAnalyzer(indexMapping, fieldCfg); err != nil {
+				return nil, fmt.Errorf("field %s: %w", fieldCfg.Name, err)
+			}
+		}
+		if fieldCfg.SearchAnalyzer != "" && indexMapping.AnalyzerNamed(fieldCfg.SearchAnalyzer) == nil {
+			return nil, fmt.Errorf("field %s: unknown search_analyzer %q", fieldCfg.Name, fieldCfg.SearchAnalyzer)
+		}
+		multiMappings, err := e.createMultiFieldMappings(indexMapping, fieldCfg)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", fieldCfg.Name, err)
+		}
+		indexMapping.DefaultMapping.AddFieldMappingsAt(fieldCfg.Name, append([]*mapping.FieldMapping{fieldMapping}, multiMappings...)...)
 	}
 
-	return indexMapping
+	return indexMapping, nil
 }
 
 // createFieldMapping creates a field mapping from configuration
-func (e *Engine) createFieldMapping(cfg config.FieldConfig) *mapping.FieldMapping {
+func (e *Engine) createFieldMapping(cfg config.FieldConfig) (*mapping.FieldMapping, error) {
+	if cfg.Boost < 0 {
+		return nil, fmt.Errorf("invalid boost %v: must not be negative", cfg.Boost)
+	}
+
 	fieldMapping := bleve.NewTextFieldMapping()
 
 	switch cfg.Type {
@@ -432,147 +1037,860 @@ func (e *Engine) createFieldMapping(cfg config.FieldConfig) *mapping.FieldMappin
 		fieldMapping = bleve.NewDateTimeFieldMapping()
 	case "boolean":
 		fieldMapping = bleve.NewBooleanFieldMapping()
+	case "ngram":
+		fieldMapping = bleve.NewTextFieldMapping()
+	}
+	if cfg.Type != "ngram" && (cfg.MinGram != 0 || cfg.MaxGram != 0) {
+		return nil, fmt.Errorf("min_gram and max_gram require an ngram field, got %q", cfg.Type)
 	}
 
-	if cfg.Analyzer != "" {
+	// An explicit analyzer takes precedence over the language analyzer, which
+	// only applies to analyzed text fields (keyword fields keep their analyzer).
+	// The index analyzer overrides both at index time.
+	if cfg.IndexAnalyzer != "" {
+		fieldMapping.Analyzer = cfg.IndexAnalyzer
+	} else if cfg.Analyzer != "" {
 		fieldMapping.Analyzer = cfg.Analyzer
+	} else if cfg.Language != "" && fieldMapping.Type == "text" && fieldMapping.Analyzer == "" {
+		analyzer, ok := languageAnalyzers[cfg.Language]
+		if !ok {
+			return nil, fmt.Errorf("unsupported language %q", cfg.Language)
+		}
+		fieldMapping.Analyzer = analyzer
+	} else if cfg.PathDelimiter != "" {
+		// Registered on the index mapping by addPathHierarchyAnalyzer
+		fieldMapping.Analyzer = pathHierarchyAnalyzerName(cfg.Name)
+	} else if cfg.Type == "ngram" {
+		// Registered on the index mapping by addNgramAnalyzer
+		fieldMapping.Analyzer = ngramAnalyzerName(cfg.Name)
 	}
 
-	// Always store field values so they can be retrieved in search results
-	fieldMapping.Store = true
+	// Store field values so they can be retrieved in search results, unless
+	// the field is excluded from the source to save disk space
+	fieldMapping.Store = !cfg.ExcludeFromSource
 
-	return fieldMapping
+	return fieldMapping, nil
 }
 
-// convertQuery converts Atlas Search query to Bleve query
-func (e *Engine) convertQuery(atlasQuery map[string]interface{}) (query.Query, error) {
-	if compound, ok := atlasQuery["compound"]; ok {
-		return e.convertCompoundQuery(compound.(map[string]interface{}))
+// createMultiFieldMappings creates the mappings of a field's multi sub-fields.
+// Each indexes the field's value again under <name>.<sub-field>, e.g. title.raw,
+// so a field can be searched both analyzed and exact. Sub-field values aren't
+// stored since they duplicate the field's own value.
+func (e *Engine) createMultiFieldMappings(indexMapping *mapping.IndexMappingImpl, cfg config.FieldConfig) ([]*mapping.FieldMapping, error) {
+	subNames := make([]string, 0, len(cfg.Multi))
+	for subName := range cfg.Multi {
+		if subName == "" || strings.Contains(subName, ".") {
+			return nil, fmt.Errorf("invalid multi sub-field name %q", subName)
+		}
+		subNames = append(subNames, subName)
 	}
+	sort.Strings(subNames)
 
-	if text, ok := atlasQuery["text"]; ok {
-		return e.convertTextQuery(text.(map[string]interface{}))
+	mappings := make([]*mapping.FieldMapping, 0, len(subNames))
+	for _, subName := range subNames {
+		subCfg := multiFieldConfig(cfg, subName)
+		fieldMapping, err := e.createFieldMapping(subCfg)
+		if err != nil {
+			return nil, fmt.Errorf("multi %s: %w", subName, err)
+		}
+		if len(subCfg.StopWords) > 0 {
+			fieldMapping.Analyzer, err = addStopWordsAnalyzer(indexMapping, subCfg)
+			if err != nil {
+				return nil, fmt.Errorf("multi %s: %w", subName, err)
+			}
+		}
+		if subCfg.PathDelimiter != "" {
+			if err := addPathHierarchyAnalyzer(indexMapping, subCfg); err != nil {
+				return nil, fmt.Errorf("multi %s: %w", subName, err)
+			}
+		}
+		if subCfg.Type == "ngram" {
+			if err := addNgramAnalyzer(indexMapping, subCfg); err != nil {
+				return nil, fmt.Errorf("multi %s: %w", subName, err)
+			}
+		}
+		if subCfg.SearchAnalyzer != "" && indexMapping.AnalyzerNamed(subCfg.SearchAnalyzer) == nil {
+			return nil, fmt.Errorf("multi %s: unknown search_analyzer %q", subName, subCfg.SearchAnalyzer)
+		}
+		// Bleve names a field mapping relative to the field's parent object
+		fieldMapping.Name = subCfg.Name[strings.LastIndex(cfg.Name, ".")+1:]
+		fieldMapping.Store = false
+		mappings = append(mappings, fieldMapping)
 	}
+	return mappings, nil
+}
+
+// multiFieldConfig returns the configuration of a multi sub-field, named by
+// its full path
+func multiFieldConfig(cfg config.FieldConfig, subName string) config.FieldConfig {
+	subCfg := cfg.Multi[subName]
+	subCfg.Name = cfg.Name + "." + subName
+	subCfg.Field = ""
+	subCfg.Multi = nil
+	return subCfg
+}
 
-	if term, ok := atlasQuery["term"]; ok {
-		return e.convertTermQuery(term.(map[string]interface{}))
+// queryAnalyzers returns the analyzer text queries use for each field of an
+// index definition whose query analyzer may differ from the one it is indexed
+// with, by path. Bleve only resolves analyzers of fields mapped at their own
+// path, so match queries on multi sub-fields set them explicitly, as do
+// queries on fields with an index_analyzer or search_analyzer.
+func (e *Engine) queryAnalyzers(def config.IndexDefinition) map[string]string {
+	defaultAnalyzer := def.DefaultAnalyzer
+	if defaultAnalyzer == "" {
+		defaultAnalyzer = bleve.NewIndexMapping().DefaultAnalyzer
 	}
 
-	if wildcard, ok := atlasQuery["wildcard"]; ok {
-		return e.convertWildcardQuery(wildcard.(map[string]interface{}))
+	analyzers := make(map[string]string)
+	for _, fieldCfg := range def.Mappings.Fields {
+		if fieldCfg.IndexAnalyzer != "" || fieldCfg.SearchAnalyzer != "" || fieldCfg.PathDelimiter != "" || fieldCfg.Type == "ngram" {
+			analyzers[fieldCfg.Name] = e.searchAnalyzer(fieldCfg, defaultAnalyzer)
+		}
+		for subName := range fieldCfg.Multi {
+			subCfg := multiFieldConfig(fieldCfg, subName)
+			if analyzer := e.searchAnalyzer(subCfg, ""); analyzer != "" {
+				analyzers[subCfg.Name] = analyzer
+			}
+		}
+	}
+	if len(analyzers) == 0 {
+		return nil
 	}
+	return analyzers
+}
 
-	// Handle match_all query (Elasticsearch-like)
-	if _, ok := atlasQuery["match_all"]; ok {
-		return bleve.NewMatchAllQuery(), nil
+// fieldBoosts returns the boost of each field of an index definition that
+// sets one, by path, or nil if none do
+func fieldBoosts(def config.IndexDefinition) map[string]float64 {
+	boosts := make(map[string]float64)
+	for _, fieldCfg := range def.Mappings.Fields {
+		if fieldCfg.Boost > 0 {
+			boosts[fieldCfg.Name] = fieldCfg.Boost
+		}
+		for subName := range fieldCfg.Multi {
+			if subCfg := multiFieldConfig(fieldCfg, subName); subCfg.Boost > 0 {
+				boosts[subCfg.Name] = subCfg.Boost
+			}
+		}
 	}
+	if len(boosts) == 0 {
+		return nil
+	}
+	return boosts
+}
 
-	// Default to match all query
-	return bleve.NewMatchAllQuery(), nil
+// searchAnalyzer returns the analyzer text queries on a field use: its
+// search_analyzer, or else the analyzer it would be indexed with if it had no
+// index_analyzer, falling back to defaultAnalyzer
+func (e *Engine) searchAnalyzer(cfg config.FieldConfig, defaultAnalyzer string) string {
+	if cfg.SearchAnalyzer != "" {
+		return cfg.SearchAnalyzer
+	}
+	if cfg.PathDelimiter != "" {
+		// A queried path matches itself and, through the indexed ancestor
+		// paths of deeper values, everything below it
+		return keyword.Name
+	}
+	if cfg.Type == "ngram" {
+		// Whole query words are looked up among the indexed substrings
+		return standard.Name
+	}
+	if len(cfg.StopWords) > 0 {
+		return stopWordsAnalyzerName(cfg.Name)
+	}
+	cfg.IndexAnalyzer = ""
+	fieldMapping, err := e.createFieldMapping(cfg)
+	if err != nil || fieldMapping.Analyzer == "" {
+		return defaultAnalyzer
+	}
+	return fieldMapping.Analyzer
 }
 
-// convertCompoundQuery converts compound queries
-func (e *Engine) convertCompoundQuery(compound map[string]interface{}) (query.Query, error) {
-	boolQuery := bleve.NewBooleanQuery()
+// convertQuery converts Atlas Search query to Bleve query
+func (e *Engine) convertQuery(atlasQuery map[string]interface{}, opts queryOptions) (query.Query, error) {
+	var operator map[string]interface{}
+	var bleveQuery query.Query
+	var err error
 
-	if must, ok := compound["must"]; ok {
-		mustQueries := must.([]interface{})
-		for _, q := range mustQueries {
-			subQuery, err := e.convertQuery(q.(map[string]interface{}))
-			if err != nil {
-				return nil, err
-			}
-			boolQuery.AddMust(subQuery)
-		}
+	if compound, ok := atlasQuery["compound"]; ok {
+		operator = compound.(map[string]interface{})
+		bleveQuery, err = e.convertCompoundQuery(operator, opts)
+	} else if text, ok := atlasQuery["text"]; ok {
+		operator = text.(map[string]interface{})
+		bleveQuery, err = e.convertTextQuery(operator, opts)
+	} else if term, ok := atlasQuery["term"]; ok {
+		operator = term.(map[string]interface{})
+		bleveQuery, err = e.convertTermQuery(operator, opts)
+	} else if wildcard, ok := atlasQuery["wildcard"]; ok {
+		operator = wildcard.(map[string]interface{})
+		bleveQuery, err = e.convertWildcardQuery(operator, opts)
+	} else if updatedSince, ok := atlasQuery["updatedSince"]; ok {
+		operator, _ = updatedSince.(map[string]interface{})
+		bleveQuery, err = convertUpdatedSinceQuery(operator, opts)
+	} else if _, ok := atlasQuery["match_none"]; ok {
+		// match_none lets generated queries emit a clause that matches nothing
+		return bleve.NewMatchNoneQuery(), nil
+	} else {
+		// Handle match_all query (Elasticsearch-like) and default to match all query
+		return bleve.NewMatchAllQuery(), nil
 	}
 
-	if should, ok := compound["should"]; ok {
-		shouldQueries := should.([]interface{})
-		for _, q := range shouldQueries {
-			subQuery, err := e.convertQuery(q.(map[string]interface{}))
-			if err != nil {
-				return nil, err
-			}
-			boolQuery.AddShould(subQuery)
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	if mustNot, ok := compound["mustNot"]; ok {
-		mustNotQueries := mustNot.([]interface{})
-		for _, q := range mustNotQueries {
-			subQuery, err := e.convertQuery(q.(map[string]interface{}))
-			if err != nil {
-				return nil, err
-			}
-			boolQuery.AddMustNot(subQuery)
-		}
+	// Apply an operator-level boost, e.g. {"compound": {..., "score": {"boost": {"value": 2}}}}
+	if boost, ok, err := parseBoost(operator); err != nil {
+		return nil, err
+	} else if ok {
+		boostQuery(bleveQuery, boost)
 	}
 
-	return boolQuery, nil
+	return bleveQuery, nil
 }
 
-// convertTextQuery converts text search queries
-func (e *Engine) convertTextQuery(textQuery map[string]interface{}) (query.Query, error) {
-	queryText := textQuery["query"].(string)
+// parseBoost extracts score.boost.value from an operator definition
+func parseBoost(operator map[string]interface{}) (float64, bool, error) {
+	score, ok := operator["score"].(map[string]interface{})
+	if !ok {
+		return 0, false, nil
+	}
+	boost, ok := score["boost"].(map[string]interface{})
+	if !ok {
+		return 0, false, nil
+	}
+
+	value, ok := boost["value"].(float64)
+	if !ok {
+		return 0, false, fmt.Errorf("invalid query: score.boost.value must be a number")
+	}
+	if value <= 0 {
+		return 0, false, fmt.Errorf("invalid query: score.boost.value must be positive, got %v", value)
+	}
+	return value, true, nil
+}
+
+// boostQuery multiplies the boost of a query by factor. Bleve ignores the boost
+// of boolean, conjunction and disjunction queries when scoring, so for those the
+// factor is pushed down into every clause, however deeply nested.
+func boostQuery(q query.Query, factor float64) {
+	switch typed := q.(type) {
+	case *query.BooleanQuery:
+		for _, clause := range []query.Query{typed.Must, typed.Should, typed.MustNot} {
+			if clause != nil {
+				boostQuery(clause, factor)
+			}
+		}
+	case *query.ConjunctionQuery:
+		for _, clause := range typed.Conjuncts {
+			boostQuery(clause, factor)
+		}
+	case *query.DisjunctionQuery:
+		for _, clause := range typed.Disjuncts {
+			boostQuery(clause, factor)
+		}
+	case *forwardOnlyQuery:
+		boostQuery(typed.Query, factor)
+	case *cachedFilterQuery:
+		boostQuery(typed.filter, factor)
+		typed.boost *= factor
+	case query.BoostableQuery:
+		typed.SetBoost(typed.Boost() * factor)
+	}
+}
+
+// convertCompoundQuery converts compound queries
+func (e *Engine) convertCompoundQuery(compound map[string]interface{}, opts queryOptions) (query.Query, error) {
+	boolQuery := bleve.NewBooleanQuery()
+
+	must, err := e.convertCompoundClauses(compound, "must", opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, subQuery := range must {
+		boolQuery.AddMust(subQuery)
+	}
+
+	// Should clauses are optional next to must or filter clauses and rank the
+	// hits without changing them, unless minimumShouldMatch requires some.
+	// scoreOnly clauses are never required and are added outside the compound.
+	should, err := e.convertCompoundClauses(compound, "should", opts)
+	if err != nil {
+		return nil, err
+	}
+	scoreOnly, err := scoreOnlyFlags(compound, "should")
+	if err != nil {
+		return nil, err
+	}
+	var matchingShould int
+	var boosters []query.Query
+	for i, subQuery := range should {
+		if scoreOnly[i] {
+			boosters = append(boosters, subQuery)
+			continue
+		}
+		boolQuery.AddShould(subQuery)
+		matchingShould++
+	}
+	if minimumShouldMatch, ok := compound["minimumShouldMatch"]; ok && should != nil {
+		minShould, err := parseMinimumShouldMatch(minimumShouldMatch, matchingShould)
+		if err != nil {
+			return nil, err
+		}
+		if matchingShould > 0 || len(boosters) == 0 {
+			boolQuery.SetMinShould(float64(minShould))
+		}
+		if should, ok := boolQuery.Should.(*query.DisjunctionQuery); ok && minShould > 1 {
+			for i, clause := range should.Disjuncts {
+				should.Disjuncts[i] = &forwardOnlyQuery{clause}
+			}
+		}
+	}
+
+	// Filter clauses must match but don't score: their boost is zeroed, which
+	// leaves the scores of the other clauses unchanged
+	filters, err := e.convertCompoundClauses(compound, "filter", opts)
+	if err != nil {
+		return nil, err
+	}
+	for i, filter := range filters {
+		if opts.cachedFilter != nil {
+			clause := compound["filter"].([]interface{})[i].(map[string]interface{})
+			filter = opts.cachedFilter(clause, filter)
+		}
+		boostQuery(filter, 0)
+		boolQuery.AddMust(filter)
+	}
+
+	// Excluded clauses, including nested compounds, are converted like any
+	// other clause and negated as a whole. Bleve doesn't score must-not
+	// clauses, so their boosts don't affect the remaining hits, and a compound
+	// with only mustNot clauses matches every other document.
+	mustNot, err := e.convertCompoundClauses(compound, "mustNot", opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, subQuery := range mustNot {
+		boolQuery.AddMustNot(subQuery)
+	}
+
+	for _, key := range []string{"must", "filter", "mustNot"} {
+		if flags, err := scoreOnlyFlags(compound, key); err != nil {
+			return nil, err
+		} else if slices.Contains(flags, true) {
+			return nil, fmt.Errorf("invalid query: scoreOnly is only allowed on compound should clauses, not %s", key)
+		}
+	}
+
+	if len(boosters) == 0 {
+		return boolQuery, nil
+	}
+
+	// scoreOnly clauses are the optional clauses of a query requiring the rest
+	// of the compound, or every document when nothing else is left, so they add
+	// to the score of its hits but never decide which documents match
+	var matching query.Query = boolQuery
+	if boolQuery.Must == nil && boolQuery.Should == nil && boolQuery.MustNot == nil {
+		matchAll := bleve.NewMatchAllQuery()
+		matchAll.SetBoost(0)
+		matching = matchAll
+	}
+	scored := bleve.NewBooleanQuery()
+	scored.AddMust(matching)
+	scored.AddShould(boosters...)
+	return scored, nil
+}
+
+// scoreOnlyFlags returns whether each clause listed under a compound key sets
+// scoreOnly, e.g. {"term": {...}, "scoreOnly": true}
+func scoreOnlyFlags(compound map[string]interface{}, key string) ([]bool, error) {
+	clauses, _ := compound[key].([]interface{})
+	flags := make([]bool, len(clauses))
+	for i, clause := range clauses {
+		value, ok := clause.(map[string]interface{})["scoreOnly"]
+		if !ok {
+			continue
+		}
+		if flags[i], ok = value.(bool); !ok {
+			return nil, fmt.Errorf("invalid query: scoreOnly must be a boolean, got %T", value)
+		}
+	}
+	return flags, nil
+}
+
+// convertCompoundClauses converts the clauses listed under a compound key
+func (e *Engine) convertCompoundClauses(compound map[string]interface{}, key string, opts queryOptions) ([]query.Query, error) {
+	value, ok := compound[key]
+	if !ok {
+		return nil, nil
+	}
+	clauses, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid query: compound %s must be an array of clauses, got %T", key, value)
+	}
+
+	queries := make([]query.Query, 0, len(clauses))
+	for _, clause := range clauses {
+		clauseMap, ok := clause.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid query: compound %s clauses must be objects, got %T", key, clause)
+		}
+		subQuery, err := e.convertQuery(clauseMap, opts)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, subQuery)
+	}
+	return queries, nil
+}
+
+// parseMinimumShouldMatch resolves minimumShouldMatch to a number of should clauses.
+// It accepts an integer or a percentage string such as "75%", which is applied to
+// the number of should clauses and truncated like Elasticsearch does.
+func parseMinimumShouldMatch(value interface{}, shouldCount int) (int, error) {
+	switch v := value.(type) {
+	case float64:
+		if v < 0 || v != math.Trunc(v) {
+			return 0, fmt.Errorf("invalid query: minimumShouldMatch must be a non-negative integer, got %v", v)
+		}
+		return int(v), nil
+	case string:
+		trimmed := strings.TrimSpace(v)
+		if !strings.HasSuffix(trimmed, "%") {
+			return 0, fmt.Errorf("invalid query: minimumShouldMatch must be an integer or a percentage, got %q", v)
+		}
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(trimmed, "%"), 64)
+		if err != nil || percentage < 0 || percentage > 100 {
+			return 0, fmt.Errorf("invalid query: minimumShouldMatch percentage must be between 0%% and 100%%, got %q", v)
+		}
+		return int(math.Floor(float64(shouldCount) * percentage / 100)), nil
+	default:
+		return 0, fmt.Errorf("invalid query: minimumShouldMatch must be an integer or a percentage, got %T", value)
+	}
+}
+
+// convertTextQuery converts text search queries. The operator option ("and" or
+// "or") decides whether all or any of the analyzed terms must match; when it is
+// absent the index's default operator applies.
+func (e *Engine) convertTextQuery(textQuery map[string]interface{}, opts queryOptions) (query.Query, error) {
+	queryText := textQuery["query"].(string)
+
+	operator := opts.defaultOperator
+	if value, ok := textQuery["operator"]; ok {
+		name, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid query: text operator must be 'and' or 'or', got %v", value)
+		}
+		operator = name
+	}
+	matchOperator, err := parseMatchOperator(operator)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
 
 	if path, ok := textQuery["path"]; ok {
-		field := path.(string)
+		return expandPaths(path, opts, func(field string) query.Query {
+			matchQuery := bleve.NewMatchQuery(queryText)
+			matchQuery.SetField(field)
+			matchQuery.SetOperator(matchOperator)
+			matchQuery.Analyzer = opts.analyzers[field]
+			return matchQuery
+		})
+	}
+
+	if matchOperator == query.MatchQueryOperatorAnd {
+		// Query strings can't require every term, so match the default field instead
 		matchQuery := bleve.NewMatchQuery(queryText)
-		matchQuery.SetField(field)
+		matchQuery.SetOperator(matchOperator)
 		return matchQuery, nil
 	}
 
 	return bleve.NewQueryStringQuery(queryText), nil
 }
 
+// parseMatchOperator resolves a text operator name; empty means "or"
+func parseMatchOperator(operator string) (query.MatchQueryOperator, error) {
+	switch strings.ToLower(operator) {
+	case "", "or":
+		return query.MatchQueryOperatorOr, nil
+	case "and":
+		return query.MatchQueryOperatorAnd, nil
+	default:
+		return query.MatchQueryOperatorOr, fmt.Errorf("text operator must be 'and' or 'or', got %q", operator)
+	}
+}
+
+// queryOptions carries the index-specific settings used to convert a query
+type queryOptions struct {
+	defaultOperator string                   // Operator for text queries without one
+	timestampField  string                   // Field polled for changes, queried by updatedSince
+	fields          func() ([]string, error) // Lists the indexed fields, to expand wildcard paths
+	analyzers       map[string]string        // Query analyzers by path, for fields that need an explicit one
+	fieldBoosts     map[string]float64       // Boosts of fields whose definition sets one, by path
+	// Replaces a compound filter clause with a cached equivalent (nil keeps it)
+	cachedFilter func(clause map[string]interface{}, filter query.Query) query.Query
+}
+
+// queryOptions returns the query conversion settings of an index or one of its shards
+func (e *Engine) queryOptions(indexName string) queryOptions {
+	def := e.IndexDefinition(indexName)
+	return queryOptions{
+		defaultOperator: def.DefaultOperator,
+		timestampField:  e.timestampField(indexName),
+		fields: func() ([]string, error) {
+			return e.indexedFields(indexName)
+		},
+		analyzers:   e.queryAnalyzers(def),
+		fieldBoosts: fieldBoosts(def),
+	}
+}
+
+// indexedFields returns the sorted names of all fields indexed in an index,
+// across every shard for sharded indexes
+func (e *Engine) indexedFields(indexName string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, index := range e.indexesFor(indexName) {
+		fields, err := index.Fields()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list fields: %w", err)
+		}
+		for _, field := range fields {
+			seen[field] = true
+		}
+	}
+
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// expandPaths builds a query for a path given as a string or an array of
+// strings. An array becomes a disjunction of the queries for each path, so
+// matching any of the fields is enough.
+func expandPaths(path interface{}, opts queryOptions, build func(field string) query.Query) (query.Query, error) {
+	var paths []string
+	switch p := path.(type) {
+	case string:
+		return expandPath(p, opts, build)
+	case []string:
+		paths = p
+	case []interface{}:
+		for _, element := range p {
+			name, ok := element.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid query: path must be a string or an array of strings, got %v", path)
+			}
+			paths = append(paths, name)
+		}
+	default:
+		return nil, fmt.Errorf("invalid query: path must be a string or an array of strings, got %v", path)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("invalid query: path array is empty")
+	}
+
+	var clauses []query.Query
+	for _, p := range paths {
+		clause, err := expandPath(p, opts, build)
+		if err != nil {
+			return nil, err
+		}
+		if _, none := clause.(*query.MatchNoneQuery); !none {
+			clauses = append(clauses, clause)
+		}
+	}
+
+	switch len(clauses) {
+	case 0:
+		return bleve.NewMatchNoneQuery(), nil
+	case 1:
+		return clauses[0], nil
+	default:
+		return bleve.NewDisjunctionQuery(clauses...), nil
+	}
+}
+
+// expandPath builds a query for a path. A path ending in ".*" matches every
+// indexed sub-field below that prefix, and becomes a disjunction of one query
+// per sub-field; other paths are used as-is. The query on each field is
+// boosted by the field's configured boost.
+func expandPath(path string, opts queryOptions, buildQuery func(field string) query.Query) (query.Query, error) {
+	build := func(field string) query.Query {
+		q := buildQuery(field)
+		if boost, ok := opts.fieldBoosts[field]; ok {
+			boostQuery(q, boost)
+		}
+		return q
+	}
+
+	if !strings.HasSuffix(path, ".*") {
+		return build(path), nil
+	}
+	if opts.fields == nil {
+		return nil, fmt.Errorf("invalid query: wildcard path %s can't be resolved without an index", path)
+	}
+
+	fields, err := opts.fields()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimSuffix(path, "*")
+	var clauses []query.Query
+	for _, field := range fields {
+		if strings.HasPrefix(field, prefix) {
+			clauses = append(clauses, build(field))
+		}
+	}
+
+	switch len(clauses) {
+	case 0:
+		return bleve.NewMatchNoneQuery(), nil
+	case 1:
+		return clauses[0], nil
+	default:
+		return bleve.NewDisjunctionQuery(clauses...), nil
+	}
+}
+
+// IndexDefinition returns the configured definition of an index or one of its
+// shards
+func (e *Engine) IndexDefinition(indexName string) config.IndexDefinition {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if def, exists := e.definitions[indexName]; exists {
+		return def
+	}
+	if i := strings.LastIndex(indexName, "_shard_"); i > 0 {
+		return e.definitions[indexName[:i]]
+	}
+	return config.IndexDefinition{}
+}
+
 // convertTermQuery converts term queries
-func (e *Engine) convertTermQuery(termQuery map[string]interface{}) (query.Query, error) {
-	value := termQuery["value"].(string)
+func (e *Engine) convertTermQuery(termQuery map[string]interface{}, opts queryOptions) (query.Query, error) {
 	path := termQuery["path"].(string)
 
-	termQueryObj := bleve.NewTermQuery(value)
-	termQueryObj.SetField(path)
-	return termQueryObj, nil
+	// Strings match exact terms, numbers and booleans match fields indexed with that type
+	switch value := termQuery["value"].(type) {
+	case string:
+		return expandPath(path, opts, func(field string) query.Query {
+			termQueryObj := bleve.NewTermQuery(value)
+			termQueryObj.SetField(field)
+			return termQueryObj
+		})
+	case bool:
+		return expandPath(path, opts, func(field string) query.Query {
+			boolQuery := bleve.NewBoolFieldQuery(value)
+			boolQuery.SetField(field)
+			return boolQuery
+		})
+	default:
+		number, ok := termNumber(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid query: term value must be a string, number or boolean, got %v", value)
+		}
+		inclusive := true
+		return expandPath(path, opts, func(field string) query.Query {
+			numericQuery := bleve.NewNumericRangeInclusiveQuery(&number, &number, &inclusive, &inclusive)
+			numericQuery.SetField(field)
+			return numericQuery
+		})
+	}
+}
+
+// termNumber converts a numeric term value to float64, the type Bleve indexes
+// numbers as. JSON numbers decode as float64; integers come from Go callers.
+func termNumber(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case int:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	default:
+		return 0, false
+	}
 }
 
 // convertWildcardQuery converts wildcard queries
-func (e *Engine) convertWildcardQuery(wildcardQuery map[string]interface{}) (query.Query, error) {
-	value := wildcardQuery["value"].(string)
-	path := wildcardQuery["path"].(string)
+func (e *Engine) convertWildcardQuery(wildcardQuery map[string]interface{}, opts queryOptions) (query.Query, error) {
+	path, ok := wildcardQuery["path"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid query: wildcard path must be a string")
+	}
+	value, err := wildcardPattern(wildcardQuery)
+	if err != nil {
+		return nil, err
+	}
 
-	wildcardQueryObj := bleve.NewWildcardQuery(value)
-	wildcardQueryObj.SetField(path)
-	return wildcardQueryObj, nil
+	return expandPath(path, opts, func(field string) query.Query {
+		wildcardQueryObj := bleve.NewWildcardQuery(value)
+		wildcardQueryObj.SetField(field)
+		return wildcardQueryObj
+	})
 }
 
-// addHighlighting adds highlighting to search request
-func (e *Engine) addHighlighting(searchReq *bleve.SearchRequest, highlight map[string]interface{}) {
-	searchReq.Highlight = bleve.NewHighlight()
-	if fields, ok := highlight["fields"]; ok {
-		for _, field := range fields.([]interface{}) {
-			searchReq.Highlight.AddField(field.(string))
+// wildcardPattern returns the validated pattern of a wildcard operator. Bleve
+// matches patterns against indexed terms as they are, so on analyzed fields,
+// whose terms are lowercased words, allowAnalyzedField lowercases the pattern
+// and rejects patterns spanning several words, which could never match.
+func wildcardPattern(wildcardQuery map[string]interface{}) (string, error) {
+	value, ok := wildcardQuery["value"].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("invalid query: wildcard value must be a non-empty string")
+	}
+
+	allowAnalyzed := false
+	if raw, exists := wildcardQuery["allowAnalyzedField"]; exists {
+		if allowAnalyzed, ok = raw.(bool); !ok {
+			return "", fmt.Errorf("invalid query: wildcard allowAnalyzedField must be a boolean, got %v", raw)
 		}
 	}
+	if !allowAnalyzed {
+		return value, nil
+	}
+
+	if strings.IndexFunc(value, unicode.IsSpace) >= 0 {
+		return "", fmt.Errorf("invalid query: wildcard value %q on an analyzed field must not contain whitespace, since each word is indexed as a separate term", value)
+	}
+	return strings.ToLower(value), nil
 }
 
 // addFacets adds facets to search request
-func (e *Engine) addFacets(searchReq *bleve.SearchRequest, facets map[string]FacetRequest) {
+func (e *Engine) addFacets(index bleve.Index, searchReq *bleve.SearchRequest, facets map[string]FacetRequest) error {
 	for name, facet := range facets {
+		if err := validateRanges(facet); err != nil {
+			return fmt.Errorf("facet %s: %w", name, err)
+		}
+
 		var facetReq *bleve.FacetRequest
 
 		switch facet.Type {
 		case "terms":
 			facetReq = bleve.NewFacetRequest(facet.Field, facet.Size)
 		case "numeric":
-			facetReq = bleve.NewFacetRequest(facet.Field, facet.Size)
+			if len(facet.Ranges) > 0 {
+				facetReq = numericRangeFacet(facet)
+			} else {
+				facetReq = bleve.NewFacetRequest(facet.Field, facet.Size)
+			}
 		case "date":
 			facetReq = bleve.NewFacetRequest(facet.Field, facet.Size)
+		case "date_histogram":
+			var err error
+			facetReq, err = e.dateHistogramFacet(index, searchReq.Query, facet)
+			if err != nil {
+				return fmt.Errorf("facet %s: %w", name, err)
+			}
 		}
 
 		if facetReq != nil {
 			searchReq.AddFacet(name, facetReq)
 		}
 	}
+	return nil
+}
+
+// dateHistogramFacet builds a date range facet with one range per interval
+// between the earliest and latest value of the field among matching documents.
+// Each range is named after its period start so buckets can be keyed by it.
+func (e *Engine) dateHistogramFacet(index bleve.Index, q query.Query, facet FacetRequest) (*bleve.FacetRequest, error) {
+	next, err := dateHistogramStep(facet.Interval)
+	if err != nil {
+		return nil, err
+	}
+
+	minDate, maxDate, found, err := e.dateFieldBounds(index, q, facet.Field)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var periods []time.Time
+	for start := truncateToInterval(minDate, facet.Interval); !start.After(maxDate); start = next(start) {
+		if len(periods) == maxDateHistogramBuckets {
+			return nil, fmt.Errorf("date_histogram on %s spans more than %d %s buckets", facet.Field, maxDateHistogramBuckets, facet.Interval)
+		}
+		periods = append(periods, start)
+	}
+
+	facetReq := bleve.NewFacetRequest(facet.Field, len(periods))
+	for _, start := range periods {
+		facetReq.AddDateTimeRange(start.Format(time.RFC3339), start, next(start))
+	}
+	return facetReq, nil
+}
+
+// dateHistogramStep returns a function advancing a period start by one interval
+func dateHistogramStep(interval string) (func(time.Time) time.Time, error) {
+	switch interval {
+	case "day":
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }, nil
+	case "month":
+		return func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }, nil
+	case "year":
+		return func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }, nil
+	default:
+		return nil, fmt.Errorf("unsupported date_histogram interval %q (expected day, month or year)", interval)
+	}
+}
+
+// truncateToInterval returns the UTC start of the day, month or year containing t
+func truncateToInterval(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	switch interval {
+	case "year":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// dateFieldBounds finds the earliest and latest date in field among documents
+// matching q by sorting on the field in both directions
+func (e *Engine) dateFieldBounds(index bleve.Index, q query.Query, field string) (time.Time, time.Time, bool, error) {
+	bound := func(desc bool) (time.Time, bool, error) {
+		req := bleve.NewSearchRequestOptions(q, 1, 0, false)
+		req.SortByCustom(search.SortOrder{&search.SortField{
+			Field:   field,
+			Desc:    desc,
+			Type:    search.SortFieldAsDate,
+			Missing: search.SortFieldMissingLast,
+		}})
+		res, err := index.Search(req)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("failed to find date bounds of %s: %w", field, err)
+		}
+		if len(res.Hits) == 0 || len(res.Hits[0].Sort) == 0 {
+			return time.Time{}, false, nil
+		}
+		nanos, err := numeric.PrefixCoded(res.Hits[0].Sort[0]).Int64()
+		if err != nil {
+			// The first hit has no value for the field, so none of the hits do
+			return time.Time{}, false, nil
+		}
+		return time.Unix(0, nanos).UTC(), true, nil
+	}
+
+	minDate, found, err := bound(false)
+	if err != nil || !found {
+		return time.Time{}, time.Time{}, false, err
+	}
+	maxDate, _, err := bound(true)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, err
+	}
+	return minDate, maxDate, true, nil
 }
 
 // convertSearchResult converts Bleve search result to our format
@@ -588,7 +1906,7 @@ func (e *Engine) convertSearchResult(result *bleve.SearchResult) *SearchResult {
 
 		hits[i] = SearchHit{
 			ID:     hit.ID,
-			Score:  hit.Score,
+			Score:  scoreOrZero(hit.Score),
 			Source: source,
 		}
 
@@ -601,7 +1919,7 @@ func (e *Engine) convertSearchResult(result *bleve.SearchResult) *SearchResult {
 	searchResult := &SearchResult{
 		Hits:     hits,
 		Total:    int(result.Total),
-		MaxScore: result.MaxScore,
+		MaxScore: scoreOrZero(result.MaxScore),
 	}
 
 	// Add facets if available
@@ -619,6 +1937,24 @@ func (e *Engine) convertSearchResult(result *bleve.SearchResult) *SearchResult {
 				}
 			}
 
+			// Date ranges come from date_histogram facets, keyed by period start
+			if len(facet.DateRanges) > 0 {
+				dateRanges := make([]*search.DateRangeFacet, len(facet.DateRanges))
+				copy(dateRanges, facet.DateRanges)
+				sort.Slice(dateRanges, func(i, j int) bool { return dateRanges[i].Name < dateRanges[j].Name })
+				for _, dateRange := range dateRanges {
+					buckets = append(buckets, map[string]interface{}{
+						"key":   dateRange.Name,
+						"count": dateRange.Count,
+					})
+				}
+			}
+
+			// Numeric ranges come from numeric facets with ranges, keyed by range name
+			if len(facet.NumericRanges) > 0 {
+				buckets = append(buckets, numericRangeBuckets(facet.NumericRanges)...)
+			}
+
 			facetData := map[string]interface{}{
 				"buckets": buckets,
 			}
@@ -630,6 +1966,218 @@ func (e *Engine) convertSearchResult(result *bleve.SearchResult) *SearchResult {
 	return searchResult
 }
 
+// GetIndexStats returns document count, on-disk size and Bleve's internal
+// counters for an index. For sharded indexes the counts are summed across
+// shards and the Bleve counters are reported per shard.
+func (e *Engine) GetIndexStats(indexName string) (*IndexStats, error) {
+	names := []string{indexName}
+	e.mutex.RLock()
+	_, exists := e.indexes[indexName]
+	e.mutex.RUnlock()
+	if !exists {
+		names = e.getShardsForIndex(indexName)
+		if len(names) == 0 {
+			return nil, indexNotFound(indexName)
+		}
+	}
+
+	stats := &IndexStats{
+		Name:       indexName,
+		BleveStats: make(map[string]interface{}),
+	}
+
+	for _, name := range names {
+		index, exists := e.GetIndex(name)
+		if !exists {
+			return nil, indexNotFound(name)
+		}
+
+		docCount, err := index.DocCount()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get document count for %s: %w", name, err)
+		}
+		stats.DocCount += docCount
+
+		diskSize, err := directorySize(filepath.Join(e.indexPath, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get disk size for %s: %w", name, err)
+		}
+		stats.DiskSizeBytes += diskSize
+
+		if cacheStats := e.filterCache.statsFor(name); cacheStats != nil {
+			if stats.FilterCache == nil {
+				stats.FilterCache = &FilterCacheStats{}
+			}
+			stats.FilterCache.Hits += cacheStats.Hits
+			stats.FilterCache.Misses += cacheStats.Misses
+			stats.FilterCache.Entries += cacheStats.Entries
+		}
+
+		if len(names) == 1 && name == indexName {
+			stats.BleveStats = index.StatsMap()
+		} else {
+			stats.BleveStats[name] = index.StatsMap()
+		}
+	}
+
+	// Results are cached under the name searched, the logical name of sharded indexes
+	stats.ResultCache = e.resultCache.statsFor(indexName)
+
+	storage, err := e.indexStorage(indexName, names[0])
+	if err != nil {
+		return nil, err
+	}
+	stats.Storage = storage
+
+	e.syncMutex.RLock()
+	if lastSync, exists := e.lastSync[indexName]; exists {
+		stats.LastSync = &lastSync
+	}
+	e.syncMutex.RUnlock()
+
+	return stats, nil
+}
+
+// indexStorage describes how an index stores field values. Shards share the
+// index type, so checking one of them is enough.
+func (e *Engine) indexStorage(indexName, shardName string) (*IndexStorage, error) {
+	index, exists := e.GetIndex(shardName)
+	if !exists {
+		return nil, indexNotFound(shardName)
+	}
+	advanced, err := index.Advanced()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access index %s: %w", shardName, err)
+	}
+
+	storage := &IndexStorage{
+		IndexType:              IndexTypeUpsidedown,
+		StoredFieldCompression: "none",
+		UnstoredFields:         []string{},
+	}
+	if _, ok := advanced.(*scorch.Scorch); ok {
+		storage.IndexType = IndexTypeScorch
+		storage.StoredFieldCompression = "snappy"
+	}
+
+	for _, field := range e.IndexDefinition(indexName).Mappings.Fields {
+		if field.ExcludeFromSource {
+			storage.UnstoredFields = append(storage.UnstoredFields, field.Name)
+		}
+	}
+	return storage, nil
+}
+
+// directorySize returns the total size of all files below a directory
+func directorySize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// OptimizeResult reports the outcome of compacting an index
+type OptimizeResult struct {
+	Name            string `json:"name"`
+	Optimized       bool   `json:"optimized"` // False when the index type doesn't support compaction
+	SizeBeforeBytes int64  `json:"sizeBeforeBytes"`
+	SizeAfterBytes  int64  `json:"sizeAfterBytes"`
+}
+
+// OptimizeIndex merges the segments of a scorch index (every shard for sharded
+// indexes) into one, dropping the data of deleted documents. Scorch merges
+// online, so searches keep being served while this runs. Upsidedown indexes
+// can't be compacted and are reported with Optimized false.
+func (e *Engine) OptimizeIndex(indexName string) (*OptimizeResult, error) {
+	names := []string{indexName}
+	e.mutex.RLock()
+	_, exists := e.indexes[indexName]
+	e.mutex.RUnlock()
+	if !exists {
+		names = e.getShardsForIndex(indexName)
+		if len(names) == 0 {
+			return nil, indexNotFound(indexName)
+		}
+	}
+
+	if !e.claimOptimize(names) {
+		return nil, fmt.Errorf("index %s: %w", indexName, ErrOptimizeInProgress)
+	}
+	defer e.releaseOptimize(names)
+
+	result := &OptimizeResult{Name: indexName, Optimized: true}
+	for _, name := range names {
+		index, exists := e.GetIndex(name)
+		if !exists {
+			return nil, indexNotFound(name)
+		}
+
+		sizeBefore, err := directorySize(filepath.Join(e.indexPath, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get disk size for %s: %w", name, err)
+		}
+		result.SizeBeforeBytes += sizeBefore
+
+		advanced, err := index.Advanced()
+		if err != nil {
+			return nil, fmt.Errorf("failed to access index %s: %w", name, err)
+		}
+		if scorchIndex, ok := advanced.(*scorch.Scorch); ok {
+			if err := scorchIndex.ForceMerge(context.Background(), nil); err != nil {
+				return nil, fmt.Errorf("failed to optimize %s: %w", name, err)
+			}
+		} else {
+			result.Optimized = false
+		}
+
+		sizeAfter, err := directorySize(filepath.Join(e.indexPath, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get disk size for %s: %w", name, err)
+		}
+		result.SizeAfterBytes += sizeAfter
+	}
+
+	return result, nil
+}
+
+// claimOptimize marks indexes as being optimized, reporting false without
+// marking any if one of them already is. Scorch refuses a second force merge
+// of an index while one runs, so concurrent optimizes are rejected up front.
+func (e *Engine) claimOptimize(names []string) bool {
+	e.optimizeMutex.Lock()
+	defer e.optimizeMutex.Unlock()
+
+	if e.optimizing == nil {
+		e.optimizing = make(map[string]bool)
+	}
+	for _, name := range names {
+		if e.optimizing[name] {
+			return false
+		}
+	}
+	for _, name := range names {
+		e.optimizing[name] = true
+	}
+	return true
+}
+
+// releaseOptimize unmarks indexes claimed by claimOptimize
+func (e *Engine) releaseOptimize(names []string) {
+	e.optimizeMutex.Lock()
+	defer e.optimizeMutex.Unlock()
+
+	for _, name := range names {
+		delete(e.optimizing, name)
+	}
+}
+
 // UpdateLastSync updates the last sync time for an index
 func (e *Engine) UpdateLastSync(indexName string, syncTime time.Time) {
 	e.syncMutex.Lock()
@@ -637,62 +2185,143 @@ func (e *Engine) UpdateLastSync(indexName string, syncTime time.Time) {
 	e.lastSync[indexName] = syncTime
 }
 
-// GetIndexMapping returns the mapping configuration for an index
+// mappedFieldType returns the type a field is indexed as. Unknown types are
+// indexed as text, see createFieldMapping.
+func mappedFieldType(fieldType string) string {
+	switch fieldType {
+	case "text", "keyword", "numeric", "date", "boolean", "ngram":
+		return fieldType
+	default:
+		return "text"
+	}
+}
+
+// GetIndexMapping returns the configured mapping of an index: the dynamic
+// flag, the default analyzer and each field with its type and the analyzer it
+// is indexed with
 func (e *Engine) GetIndexMapping(indexName string) (map[string]interface{}, error) {
 	e.mutex.RLock()
-	_, exists := e.indexes[indexName]
+	def, exists := e.definitions[indexName]
 	e.mutex.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("index %s not found", indexName)
+		return nil, indexNotFound(indexName)
 	}
 
-	// Return basic mapping info
-	// For a more complete implementation, you'd need to store the original config
-	// or parse the bleve mapping structure more carefully
-	result := map[string]interface{}{
-		"name":    indexName,
-		"type":    "bleve",
-		"status":  "active",
-		"message": "Mapping details available through Bleve index introspection",
+	defaultAnalyzer := def.DefaultAnalyzer
+	if defaultAnalyzer == "" {
+		defaultAnalyzer = bleve.NewIndexMapping().DefaultAnalyzer
+	}
+
+	fields := make([]map[string]interface{}, 0, len(def.Mappings.Fields))
+	for _, fieldCfg := range def.Mappings.Fields {
+		fieldMapping, err := e.createFieldMapping(fieldCfg)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", fieldCfg.Name, err)
+		}
+		if len(fieldCfg.StopWords) > 0 {
+			fieldMapping.Analyzer = stopWordsAnalyzerName(fieldCfg.Name)
+		}
+
+		field := map[string]interface{}{
+			"name":  fieldCfg.Name,
+			"type":  mappedFieldType(fieldCfg.Type),
+			"facet": fieldCfg.Facet,
+		}
+		if fieldCfg.Field != "" {
+			field["field"] = fieldCfg.Field
+		}
+		if fieldCfg.Language != "" {
+			field["language"] = fieldCfg.Language
+		}
+		if fieldCfg.ExcludeFromSource {
+			field["excludeFromSource"] = true
+		}
+		if fieldCfg.PathDelimiter != "" {
+			field["pathDelimiter"] = fieldCfg.PathDelimiter
+		}
+		if fieldCfg.Boost > 0 {
+			field["boost"] = fieldCfg.Boost
+		}
+		if fieldCfg.Type == "ngram" {
+			field["minGram"], field["maxGram"] = ngramSizes(fieldCfg)
+		}
+		if fieldMapping.Type == "text" {
+			analyzer := fieldMapping.Analyzer
+			if analyzer == "" {
+				analyzer = defaultAnalyzer
+			}
+			field["analyzer"] = analyzer
+			if searchAnalyzer := e.searchAnalyzer(fieldCfg, defaultAnalyzer); searchAnalyzer != analyzer {
+				field["searchAnalyzer"] = searchAnalyzer
+			}
+		}
+		if len(fieldCfg.Multi) > 0 {
+			multi := make(map[string]interface{}, len(fieldCfg.Multi))
+			for subName := range fieldCfg.Multi {
+				subCfg := multiFieldConfig(fieldCfg, subName)
+				subField := map[string]interface{}{"type": mappedFieldType(subCfg.Type)}
+				if subMapping, err := e.createFieldMapping(subCfg); err == nil && subMapping.Analyzer != "" {
+					analyzer := subMapping.Analyzer
+					if len(subCfg.StopWords) > 0 {
+						analyzer = stopWordsAnalyzerName(subCfg.Name)
+					}
+					subField["analyzer"] = analyzer
+					if searchAnalyzer := e.searchAnalyzer(subCfg, ""); searchAnalyzer != analyzer {
+						subField["searchAnalyzer"] = searchAnalyzer
+					}
+				}
+				multi[subName] = subField
+			}
+			field["multi"] = multi
+		}
+		fields = append(fields, field)
 	}
 
+	result := map[string]interface{}{
+		"name":            indexName,
+		"dynamic":         def.Mappings.Dynamic,
+		"defaultAnalyzer": defaultAnalyzer,
+		"fields":          fields,
+	}
+	// The index still uses the mapping of the definition it was created with
+	if e.MappingOutdated(indexName) {
+		result["outdated"] = true
+	}
 	return result, nil
 }
 
 // getShardForDocument determines which shard a document should be indexed to
 func (e *Engine) getShardForDocument(indexName, docID string) string {
-	// Check if this is a sharded index by looking for shard indexes
-	shardCount := 0
-	e.mutex.RLock()
-	for name := range e.indexes {
-		if len(name) > len(indexName) && name[:len(indexName)] == indexName && name[len(indexName):len(indexName)+7] == "_shard_" {
-			shardCount++
-		}
-	}
-	e.mutex.RUnlock()
+	shards := len(e.getShardsForIndex(indexName))
 
 	// If no shards found, use the index name directly
-	if shardCount == 0 {
+	if shards == 0 {
 		return indexName
 	}
 
-	// Use consistent hashing to determine shard
-	hash := fnv32(docID)
-	shardNum := int(hash) % shardCount
-	return fmt.Sprintf("%s_shard_%d", indexName, shardNum)
+	return e.shardRingFor(indexName, shards).shardFor(docID)
 }
 
-// SearchSharded performs a search across all shards of an index
+// SearchSharded performs a search across all shards of an index, serving
+// repeated identical searches from the result cache when one is configured
 func (e *Engine) SearchSharded(req SearchRequest) (*SearchResult, error) {
+	return e.cachedSearch(req, e.searchSharded)
+}
+
+// searchSharded performs a search across all shards of an index without the
+// result cache
+func (e *Engine) searchSharded(req SearchRequest) (*SearchResult, error) {
 	// Find all shards for this index
 	shards := e.getShardsForIndex(req.Index)
 
 	if len(shards) == 0 {
 		// No shards found, try direct index search
-		return e.Search(req)
+		return e.search(req)
 	}
 
+	start := time.Now()
+
 	// Search all shards in parallel
 	type shardResult struct {
 		result *SearchResult
@@ -705,7 +2334,8 @@ func (e *Engine) SearchSharded(req SearchRequest) (*SearchResult, error) {
 		go func(shard string) {
 			shardReq := req
 			shardReq.Index = shard
-			result, err := e.Search(shardReq)
+			shardReq.MinScore = 0 // Applied to the merged scores, which may be normalized
+			result, err := e.searchIndex(shardReq)
 			resultChan <- shardResult{result: result, err: err}
 		}(shardName)
 	}
@@ -715,6 +2345,7 @@ func (e *Engine) SearchSharded(req SearchRequest) (*SearchResult, error) {
 	allFacets := make(map[string]interface{})
 	totalCount := 0
 	maxScore := float64(0)
+	var queryConversion, searchTime time.Duration
 
 	for i := 0; i < len(shards); i++ {
 		shardRes := <-resultChan
@@ -723,6 +2354,16 @@ func (e *Engine) SearchSharded(req SearchRequest) (*SearchResult, error) {
 			continue
 		}
 
+		if req.ScoreMode == ScoreModeNormalized {
+			e.normalizeHitScores(shardRes.result)
+		}
+
+		// Shards run in parallel, so the slowest shard determines each phase
+		if profile := shardRes.result.Profile; profile != nil {
+			queryConversion = max(queryConversion, time.Duration(profile.QueryConversionMs*float64(time.Millisecond)))
+			searchTime = max(searchTime, time.Duration(profile.SearchMs*float64(time.Millisecond)))
+		}
+
 		allHits = append(allHits, shardRes.result.Hits...)
 		totalCount += shardRes.result.Total
 		if shardRes.result.MaxScore > maxScore {
@@ -738,7 +2379,7 @@ func (e *Engine) SearchSharded(req SearchRequest) (*SearchResult, error) {
 						if existingData, ok := existingFacet.(map[string]interface{}); ok {
 							if existingBuckets, ok := existingData["buckets"].([]map[string]interface{}); ok {
 								allFacets[name] = map[string]interface{}{
-									"buckets": e.mergeFacetBuckets(existingBuckets, buckets),
+									"buckets": e.mergeFacetBuckets(req.Facets[name], existingBuckets, buckets),
 								}
 							}
 						}
@@ -750,6 +2391,21 @@ func (e *Engine) SearchSharded(req SearchRequest) (*SearchResult, error) {
 		}
 	}
 
+	// Replicas can return the same document from more than one shard
+	var duplicates int
+	allHits, duplicates = dedupHits(allHits)
+	totalCount -= duplicates
+
+	if req.MinScore > 0 {
+		kept := allHits[:0]
+		for _, hit := range allHits {
+			if hit.Score >= req.MinScore {
+				kept = append(kept, hit)
+			}
+		}
+		allHits = kept
+	}
+
 	// Sort hits by score and apply pagination
 	e.sortHitsByScore(allHits)
 
@@ -770,12 +2426,24 @@ func (e *Engine) SearchSharded(req SearchRequest) (*SearchResult, error) {
 		allHits = allHits[from:end]
 	}
 
-	return &SearchResult{
+	result := &SearchResult{
 		Hits:     allHits,
 		Total:    totalCount,
 		Facets:   allFacets,
 		MaxScore: maxScore,
-	}, nil
+	}
+	if req.Profile {
+		// Converting and merging the shard results makes up the rest of the time
+		total := time.Since(start)
+		result.Profile = &SearchProfile{
+			QueryConversionMs:  durationMs(queryConversion),
+			SearchMs:           durationMs(searchTime),
+			ResultConversionMs: durationMs(max(total-queryConversion-searchTime, 0)),
+			TotalMs:            durationMs(total),
+		}
+	}
+	e.addSuggestion(req, result)
+	return result, nil
 }
 
 // getShardsForIndex returns all shard names for a given index
@@ -791,34 +2459,115 @@ func (e *Engine) getShardsForIndex(indexName string) []string {
 	return shards
 }
 
-// mergeFacetBuckets merges two sets of facet buckets
-func (e *Engine) mergeFacetBuckets(buckets1, buckets2 []map[string]interface{}) []map[string]interface{} {
-	bucketMap := make(map[string]int)
-	for _, bucket := range buckets1 {
-		if key, ok := bucket["key"].(string); ok {
-			if count, ok := bucket["count"].(int); ok {
-				bucketMap[key] = count
-			}
+// mergeFacetBuckets merges two sets of facet buckets, summing the counts of
+// buckets with the same key. Other bucket fields, such as the bounds of range
+// buckets, are kept, and the merged buckets are ordered the way a single
+// index orders them for the facet's type.
+func (e *Engine) mergeFacetBuckets(facet FacetRequest, buckets1, buckets2 []map[string]interface{}) []map[string]interface{} {
+	var mergedBuckets []map[string]interface{}
+	positions := make(map[string]int)
+	for _, bucket := range append(append([]map[string]interface{}{}, buckets1...), buckets2...) {
+		key, ok := bucket["key"].(string)
+		if !ok {
+			continue
+		}
+		count, _ := bucket["count"].(int)
+		if i, exists := positions[key]; exists {
+			mergedBuckets[i]["count"] = mergedBuckets[i]["count"].(int) + count
+			continue
+		}
+		merged := make(map[string]interface{}, len(bucket))
+		for field, value := range bucket {
+			merged[field] = value
 		}
+		merged["count"] = count
+		positions[key] = len(mergedBuckets)
+		mergedBuckets = append(mergedBuckets, merged)
 	}
 
-	for _, bucket := range buckets2 {
-		if key, ok := bucket["key"].(string); ok {
-			if count, ok := bucket["count"].(int); ok {
-				bucketMap[key] += count
+	switch {
+	case len(facet.Ranges) > 0:
+		// Ranges are ordered by their lower bound, open-ended ranges first
+		sort.SliceStable(mergedBuckets, func(i, j int) bool {
+			a, aOK := mergedBuckets[i]["min"].(float64)
+			b, bOK := mergedBuckets[j]["min"].(float64)
+			if !aOK || !bOK {
+				return !aOK && bOK
 			}
+			return a < b
+		})
+	case facet.Type == "date_histogram":
+		// Periods are keyed by their RFC3339 start, so keys sort chronologically
+		sort.SliceStable(mergedBuckets, func(i, j int) bool {
+			return mergedBuckets[i]["key"].(string) < mergedBuckets[j]["key"].(string)
+		})
+	default:
+		sort.SliceStable(mergedBuckets, func(i, j int) bool {
+			a, b := mergedBuckets[i]["count"].(int), mergedBuckets[j]["count"].(int)
+			if a != b {
+				return a > b
+			}
+			return mergedBuckets[i]["key"].(string) < mergedBuckets[j]["key"].(string)
+		})
+	}
+
+	return mergedBuckets
+}
+
+// matchedFields returns the sorted names of the fields a hit matched query
+// terms in. Internal fields such as the _all composite field are left out, as
+// are clauses without term locations, e.g. numeric ranges and cached filters.
+func matchedFields(locations search.FieldTermLocationMap) []string {
+	fields := make([]string, 0, len(locations))
+	for field := range locations {
+		if !strings.HasPrefix(field, "_") {
+			fields = append(fields, field)
 		}
 	}
+	sort.Strings(fields)
+	return fields
+}
 
-	var mergedBuckets []map[string]interface{}
-	for key, count := range bucketMap {
-		mergedBuckets = append(mergedBuckets, map[string]interface{}{
-			"key":   key,
-			"count": count,
-		})
+// scoreOrZero replaces a NaN score with 0. Bleve scores queries whose clauses
+// all have a zero boost, such as compounds with only filter clauses, as NaN.
+func scoreOrZero(score float64) float64 {
+	if math.IsNaN(score) {
+		return 0
 	}
+	return score
+}
 
-	return mergedBuckets
+// normalizeHitScores scales the hit scores of a single shard result into the
+// range [0, 1] by dividing by the shard's max score. Each shard computes IDF
+// from its own term statistics, so raw scores are not comparable across shards;
+// normalizing trades absolute relevance for a consistent per-shard scale.
+func (e *Engine) normalizeHitScores(result *SearchResult) {
+	if result.MaxScore <= 0 {
+		return
+	}
+
+	for i := range result.Hits {
+		result.Hits[i].Score = result.Hits[i].Score / result.MaxScore
+	}
+	result.MaxScore = 1
+}
+
+// dedupHits keeps the highest-scoring hit of each document ID, preserving the
+// order of the kept hits, and returns the number of hits dropped
+func dedupHits(hits []SearchHit) ([]SearchHit, int) {
+	best := make(map[string]int, len(hits)) // document ID -> index of its kept hit
+	kept := hits[:0]
+	for _, hit := range hits {
+		if i, seen := best[hit.ID]; seen {
+			if hit.Score > kept[i].Score {
+				kept[i] = hit
+			}
+			continue
+		}
+		best[hit.ID] = len(kept)
+		kept = append(kept, hit)
+	}
+	return kept, len(hits) - len(kept)
 }
 
 // sortHitsByScore sorts search hits by score in descending order
@@ -831,18 +2580,3 @@ func (e *Engine) sortHitsByScore(hits []SearchHit) {
 		}
 	}
 }
-
-// fnv32 implements a simple 32-bit FNV-1a hash
-func fnv32(data string) uint32 {
-	const (
-		offset32 = 2166136261
-		prime32  = 16777619
-	)
-
-	hash := uint32(offset32)
-	for _, b := range []byte(data) {
-		hash ^= uint32(b)
-		hash *= prime32
-	}
-	return hash
-}
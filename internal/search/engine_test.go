@@ -1,10 +1,22 @@
 package search
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/index/scorch"
 	"github.com/blevesearch/bleve/v2/search"
 
 	"github.com/davidschrooten/open-atlas-search/config"
@@ -77,6 +89,242 @@ func TestEngine_ListIndexes(t *testing.T) {
 	// This test focuses on the basic structure and empty case
 }
 
+func TestShardRing_GrowingMovesFewDocuments(t *testing.T) {
+	ids := make([]string, 3000)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("doc%d", i)
+	}
+
+	// Hashing modulo the shard count, as documents were routed before
+	moduloShard := func(id string, shards int) string {
+		hash := fnv.New32a()
+		hash.Write([]byte(id))
+		return fmt.Sprintf("products_shard_%d", int(hash.Sum32())%shards)
+	}
+	twoShards, threeShards := newShardRing("products", 2, 128), newShardRing("products", 3, 128)
+
+	moduloMoved, ringMoved := 0, 0
+	perShard := make(map[string]int)
+	for _, id := range ids {
+		if moduloShard(id, 2) != moduloShard(id, 3) {
+			moduloMoved++
+		}
+		before, after := twoShards.shardFor(id), threeShards.shardFor(id)
+		perShard[after]++
+		if before != after {
+			ringMoved++
+			if after != "products_shard_2" {
+				t.Errorf("Expected %s to only move to the new shard, got %s -> %s", id, before, after)
+			}
+		}
+	}
+
+	if moduloMoved < len(ids)/2 {
+		t.Errorf("Expected modulo hashing to move most documents, moved %d of %d", moduloMoved, len(ids))
+	}
+	if ringMoved > len(ids)/2 {
+		t.Errorf("Expected consistent hashing to move about a third of the documents, moved %d of %d", ringMoved, len(ids))
+	}
+	t.Logf("Growing from 2 to 3 shards moved %d documents with modulo hashing and %d with consistent hashing", moduloMoved, ringMoved)
+
+	// Virtual nodes keep the shards reasonably balanced
+	for shard := 0; shard < 3; shard++ {
+		name := fmt.Sprintf("products_shard_%d", shard)
+		if count := perShard[name]; count < len(ids)/6 || count > len(ids)/2 {
+			t.Errorf("Expected %s to hold about a third of the documents, got %d of %d", name, count, len(ids))
+		}
+	}
+}
+
+func TestEngine_GetShardForDocument(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir(), ShardVirtualNodes: 64})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, indexCfg := range []config.IndexConfig{
+		{Name: "users", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}},
+		{Name: "products", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}, Distribution: config.IndexDistribution{Shards: 3}},
+	} {
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+
+	if shard := engine.getShardForDocument("users", "u1"); shard != "users" {
+		t.Errorf("Expected an unsharded index to be used directly, got %s", shard)
+	}
+	ring := newShardRing("products", 3, 64)
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("doc%d", i)
+		if shard, want := engine.getShardForDocument("products", id), ring.shardFor(id); shard != want {
+			t.Errorf("Expected %s on %s, got %s", id, want, shard)
+		}
+	}
+}
+
+func TestEngine_ShardRoutingChange(t *testing.T) {
+	indexPath := t.TempDir()
+	// open restarts the engine with the given virtual nodes per shard
+	open := func(virtualNodes int, reindex bool) *Engine {
+		t.Helper()
+		engine, err := NewEngine(config.SearchConfig{IndexPath: indexPath, ShardVirtualNodes: virtualNodes})
+		if err != nil {
+			t.Fatalf("Failed to create engine: %v", err)
+		}
+		err = engine.CreateIndex(config.IndexConfig{
+			Name:                   "products",
+			Definition:             config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+			Distribution:           config.IndexDistribution{Shards: 2},
+			ReindexOnMappingChange: reindex,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		return engine
+	}
+	docCount := func(engine *Engine) uint64 {
+		t.Helper()
+		var total uint64
+		for _, shard := range []string{"products_shard_0", "products_shard_1"} {
+			index, _ := engine.GetIndex(shard)
+			count, err := index.DocCount()
+			if err != nil {
+				t.Fatalf("Failed to get document count: %v", err)
+			}
+			total += count
+		}
+		return total
+	}
+
+	engine := open(128, false)
+	for i := 0; i < 10; i++ {
+		if err := engine.IndexDocument("products", fmt.Sprintf("p%d", i), map[string]interface{}{"name": "laptop"}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+	engine.Close()
+
+	// Restarting with the same routing keeps the index as is
+	engine = open(128, false)
+	if engine.MappingOutdated("products") || docCount(engine) != 10 {
+		t.Errorf("Expected unchanged routing to keep the index, got outdated %t and %d documents", engine.MappingOutdated("products"), docCount(engine))
+	}
+	engine.Close()
+
+	// Changing shard_virtual_nodes moves documents between shards, so the
+	// index is reported as outdated but keeps its documents by default
+	engine = open(64, false)
+	if !engine.MappingOutdated("products") {
+		t.Error("Expected the changed routing to be detected")
+	}
+	if count := docCount(engine); count != 10 {
+		t.Errorf("Expected the outdated index to keep its documents, got %d", count)
+	}
+	engine.Close()
+
+	// With reindex_on_mapping_change the shards are rebuilt for the new routing
+	engine = open(64, true)
+	if engine.MappingOutdated("products") {
+		t.Error("Expected the rebuilt index to be current")
+	}
+	if count := docCount(engine); count != 0 {
+		t.Errorf("Expected the rebuilt index to be empty until the initial sync, got %d documents", count)
+	}
+	if err := engine.IndexDocument("products", "p0", map[string]interface{}{"name": "laptop"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	// Shards filled before the routing was stored hashed IDs modulo the shard count
+	for _, shard := range []string{"products_shard_0", "products_shard_1"} {
+		index, _ := engine.GetIndex(shard)
+		if err := index.DeleteInternal(shardRoutingKey); err != nil {
+			t.Fatalf("Failed to delete routing: %v", err)
+		}
+	}
+	engine.Close()
+
+	engine = open(64, false)
+	defer engine.Close()
+	if !engine.MappingOutdated("products") {
+		t.Error("Expected shards filled without a stored routing to be outdated")
+	}
+}
+
+func TestEngine_ListIndexes_Sharded(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, indexCfg := range []config.IndexConfig{
+		{
+			Name:         "products",
+			Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+			Distribution: config.IndexDistribution{Shards: 2, Replicas: 3},
+		},
+		{
+			Name:       "users",
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		},
+	} {
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index %s: %v", indexCfg.Name, err)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := engine.IndexDocument("products", fmt.Sprintf("p%d", i), map[string]interface{}{"name": "laptop"}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+	if err := engine.IndexDocument("users", "u1", map[string]interface{}{"name": "jane"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	indexes, err := engine.ListIndexes()
+	if err != nil {
+		t.Fatalf("Failed to list indexes: %v", err)
+	}
+
+	byName := make(map[string]IndexInfo)
+	for _, info := range indexes {
+		byName[info.Name] = info
+	}
+
+	products, ok := byName["products"]
+	if !ok {
+		t.Fatalf("Expected a logical entry for the sharded index, got %v", indexes)
+	}
+	if products.DocCount != 5 {
+		t.Errorf("Expected 5 documents across shards, got %d", products.DocCount)
+	}
+	if products.Shards != 2 || products.Replicas != 3 {
+		t.Errorf("Expected 2 shards and 3 replicas, got %d and %d", products.Shards, products.Replicas)
+	}
+
+	shard0, shard1 := byName["products_shard_0"], byName["products_shard_1"]
+	if shard0.DocCount+shard1.DocCount != 5 {
+		t.Errorf("Expected shard counts to add up to 5, got %d and %d", shard0.DocCount, shard1.DocCount)
+	}
+	if shard0.ShardOf != "products" || shard1.ShardOf != "products" {
+		t.Errorf("Expected shard entries to name their logical index, got %q and %q", shard0.ShardOf, shard1.ShardOf)
+	}
+	if products.ShardOf != "" {
+		t.Errorf("Expected the logical entry not to be marked as a shard, got %q", products.ShardOf)
+	}
+	if shard0.Shards != 1 || shard0.Replicas != 3 {
+		t.Errorf("Expected shard entry with 1 shard and 3 replicas, got %+v", shard0)
+	}
+
+	users := byName["users"]
+	if users.DocCount != 1 || users.Shards != 1 || users.Replicas != 1 {
+		t.Errorf("Expected unsharded index with 1 document, 1 shard and 1 replica, got %+v", users)
+	}
+}
+
 func TestEngine_ConvertSearchResult(t *testing.T) {
 	engine := &Engine{}
 
@@ -149,6 +397,365 @@ func TestEngine_ConvertSearchResult(t *testing.T) {
 	}
 }
 
+func TestEngine_Search_HighlightPhraseAndWildcard(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "articles",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	doc := map[string]interface{}{"content": "the quick brown fox jumps over the lazy dog"}
+	if err := engine.IndexDocument("articles", "doc1", doc); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	queries := map[string]map[string]interface{}{
+		"phrase":   {"text": map[string]interface{}{"query": `content:"brown fox"`}},
+		"wildcard": {"wildcard": map[string]interface{}{"value": "qui*", "path": "content"}},
+	}
+	expected := map[string][]string{
+		"phrase":   {"<mark>brown</mark>", "<mark>fox</mark>"},
+		"wildcard": {"<mark>quick</mark>"},
+	}
+
+	for name, q := range queries {
+		result, err := engine.Search(SearchRequest{
+			Index:     "articles",
+			Query:     q,
+			Highlight: map[string]interface{}{"fields": []interface{}{"content"}},
+			Size:      10,
+		})
+		if err != nil {
+			t.Fatalf("%s search failed: %v", name, err)
+		}
+		if len(result.Hits) != 1 {
+			t.Fatalf("Expected 1 %s hit, got %d", name, len(result.Hits))
+		}
+
+		fragments := result.Hits[0].Highlight["content"]
+		if len(fragments) == 0 {
+			t.Errorf("Expected highlight fragments for %s query", name)
+			continue
+		}
+		for _, mark := range expected[name] {
+			if !strings.Contains(fragments[0], mark) {
+				t.Errorf("Expected %s fragment %q to contain %q", name, fragments[0], mark)
+			}
+		}
+	}
+
+	// Without a highlight request no fragments are produced
+	result, err := engine.Search(SearchRequest{Index: "articles", Query: queries["phrase"], Size: 10})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(result.Hits) != 1 || result.Hits[0].Highlight != nil {
+		t.Errorf("Expected 1 hit without highlighting, got %+v", result.Hits)
+	}
+}
+
+func TestEngine_Search_HighlightFragmentOrder(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir(), MaxHighlightFragments: 2})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "articles",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	// The first mention matches one query term, the second, far enough away to
+	// be its own fragment, matches both
+	filler := strings.Repeat("lorem ipsum dolor sit amet ", 20)
+	doc := map[string]interface{}{"content": "a fox ran " + filler + "a fox chased the dog"}
+	if err := engine.IndexDocument("articles", "doc1", doc); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	highlight := func(options map[string]interface{}) []string {
+		t.Helper()
+		options["fields"] = []interface{}{"content"}
+		result, err := engine.Search(SearchRequest{
+			Index:     "articles",
+			Query:     map[string]interface{}{"text": map[string]interface{}{"query": "fox dog", "path": "content"}},
+			Highlight: options,
+			Size:      10,
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(result.Hits) != 1 {
+			t.Fatalf("Expected 1 hit, got %d", len(result.Hits))
+		}
+		return result.Hits[0].Highlight["content"]
+	}
+
+	byScore := highlight(map[string]interface{}{"fragmentOrder": FragmentOrderScore})
+	byOffset := highlight(map[string]interface{}{"fragmentOrder": FragmentOrderOffset})
+	if len(byScore) != 2 || len(byOffset) != 2 {
+		t.Fatalf("Expected max_highlight_fragments to return 2 fragments, got %q and %q", byScore, byOffset)
+	}
+	if !strings.Contains(byScore[0], "<mark>dog</mark>") || strings.Contains(byScore[1], "<mark>dog</mark>") {
+		t.Errorf("Expected the fragment matching both terms first by score, got %q", byScore)
+	}
+	if !strings.Contains(byOffset[0], "<mark>fox</mark> ran") || !strings.Contains(byOffset[1], "<mark>dog</mark>") {
+		t.Errorf("Expected the fragments in field order by offset, got %q", byOffset)
+	}
+
+	// Score is the default order and maxNumberOfFragments overrides the default count
+	if defaults := highlight(map[string]interface{}{}); !reflect.DeepEqual(defaults, byScore) {
+		t.Errorf("Expected score order by default, got %q", defaults)
+	}
+	if single := highlight(map[string]interface{}{"maxNumberOfFragments": 1.0}); len(single) != 1 || single[0] != byScore[0] {
+		t.Errorf("Expected only the best fragment, got %q", single)
+	}
+
+	for _, options := range []map[string]interface{}{
+		{"fragmentOrder": "length"},
+		{"maxNumberOfFragments": 0.0},
+		{"maxNumberOfFragments": 1.5},
+	} {
+		_, err := engine.Search(SearchRequest{
+			Index:     "articles",
+			Query:     map[string]interface{}{"text": map[string]interface{}{"query": "fox", "path": "content"}},
+			Highlight: options,
+			Size:      10,
+		})
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected ErrInvalidQuery for highlight %v, got %v", options, err)
+		}
+	}
+}
+
+func TestEngine_Search_MinScore(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, indexCfg := range []config.IndexConfig{
+		{Name: "single", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}},
+		{Name: "sharded", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}, Distribution: config.IndexDistribution{Shards: 2}},
+	} {
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index %s: %v", indexCfg.Name, err)
+		}
+		// "laptop" dominates the short title and is diluted in the long one,
+		// though per-shard statistics can reorder them on the sharded index
+		docs := map[string]string{
+			"strong": "laptop",
+			"weak":   "laptop sleeve with extra padding for travel and daily commuting",
+			"other":  "phone case",
+		}
+		for id, title := range docs {
+			if err := engine.IndexDocument(indexCfg.Name, id, map[string]interface{}{"title": title}); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+	}
+
+	search := func(index string, minScore float64) *SearchResult {
+		req := SearchRequest{
+			Index:    index,
+			Query:    map[string]interface{}{"text": map[string]interface{}{"query": "laptop", "path": "title"}},
+			Size:     10,
+			MinScore: minScore,
+		}
+		result, err := engine.SearchSharded(req)
+		if err != nil {
+			t.Fatalf("Search on %s failed: %v", index, err)
+		}
+		return result
+	}
+
+	for _, index := range []string{"single", "sharded"} {
+		all := search(index, 0)
+		if len(all.Hits) != 2 {
+			t.Fatalf("Expected 2 hits on %s without min_score, got %d", index, len(all.Hits))
+		}
+		threshold := (all.Hits[0].Score + all.Hits[1].Score) / 2
+
+		filtered := search(index, threshold)
+		if len(filtered.Hits) != 1 || filtered.Hits[0].ID != all.Hits[0].ID {
+			t.Errorf("Expected only hit %s on %s above %f, got %+v", all.Hits[0].ID, index, threshold, filtered.Hits)
+		}
+		if filtered.Total != 2 {
+			t.Errorf("Expected total on %s to still count every match, got %d", index, filtered.Total)
+		}
+	}
+}
+
+func TestEngine_CountBy_Sharded(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:         "products",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		Distribution: config.IndexDistribution{Shards: 2},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		category := "electronics"
+		if i%3 == 0 {
+			category = "books"
+		}
+		if err := engine.IndexDocument("products", fmt.Sprintf("p%d", i), map[string]interface{}{"category": category}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	counts, err := engine.CountBy("products", "category", nil)
+	if err != nil {
+		t.Fatalf("CountBy failed: %v", err)
+	}
+	expected := map[string]int{"books": 4, "electronics": 6}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Expected counts %v summed across shards, got %v", expected, counts)
+	}
+
+	if _, err := engine.CountBy("missing", "category", nil); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error for unknown index, got %v", err)
+	}
+}
+
+func TestEngine_Terms(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, shards := range []int{0, 2} {
+		indexCfg := config.IndexConfig{
+			Name: fmt.Sprintf("products_%d", shards),
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+				{Name: "category", Type: "keyword"},
+				{Name: "price", Type: "number"},
+			}}},
+			Distribution: config.IndexDistribution{Shards: shards},
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		categories := []string{"books", "electronics", "books", "garden", "electronics", "books", "games"}
+		for i, category := range categories {
+			doc := map[string]interface{}{"category": category, "price": float64(i)}
+			if err := engine.IndexDocument(indexCfg.Name, fmt.Sprintf("p%d", i), doc); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+
+		tests := []struct {
+			field    string
+			prefix   string
+			size     int
+			expected []TermCount
+		}{
+			{"category", "", 0, []TermCount{{"books", 3}, {"electronics", 2}, {"games", 1}, {"garden", 1}}},
+			{"category", "ga", 0, []TermCount{{"games", 1}, {"garden", 1}}},
+			{"category", "", 2, []TermCount{{"books", 3}, {"electronics", 2}}},
+			{"category", "toys", 0, []TermCount{}},
+			{"price", "", 0, []TermCount{}},
+		}
+		for _, tt := range tests {
+			terms, err := engine.Terms(indexCfg.Name, tt.field, tt.prefix, tt.size)
+			if err != nil {
+				t.Fatalf("Terms failed: %v", err)
+			}
+			if !reflect.DeepEqual(terms, tt.expected) {
+				t.Errorf("%d shards, field %s, prefix %q, size %d: expected %v, got %v", shards, tt.field, tt.prefix, tt.size, tt.expected, terms)
+			}
+		}
+	}
+
+	if _, err := engine.Terms("missing", "category", "", 0); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected not found error for unknown index, got %v", err)
+	}
+}
+
+func TestEngine_ExportDocuments(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, shards := range []int{0, 3} {
+		indexCfg := config.IndexConfig{
+			Name:         fmt.Sprintf("products_%d", shards),
+			Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+			Distribution: config.IndexDistribution{Shards: shards},
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		// Export 3 documents per page, so it has to continue across pages
+		docCount := 20
+		for i := 0; i < docCount; i++ {
+			doc := map[string]interface{}{"name": fmt.Sprintf("product %d", i)}
+			if err := engine.IndexDocument(indexCfg.Name, fmt.Sprintf("p%05d", i), doc); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+
+		exported := make(map[string]string)
+		err := engine.exportDocuments(indexCfg.Name, 3, func(doc ExportedDocument) error {
+			if _, seen := exported[doc.ID]; seen {
+				t.Errorf("%d shards: document %s exported twice", shards, doc.ID)
+			}
+			name, _ := doc.Source["name"].(string)
+			exported[doc.ID] = name
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ExportDocuments failed: %v", err)
+		}
+		if len(exported) != docCount {
+			t.Errorf("%d shards: expected %d exported documents, got %d", shards, docCount, len(exported))
+		}
+		if exported["p00012"] != "product 12" {
+			t.Errorf("%d shards: expected the stored name of p00012, got %q", shards, exported["p00012"])
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = engine.ExportDocuments("products_0", func(doc ExportedDocument) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Expected export to stop at the first callback error, got %v after %d calls", err, calls)
+	}
+
+	if err := engine.ExportDocuments("missing", func(ExportedDocument) error { return nil }); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected not found error for unknown index, got %v", err)
+	}
+}
+
 func TestEngine_ConvertTextQuery(t *testing.T) {
 	engine := &Engine{}
 
@@ -158,7 +765,7 @@ func TestEngine_ConvertTextQuery(t *testing.T) {
 		"path":  "content",
 	}
 
-	query, err := engine.convertTextQuery(textQuery)
+	query, err := engine.convertTextQuery(textQuery, queryOptions{})
 	if err != nil {
 		t.Fatalf("Failed to convert text query: %v", err)
 	}
@@ -172,7 +779,7 @@ func TestEngine_ConvertTextQuery(t *testing.T) {
 		"query": "test search",
 	}
 
-	query2, err := engine.convertTextQuery(textQueryNoPath)
+	query2, err := engine.convertTextQuery(textQueryNoPath, queryOptions{})
 	if err != nil {
 		t.Fatalf("Failed to convert text query without path: %v", err)
 	}
@@ -190,7 +797,7 @@ func TestEngine_ConvertTermQuery(t *testing.T) {
 		"path":  "status",
 	}
 
-	query, err := engine.convertTermQuery(termQuery)
+	query, err := engine.convertTermQuery(termQuery, queryOptions{})
 	if err != nil {
 		t.Fatalf("Failed to convert term query: %v", err)
 	}
@@ -200,6 +807,75 @@ func TestEngine_ConvertTermQuery(t *testing.T) {
 	}
 }
 
+func TestEngine_Search_TermNumericAndBoolean(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	docs := map[string]map[string]interface{}{
+		"a": {"stock": 5, "active": true, "status": "open"},
+		"b": {"stock": 12, "active": false, "status": "closed"},
+	}
+	for id, doc := range docs {
+		if err := engine.IndexDocument("products", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		value    interface{}
+		expected []string
+	}{
+		{"stock", float64(5), []string{"a"}},
+		{"stock", 12, []string{"b"}},
+		{"stock", float64(7), nil},
+		{"active", true, []string{"a"}},
+		{"active", false, []string{"b"}},
+		{"status", "open", []string{"a"}},
+	}
+	for _, tt := range tests {
+		result, err := engine.Search(SearchRequest{
+			Index: "products",
+			Query: map[string]interface{}{"term": map[string]interface{}{"path": tt.path, "value": tt.value}},
+			Size:  10,
+		})
+		if err != nil {
+			t.Fatalf("Term query %s=%v failed: %v", tt.path, tt.value, err)
+		}
+		var ids []string
+		for _, hit := range result.Hits {
+			ids = append(ids, hit.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.expected) {
+			t.Errorf("Term query %s=%v: expected hits %v, got %v", tt.path, tt.value, tt.expected, ids)
+		}
+	}
+
+	if _, err := engine.convertTermQuery(map[string]interface{}{"path": "stock", "value": []interface{}{5}}, queryOptions{}); err == nil {
+		t.Error("Expected error for an array term value")
+	}
+
+	desc, err := engine.DescribeQuery("products", map[string]interface{}{"term": map[string]interface{}{"path": "active", "value": true}})
+	if err != nil {
+		t.Fatalf("Failed to describe query: %v", err)
+	}
+	if desc.Type != "bool" || desc.Field != "active" {
+		t.Errorf("Expected bool query on active, got %+v", desc)
+	}
+}
+
 func TestEngine_ConvertWildcardQuery(t *testing.T) {
 	engine := &Engine{}
 
@@ -208,7 +884,7 @@ func TestEngine_ConvertWildcardQuery(t *testing.T) {
 		"path":  "title",
 	}
 
-	query, err := engine.convertWildcardQuery(wildcardQuery)
+	query, err := engine.convertWildcardQuery(wildcardQuery, queryOptions{})
 	if err != nil {
 		t.Fatalf("Failed to convert wildcard query: %v", err)
 	}
@@ -217,3 +893,3929 @@ func TestEngine_ConvertWildcardQuery(t *testing.T) {
 		t.Fatal("Expected query to be created")
 	}
 }
+
+func TestEngine_Search_WildcardAllowAnalyzedField(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+			{Name: "name", Type: "text"},
+			{Name: "sku", Type: "keyword"},
+		}}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	docs := map[string]map[string]interface{}{
+		"1": {"name": "MacBook Pro", "sku": "MBP-2024"},
+		"2": {"name": "Magic Mouse", "sku": "MM-2021"},
+	}
+	for id, doc := range docs {
+		if err := engine.IndexDocument("products", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	wildcard := func(path, value string, allowAnalyzed interface{}) map[string]interface{} {
+		operator := map[string]interface{}{"path": path, "value": value}
+		if allowAnalyzed != nil {
+			operator["allowAnalyzedField"] = allowAnalyzed
+		}
+		return map[string]interface{}{"wildcard": operator}
+	}
+
+	tests := []struct {
+		name     string
+		query    map[string]interface{}
+		expected int
+	}{
+		// The analyzed field's terms are lowercased, so mixed-case patterns
+		// only match once normalized
+		{"mixed case on analyzed field", wildcard("name", "Mac*", nil), 0},
+		{"mixed case allowed on analyzed field", wildcard("name", "Mac*", true), 1},
+		{"single character wildcard", wildcard("name", "MA?IC", true), 1},
+		{"lowercase pattern", wildcard("name", "ma*", false), 2},
+		// Keyword values keep their case
+		{"keyword field", wildcard("sku", "MBP-*", nil), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := engine.Search(SearchRequest{Index: "products", Query: tt.query, Size: 10})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if result.Total != tt.expected {
+				t.Errorf("Expected %d hits, got %d", tt.expected, result.Total)
+			}
+		})
+	}
+
+	for name, query := range map[string]map[string]interface{}{
+		"empty value":        wildcard("name", "", true),
+		"several words":      wildcard("name", "Mac* Pro", true),
+		"non-boolean option": wildcard("name", "Mac*", "yes"),
+		"missing path":       {"wildcard": map[string]interface{}{"value": "mac*"}},
+	} {
+		_, err := engine.Search(SearchRequest{Index: "products", Query: query, Size: 10})
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected %s to be rejected as an invalid query, got %v", name, err)
+		}
+	}
+}
+
+func TestEngine_SearchSharded_ScoreMode(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+		Distribution: config.IndexDistribution{Shards: 2},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create sharded index: %v", err)
+	}
+
+	// Skew term frequencies: "laptop" is common in shard 0 and rare in shard 1,
+	// so the same document scores very differently depending on its shard.
+	shard0, _ := engine.GetIndex("products_shard_0")
+	shard1, _ := engine.GetIndex("products_shard_1")
+	for i := 0; i < 20; i++ {
+		if err := shard0.Index(fmt.Sprintf("common%d", i), map[string]interface{}{"name": "laptop bag"}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+		if err := shard1.Index(fmt.Sprintf("other%d", i), map[string]interface{}{"name": "phone case"}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+	if err := shard0.Index("a", map[string]interface{}{"name": "laptop"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+	if err := shard1.Index("b", map[string]interface{}{"name": "laptop"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	scoresByID := func(scoreMode string) map[string]float64 {
+		result, err := engine.SearchSharded(SearchRequest{
+			Index:     "products",
+			Query:     map[string]interface{}{"text": map[string]interface{}{"query": "laptop", "path": "name"}},
+			Size:      50,
+			ScoreMode: scoreMode,
+		})
+		if err != nil {
+			t.Fatalf("Sharded search failed: %v", err)
+		}
+		scores := make(map[string]float64)
+		for _, hit := range result.Hits {
+			scores[hit.ID] = hit.Score
+		}
+		return scores
+	}
+
+	raw := scoresByID(ScoreModeRaw)
+	if raw["b"] <= raw["a"]*1.5 {
+		t.Fatalf("Expected raw score of rare-term shard to dominate, got a=%f b=%f", raw["a"], raw["b"])
+	}
+
+	normalized := scoresByID(ScoreModeNormalized)
+	if math.Abs(normalized["a"]-normalized["b"]) > 1e-9 {
+		t.Errorf("Expected identical documents to score equally when normalized, got a=%f b=%f", normalized["a"], normalized["b"])
+	}
+	for id, score := range normalized {
+		if score < 0 || score > 1 {
+			t.Errorf("Expected normalized score for %s in [0, 1], got %f", id, score)
+		}
+	}
+}
+
+func TestEngine_CreateIndex_DefaultAnalyzer(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	analyzers := map[string]string{
+		"standard_index": "",
+		"keyword_index":  "keyword",
+	}
+	for name, analyzer := range analyzers {
+		indexCfg := config.IndexConfig{
+			Name: name,
+			Definition: config.IndexDefinition{
+				Mappings:        config.IndexMappings{Dynamic: true},
+				DefaultAnalyzer: analyzer,
+			},
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index %s: %v", name, err)
+		}
+		if err := engine.IndexDocument(name, "doc1", map[string]interface{}{"title": "Hello World"}); err != nil {
+			t.Fatalf("Failed to index document into %s: %v", name, err)
+		}
+	}
+
+	termHits := func(indexName, term string) int {
+		result, err := engine.Search(SearchRequest{
+			Index: indexName,
+			Query: map[string]interface{}{"term": map[string]interface{}{"value": term, "path": "title"}},
+			Size:  10,
+		})
+		if err != nil {
+			t.Fatalf("Search on %s failed: %v", indexName, err)
+		}
+		return result.Total
+	}
+
+	// The standard analyzer splits and lowercases, the keyword analyzer keeps the whole value
+	if hits := termHits("standard_index", "hello"); hits != 1 {
+		t.Errorf("Expected standard analyzer to produce token 'hello', got %d hits", hits)
+	}
+	if hits := termHits("keyword_index", "hello"); hits != 0 {
+		t.Errorf("Expected keyword analyzer not to produce token 'hello', got %d hits", hits)
+	}
+	if hits := termHits("keyword_index", "Hello World"); hits != 1 {
+		t.Errorf("Expected keyword analyzer to produce token 'Hello World', got %d hits", hits)
+	}
+}
+
+func TestEngine_CreateIndex_UnknownDefaultAnalyzer(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "bad_index",
+		Definition: config.IndexDefinition{
+			DefaultAnalyzer: "does_not_exist",
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err == nil {
+		t.Error("Expected error for unknown default analyzer")
+	}
+	if _, exists := engine.GetIndex("bad_index"); exists {
+		t.Error("Expected index not to be created with unknown default analyzer")
+	}
+}
+
+func TestEngine_CreateFieldMapping_Language(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "articles",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{
+				Fields: []config.FieldConfig{
+					{Name: "body", Type: "text", Language: "en"},
+					{Name: "tag", Type: "keyword", Language: "en"},
+					{Name: "summary", Type: "text", Language: "en", Analyzer: "standard"},
+				},
+			},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	doc := map[string]interface{}{"body": "running", "tag": "running", "summary": "running"}
+	if err := engine.IndexDocument("articles", "doc1", doc); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	textHits := func(path string) int {
+		result, err := engine.Search(SearchRequest{
+			Index: "articles",
+			Query: map[string]interface{}{"text": map[string]interface{}{"query": "run", "path": path}},
+			Size:  10,
+		})
+		if err != nil {
+			t.Fatalf("Search on %s failed: %v", path, err)
+		}
+		return result.Total
+	}
+
+	if hits := textHits("body"); hits != 1 {
+		t.Errorf("Expected English field to stem 'running' to match 'run', got %d hits", hits)
+	}
+	if hits := textHits("tag"); hits != 0 {
+		t.Errorf("Expected keyword field not to stem 'running', got %d hits", hits)
+	}
+	if hits := textHits("summary"); hits != 0 {
+		t.Errorf("Expected explicit analyzer to win over language, got %d hits", hits)
+	}
+}
+
+func TestEngine_CreateFieldMapping_UnsupportedLanguage(t *testing.T) {
+	engine := &Engine{}
+
+	if _, err := engine.createFieldMapping(config.FieldConfig{Name: "body", Type: "text", Language: "xx"}); err == nil {
+		t.Error("Expected error for unsupported language")
+	}
+}
+
+func TestEngine_CreateFieldMapping_StopWords(t *testing.T) {
+	indexPath := t.TempDir()
+	engine, err := NewEngine(config.SearchConfig{IndexPath: indexPath})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{
+				Fields: []config.FieldConfig{
+					{Name: "title", Type: "text", StopWords: []string{"Acme", "inc"}},
+					{Name: "brand", Type: "text"},
+				},
+			},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	doc := map[string]interface{}{"title": "Acme Widgets Inc", "brand": "Acme"}
+	if err := engine.IndexDocument("products", "doc1", doc); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	hits := func(engine *Engine, queryType, value, path string) int {
+		operator := map[string]interface{}{"path": path}
+		if queryType == "text" {
+			operator["query"] = value
+		} else {
+			operator["value"] = value
+		}
+		result, err := engine.Search(SearchRequest{
+			Index: "products",
+			Query: map[string]interface{}{queryType: operator},
+			Size:  10,
+		})
+		if err != nil {
+			t.Fatalf("Search for %q on %s failed: %v", value, path, err)
+		}
+		return result.Total
+	}
+
+	if n := hits(engine, "text", "acme", "title"); n != 0 {
+		t.Errorf("Expected stop word 'acme' to match nothing, got %d hits", n)
+	}
+	if n := hits(engine, "term", "inc", "title"); n != 0 {
+		t.Errorf("Expected stop word 'inc' not to be indexed, got %d hits", n)
+	}
+	if n := hits(engine, "text", "widgets", "title"); n != 1 {
+		t.Errorf("Expected 'widgets' to match, got %d hits", n)
+	}
+	if n := hits(engine, "text", "acme", "brand"); n != 1 {
+		t.Errorf("Expected stop words to only apply to their field, got %d hits", n)
+	}
+
+	// The analyzer is stored with the index mapping, so it survives a reopen
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+	reopened, err := NewEngine(config.SearchConfig{IndexPath: indexPath})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer reopened.Close()
+	if err := reopened.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to reopen index: %v", err)
+	}
+	if n := hits(reopened, "text", "acme widgets", "title"); n != 1 {
+		t.Errorf("Expected 'acme widgets' to match on 'widgets' after reopen, got %d hits", n)
+	}
+}
+
+func TestEngine_CreateIndex_StopWordsInvalid(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	fields := []config.FieldConfig{
+		{Name: "sku", Type: "keyword", StopWords: []string{"acme"}},
+		{Name: "title", Type: "text", Language: "en", StopWords: []string{"acme"}},
+	}
+	for _, field := range fields {
+		indexCfg := config.IndexConfig{
+			Name:       "bad_" + field.Name,
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{field}}},
+		}
+		if err := engine.CreateIndex(indexCfg); err == nil {
+			t.Errorf("Expected error for stop_words on field %+v", field)
+		}
+	}
+}
+
+func TestEngine_CreateIndex_MultiFields(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "books",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{
+				Fields: []config.FieldConfig{
+					{Name: "title", Type: "text", Multi: map[string]config.FieldConfig{
+						"raw":     {Type: "keyword"},
+						"english": {Type: "text", Language: "en"},
+					}},
+					{Name: "author", Type: "text", Multi: map[string]config.FieldConfig{
+						"raw": {Type: "keyword"},
+					}},
+				},
+			},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	docs := map[string]map[string]interface{}{
+		"1": {"title": "Running in Action", "author": "Jane Doe"},
+		"2": {"title": "Action Runs", "author": "John Doe"},
+	}
+	for id, doc := range docs {
+		if err := engine.IndexDocument("books", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	search := func(queryType, value, path string) *SearchResult {
+		operator := map[string]interface{}{"path": path}
+		if queryType == "text" {
+			operator["query"] = value
+		} else {
+			operator["value"] = value
+		}
+		result, err := engine.Search(SearchRequest{
+			Index: "books",
+			Query: map[string]interface{}{queryType: operator},
+			Size:  10,
+		})
+		if err != nil {
+			t.Fatalf("Search for %q on %s failed: %v", value, path, err)
+		}
+		return result
+	}
+
+	tests := []struct {
+		queryType, value, path string
+		expected               int
+	}{
+		{"text", "action", "title", 2},
+		{"text", "running", "title", 1},
+		{"term", "Running in Action", "title", 0},
+		{"term", "Running in Action", "title.raw", 1},
+		{"term", "action", "title.raw", 0},
+		// Text queries on a keyword sub-field match the whole value
+		{"text", "Running in Action", "title.raw", 1},
+		// The English sub-field stems, so "running" matches "Runs" too
+		{"text", "running", "title.english", 2},
+		{"term", "Jane Doe", "author.raw", 1},
+		{"text", "doe", "author", 2},
+	}
+	for _, tt := range tests {
+		if n := search(tt.queryType, tt.value, tt.path).Total; n != tt.expected {
+			t.Errorf("Expected %s %q on %s to match %d documents, got %d", tt.queryType, tt.value, tt.path, tt.expected, n)
+		}
+	}
+
+	// Sub-fields index the field's value again but aren't returned with hits
+	result := search("term", "Jane Doe", "author.raw")
+	if len(result.Hits) == 1 {
+		if _, ok := result.Hits[0].Source["author.raw"]; ok {
+			t.Errorf("Expected sub-fields not to be stored, got %v", result.Hits[0].Source)
+		}
+	}
+
+	indexMapping, err := engine.GetIndexMapping("books")
+	if err != nil {
+		t.Fatalf("Failed to get mapping: %v", err)
+	}
+	multi := indexMapping["fields"].([]map[string]interface{})[0]["multi"]
+	expectedMulti := map[string]interface{}{
+		"raw":     map[string]interface{}{"type": "keyword", "analyzer": "keyword"},
+		"english": map[string]interface{}{"type": "text", "analyzer": "en"},
+	}
+	if !reflect.DeepEqual(multi, expectedMulti) {
+		t.Errorf("Expected multi sub-fields %v in mapping, got %v", expectedMulti, multi)
+	}
+
+	if err := engine.CreateIndex(config.IndexConfig{
+		Name: "bad",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+			{Name: "title", Type: "text", Multi: map[string]config.FieldConfig{"a.b": {Type: "keyword"}}},
+		}}},
+	}); err == nil {
+		t.Error("Expected error for a multi sub-field name containing a dot")
+	}
+}
+
+func TestEngine_CreateIndex_AutocompleteAnalyzer(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{
+				Fields: []config.FieldConfig{
+					{Name: "name", Type: "text", IndexAnalyzer: "autocomplete", SearchAnalyzer: "standard", Multi: map[string]config.FieldConfig{
+						"suggest": {Type: "text", IndexAnalyzer: "autocomplete"},
+					}},
+					{Name: "description", Type: "text"},
+				},
+			},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	docs := map[string]map[string]interface{}{
+		"1": {"name": "Blue Widget", "description": "Blue Widget"},
+		"2": {"name": "Window Cleaner", "description": "Window Cleaner"},
+	}
+	for id, doc := range docs {
+		if err := engine.IndexDocument("products", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	tests := []struct {
+		value, path string
+		expected    int
+	}{
+		// Ngrams are indexed, so prefixes of a word match it
+		{"wid", "name", 1},
+		{"Wi", "name", 2},
+		{"widget", "name", 1},
+		{"blue wid", "name.suggest", 1},
+		// The query isn't split into ngrams, so "widget" doesn't match "window"
+		// through their shared prefix
+		{"widget", "name.suggest", 1},
+		{"wid", "description", 0},
+	}
+	for _, tt := range tests {
+		result, err := engine.Search(SearchRequest{
+			Index: "products",
+			Query: map[string]interface{}{"text": map[string]interface{}{"query": tt.value, "path": tt.path, "operator": "and"}},
+			Size:  10,
+		})
+		if err != nil {
+			t.Fatalf("Search for %q on %s failed: %v", tt.value, tt.path, err)
+		}
+		if result.Total != tt.expected {
+			t.Errorf("Expected %q on %s to match %d documents, got %d", tt.value, tt.path, tt.expected, result.Total)
+		}
+	}
+
+	indexMapping, err := engine.GetIndexMapping("products")
+	if err != nil {
+		t.Fatalf("Failed to get mapping: %v", err)
+	}
+	field := indexMapping["fields"].([]map[string]interface{})[0]
+	if field["analyzer"] != "autocomplete" || field["searchAnalyzer"] != "standard" {
+		t.Errorf("Expected autocomplete index analyzer and standard search analyzer, got %v", field)
+	}
+
+	if err := engine.CreateIndex(config.IndexConfig{
+		Name: "bad",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+			{Name: "name", Type: "text", SearchAnalyzer: "does_not_exist"},
+		}}},
+	}); err == nil {
+		t.Error("Expected error for an unknown search analyzer")
+	}
+}
+
+func TestEngine_CreateIndex_NgramField(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{
+				Fields: []config.FieldConfig{
+					{Name: "name", Type: "ngram", MinGram: 3, MaxGram: 5},
+					{Name: "sku", Type: "keyword", Multi: map[string]config.FieldConfig{
+						"partial": {Type: "ngram"},
+					}},
+					{Name: "description", Type: "text"},
+				},
+			},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	docs := map[string]map[string]interface{}{
+		"1": {"name": "Laptop Stand", "sku": "XK-4471", "description": "Laptop Stand"},
+		"2": {"name": "Desktop Lamp", "sku": "XL-1190", "description": "Desktop Lamp"},
+	}
+	for id, doc := range docs {
+		if err := engine.IndexDocument("products", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	tests := []struct {
+		value, path string
+		expected    int
+	}{
+		// Substrings anywhere in a word match it
+		{"lap", "name", 1},
+		{"ptop", "name", 1},
+		{"top", "name", 2},
+		{"TOP", "name", 2},
+		{"sktop", "name", 1},
+		// Shorter than min_gram or longer than max_gram
+		{"la", "name", 0},
+		{"laptop", "name", 0},
+		// The query isn't split into ngrams, so "lamp" doesn't match "laptop"
+		// through their shared "la"
+		{"lamp", "name", 1},
+		{"4471", "sku.partial", 1},
+		{"4471", "sku", 0},
+		{"lap", "description", 0},
+	}
+	for _, tt := range tests {
+		result, err := engine.Search(SearchRequest{
+			Index: "products",
+			Query: map[string]interface{}{"text": map[string]interface{}{"query": tt.value, "path": tt.path}},
+			Size:  10,
+		})
+		if err != nil {
+			t.Fatalf("Search for %q on %s failed: %v", tt.value, tt.path, err)
+		}
+		if result.Total != tt.expected {
+			t.Errorf("Expected %q on %s to match %d documents, got %d", tt.value, tt.path, tt.expected, result.Total)
+		}
+	}
+
+	indexMapping, err := engine.GetIndexMapping("products")
+	if err != nil {
+		t.Fatalf("Failed to get mapping: %v", err)
+	}
+	field := indexMapping["fields"].([]map[string]interface{})[0]
+	if field["type"] != "ngram" || field["analyzer"] != "ngram_name" || field["searchAnalyzer"] != "standard" {
+		t.Errorf("Expected an ngram field searched with the standard analyzer, got %v", field)
+	}
+	if field["minGram"] != 3 || field["maxGram"] != 5 {
+		t.Errorf("Expected gram sizes 3 to 5, got %v", field)
+	}
+
+	for name, field := range map[string]config.FieldConfig{
+		"min_gram above max_gram": {Name: "name", Type: "ngram", MinGram: 4, MaxGram: 3},
+		"negative min_gram":       {Name: "name", Type: "ngram", MinGram: -1},
+		"analyzer":                {Name: "name", Type: "ngram", Analyzer: "standard"},
+		"gram sizes on text":      {Name: "name", Type: "text", MaxGram: 5},
+	} {
+		bad := config.IndexConfig{
+			Name:       "bad",
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{field}}},
+		}
+		if err := engine.CreateIndex(bad); err == nil {
+			t.Errorf("Expected an ngram field with %s to be rejected", name)
+		}
+	}
+}
+
+func TestEngine_ConvertQuery_CompoundBoost(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := engine.IndexDocument("products", "laptop", map[string]interface{}{"title": "laptop"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+	if err := engine.IndexDocument("products", "phone", map[string]interface{}{"title": "phone"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	textClause := func(value string) map[string]interface{} {
+		return map[string]interface{}{"text": map[string]interface{}{"query": value, "path": "title"}}
+	}
+	boosted := func(clause map[string]interface{}, boost float64) map[string]interface{} {
+		return map[string]interface{}{"compound": map[string]interface{}{
+			"must":  []interface{}{clause},
+			"score": map[string]interface{}{"boost": map[string]interface{}{"value": boost}},
+		}}
+	}
+	// scoreRatio returns the laptop score relative to the phone score, which
+	// both match one equally weighted clause unless boosted
+	scoreRatio := func(laptopClause map[string]interface{}) float64 {
+		result, err := engine.Search(SearchRequest{
+			Index: "products",
+			Query: map[string]interface{}{"compound": map[string]interface{}{
+				"should": []interface{}{laptopClause, textClause("phone")},
+			}},
+			Size: 10,
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		scores := make(map[string]float64)
+		for _, hit := range result.Hits {
+			scores[hit.ID] = hit.Score
+		}
+		if scores["phone"] == 0 {
+			t.Fatalf("Expected phone to match, got hits %v", result.Hits)
+		}
+		return scores["laptop"] / scores["phone"]
+	}
+
+	if ratio := scoreRatio(textClause("laptop")); math.Abs(ratio-1) > 1e-6 {
+		t.Errorf("Expected unboosted clauses to score equally, got ratio %f", ratio)
+	}
+	if ratio := scoreRatio(boosted(textClause("laptop"), 3)); math.Abs(ratio-3) > 1e-6 {
+		t.Errorf("Expected boosted compound to score 3x, got ratio %f", ratio)
+	}
+	if ratio := scoreRatio(boosted(boosted(textClause("laptop"), 2), 3)); math.Abs(ratio-6) > 1e-6 {
+		t.Errorf("Expected nested boosts to multiply to 6x, got ratio %f", ratio)
+	}
+}
+
+func TestEngine_ConvertQuery_NestedMustNot(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	docs := map[string]string{
+		"red":       "red shirt",
+		"blue":      "blue shirt",
+		"green":     "green shirt",
+		"red-blue":  "red and blue shirt",
+		"red-scarf": "red scarf",
+	}
+	for id, title := range docs {
+		if err := engine.IndexDocument("products", id, map[string]interface{}{"title": title}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	textClause := func(query string) interface{} {
+		return map[string]interface{}{"text": map[string]interface{}{"query": query, "path": "title"}}
+	}
+	compound := func(clauses map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"compound": clauses}
+	}
+	search := func(q map[string]interface{}) map[string]float64 {
+		result, err := engine.Search(SearchRequest{Index: "products", Query: q, Size: 10})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		scores := make(map[string]float64)
+		for _, hit := range result.Hits {
+			scores[hit.ID] = hit.Score
+		}
+		return scores
+	}
+	ids := func(scores map[string]float64) string {
+		var ids []string
+		for id := range scores {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+
+	redOrBlue := compound(map[string]interface{}{"should": []interface{}{textClause("red"), textClause("blue")}})
+	tests := []struct {
+		name     string
+		query    map[string]interface{}
+		expected string
+	}{
+		{
+			"must with nested should excluded",
+			compound(map[string]interface{}{
+				"must":    []interface{}{textClause("shirt")},
+				"mustNot": []interface{}{redOrBlue},
+			}),
+			"green",
+		},
+		{
+			"only mustNot with nested should",
+			compound(map[string]interface{}{"mustNot": []interface{}{redOrBlue}}),
+			"green",
+		},
+		{
+			"nested minimumShouldMatch",
+			compound(map[string]interface{}{
+				"must": []interface{}{textClause("shirt")},
+				"mustNot": []interface{}{compound(map[string]interface{}{
+					"should":             []interface{}{textClause("red"), textClause("blue")},
+					"minimumShouldMatch": float64(2),
+				})},
+			}),
+			"blue,green,red",
+		},
+		{
+			"double negation",
+			compound(map[string]interface{}{
+				"must":    []interface{}{textClause("shirt")},
+				"mustNot": []interface{}{compound(map[string]interface{}{"mustNot": []interface{}{textClause("red")}})},
+			}),
+			"red,red-blue",
+		},
+		{
+			"deeply nested",
+			compound(map[string]interface{}{
+				"should": []interface{}{textClause("shirt"), textClause("scarf")},
+				"mustNot": []interface{}{compound(map[string]interface{}{
+					"must": []interface{}{compound(map[string]interface{}{
+						"should": []interface{}{textClause("red")},
+					})},
+					"mustNot": []interface{}{textClause("scarf")},
+				})},
+			}),
+			"blue,green,red-scarf",
+		},
+	}
+	for _, tt := range tests {
+		if got := ids(search(tt.query)); got != tt.expected {
+			t.Errorf("%s: expected hits %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+
+	// A boost on an excluded clause neither readmits documents nor changes the
+	// scores of the remaining ones
+	plain := search(compound(map[string]interface{}{
+		"must":    []interface{}{textClause("shirt")},
+		"mustNot": []interface{}{redOrBlue},
+	}))
+	boostedRedOrBlue := compound(map[string]interface{}{
+		"should": []interface{}{textClause("red"), textClause("blue")},
+		"score":  map[string]interface{}{"boost": map[string]interface{}{"value": float64(5)}},
+	})
+	boosted := search(compound(map[string]interface{}{
+		"must":    []interface{}{textClause("shirt")},
+		"mustNot": []interface{}{boostedRedOrBlue},
+	}))
+	if ids(boosted) != "green" || math.Abs(boosted["green"]-plain["green"]) > 1e-9 {
+		t.Errorf("Expected a boosted mustNot clause to leave green with score %f, got %v", plain["green"], boosted)
+	}
+
+	// mustNot must be an array of clauses
+	_, err = engine.Search(SearchRequest{
+		Index: "products",
+		Query: compound(map[string]interface{}{"mustNot": "red"}),
+		Size:  10,
+	})
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for a mustNot that isn't an array, got %v", err)
+	}
+}
+
+func TestEngine_Search_MinimumShouldMatchInMustNotKeepsLaterSearches(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	// Indexed in order, so "red" is exhausted before the compound skips
+	// documents matching only "blue"
+	docs := []struct{ id, title string }{
+		{"red-blue", "red and blue shirt"},
+		{"red", "red shirt"},
+		{"blue", "blue shirt"},
+		{"green", "green shirt"},
+		{"blue-2", "blue shirt"},
+	}
+	for _, doc := range docs {
+		if err := engine.IndexDocument("products", doc.id, map[string]interface{}{"title": doc.title}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	textClause := func(query string) interface{} {
+		return map[string]interface{}{"text": map[string]interface{}{"query": query, "path": "title"}}
+	}
+	hits := func(q map[string]interface{}) string {
+		t.Helper()
+		result, err := engine.Search(SearchRequest{Index: "products", Query: q, Size: 10})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		var ids []string
+		for _, hit := range result.Hits {
+			ids = append(ids, hit.ID)
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+	excludeBoth := map[string]interface{}{"compound": map[string]interface{}{
+		"must": []interface{}{textClause("shirt")},
+		"mustNot": []interface{}{map[string]interface{}{"compound": map[string]interface{}{
+			"should":             []interface{}{textClause("red"), textClause("blue")},
+			"minimumShouldMatch": float64(2),
+		}}},
+	}}
+
+	// Term readers are reused between searches on an index, so a reader left
+	// in use by the compound would corrupt the searches after it
+	for i := 0; i < 20; i++ {
+		if got := hits(excludeBoth); got != "blue,blue-2,green,red" {
+			t.Fatalf("Run %d: expected the compound to exclude red-blue, got %s", i, got)
+		}
+		if got := hits(map[string]interface{}{"text": map[string]interface{}{"query": "red", "path": "title"}}); got != "red,red-blue" {
+			t.Fatalf("Run %d: expected a later search for red to be unaffected, got %s", i, got)
+		}
+		if got := hits(map[string]interface{}{"text": map[string]interface{}{"query": "blue", "path": "title"}}); got != "blue,blue-2,red-blue" {
+			t.Fatalf("Run %d: expected a later search for blue to be unaffected, got %s", i, got)
+		}
+	}
+}
+
+func TestEngine_ConvertQuery_InvalidBoost(t *testing.T) {
+	engine := &Engine{}
+
+	atlasQuery := map[string]interface{}{
+		"term": map[string]interface{}{
+			"value": "x",
+			"path":  "status",
+			"score": map[string]interface{}{"boost": map[string]interface{}{"value": "high"}},
+		},
+	}
+	if _, err := engine.convertQuery(atlasQuery, queryOptions{}); err == nil {
+		t.Error("Expected error for non-numeric boost value")
+	}
+}
+
+func TestParseMinimumShouldMatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       interface{}
+		shouldCount int
+		expected    int
+		expectErr   bool
+	}{
+		{"integer", float64(2), 4, 2, false},
+		{"zero", float64(0), 4, 0, false},
+		{"percentage exact", "50%", 4, 2, false},
+		{"percentage truncates", "75%", 3, 2, false},
+		{"percentage truncates to zero", "33%", 2, 0, false},
+		{"full percentage", "100%", 3, 3, false},
+		{"percentage with spaces", " 60% ", 5, 3, false},
+		{"fractional percentage", "66.7%", 3, 2, false},
+		{"negative integer", float64(-1), 4, 0, true},
+		{"fractional integer", 1.5, 4, 0, true},
+		{"missing percent sign", "75", 4, 0, true},
+		{"not a number", "abc%", 4, 0, true},
+		{"percentage above 100", "150%", 4, 0, true},
+		{"negative percentage", "-10%", 4, 0, true},
+		{"unsupported type", true, 4, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseMinimumShouldMatch(tt.value, tt.shouldCount)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error for %v, got %d", tt.value, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEngine_Search_MinimumShouldMatch(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	docs := map[string]string{
+		"one":   "red",
+		"two":   "red green",
+		"three": "red green blue",
+	}
+	for id, tags := range docs {
+		if err := engine.IndexDocument("products", id, map[string]interface{}{"tags": tags}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	should := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"value": "red", "path": "tags"}},
+		map[string]interface{}{"term": map[string]interface{}{"value": "green", "path": "tags"}},
+		map[string]interface{}{"term": map[string]interface{}{"value": "blue", "path": "tags"}},
+	}
+
+	tests := []struct {
+		minimumShouldMatch interface{}
+		expectedTotal      int
+	}{
+		{float64(1), 3},
+		{float64(2), 2},
+		{"50%", 3}, // 3 * 0.5 = 1.5 truncates to 1
+		{"67%", 2}, // 3 * 0.67 = 2.01 truncates to 2
+		{"100%", 1},
+	}
+
+	for _, tt := range tests {
+		result, err := engine.Search(SearchRequest{
+			Index: "products",
+			Query: map[string]interface{}{"compound": map[string]interface{}{
+				"should":             should,
+				"minimumShouldMatch": tt.minimumShouldMatch,
+			}},
+			Size: 10,
+		})
+		if err != nil {
+			t.Fatalf("Search with minimumShouldMatch %v failed: %v", tt.minimumShouldMatch, err)
+		}
+		if result.Total != tt.expectedTotal {
+			t.Errorf("Expected %d hits for minimumShouldMatch %v, got %d", tt.expectedTotal, tt.minimumShouldMatch, result.Total)
+		}
+	}
+}
+
+func TestEngine_Search_DateHistogramFacet(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "orders",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	dates := []string{
+		"2024-01-05T10:00:00Z",
+		"2024-01-20T10:00:00Z",
+		"2024-01-31T23:59:59Z",
+		"2024-02-01T00:00:00Z",
+		"2024-04-15T08:30:00Z",
+		"2024-04-16T08:30:00Z",
+	}
+	for i, date := range dates {
+		doc := map[string]interface{}{"status": "paid", "createdAt": date}
+		if err := engine.IndexDocument("orders", fmt.Sprintf("order%d", i), doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	result, err := engine.Search(SearchRequest{
+		Index: "orders",
+		Query: map[string]interface{}{"term": map[string]interface{}{"value": "paid", "path": "status"}},
+		Facets: map[string]FacetRequest{
+			"per_month": {Type: "date_histogram", Field: "createdAt", Interval: "month"},
+		},
+		Size: 10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	facet, ok := result.Facets["per_month"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected per_month facet, got %v", result.Facets)
+	}
+	buckets := facet["buckets"].([]map[string]interface{})
+
+	// March has no documents, so Bleve omits its bucket
+	expected := []struct {
+		key   string
+		count int
+	}{
+		{"2024-01-01T00:00:00Z", 3},
+		{"2024-02-01T00:00:00Z", 1},
+		{"2024-04-01T00:00:00Z", 2},
+	}
+	if len(buckets) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %d: %v", len(expected), len(buckets), buckets)
+	}
+	for i, want := range expected {
+		if buckets[i]["key"] != want.key || buckets[i]["count"] != want.count {
+			t.Errorf("Expected bucket %d to be %s=%d, got %v=%v", i, want.key, want.count, buckets[i]["key"], buckets[i]["count"])
+		}
+	}
+}
+
+func TestEngine_Search_DateHistogramFacet_InvalidInterval(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "orders",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	_, err = engine.Search(SearchRequest{
+		Index: "orders",
+		Query: map[string]interface{}{},
+		Facets: map[string]FacetRequest{
+			"per_week": {Type: "date_histogram", Field: "createdAt", Interval: "week"},
+		},
+		Size: 10,
+	})
+	if err == nil {
+		t.Error("Expected error for unsupported date_histogram interval")
+	}
+}
+
+func TestEngine_DescribeQuery(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	t.Run("text", func(t *testing.T) {
+		desc, err := engine.DescribeQuery("products", map[string]interface{}{
+			"text": map[string]interface{}{"query": "The Quick Fox", "path": "title"},
+		})
+		if err != nil {
+			t.Fatalf("DescribeQuery failed: %v", err)
+		}
+		if desc.Type != "match" || desc.Field != "title" || desc.Analyzer != "standard" {
+			t.Errorf("Expected match on title with standard analyzer, got %+v", desc)
+		}
+		// The standard analyzer lowercases and drops English stop words
+		if len(desc.Terms) != 2 || desc.Terms[0] != "quick" || desc.Terms[1] != "fox" {
+			t.Errorf("Expected analyzed terms [quick fox], got %v", desc.Terms)
+		}
+	})
+
+	t.Run("term", func(t *testing.T) {
+		desc, err := engine.DescribeQuery("products", map[string]interface{}{
+			"term": map[string]interface{}{"value": "Electronics", "path": "category"},
+		})
+		if err != nil {
+			t.Fatalf("DescribeQuery failed: %v", err)
+		}
+		if desc.Type != "term" || desc.Field != "category" {
+			t.Errorf("Expected term on category, got %+v", desc)
+		}
+		if len(desc.Terms) != 1 || desc.Terms[0] != "Electronics" {
+			t.Errorf("Expected term to be kept verbatim, got %v", desc.Terms)
+		}
+	})
+
+	t.Run("compound", func(t *testing.T) {
+		desc, err := engine.DescribeQuery("products", map[string]interface{}{
+			"compound": map[string]interface{}{
+				"must": []interface{}{
+					map[string]interface{}{"text": map[string]interface{}{"query": "laptop", "path": "title"}},
+				},
+				"should": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"value": "sale", "path": "tags"}},
+					map[string]interface{}{"term": map[string]interface{}{"value": "new", "path": "tags"}},
+				},
+				"mustNot": []interface{}{
+					map[string]interface{}{"wildcard": map[string]interface{}{"value": "refurb*", "path": "title"}},
+				},
+				"minimumShouldMatch": float64(1),
+			},
+		})
+		if err != nil {
+			t.Fatalf("DescribeQuery failed: %v", err)
+		}
+		if desc.Type != "boolean" {
+			t.Fatalf("Expected boolean query, got %s", desc.Type)
+		}
+		if len(desc.Must) != 1 || desc.Must[0].Type != "match" || desc.Must[0].Terms[0] != "laptop" {
+			t.Errorf("Expected must clause matching laptop, got %+v", desc.Must)
+		}
+		if len(desc.Should) != 2 || desc.Should[0].Type != "term" || desc.Should[1].Terms[0] != "new" {
+			t.Errorf("Expected two term should clauses, got %+v", desc.Should)
+		}
+		if desc.MinShould != 1 {
+			t.Errorf("Expected minShould 1, got %v", desc.MinShould)
+		}
+		if len(desc.MustNot) != 1 || desc.MustNot[0].Type != "wildcard" || desc.MustNot[0].Field != "title" {
+			t.Errorf("Expected wildcard mustNot clause on title, got %+v", desc.MustNot)
+		}
+	})
+
+	t.Run("unknown index", func(t *testing.T) {
+		if _, err := engine.DescribeQuery("missing", map[string]interface{}{}); err == nil {
+			t.Error("Expected error for unknown index")
+		}
+	})
+}
+
+func TestEngine_Search_MatchNone(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for id, tags := range map[string]string{"one": "red", "two": "green", "three": "blue"} {
+		if err := engine.IndexDocument("products", id, map[string]interface{}{"tags": tags}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	matchNone := map[string]interface{}{"match_none": map[string]interface{}{}}
+	red := map[string]interface{}{"term": map[string]interface{}{"value": "red", "path": "tags"}}
+	green := map[string]interface{}{"term": map[string]interface{}{"value": "green", "path": "tags"}}
+
+	tests := []struct {
+		name          string
+		query         map[string]interface{}
+		expectedTotal int
+	}{
+		{"match_none alone", matchNone, 0},
+		{"should of only match_none", map[string]interface{}{"compound": map[string]interface{}{
+			"should": []interface{}{matchNone},
+		}}, 0},
+		{"should with match_none contributes nothing", map[string]interface{}{"compound": map[string]interface{}{
+			"should": []interface{}{matchNone, red, green},
+		}}, 2},
+		{"must with match_none matches nothing", map[string]interface{}{"compound": map[string]interface{}{
+			"must": []interface{}{red, matchNone},
+		}}, 0},
+		{"mustNot match_none excludes nothing", map[string]interface{}{"compound": map[string]interface{}{
+			"must":    []interface{}{red},
+			"mustNot": []interface{}{matchNone},
+		}}, 1},
+	}
+
+	for _, tt := range tests {
+		result, err := engine.Search(SearchRequest{Index: "products", Query: tt.query, Size: 10})
+		if err != nil {
+			t.Fatalf("%s: search failed: %v", tt.name, err)
+		}
+		if result.Total != tt.expectedTotal {
+			t.Errorf("%s: expected %d hits, got %d", tt.name, tt.expectedTotal, result.Total)
+		}
+	}
+}
+
+func TestEngine_Search_FacetFilters(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "shirts",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	docs := []map[string]interface{}{
+		{"color": "red", "size": "s"},
+		{"color": "red", "size": "m"},
+		{"color": "red", "size": "m"},
+		{"color": "blue", "size": "m"},
+		{"color": "blue", "size": "l"},
+		{"color": "green", "size": "l"},
+	}
+	for i, doc := range docs {
+		if err := engine.IndexDocument("shirts", fmt.Sprintf("shirt%d", i), doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	result, err := engine.Search(SearchRequest{
+		Index: "shirts",
+		Query: map[string]interface{}{},
+		Facets: map[string]FacetRequest{
+			"color": {Type: "terms", Field: "color", Size: 10},
+			"size":  {Type: "terms", Field: "size", Size: 10},
+		},
+		FacetFilters: map[string]map[string]interface{}{
+			"color": {"term": map[string]interface{}{"value": "red", "path": "color"}},
+		},
+		Size: 10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	if result.Total != 3 {
+		t.Errorf("Expected the color filter to narrow hits to 3, got %d", result.Total)
+	}
+
+	counts := func(name string) map[string]int {
+		facet, ok := result.Facets[name].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected facet %s, got %v", name, result.Facets)
+		}
+		byKey := make(map[string]int)
+		for _, bucket := range facet["buckets"].([]map[string]interface{}) {
+			byKey[bucket["key"].(string)] = bucket["count"].(int)
+		}
+		return byKey
+	}
+
+	// The color facet ignores its own filter, so every color keeps its count
+	colorCounts := counts("color")
+	for color, expected := range map[string]int{"red": 3, "blue": 2, "green": 1} {
+		if colorCounts[color] != expected {
+			t.Errorf("Expected color %s count %d over the unfiltered set, got %d", color, expected, colorCounts[color])
+		}
+	}
+
+	// The size facet is counted over the red shirts only
+	sizeCounts := counts("size")
+	expectedSizes := map[string]int{"s": 1, "m": 2}
+	if len(sizeCounts) != len(expectedSizes) {
+		t.Errorf("Expected size counts %v, got %v", expectedSizes, sizeCounts)
+	}
+	for size, expected := range expectedSizes {
+		if sizeCounts[size] != expected {
+			t.Errorf("Expected size %s count %d over the filtered set, got %d", size, expected, sizeCounts[size])
+		}
+	}
+}
+
+func TestEngine_Search_NumericRangeFacetDrillDown(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	prices := []float64{5, 20, 49.99, 50, 75, 120, 300}
+	for i, price := range prices {
+		doc := map[string]interface{}{"price": price, "brand": "acme"}
+		if err := engine.IndexDocument("products", fmt.Sprintf("p%d", i), doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	fifty, hundred := 50.0, 100.0
+	priceFacet := FacetRequest{
+		Type:  "numeric",
+		Field: "price",
+		Ranges: []NumericRange{
+			{Name: "under_50", Max: &fifty},
+			{Name: "50_to_100", Min: &fifty, Max: &hundred},
+			{Name: "over_100", Min: &hundred},
+		},
+	}
+
+	result, err := engine.Search(SearchRequest{
+		Index:  "products",
+		Query:  map[string]interface{}{},
+		Facets: map[string]FacetRequest{"price": priceFacet},
+		Size:   10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	buckets := result.Facets["price"].(map[string]interface{})["buckets"].([]map[string]interface{})
+	var keys []string
+	counts := make(map[string]int)
+	for _, bucket := range buckets {
+		keys = append(keys, bucket["key"].(string))
+		counts[bucket["key"].(string)] = bucket["count"].(int)
+	}
+	if !reflect.DeepEqual(keys, []string{"under_50", "50_to_100", "over_100"}) {
+		t.Errorf("Expected buckets ordered by lower bound, got %v", keys)
+	}
+	for key, expected := range map[string]int{"under_50": 3, "50_to_100": 2, "over_100": 2} {
+		if counts[key] != expected {
+			t.Errorf("Expected bucket %s count %d, got %d", key, expected, counts[key])
+		}
+	}
+
+	// Select the 50_to_100 bucket from the response and search again
+	selected := buckets[1]["key"].(string)
+	result, err = engine.Search(SearchRequest{
+		Index:        "products",
+		Query:        map[string]interface{}{},
+		Facets:       map[string]FacetRequest{"price": priceFacet},
+		FacetFilters: map[string]map[string]interface{}{"price": {"bucket": selected}},
+		Size:         10,
+	})
+	if err != nil {
+		t.Fatalf("Drill-down search failed: %v", err)
+	}
+
+	if result.Total != 2 {
+		t.Errorf("Expected the bucket filter to narrow hits to 2, got %d", result.Total)
+	}
+	for _, hit := range result.Hits {
+		price, _ := hit.Source["price"].(float64)
+		if price < fifty || price >= hundred {
+			t.Errorf("Expected hit %s priced within [50, 100), got %v", hit.ID, hit.Source["price"])
+		}
+	}
+
+	// The price facet ignores its own filter, so every bucket keeps its count
+	buckets = result.Facets["price"].(map[string]interface{})["buckets"].([]map[string]interface{})
+	if len(buckets) != 3 || buckets[0]["count"].(int) != 3 {
+		t.Errorf("Expected unfiltered price buckets, got %v", buckets)
+	}
+
+	for name, filter := range map[string]map[string]interface{}{
+		"unknown bucket": {"bucket": "under_10"},
+		"malformed":      {"bucket": 50},
+	} {
+		_, err := engine.Search(SearchRequest{
+			Index:        "products",
+			Query:        map[string]interface{}{},
+			Facets:       map[string]FacetRequest{"price": priceFacet},
+			FacetFilters: map[string]map[string]interface{}{"price": filter},
+		})
+		if err == nil {
+			t.Errorf("Expected %s bucket filter to fail", name)
+		}
+	}
+
+	_, err = engine.Search(SearchRequest{
+		Index:  "products",
+		Query:  map[string]interface{}{},
+		Facets: map[string]FacetRequest{"price": {Type: "terms", Field: "price", Ranges: priceFacet.Ranges}},
+	})
+	if err == nil {
+		t.Error("Expected ranges on a terms facet to fail")
+	}
+}
+
+func TestEngine_Search_NumericRangeFacetSharded(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:         "products",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		Distribution: config.IndexDistribution{Shards: 3},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	docs := make([]DocumentBatch, 30)
+	for i := range docs {
+		docs[i] = DocumentBatch{ID: fmt.Sprintf("p%d", i), Doc: map[string]interface{}{"price": float64(i * 5)}}
+	}
+	if err := engine.IndexDocuments("products", docs); err != nil {
+		t.Fatalf("Failed to index documents: %v", err)
+	}
+
+	fifty, hundred := 50.0, 100.0
+	result, err := engine.SearchSharded(SearchRequest{
+		Index: "products",
+		Query: map[string]interface{}{},
+		Facets: map[string]FacetRequest{"price": {
+			Type:  "numeric",
+			Field: "price",
+			Ranges: []NumericRange{
+				{Name: "over_100", Min: &hundred},
+				{Name: "50_to_100", Min: &fifty, Max: &hundred},
+				{Name: "under_50", Max: &fifty},
+			},
+		}},
+		Size: 10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	buckets := result.Facets["price"].(map[string]interface{})["buckets"].([]map[string]interface{})
+	expected := []map[string]interface{}{
+		{"key": "under_50", "count": 10, "max": 50.0},
+		{"key": "50_to_100", "count": 10, "min": 50.0, "max": 100.0},
+		{"key": "over_100", "count": 10, "min": 100.0},
+	}
+	if !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("Expected merged range buckets %v, got %v", expected, buckets)
+	}
+}
+
+func TestEngine_Search_Fields(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			Mappings: config.IndexMappings{Dynamic: true},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	doc := map[string]interface{}{"name": "laptop", "description": "a very long description", "price": 999.0}
+	if err := engine.IndexDocument("products", "p1", doc); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	result, err := engine.Search(SearchRequest{
+		Index:  "products",
+		Query:  map[string]interface{}{},
+		Fields: []string{"name", "price"},
+		Size:   10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(result.Hits) != 1 {
+		t.Fatalf("Expected 1 hit, got %d", len(result.Hits))
+	}
+	source := result.Hits[0].Source
+	if len(source) != 2 || source["name"] != "laptop" || source["price"] != 999.0 {
+		t.Errorf("Expected only name and price in source, got %v", source)
+	}
+
+	result, err = engine.Search(SearchRequest{Index: "products", Query: map[string]interface{}{}, Size: 10})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(result.Hits[0].Source) != 3 {
+		t.Errorf("Expected all fields in source when none are requested, got %v", result.Hits[0].Source)
+	}
+}
+
+func TestEngine_GetIndexMapping(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{
+			DefaultAnalyzer: "simple",
+			Mappings: config.IndexMappings{
+				Dynamic: true,
+				Fields: []config.FieldConfig{
+					{Name: "title", Type: "text", Analyzer: "standard"},
+					{Name: "body", Type: "text", Language: "en"},
+					{Name: "summary", Type: "text"},
+					{Name: "category", Type: "keyword", Facet: true},
+					{Name: "price", Field: "pricing.amount", Type: "numeric"},
+				},
+			},
+		},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	result, err := engine.GetIndexMapping("products")
+	if err != nil {
+		t.Fatalf("GetIndexMapping failed: %v", err)
+	}
+
+	if result["name"] != "products" || result["dynamic"] != true || result["defaultAnalyzer"] != "simple" {
+		t.Errorf("Unexpected mapping header: %v", result)
+	}
+
+	fields := result["fields"].([]map[string]interface{})
+	if len(fields) != len(indexCfg.Definition.Mappings.Fields) {
+		t.Fatalf("Expected %d fields, got %d", len(indexCfg.Definition.Mappings.Fields), len(fields))
+	}
+
+	expected := []map[string]interface{}{
+		{"name": "title", "type": "text", "analyzer": "standard", "facet": false},
+		{"name": "body", "type": "text", "analyzer": "en", "language": "en", "facet": false},
+		{"name": "summary", "type": "text", "analyzer": "simple", "facet": false},
+		{"name": "category", "type": "keyword", "analyzer": "keyword", "facet": true},
+		{"name": "price", "field": "pricing.amount", "type": "numeric", "facet": false},
+	}
+	for i, want := range expected {
+		if len(fields[i]) != len(want) {
+			t.Errorf("Expected field %d to be %v, got %v", i, want, fields[i])
+			continue
+		}
+		for key, value := range want {
+			if fields[i][key] != value {
+				t.Errorf("Expected field %s %s to be %v, got %v", want["name"], key, value, fields[i][key])
+			}
+		}
+	}
+
+	if _, err := engine.GetIndexMapping("missing"); err == nil {
+		t.Error("Expected error for unknown index")
+	}
+}
+
+func TestEngine_GetIndexMapping_Sharded(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:         "products",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: false}},
+		Distribution: config.IndexDistribution{Shards: 2},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	result, err := engine.GetIndexMapping("products")
+	if err != nil {
+		t.Fatalf("Expected mapping of sharded index to be available, got %v", err)
+	}
+	if result["dynamic"] != false || result["defaultAnalyzer"] != "standard" {
+		t.Errorf("Unexpected mapping for sharded index: %v", result)
+	}
+}
+
+func TestEngine_DidYouMean(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "articles",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	docs := map[string]map[string]interface{}{
+		"1": {"title": "The quick brown fox", "views": 120},
+		"2": {"title": "Search engine basics", "views": 45},
+		"3": {"title": "Searching with Bleve", "views": 7},
+	}
+	for id, doc := range docs {
+		if err := engine.IndexDocument("articles", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"serch", "search"},
+		{"quick brwn fox", "quick brown fox"},
+		{"engine", ""},
+		{"xyzzy", ""},
+	}
+	for _, tt := range tests {
+		suggestion, err := engine.DidYouMean("articles", tt.query)
+		if err != nil {
+			t.Fatalf("DidYouMean(%q) failed: %v", tt.query, err)
+		}
+		if suggestion != tt.expected {
+			t.Errorf("DidYouMean(%q) = %q, expected %q", tt.query, suggestion, tt.expected)
+		}
+	}
+
+	if _, err := engine.DidYouMean("missing", "serch"); err == nil {
+		t.Error("Expected error for unknown index")
+	}
+}
+
+func TestEngine_DidYouMean_TextFieldsAndCache(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "articles",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+			{Name: "title", Type: "text"},
+			{Name: "sku", Type: "keyword"},
+		}}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := engine.IndexDocument("articles", "1", map[string]interface{}{"title": "Search basics", "sku": "serch"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	// Keyword values neither count as known terms nor as corrections
+	suggestion, err := engine.DidYouMean("articles", "serch")
+	if err != nil {
+		t.Fatalf("DidYouMean failed: %v", err)
+	}
+	if suggestion != "search" {
+		t.Errorf("Expected suggestion %q from the text field, got %q", "search", suggestion)
+	}
+
+	// Writes drop the cached suggestion
+	if err := engine.IndexDocument("articles", "2", map[string]interface{}{"title": "serch"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+	suggestion, err = engine.DidYouMean("articles", "serch")
+	if err != nil {
+		t.Fatalf("DidYouMean failed: %v", err)
+	}
+	if suggestion != "" {
+		t.Errorf("Expected no suggestion once the term is indexed, got %q", suggestion)
+	}
+}
+
+func TestEngine_Search_Suggestion(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir(), SuggestThreshold: 1})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "articles",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := engine.IndexDocument("articles", "1", map[string]interface{}{"title": "Search engine basics"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	result, err := engine.Search(SearchRequest{
+		Index: "articles",
+		Query: map[string]interface{}{"text": map[string]interface{}{"query": "serch engine", "path": "title"}},
+		Size:  10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 1 {
+		t.Fatalf("Expected the correctly spelled term to match, got %d hits", result.Total)
+	}
+	if result.Suggestion != "" {
+		t.Errorf("Expected no suggestion when hits reach the threshold, got %q", result.Suggestion)
+	}
+
+	result, err = engine.Search(SearchRequest{
+		Index: "articles",
+		Query: map[string]interface{}{"text": map[string]interface{}{"query": "serch", "path": "title"}},
+		Size:  10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 0 {
+		t.Fatalf("Expected no hits for misspelled query, got %d", result.Total)
+	}
+	if result.Suggestion != "search" {
+		t.Errorf("Expected suggestion %q, got %q", "search", result.Suggestion)
+	}
+}
+
+func TestEngine_IndexTypes(t *testing.T) {
+	tests := []struct {
+		indexType    string
+		expectedMeta string
+	}{
+		{"", "scorch"},
+		{IndexTypeScorch, "scorch"},
+		{IndexTypeUpsidedown, "upside_down"},
+	}
+
+	for _, tt := range tests {
+		t.Run("type_"+tt.indexType, func(t *testing.T) {
+			indexPath := t.TempDir()
+			engine, err := NewEngine(config.SearchConfig{IndexPath: indexPath, IndexType: tt.indexType})
+			if err != nil {
+				t.Fatalf("Failed to create engine: %v", err)
+			}
+			defer engine.Close()
+
+			indexCfg := config.IndexConfig{
+				Name:       "products",
+				Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+			}
+			if err := engine.CreateIndex(indexCfg); err != nil {
+				t.Fatalf("Failed to create index: %v", err)
+			}
+			if err := engine.IndexDocument("products", "1", map[string]interface{}{"name": "laptop"}); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+
+			result, err := engine.Search(SearchRequest{
+				Index: "products",
+				Query: map[string]interface{}{"text": map[string]interface{}{"query": "laptop", "path": "name"}},
+				Size:  10,
+			})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if result.Total != 1 {
+				t.Errorf("Expected 1 hit, got %d", result.Total)
+			}
+
+			data, err := os.ReadFile(filepath.Join(indexPath, "products", "index_meta.json"))
+			if err != nil {
+				t.Fatalf("Failed to read index metadata: %v", err)
+			}
+			var meta struct {
+				IndexType string `json:"index_type"`
+			}
+			if err := json.Unmarshal(data, &meta); err != nil {
+				t.Fatalf("Failed to parse index metadata: %v", err)
+			}
+			if meta.IndexType != tt.expectedMeta {
+				t.Errorf("Expected index type %q, got %q", tt.expectedMeta, meta.IndexType)
+			}
+		})
+	}
+}
+
+func TestNewEngine_IndexDirMode(t *testing.T) {
+	// 0770 would be reduced to 0750 by the common umask of 022
+	indexPath := filepath.Join(t.TempDir(), "indexes")
+	engine, err := NewEngine(config.SearchConfig{IndexPath: indexPath, IndexDirMode: "0770"})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, indexCfg := range []config.IndexConfig{
+		{Name: "products"},
+		{Name: "orders", Distribution: config.IndexDistribution{Shards: 2}},
+	} {
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+
+	for _, dir := range []string{indexPath, filepath.Join(indexPath, "products"), filepath.Join(indexPath, "orders_shard_0"), filepath.Join(indexPath, "orders_shard_1")} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", dir, err)
+		}
+		if mode := info.Mode().Perm(); mode != 0770 {
+			t.Errorf("Expected %s to have mode 0770, got %#o", dir, mode)
+		}
+	}
+}
+
+func TestNewEngine_InvalidIndexDirMode(t *testing.T) {
+	for _, mode := range []string{"rwx", "0999", "01777", "0600", "-700"} {
+		_, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir(), IndexDirMode: mode})
+		if err == nil || !strings.Contains(err.Error(), "invalid index_dir_mode") {
+			t.Errorf("Expected index_dir_mode %q to be rejected, got %v", mode, err)
+		}
+	}
+}
+
+func TestNewEngine_UnknownIndexType(t *testing.T) {
+	_, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir(), IndexType: "rocksdb"})
+	if err == nil {
+		t.Fatal("Expected error for unknown index type")
+	}
+	if !strings.Contains(err.Error(), "unsupported index_type") {
+		t.Errorf("Expected unsupported index_type error, got %v", err)
+	}
+}
+
+func TestEngine_OptimizeIndex(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	for i := 0; i < 200; i++ {
+		id := fmt.Sprintf("%d", i)
+		if err := engine.IndexDocument("products", id, map[string]interface{}{"name": "product " + id, "description": strings.Repeat("filler text ", 20)}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+	for i := 0; i < 150; i++ {
+		if err := engine.DeleteDocument("products", fmt.Sprintf("%d", i)); err != nil {
+			t.Fatalf("Failed to delete document: %v", err)
+		}
+	}
+
+	result, err := engine.OptimizeIndex("products")
+	if err != nil {
+		t.Fatalf("OptimizeIndex failed: %v", err)
+	}
+	if !result.Optimized {
+		t.Error("Expected scorch index to be optimized")
+	}
+	if result.SizeBeforeBytes <= 0 || result.SizeAfterBytes <= 0 {
+		t.Errorf("Expected positive sizes, got before %d after %d", result.SizeBeforeBytes, result.SizeAfterBytes)
+	}
+
+	index, _ := engine.GetIndex("products")
+	docCount, err := index.DocCount()
+	if err != nil {
+		t.Fatalf("Failed to get document count: %v", err)
+	}
+	if docCount != 50 {
+		t.Errorf("Expected 50 documents after optimize, got %d", docCount)
+	}
+
+	searchResult, err := engine.Search(SearchRequest{
+		Index: "products",
+		Query: map[string]interface{}{"text": map[string]interface{}{"query": "199", "path": "name"}},
+		Size:  10,
+	})
+	if err != nil {
+		t.Fatalf("Search after optimize failed: %v", err)
+	}
+	if searchResult.Total != 1 {
+		t.Errorf("Expected remaining document to be searchable, got %d hits", searchResult.Total)
+	}
+
+	if _, err := engine.OptimizeIndex("missing"); err == nil {
+		t.Error("Expected error for unknown index")
+	}
+
+	// A second optimize of an index is rejected while the first runs
+	engine.claimOptimize([]string{"products"})
+	if _, err := engine.OptimizeIndex("products"); !errors.Is(err, ErrOptimizeInProgress) {
+		t.Errorf("Expected ErrOptimizeInProgress while the index is being optimized, got %v", err)
+	}
+	engine.releaseOptimize([]string{"products"})
+	if _, err := engine.OptimizeIndex("products"); err != nil {
+		t.Errorf("Expected optimize to succeed once the first finished, got %v", err)
+	}
+}
+
+func TestEngine_OptimizeIndex_Upsidedown(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir(), IndexType: IndexTypeUpsidedown})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	result, err := engine.OptimizeIndex("products")
+	if err != nil {
+		t.Fatalf("OptimizeIndex failed: %v", err)
+	}
+	if result.Optimized {
+		t.Error("Expected upsidedown index to be reported as not optimized")
+	}
+}
+
+func TestEngine_Search_Profile(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, indexCfg := range []config.IndexConfig{
+		{Name: "products", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}},
+		{Name: "sharded", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}, Distribution: config.IndexDistribution{Shards: 2}},
+	} {
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		doc := map[string]interface{}{"name": fmt.Sprintf("laptop %d", i)}
+		for _, index := range []string{"products", fmt.Sprintf("sharded_shard_%d", i%2)} {
+			if err := engine.IndexDocument(index, fmt.Sprintf("%d", i), doc); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+	}
+
+	query := map[string]interface{}{"text": map[string]interface{}{"query": "laptop", "path": "name"}}
+
+	result, err := engine.Search(SearchRequest{Index: "products", Query: query, Size: 10})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Profile != nil {
+		t.Errorf("Expected no profile unless requested, got %+v", result.Profile)
+	}
+
+	for _, index := range []string{"products", "sharded"} {
+		result, err := engine.SearchSharded(SearchRequest{Index: index, Query: query, Size: 10, Profile: true})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		profile := result.Profile
+		if profile == nil {
+			t.Fatalf("Expected profile for index %s", index)
+		}
+		if profile.TotalMs <= 0 || profile.SearchMs <= 0 {
+			t.Errorf("Expected positive search and total times for %s, got %+v", index, profile)
+		}
+		if profile.QueryConversionMs < 0 || profile.ResultConversionMs < 0 {
+			t.Errorf("Expected non-negative phase times for %s, got %+v", index, profile)
+		}
+		sum := profile.QueryConversionMs + profile.SearchMs + profile.ResultConversionMs
+		if math.Abs(sum-profile.TotalMs) > profile.TotalMs*0.1 {
+			t.Errorf("Expected phases of %s to sum to roughly the total %.3fms, got %.3fms", index, profile.TotalMs, sum)
+		}
+	}
+}
+
+func TestEngine_Search_TextOperator(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, indexCfg := range []config.IndexConfig{
+		{Name: "products", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}},
+		{Name: "strict", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}, DefaultOperator: "and"}},
+	} {
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		docs := map[string]string{"1": "red shoes", "2": "red hat", "3": "blue shoes"}
+		for id, name := range docs {
+			if err := engine.IndexDocument(indexCfg.Name, id, map[string]interface{}{"name": name}); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		index    string
+		text     map[string]interface{}
+		expected int
+	}{
+		{"default or", "products", map[string]interface{}{"query": "red shoes", "path": "name"}, 3},
+		{"explicit or", "products", map[string]interface{}{"query": "red shoes", "path": "name", "operator": "or"}, 3},
+		{"explicit and", "products", map[string]interface{}{"query": "red shoes", "path": "name", "operator": "and"}, 1},
+		{"and without path", "products", map[string]interface{}{"query": "red shoes", "operator": "AND"}, 1},
+		{"index default and", "strict", map[string]interface{}{"query": "red shoes", "path": "name"}, 1},
+		{"or overrides index default", "strict", map[string]interface{}{"query": "red shoes", "path": "name", "operator": "or"}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := engine.Search(SearchRequest{
+				Index: tt.index,
+				Query: map[string]interface{}{"text": tt.text},
+				Size:  10,
+			})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if result.Total != tt.expected {
+				t.Errorf("Expected %d hits, got %d", tt.expected, result.Total)
+			}
+		})
+	}
+
+	_, err = engine.Search(SearchRequest{
+		Index: "products",
+		Query: map[string]interface{}{"text": map[string]interface{}{"query": "red", "path": "name", "operator": "xor"}},
+		Size:  10,
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid query") {
+		t.Errorf("Expected invalid query error for unknown operator, got %v", err)
+	}
+
+	err = engine.CreateIndex(config.IndexConfig{
+		Name:       "broken",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}, DefaultOperator: "xor"},
+	})
+	if err == nil {
+		t.Error("Expected error for unknown default_operator")
+	}
+}
+
+func TestEngine_GetStoredField(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	updatedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	doc := map[string]interface{}{"name": "laptop", "version": 3, "updatedAt": updatedAt.Format(time.RFC3339)}
+	if err := engine.IndexDocument("products", "1", doc); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	tests := []struct {
+		field    string
+		expected interface{}
+		found    bool
+	}{
+		{"name", "laptop", true},
+		{"version", float64(3), true},
+		{"updatedAt", updatedAt, true},
+		{"missing", nil, false},
+	}
+	for _, tt := range tests {
+		value, found, err := engine.GetStoredField("products", "1", tt.field)
+		if err != nil {
+			t.Fatalf("GetStoredField(%s) failed: %v", tt.field, err)
+		}
+		if found != tt.found {
+			t.Errorf("Expected %s found=%v, got %v", tt.field, tt.found, found)
+		}
+		if expectedTime, ok := tt.expected.(time.Time); ok {
+			if actual, ok := value.(time.Time); !ok || !actual.Equal(expectedTime) {
+				t.Errorf("Expected %s to be %v, got %v", tt.field, expectedTime, value)
+			}
+		} else if value != tt.expected {
+			t.Errorf("Expected %s to be %v, got %v", tt.field, tt.expected, value)
+		}
+	}
+
+	if _, found, err := engine.GetStoredField("products", "missing", "name"); err != nil || found {
+		t.Errorf("Expected missing document to report not found, got found=%v err=%v", found, err)
+	}
+}
+
+func TestEngine_GetStoredField_Sharded(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:         "products",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		Distribution: config.IndexDistribution{Shards: 3},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	// Documents land on different shards and are each read from their own
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("doc%d", i)
+		if err := engine.IndexDocument("products", id, map[string]interface{}{"version": i}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("doc%d", i)
+		value, found, err := engine.GetStoredField("products", id, "version")
+		if err != nil || !found || value != float64(i) {
+			t.Errorf("Expected %s to have version %d, got %v (found %t, err %v)", id, i, value, found, err)
+		}
+	}
+}
+
+func TestEngine_IndexDocuments_Sharded(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:         "products",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		Distribution: config.IndexDistribution{Shards: 3},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	docs := make([]DocumentBatch, 20)
+	for i := range docs {
+		docs[i] = DocumentBatch{ID: fmt.Sprintf("doc%d", i), Doc: map[string]interface{}{"version": i}}
+	}
+	if err := engine.IndexDocuments("products", docs); err != nil {
+		t.Fatalf("Failed to bulk index a sharded index: %v", err)
+	}
+
+	// Each document is on the shard single-document writes route it to
+	for i, doc := range docs {
+		value, found, err := engine.GetStoredField("products", doc.ID, "version")
+		if err != nil || !found || value != float64(i) {
+			t.Errorf("Expected %s to have version %d, got %v (found %t, err %v)", doc.ID, i, value, found, err)
+		}
+	}
+	if err := engine.IndexDocuments("missing", docs); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound for a missing index, got %v", err)
+	}
+}
+
+func TestEngine_CountLiveDocuments(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:         "sessions",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		Distribution: config.IndexDistribution{Shards: 3},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		expiresAt := now.Add(time.Hour)
+		if i < 2 {
+			expiresAt = now.Add(-time.Hour)
+		}
+		if err := engine.IndexDocument("sessions", fmt.Sprintf("s%d", i), map[string]interface{}{"expires_at": expiresAt}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	// A stale copy on a shard the document isn't routed to isn't counted
+	owner := engine.getShardForDocument("sessions", "s5")
+	for _, shard := range engine.getShardsForIndex("sessions") {
+		if shard != owner {
+			index, _ := engine.GetIndex(shard)
+			if err := index.Index("s5", map[string]interface{}{"expires_at": now.Add(time.Hour)}); err != nil {
+				t.Fatalf("Failed to index the stale copy: %v", err)
+			}
+			break
+		}
+	}
+
+	if count, err := engine.CountLiveDocuments("sessions", "", time.Time{}); err != nil || count != 10 {
+		t.Errorf("Expected 10 documents without the stale copy, got %d (%v)", count, err)
+	}
+	if count, err := engine.CountLiveDocuments("sessions", "expires_at", now); err != nil || count != 8 {
+		t.Errorf("Expected 8 unexpired documents, got %d (%v)", count, err)
+	}
+	if _, err := engine.CountLiveDocuments("missing", "", time.Time{}); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound for a missing index, got %v", err)
+	}
+}
+
+func TestEngine_CreateIndex_ManyShards(t *testing.T) {
+	indexPath := t.TempDir()
+	indexCfg := config.IndexConfig{
+		Name:         "products",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		Distribution: config.IndexDistribution{Shards: 16},
+	}
+
+	engine, err := NewEngine(config.SearchConfig{IndexPath: indexPath, ShardWorkers: 4})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	for shard := 0; shard < 16; shard++ {
+		shardName := fmt.Sprintf("products_shard_%d", shard)
+		if _, exists := engine.GetIndex(shardName); !exists {
+			t.Errorf("Expected shard %s to be registered", shardName)
+		}
+	}
+	for i := 0; i < 32; i++ {
+		if err := engine.IndexDocument("products", fmt.Sprintf("%d", i), map[string]interface{}{"name": "laptop"}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+	if shards := engine.getShardsForIndex("products"); len(shards) != 16 {
+		t.Errorf("Expected 16 shards, got %d", len(shards))
+	}
+	engine.Close()
+
+	// Reopening uses the same pool to open the existing shards
+	engine, err = NewEngine(config.SearchConfig{IndexPath: indexPath})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to reopen index: %v", err)
+	}
+
+	result, err := engine.SearchSharded(SearchRequest{
+		Index: "products",
+		Query: map[string]interface{}{"text": map[string]interface{}{"query": "laptop", "path": "name"}},
+		Size:  10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 32 {
+		t.Errorf("Expected 32 hits across reopened shards, got %d", result.Total)
+	}
+}
+
+func TestEngine_Search_WildcardPath(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	docs := map[string]map[string]interface{}{
+		"1": {"name": "shirt", "attributes": map[string]interface{}{"color": "red"}},
+		"2": {"name": "scarf", "attributes": map[string]interface{}{"material": "red wool"}},
+		"3": {"name": "box", "attributes": map[string]interface{}{"dims": map[string]interface{}{"unit": "red"}}},
+		"4": {"name": "red hat", "attributes": map[string]interface{}{"color": "blue"}},
+	}
+	for id, doc := range docs {
+		if err := engine.IndexDocument("products", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		query    map[string]interface{}
+		expected []string
+	}{
+		{"text", map[string]interface{}{"text": map[string]interface{}{"query": "red", "path": "attributes.*"}}, []string{"1", "2", "3"}},
+		{"term", map[string]interface{}{"term": map[string]interface{}{"value": "blue", "path": "attributes.*"}}, []string{"4"}},
+		{"wildcard", map[string]interface{}{"wildcard": map[string]interface{}{"value": "wo*", "path": "attributes.*"}}, []string{"2"}},
+		{"nested prefix", map[string]interface{}{"text": map[string]interface{}{"query": "red", "path": "attributes.dims.*"}}, []string{"3"}},
+		{"unknown prefix", map[string]interface{}{"text": map[string]interface{}{"query": "red", "path": "missing.*"}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := engine.Search(SearchRequest{Index: "products", Query: tt.query, Size: 10})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			var ids []string
+			for _, hit := range result.Hits {
+				ids = append(ids, hit.ID)
+			}
+			sort.Strings(ids)
+			if strings.Join(ids, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected hits %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestEngine_Search_TextMultiplePaths(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "articles",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	docs := map[string]map[string]interface{}{
+		"1": {"title": "Search engines", "body": "How indexes work"},
+		"2": {"title": "Databases", "body": "Search with MongoDB"},
+		"3": {"title": "Cooking", "body": "Pasta recipes", "summary": "search free"},
+	}
+	for id, doc := range docs {
+		if err := engine.IndexDocument("articles", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		text     map[string]interface{}
+		expected []string
+	}{
+		{"single path", map[string]interface{}{"query": "search", "path": "title"}, []string{"1"}},
+		{"either field", map[string]interface{}{"query": "search", "path": []interface{}{"title", "body"}}, []string{"1", "2"}},
+		{"one element", map[string]interface{}{"query": "search", "path": []interface{}{"body"}}, []string{"2"}},
+		{"and within a field", map[string]interface{}{"query": "search mongodb", "path": []interface{}{"title", "body"}, "operator": "and"}, []string{"2"}},
+		{"with wildcard path", map[string]interface{}{"query": "search", "path": []interface{}{"title", "missing.*"}}, []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := engine.Search(SearchRequest{Index: "articles", Query: map[string]interface{}{"text": tt.text}, Size: 10})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			var ids []string
+			for _, hit := range result.Hits {
+				ids = append(ids, hit.ID)
+			}
+			sort.Strings(ids)
+			if strings.Join(ids, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected hits %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+
+	for _, path := range []interface{}{[]interface{}{}, []interface{}{"title", 1}, 42} {
+		_, err := engine.Search(SearchRequest{
+			Index: "articles",
+			Query: map[string]interface{}{"text": map[string]interface{}{"query": "search", "path": path}},
+			Size:  10,
+		})
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected ErrInvalidQuery for path %v, got %v", path, err)
+		}
+	}
+}
+
+func TestEngine_TypedErrors(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if err := engine.CreateIndex(config.IndexConfig{Name: "products", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}}); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	_, err = engine.Search(SearchRequest{Index: "missing", Size: 10})
+	var notFound *IndexNotFoundError
+	if !errors.Is(err, ErrIndexNotFound) || !errors.As(err, &notFound) || notFound.Index != "missing" {
+		t.Errorf("Expected an index not found error for missing, got %v", err)
+	}
+	if _, err := engine.GetIndexStats("missing"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected GetIndexStats to return ErrIndexNotFound, got %v", err)
+	}
+
+	_, err = engine.Search(SearchRequest{
+		Index: "products",
+		Query: map[string]interface{}{"text": map[string]interface{}{"query": "red", "path": "name", "operator": "xor"}},
+		Size:  10,
+	})
+	if !errors.Is(err, ErrInvalidQuery) || errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrInvalidQuery, got %v", err)
+	}
+
+	_, err = engine.Search(SearchRequest{
+		Index:  "products",
+		Size:   10,
+		Facets: map[string]FacetRequest{"created": {Type: "date_histogram", Field: "created", Interval: "week"}},
+	})
+	if !errors.Is(err, ErrInvalidFacet) {
+		t.Errorf("Expected ErrInvalidFacet for an unsupported interval, got %v", err)
+	}
+
+	if _, err := engine.AnalyzeText("products", "nope", "text"); !errors.Is(err, ErrUnknownAnalyzer) {
+		t.Errorf("Expected ErrUnknownAnalyzer, got %v", err)
+	}
+}
+
+func TestEngine_RenameIndex(t *testing.T) {
+	indexPath := t.TempDir()
+	engine, err := NewEngine(config.SearchConfig{IndexPath: indexPath})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	dynamic := config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}
+	for _, indexCfg := range []config.IndexConfig{
+		{Name: "products_v2", Definition: dynamic},
+		{Name: "orders_v2", Definition: dynamic, Distribution: config.IndexDistribution{Shards: 2}},
+		{Name: "taken", Definition: dynamic},
+	} {
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index %s: %v", indexCfg.Name, err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		doc := map[string]interface{}{"name": "red widget"}
+		if err := engine.IndexDocument("products_v2", fmt.Sprintf("p%d", i), doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+		if err := engine.IndexDocument("orders_v2", fmt.Sprintf("o%d", i), doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	query := map[string]interface{}{"text": map[string]interface{}{"query": "widget", "path": "name"}}
+	for _, rename := range [][2]string{{"products_v2", "products"}, {"orders_v2", "orders"}} {
+		if err := engine.RenameIndex(rename[0], rename[1]); err != nil {
+			t.Fatalf("Failed to rename %s: %v", rename[0], err)
+		}
+
+		result, err := engine.SearchSharded(SearchRequest{Index: rename[1], Query: query, Size: 10})
+		if err != nil {
+			t.Fatalf("Search under new name %s failed: %v", rename[1], err)
+		}
+		if result.Total != 4 {
+			t.Errorf("Expected 4 hits under %s, got %d", rename[1], result.Total)
+		}
+		if _, err := engine.Search(SearchRequest{Index: rename[0], Query: query, Size: 10}); !errors.Is(err, ErrIndexNotFound) {
+			t.Errorf("Expected search under old name %s to fail, got %v", rename[0], err)
+		}
+		if _, err := os.Stat(filepath.Join(indexPath, rename[0])); !os.IsNotExist(err) {
+			t.Errorf("Expected directory of %s to be moved", rename[0])
+		}
+	}
+
+	for _, name := range []string{"orders_shard_0", "orders_shard_1"} {
+		if _, exists := engine.GetIndex(name); !exists {
+			t.Errorf("Expected shard %s after renaming a sharded index", name)
+		}
+	}
+	if _, err := engine.GetIndexMapping("orders"); err != nil {
+		t.Errorf("Expected the definition to follow the rename, got %v", err)
+	}
+
+	if err := engine.RenameIndex("products", "taken"); !errors.Is(err, ErrIndexExists) {
+		t.Errorf("Expected ErrIndexExists renaming onto an existing index, got %v", err)
+	}
+	if err := engine.RenameIndex("missing", "other"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound renaming a missing index, got %v", err)
+	}
+	if err := engine.RenameIndex("products", "../escape"); !errors.Is(err, ErrInvalidIndexName) {
+		t.Errorf("Expected ErrInvalidIndexName for a path, got %v", err)
+	}
+}
+
+func TestEngine_RenameIndex_RollsBackShards(t *testing.T) {
+	indexPath := t.TempDir()
+	engine, err := NewEngine(config.SearchConfig{IndexPath: indexPath})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:         "orders",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		Distribution: config.IndexDistribution{Shards: 3},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		if err := engine.IndexDocument("orders", fmt.Sprintf("o%d", i), map[string]interface{}{"name": "red widget"}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	// The last shard can't be moved after the others were
+	defer func(original func(string, string) error) { renameDir = original }(renameDir)
+	renameDir = func(oldPath, newPath string) error {
+		if strings.HasSuffix(oldPath, "orders_shard_2") {
+			return errors.New("disk full")
+		}
+		return os.Rename(oldPath, newPath)
+	}
+
+	if err := engine.RenameIndex("orders", "orders_v2"); err == nil {
+		t.Fatal("Expected the rename to fail")
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, exists := engine.GetIndex(fmt.Sprintf("orders_shard_%d", i)); !exists {
+			t.Errorf("Expected shard %d to be back under the old name", i)
+		}
+		if _, err := os.Stat(filepath.Join(indexPath, fmt.Sprintf("orders_v2_shard_%d", i))); !os.IsNotExist(err) {
+			t.Errorf("Expected no directory for shard %d under the new name", i)
+		}
+	}
+	query := map[string]interface{}{"text": map[string]interface{}{"query": "widget", "path": "name"}}
+	result, err := engine.SearchSharded(SearchRequest{Index: "orders", Query: query, Size: 10})
+	if err != nil {
+		t.Fatalf("Search under the old name failed: %v", err)
+	}
+	if result.Total != 6 {
+		t.Errorf("Expected 6 hits under the old name, got %d", result.Total)
+	}
+}
+
+func TestDedupHits(t *testing.T) {
+	hits := []SearchHit{
+		{ID: "a", Score: 1.0},
+		{ID: "b", Score: 0.5},
+		{ID: "a", Score: 2.0},
+		{ID: "c", Score: 0.7},
+		{ID: "b", Score: 0.2},
+	}
+	got, dropped := dedupHits(hits)
+
+	want := []SearchHit{{ID: "a", Score: 2.0}, {ID: "b", Score: 0.5}, {ID: "c", Score: 0.7}}
+	if !reflect.DeepEqual(got, want) || dropped != 2 {
+		t.Errorf("Expected %v with 2 dropped, got %v with %d dropped", want, got, dropped)
+	}
+}
+
+func TestEngine_SearchSharded_DedupsReplicatedDocuments(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	err = engine.CreateIndex(config.IndexConfig{
+		Name:         "products",
+		Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+		Distribution: config.IndexDistribution{Shards: 2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	// Write overlapping documents straight into both shards, as replicas would
+	shardDocs := map[string]map[string]string{
+		"products_shard_0": {"shared": "red widget", "only0": "red gadget"},
+		"products_shard_1": {"shared": "red widget", "only1": "red gizmo"},
+	}
+	for shard, docs := range shardDocs {
+		index, exists := engine.GetIndex(shard)
+		if !exists {
+			t.Fatalf("Shard %s not found", shard)
+		}
+		for id, name := range docs {
+			if err := index.Index(id, map[string]interface{}{"name": name}); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+	}
+
+	result, err := engine.SearchSharded(SearchRequest{
+		Index: "products",
+		Query: map[string]interface{}{"text": map[string]interface{}{"query": "red", "path": "name"}},
+		Size:  10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	seen := make(map[string]int)
+	for _, hit := range result.Hits {
+		seen[hit.ID]++
+	}
+	if len(result.Hits) != 3 || seen["shared"] != 1 {
+		t.Errorf("Expected each document once, got hits %v", seen)
+	}
+	if result.Total != 3 {
+		t.Errorf("Expected total 3 after removing the duplicate, got %d", result.Total)
+	}
+}
+
+func TestEngine_CreateIndex_IndexTemplates(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	logsDefinition := config.IndexDefinition{
+		DefaultOperator: "and",
+		Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+			{Name: "message", Type: "text"},
+			{Name: "level", Type: "keyword", Facet: true},
+		}},
+	}
+	err = engine.SetIndexTemplates([]config.IndexTemplate{
+		{Name: "logs", Pattern: "logs-*", Definition: logsDefinition},
+		{Name: "catch-all", Pattern: "*", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to set index templates: %v", err)
+	}
+
+	if err := engine.CreateIndex(config.IndexConfig{Name: "logs-2024-01"}); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if def := engine.IndexDefinition("logs-2024-01"); !reflect.DeepEqual(def, logsDefinition) {
+		t.Errorf("Expected the logs template definition, got %+v", def)
+	}
+	indexMapping, err := engine.GetIndexMapping("logs-2024-01")
+	if err != nil {
+		t.Fatalf("Failed to get mapping: %v", err)
+	}
+	if fields := indexMapping["fields"].([]map[string]interface{}); len(fields) != 2 || fields[1]["name"] != "level" || fields[1]["facet"] != true {
+		t.Errorf("Expected the template's fields in the mapping, got %v", fields)
+	}
+
+	// The template's mapping is used: level is a keyword field
+	if err := engine.IndexDocument("logs-2024-01", "1", map[string]interface{}{"message": "disk full", "level": "Error"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+	result, err := engine.Search(SearchRequest{
+		Index: "logs-2024-01",
+		Query: map[string]interface{}{"term": map[string]interface{}{"path": "level", "value": "Error"}},
+		Size:  10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 1 {
+		t.Errorf("Expected the keyword field to match its exact value, got %d hits", result.Total)
+	}
+
+	// An explicit definition takes precedence, and the first matching template wins
+	explicit := config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{{Name: "title", Type: "text"}}}}
+	if err := engine.CreateIndex(config.IndexConfig{Name: "logs-2024-02", Definition: explicit}); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if def := engine.IndexDefinition("logs-2024-02"); !reflect.DeepEqual(def, explicit) {
+		t.Errorf("Expected the explicit definition, got %+v", def)
+	}
+	if err := engine.CreateIndex(config.IndexConfig{Name: "metrics"}); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if def := engine.IndexDefinition("metrics"); !def.Mappings.Dynamic {
+		t.Errorf("Expected the catch-all template definition, got %+v", def)
+	}
+
+	for _, template := range []config.IndexTemplate{
+		{Name: "no-pattern"},
+		{Name: "bad-pattern", Pattern: "logs-["},
+		{Name: "bad-mapping", Pattern: "x-*", Definition: config.IndexDefinition{DefaultAnalyzer: "does_not_exist"}},
+	} {
+		if err := engine.SetIndexTemplates([]config.IndexTemplate{template}); err == nil {
+			t.Errorf("Expected error for index template %s", template.Name)
+		}
+	}
+}
+
+func TestEngine_CompoundFilter(t *testing.T) {
+	for _, cacheSize := range []int{0, 10} {
+		engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir(), FilterCacheSize: cacheSize})
+		if err != nil {
+			t.Fatalf("Failed to create engine: %v", err)
+		}
+		defer engine.Close()
+
+		indexCfg := config.IndexConfig{
+			Name: "products",
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+				{Name: "title", Type: "text"},
+				{Name: "category", Type: "keyword"},
+			}}},
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		docs := map[string][2]string{
+			"1": {"red shirt", "clothing"},
+			"2": {"red red shirt", "clothing"},
+			"3": {"red car", "vehicles"},
+			"4": {"blue shirt", "clothing"},
+		}
+		for id, doc := range docs {
+			if err := engine.IndexDocument("products", id, map[string]interface{}{"title": doc[0], "category": doc[1]}); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+
+		search := func(q map[string]interface{}) map[string]float64 {
+			result, err := engine.Search(SearchRequest{Index: "products", Query: q, Size: 10})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			scores := make(map[string]float64)
+			for _, hit := range result.Hits {
+				scores[hit.ID] = hit.Score
+			}
+			return scores
+		}
+		red := map[string]interface{}{"text": map[string]interface{}{"query": "red", "path": "title"}}
+		clothing := map[string]interface{}{"wildcard": map[string]interface{}{"path": "category", "value": "cloth*"}}
+
+		unfiltered := search(map[string]interface{}{"compound": map[string]interface{}{"must": []interface{}{red}}})
+		filtered := search(map[string]interface{}{"compound": map[string]interface{}{
+			"must":   []interface{}{red},
+			"filter": []interface{}{clothing},
+		}})
+		if len(filtered) != 2 {
+			t.Errorf("cache size %d: expected the filter to keep documents 1 and 2, got %v", cacheSize, filtered)
+		}
+		for id, score := range filtered {
+			if score != unfiltered[id] {
+				t.Errorf("cache size %d: expected the filter not to change the score of %s, got %v instead of %v", cacheSize, id, score, unfiltered[id])
+			}
+		}
+
+		filterOnly := search(map[string]interface{}{"compound": map[string]interface{}{"filter": []interface{}{clothing}}})
+		if !reflect.DeepEqual(filterOnly, map[string]float64{"1": 0, "2": 0, "4": 0}) {
+			t.Errorf("cache size %d: expected a filter-only compound to match clothing with score 0, got %v", cacheSize, filterOnly)
+		}
+	}
+}
+
+func TestEngine_FilterCache(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir(), FilterCacheSize: 2})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+			{Name: "category", Type: "keyword"},
+		}}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	// A single batch leaves one segment, so no merge replaces the snapshot the
+	// cached document numbers belong to
+	var docs []DocumentBatch
+	for i, category := range []string{"books", "books", "games"} {
+		docs = append(docs, DocumentBatch{ID: fmt.Sprintf("p%d", i), Doc: map[string]interface{}{"category": category}})
+	}
+	if err := engine.IndexDocuments("products", docs); err != nil {
+		t.Fatalf("Failed to index documents: %v", err)
+	}
+
+	filterOn := func(category string) map[string]interface{} {
+		return map[string]interface{}{"compound": map[string]interface{}{"filter": []interface{}{
+			map[string]interface{}{"wildcard": map[string]interface{}{"path": "category", "value": category + "*"}},
+		}}}
+	}
+	search := func(q map[string]interface{}) int {
+		result, err := engine.Search(SearchRequest{Index: "products", Query: q, Size: 10})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result.Total
+	}
+	cacheStats := func() FilterCacheStats {
+		stats, err := engine.GetIndexStats("products")
+		if err != nil {
+			t.Fatalf("GetIndexStats failed: %v", err)
+		}
+		if stats.FilterCache == nil {
+			t.Fatal("Expected filter cache stats")
+		}
+		return *stats.FilterCache
+	}
+
+	// Identical filters reuse the cached documents
+	if total := search(filterOn("books")); total != 2 {
+		t.Errorf("Expected 2 books, got %d", total)
+	}
+	if total := search(filterOn("books")); total != 2 {
+		t.Errorf("Expected 2 books from the cache, got %d", total)
+	}
+	if stats := cacheStats(); stats != (FilterCacheStats{Hits: 1, Misses: 1, Entries: 1}) {
+		t.Errorf("Expected 1 hit, 1 miss and 1 entry, got %+v", stats)
+	}
+
+	// A write invalidates the cached filters of the index
+	if err := engine.IndexDocument("products", "p3", map[string]interface{}{"category": "books"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+	if stats := cacheStats(); stats.Entries != 0 {
+		t.Errorf("Expected the write to empty the cache, got %+v", stats)
+	}
+	if total := search(filterOn("books")); total != 3 {
+		t.Errorf("Expected 3 books after the write, got %d", total)
+	}
+	if stats := cacheStats(); stats.Misses != 2 {
+		t.Errorf("Expected a miss after the write, got %+v", stats)
+	}
+
+	// The least recently used filter is evicted when the cache is full
+	search(filterOn("games"))
+	search(filterOn("books"))
+	search(filterOn("toys"))
+	if stats := cacheStats(); stats.Entries != 2 {
+		t.Errorf("Expected 2 entries in a full cache, got %+v", stats)
+	}
+	before := cacheStats()
+	search(filterOn("games"))
+	if stats := cacheStats(); stats.Misses != before.Misses+1 {
+		t.Errorf("Expected the least recently used filter to be evicted, got %+v", stats)
+	}
+
+	// Single term filters read their postings instead of the cache
+	before = cacheStats()
+	termFilter := map[string]interface{}{"compound": map[string]interface{}{"filter": []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"path": "category", "value": "books"}},
+	}}}
+	if total := search(termFilter); total != 3 {
+		t.Errorf("Expected 3 books from a term filter, got %d", total)
+	}
+	if stats := cacheStats(); stats != before {
+		t.Errorf("Expected a term filter to bypass the cache, got %+v", stats)
+	}
+}
+
+func TestEngine_ResultCache(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir(), ResultCacheSize: 10, ResultCacheTTL: 60})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine.resultCache.now = func() time.Time { return now }
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for i, name := range []string{"red shirt", "blue shirt"} {
+		if err := engine.IndexDocument("products", fmt.Sprintf("p%d", i), map[string]interface{}{"name": name}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	search := func(size int) *SearchResult {
+		result, err := engine.Search(SearchRequest{
+			Index: "products",
+			Query: map[string]interface{}{"text": map[string]interface{}{"query": "shirt", "path": "name"}},
+			Size:  size,
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result
+	}
+	cacheStats := func() ResultCacheStats {
+		stats, err := engine.GetIndexStats("products")
+		if err != nil {
+			t.Fatalf("GetIndexStats failed: %v", err)
+		}
+		if stats.ResultCache == nil {
+			t.Fatal("Expected result cache stats")
+		}
+		return *stats.ResultCache
+	}
+
+	// A repeated identical search is served from the cache
+	first := search(10)
+	if second := search(10); second != first {
+		t.Error("Expected the repeated search to return the cached result")
+	}
+	if stats := cacheStats(); stats != (ResultCacheStats{Hits: 1, Misses: 1, Entries: 1}) {
+		t.Errorf("Expected 1 hit, 1 miss and 1 entry, got %+v", stats)
+	}
+
+	// A different size is a different search
+	if result := search(1); len(result.Hits) != 1 {
+		t.Errorf("Expected 1 hit for size 1, got %d", len(result.Hits))
+	}
+	if stats := cacheStats(); stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("Expected a miss for a different size, got %+v", stats)
+	}
+
+	// A write invalidates the cached results of the index
+	if err := engine.IndexDocument("products", "p2", map[string]interface{}{"name": "green shirt"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+	if stats := cacheStats(); stats.Entries != 0 {
+		t.Errorf("Expected the write to empty the cache, got %+v", stats)
+	}
+	if result := search(10); result.Total != 3 {
+		t.Errorf("Expected 3 hits after the write, got %d", result.Total)
+	}
+	if stats := cacheStats(); stats.Misses != 3 {
+		t.Errorf("Expected a miss after the write, got %+v", stats)
+	}
+
+	// Cached results expire after the TTL
+	now = now.Add(59 * time.Second)
+	search(10)
+	if stats := cacheStats(); stats.Hits != 2 {
+		t.Errorf("Expected a hit before the TTL, got %+v", stats)
+	}
+	now = now.Add(time.Second)
+	search(10)
+	if stats := cacheStats(); stats.Hits != 2 || stats.Misses != 4 {
+		t.Errorf("Expected a miss once the TTL passed, got %+v", stats)
+	}
+
+	// Profiled searches always run
+	before := cacheStats()
+	if _, err := engine.Search(SearchRequest{Index: "products", Query: map[string]interface{}{}, Profile: true}); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if stats := cacheStats(); stats != before {
+		t.Errorf("Expected profiled searches to bypass the cache, got %+v", stats)
+	}
+}
+
+func TestEngine_Search_TypedSource(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, shards := range []int{0, 2} {
+		indexCfg := config.IndexConfig{
+			Name: fmt.Sprintf("products_%d", shards),
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{
+				Dynamic: true,
+				Fields: []config.FieldConfig{
+					{Name: "name", Type: "text"},
+					{Name: "price", Type: "numeric"},
+					{Name: "ratings", Type: "numeric"},
+					{Name: "released", Type: "date"},
+				},
+			}},
+			Distribution: config.IndexDistribution{Shards: shards},
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		doc := map[string]interface{}{
+			"name":     "widget",
+			"price":    19.99,
+			"ratings":  []interface{}{4.0, 5.0},
+			"released": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			"stock":    3.0, // Dynamic, so it has no mapped type
+		}
+		if err := engine.IndexDocument(indexCfg.Name, "p1", doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	for _, index := range []string{"products_0", "products_2"} {
+		run := engine.Search
+		if index == "products_2" {
+			run = engine.SearchSharded
+		}
+		source := func(typed bool) map[string]interface{} {
+			t.Helper()
+			result, err := run(SearchRequest{
+				Index:       index,
+				Query:       map[string]interface{}{"text": map[string]interface{}{"query": "widget", "path": "name"}},
+				Size:        10,
+				TypedSource: typed,
+			})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if len(result.Hits) != 1 {
+				t.Fatalf("Expected 1 hit, got %d", len(result.Hits))
+			}
+			return result.Hits[0].Source
+		}
+
+		want := map[string]interface{}{
+			"name":     "widget",
+			"price":    map[string]interface{}{"$numberDouble": "19.99"},
+			"ratings":  []interface{}{map[string]interface{}{"$numberDouble": "4"}, map[string]interface{}{"$numberDouble": "5"}},
+			"released": map[string]interface{}{"$date": "2024-01-02T03:04:05Z"},
+			"stock":    3.0,
+		}
+		if got := source(true); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected typed source %v, got %v", index, want, got)
+		}
+
+		// Without typed_source values are returned as stored
+		if got := source(false); got["price"] != 19.99 || got["released"] != "2024-01-02T03:04:05Z" {
+			t.Errorf("%s: expected untyped values, got %v", index, got)
+		}
+	}
+}
+
+func TestEngine_Search_MatchedFields(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name:       "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	docs := map[string]map[string]interface{}{
+		"title":       {"title": "gaming laptop", "description": "fast and light", "brand": "acme"},
+		"description": {"title": "carrying bag", "description": "fits any laptop", "brand": "acme"},
+		"both":        {"title": "laptop stand", "description": "raises your laptop", "brand": "acme"},
+		"brand":       {"title": "desk lamp", "description": "bright light", "brand": "acme"},
+	}
+	for id, doc := range docs {
+		if err := engine.IndexDocument("products", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	query := map[string]interface{}{"compound": map[string]interface{}{"should": []interface{}{
+		map[string]interface{}{"text": map[string]interface{}{"query": "laptop", "path": []interface{}{"title", "description"}}},
+		map[string]interface{}{"term": map[string]interface{}{"path": "brand", "value": "acme"}},
+	}}}
+
+	result, err := engine.Search(SearchRequest{Index: "products", Query: query, Size: 10, MatchedFields: true})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	matched := make(map[string][]string)
+	for _, hit := range result.Hits {
+		matched[hit.ID] = hit.MatchedFields
+	}
+	expected := map[string][]string{
+		"title":       {"brand", "title"},
+		"description": {"brand", "description"},
+		"both":        {"brand", "description", "title"},
+		"brand":       {"brand"},
+	}
+	if !reflect.DeepEqual(matched, expected) {
+		t.Errorf("Expected matched fields %v, got %v", expected, matched)
+	}
+
+	result, err = engine.Search(SearchRequest{Index: "products", Query: query, Size: 10})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	for _, hit := range result.Hits {
+		if hit.MatchedFields != nil {
+			t.Errorf("Expected no matched fields unless requested, got %v for %s", hit.MatchedFields, hit.ID)
+		}
+	}
+}
+
+func TestEngine_ExcludeFromSource(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, exclude := range []bool{false, true} {
+		indexCfg := config.IndexConfig{
+			Name: fmt.Sprintf("articles_%t", exclude),
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+				{Name: "title", Type: "text"},
+				{Name: "body", Type: "text", ExcludeFromSource: exclude},
+			}}},
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+
+	// Random words compress poorly, so storing the body dominates the size
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 30; i++ {
+		words := make([]string, 500)
+		for j := range words {
+			words[j] = fmt.Sprintf("w%x", random.Int63())
+		}
+		doc := map[string]interface{}{"title": fmt.Sprintf("article %d", i), "body": strings.Join(words, " ")}
+		if i == 0 {
+			doc["body"] = "needle " + doc["body"].(string)
+		}
+		for _, index := range []string{"articles_false", "articles_true"} {
+			if err := engine.IndexDocument(index, fmt.Sprintf("%d", i), doc); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+	}
+
+	// Scorch deletes merged segments in the background, so the size of the
+	// index is that of the segments it still uses
+	sizes := make(map[string]uint64)
+	for _, index := range []string{"articles_false", "articles_true"} {
+		if _, err := engine.OptimizeIndex(index); err != nil {
+			t.Fatalf("OptimizeIndex failed: %v", err)
+		}
+		stats, err := engine.GetIndexStats(index)
+		if err != nil {
+			t.Fatalf("GetIndexStats failed: %v", err)
+		}
+		if stats.Storage == nil || stats.Storage.IndexType != IndexTypeScorch || stats.Storage.StoredFieldCompression != "snappy" {
+			t.Errorf("Expected scorch storage with snappy compression for %s, got %+v", index, stats.Storage)
+		}
+		bleveIndex, _ := engine.GetIndex(index)
+		advanced, err := bleveIndex.Advanced()
+		if err != nil {
+			t.Fatalf("Failed to access index %s: %v", index, err)
+		}
+		sizes[index] = advanced.(*scorch.Scorch).StatsMap()["num_bytes_used_disk_by_root"].(uint64)
+	}
+	if sizes["articles_true"] >= sizes["articles_false"] {
+		t.Errorf("Expected excluding the body to shrink the index, got %d bytes with it stored and %d without", sizes["articles_false"], sizes["articles_true"])
+	}
+
+	stats, _ := engine.GetIndexStats("articles_true")
+	if !reflect.DeepEqual(stats.Storage.UnstoredFields, []string{"body"}) {
+		t.Errorf("Expected body to be reported as unstored, got %v", stats.Storage.UnstoredFields)
+	}
+
+	query := map[string]interface{}{"text": map[string]interface{}{"query": "needle", "path": "body"}}
+	result, err := engine.Search(SearchRequest{Index: "articles_true", Query: query, Size: 10})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(result.Hits) != 1 || result.Hits[0].ID != "0" {
+		t.Fatalf("Expected the excluded body to stay searchable, got %+v", result.Hits)
+	}
+	if _, stored := result.Hits[0].Source["body"]; stored {
+		t.Error("Expected body to be left out of the source")
+	}
+	if result.Hits[0].Source["title"] != "article 0" {
+		t.Errorf("Expected title in the source, got %v", result.Hits[0].Source)
+	}
+}
+
+func TestEngine_Search_PathHierarchyFacet(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+			{Name: "category", Type: "keyword", PathDelimiter: "/", Facet: true},
+		}}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	categories := []string{"electronics/computers/laptops", "electronics/computers/desktops", "electronics/phones", "/books"}
+	for i, category := range categories {
+		if err := engine.IndexDocument("products", fmt.Sprintf("%d", i), map[string]interface{}{"category": category}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	facetCounts := func(query map[string]interface{}) map[string]int {
+		result, err := engine.Search(SearchRequest{
+			Index:  "products",
+			Query:  query,
+			Facets: map[string]FacetRequest{"category": {Type: "terms", Field: "category", Size: 20}},
+			Size:   10,
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		facet := result.Facets["category"].(map[string]interface{})
+		counts := make(map[string]int)
+		for _, bucket := range facet["buckets"].([]map[string]interface{}) {
+			counts[bucket["key"].(string)] = bucket["count"].(int)
+		}
+		return counts
+	}
+
+	// Every level of the hierarchy gets a bucket; a leading delimiter doesn't
+	// produce an empty path
+	expected := map[string]int{
+		"electronics":                    3,
+		"electronics/computers":          2,
+		"electronics/computers/laptops":  1,
+		"electronics/computers/desktops": 1,
+		"electronics/phones":             1,
+		"/books":                         1,
+	}
+	if counts := facetCounts(map[string]interface{}{}); !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Expected hierarchy buckets %v, got %v", expected, counts)
+	}
+
+	// Drilling down into a path matches everything below it, with term and text queries alike
+	for _, operator := range []string{"term", "text"} {
+		query := map[string]interface{}{operator: map[string]interface{}{"path": "category", "query": "electronics/computers", "value": "electronics/computers"}}
+		counts := facetCounts(query)
+		if counts["electronics/computers"] != 2 || counts["electronics/phones"] != 0 || counts["/books"] != 0 {
+			t.Errorf("Expected %s query to drill into electronics/computers, got %v", operator, counts)
+		}
+	}
+
+	mapping, err := engine.GetIndexMapping("products")
+	if err != nil {
+		t.Fatalf("GetIndexMapping failed: %v", err)
+	}
+	field := mapping["fields"].([]map[string]interface{})[0]
+	if field["pathDelimiter"] != "/" || field["analyzer"] != "path_hierarchy_category" || field["searchAnalyzer"] != "keyword" {
+		t.Errorf("Expected the path hierarchy analyzer in the mapping, got %v", field)
+	}
+}
+
+func TestEngine_CreateIndex_InvalidPathDelimiter(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for name, field := range map[string]config.FieldConfig{
+		"text field":    {Name: "category", Type: "text", PathDelimiter: "/"},
+		"with analyzer": {Name: "category", Type: "keyword", Analyzer: "standard", PathDelimiter: "/"},
+	} {
+		indexCfg := config.IndexConfig{
+			Name:       "products",
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{field}}},
+		}
+		if err := engine.CreateIndex(indexCfg); err == nil {
+			t.Errorf("Expected path_delimiter on a %s to be rejected", name)
+		}
+	}
+}
+
+func TestEngine_MappingChange(t *testing.T) {
+	indexPath := t.TempDir()
+	productsCfg := func(codeType string, reindex bool) config.IndexConfig {
+		return config.IndexConfig{
+			Name: "products",
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+				{Name: "code", Type: codeType},
+			}}},
+			ReindexOnMappingChange: reindex,
+		}
+	}
+	// open restarts the engine with the given definition of products
+	open := func(indexCfg config.IndexConfig) *Engine {
+		t.Helper()
+		engine, err := NewEngine(config.SearchConfig{IndexPath: indexPath})
+		if err != nil {
+			t.Fatalf("Failed to create engine: %v", err)
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		return engine
+	}
+	docCount := func(engine *Engine) uint64 {
+		t.Helper()
+		index, _ := engine.GetIndex("products")
+		count, err := index.DocCount()
+		if err != nil {
+			t.Fatalf("Failed to get document count: %v", err)
+		}
+		return count
+	}
+	exactMatches := func(engine *Engine) int {
+		t.Helper()
+		result, err := engine.Search(SearchRequest{
+			Index: "products",
+			Query: map[string]interface{}{"term": map[string]interface{}{"path": "code", "value": "AB-12"}},
+			Size:  10,
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result.Total
+	}
+
+	engine := open(productsCfg("text", false))
+	if err := engine.IndexDocument("products", "p1", map[string]interface{}{"code": "AB-12"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+	engine.Close()
+
+	// Restarting with the same definition keeps the index as is
+	engine = open(productsCfg("text", false))
+	if engine.MappingOutdated("products") || docCount(engine) != 1 {
+		t.Errorf("Expected an unchanged definition to keep the index, got outdated %t and %d documents", engine.MappingOutdated("products"), docCount(engine))
+	}
+	engine.Close()
+
+	// Changing the field type only warns by default, keeping the old mapping
+	engine = open(productsCfg("keyword", false))
+	if !engine.MappingOutdated("products") {
+		t.Error("Expected the changed definition to be detected")
+	}
+	if mapping, _ := engine.GetIndexMapping("products"); mapping["outdated"] != true {
+		t.Errorf("Expected the mapping to be reported as outdated, got %v", mapping)
+	}
+	if count := docCount(engine); count != 1 {
+		t.Errorf("Expected the outdated index to keep its documents, got %d", count)
+	}
+	if matches := exactMatches(engine); matches != 0 {
+		t.Errorf("Expected the old text mapping to stay in use, got %d exact matches", matches)
+	}
+	engine.Close()
+
+	// With reindex_on_mapping_change the index is rebuilt with the new mapping
+	engine = open(productsCfg("keyword", true))
+	defer engine.Close()
+	if engine.MappingOutdated("products") {
+		t.Error("Expected the rebuilt index to be current")
+	}
+	if count := docCount(engine); count != 0 {
+		t.Errorf("Expected the rebuilt index to be empty until the initial sync, got %d documents", count)
+	}
+	if err := engine.IndexDocument("products", "p1", map[string]interface{}{"code": "AB-12"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+	if matches := exactMatches(engine); matches != 1 {
+		t.Errorf("Expected the keyword mapping to match the code exactly, got %d matches", matches)
+	}
+}
+
+func TestEngine_CleanupIndexes_ClearsOutdated(t *testing.T) {
+	indexPath := t.TempDir()
+	productsCfg := func(codeType string) config.IndexConfig {
+		return config.IndexConfig{
+			Name: "products",
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+				{Name: "code", Type: codeType},
+			}}},
+		}
+	}
+
+	engine, err := NewEngine(config.SearchConfig{IndexPath: indexPath})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	if err := engine.CreateIndex(productsCfg("text")); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	engine.Close()
+
+	engine, err = NewEngine(config.SearchConfig{IndexPath: indexPath})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.CreateIndex(productsCfg("keyword")); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if !engine.MappingOutdated("products") {
+		t.Fatal("Expected the changed definition to be detected")
+	}
+
+	// Dropping the index from the configuration forgets it was outdated, so
+	// adding it back creates a current index
+	engine.CleanupIndexes(&config.Config{})
+	if engine.MappingOutdated("products") {
+		t.Error("Expected the removed index to no longer be outdated")
+	}
+	if err := engine.CreateIndex(productsCfg("keyword")); err != nil {
+		t.Fatalf("Failed to recreate index: %v", err)
+	}
+	if engine.MappingOutdated("products") {
+		t.Error("Expected the recreated index to be current")
+	}
+}
+
+func TestEngine_MappingChange_Sharded(t *testing.T) {
+	indexPath := t.TempDir()
+	for i, codeType := range []string{"text", "keyword", "keyword"} {
+		engine, err := NewEngine(config.SearchConfig{IndexPath: indexPath})
+		if err != nil {
+			t.Fatalf("Failed to create engine: %v", err)
+		}
+		indexCfg := config.IndexConfig{
+			Name: "products",
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+				{Name: "code", Type: codeType},
+			}}},
+			Distribution: config.IndexDistribution{Shards: 2},
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		// Shards created with the text definition stay outdated until rebuilt
+		if outdated, want := engine.MappingOutdated("products"), i > 0; outdated != want {
+			t.Errorf("Restart %d: expected outdated %t, got %t", i, want, outdated)
+		}
+		engine.Close()
+	}
+}
+
+func TestEngine_Search_FieldBoost(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	// The same documents with and without a boost on body
+	for name, bodyBoost := range map[string]float64{"plain": 0, "boosted": 10} {
+		indexCfg := config.IndexConfig{
+			Name: name,
+			Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+				{Name: "title", Type: "text"},
+				{Name: "body", Type: "text", Boost: bodyBoost},
+			}}},
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		docs := map[string]map[string]interface{}{
+			"in_title": {"title": "laptop stand", "body": "a stand made of oak for any desk"},
+			"in_body":  {"title": "oak desk", "body": "a desk with room for a laptop and a monitor"},
+		}
+		for id, doc := range docs {
+			if err := engine.IndexDocument(name, id, doc); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+	}
+
+	search := func(index string) *SearchResult {
+		t.Helper()
+		text := map[string]interface{}{"query": "laptop", "path": []interface{}{"title", "body"}}
+		result, err := engine.Search(SearchRequest{Index: index, Query: map[string]interface{}{"text": text}, Size: 10})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(result.Hits) != 2 {
+			t.Fatalf("Expected 2 hits, got %d", len(result.Hits))
+		}
+		return result
+	}
+
+	// A match in the short title outranks one in the longer body, unless body is boosted
+	if top := search("plain").Hits[0].ID; top != "in_title" {
+		t.Errorf("Expected the title match first without a field boost, got %s", top)
+	}
+	if top := search("boosted").Hits[0].ID; top != "in_body" {
+		t.Errorf("Expected the body match first with a body boost, got %s", top)
+	}
+
+	// Query-time boosts multiply with the field boost: a match in the name
+	// field, boosted 2x, scores 6x a like match in title under a 3x query boost
+	ratioCfg := config.IndexConfig{
+		Name: "ratio",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+			{Name: "title", Type: "text"},
+			{Name: "name", Type: "text", Boost: 2},
+		}}},
+	}
+	if err := engine.CreateIndex(ratioCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for id, doc := range map[string]map[string]interface{}{"by_title": {"title": "laptop"}, "by_name": {"name": "laptop"}} {
+		if err := engine.IndexDocument("ratio", id, doc); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+	scoreRatio := func(queryBoost float64) float64 {
+		t.Helper()
+		name := map[string]interface{}{"query": "laptop", "path": "name"}
+		if queryBoost > 0 {
+			name["score"] = map[string]interface{}{"boost": map[string]interface{}{"value": queryBoost}}
+		}
+		result, err := engine.Search(SearchRequest{
+			Index: "ratio",
+			Query: map[string]interface{}{"compound": map[string]interface{}{"should": []interface{}{
+				map[string]interface{}{"text": name},
+				map[string]interface{}{"text": map[string]interface{}{"query": "laptop", "path": "title"}},
+			}}},
+			Size: 10,
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		scores := make(map[string]float64)
+		for _, hit := range result.Hits {
+			scores[hit.ID] = hit.Score
+		}
+		if scores["by_title"] == 0 {
+			t.Fatalf("Expected by_title to match, got hits %v", result.Hits)
+		}
+		return scores["by_name"] / scores["by_title"]
+	}
+	if ratio := scoreRatio(0); math.Abs(ratio-2) > 1e-6 {
+		t.Errorf("Expected the field boost to score 2x, got ratio %f", ratio)
+	}
+	if ratio := scoreRatio(3); math.Abs(ratio-6) > 1e-6 {
+		t.Errorf("Expected field and query boosts to multiply to 6x, got ratio %f", ratio)
+	}
+
+	mapping, err := engine.GetIndexMapping("boosted")
+	if err != nil {
+		t.Fatalf("Failed to get mapping: %v", err)
+	}
+	if !strings.Contains(fmt.Sprint(mapping), "boost:10") {
+		t.Errorf("Expected the mapping to report the body boost, got %v", mapping)
+	}
+
+	negative := config.IndexConfig{
+		Name:       "negative",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{{Name: "title", Type: "text", Boost: -1}}}},
+	}
+	if err := engine.CreateIndex(negative); err == nil {
+		t.Error("Expected a negative field boost to be rejected")
+	}
+}
+
+func TestEngine_Search_UpdatedSince(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, indexCfg := range []config.IndexConfig{
+		{Name: "custom", TimestampField: "modified", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}},
+		{Name: "default", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}},
+		{Name: "by_id", TimestampField: "_id", Definition: config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}}},
+	} {
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	stamp := func(age time.Duration) string { return now.Add(-age).Format(time.RFC3339Nano) }
+	// The other timestamp field holds the opposite times, so querying it would match the wrong documents
+	docs := map[string]map[string]interface{}{
+		"recent": {"modified": stamp(time.Hour), "updated_at": stamp(72 * time.Hour)},
+		"old":    {"modified": stamp(72 * time.Hour), "updated_at": stamp(time.Hour)},
+	}
+	for id, doc := range docs {
+		for _, index := range []string{"custom", "default"} {
+			if err := engine.IndexDocument(index, id, doc); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+	}
+
+	hitIDs := func(index, value string) []string {
+		t.Helper()
+		result, err := engine.Search(SearchRequest{
+			Index: index,
+			Query: map[string]interface{}{"updatedSince": map[string]interface{}{"value": value}},
+			Size:  10,
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		var ids []string
+		for _, hit := range result.Hits {
+			ids = append(ids, hit.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	for _, value := range []string{"24h", stamp(24 * time.Hour)} {
+		if ids := hitIDs("custom", value); !reflect.DeepEqual(ids, []string{"recent"}) {
+			t.Errorf("Expected updatedSince %s to query timestamp_field modified, got %v", value, ids)
+		}
+		if ids := hitIDs("default", value); !reflect.DeepEqual(ids, []string{"old"}) {
+			t.Errorf("Expected updatedSince %s to query updated_at by default, got %v", value, ids)
+		}
+	}
+	if ids := hitIDs("custom", "100h"); !reflect.DeepEqual(ids, []string{"old", "recent"}) {
+		t.Errorf("Expected both documents within 100h, got %v", ids)
+	}
+
+	for index, value := range map[string]interface{}{"by_id": "24h", "custom": "yesterday"} {
+		_, err := engine.Search(SearchRequest{
+			Index: index,
+			Query: map[string]interface{}{"updatedSince": map[string]interface{}{"value": value}},
+		})
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected ErrInvalidQuery for updatedSince %v on %s, got %v", value, index, err)
+		}
+	}
+}
+
+func TestEngine_DeleteExpired(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	now := time.Now().UTC()
+	for _, shards := range []int{0, 3} {
+		indexCfg := config.IndexConfig{
+			Name:         fmt.Sprintf("sessions_%d", shards),
+			Definition:   config.IndexDefinition{Mappings: config.IndexMappings{Dynamic: true}},
+			Distribution: config.IndexDistribution{Shards: shards},
+		}
+		if err := engine.CreateIndex(indexCfg); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		// 7 expired documents, deleted 2 per batch, and 5 current ones
+		for i := 0; i < 12; i++ {
+			createdAt := now.Add(-time.Duration(i) * 20 * time.Minute)
+			doc := map[string]interface{}{"user": fmt.Sprintf("user %d", i), "created_at": createdAt.Format(time.RFC3339)}
+			if err := engine.IndexDocument(indexCfg.Name, fmt.Sprintf("s%02d", i), doc); err != nil {
+				t.Fatalf("Failed to index document: %v", err)
+			}
+		}
+		// Documents without the field never expire
+		if err := engine.IndexDocument(indexCfg.Name, "no-date", map[string]interface{}{"user": "anonymous"}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+
+		cutoff := now.Add(-90 * time.Minute)
+		deleted, err := engine.deleteExpired(indexCfg.Name, "created_at", cutoff, 2)
+		if err != nil {
+			t.Fatalf("%d shards: DeleteExpired failed: %v", shards, err)
+		}
+		if deleted != 7 {
+			t.Errorf("%d shards: expected 7 expired documents deleted, got %d", shards, deleted)
+		}
+
+		remaining := make(map[string]bool)
+		err = engine.ExportDocuments(indexCfg.Name, func(doc ExportedDocument) error {
+			remaining[doc.ID] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ExportDocuments failed: %v", err)
+		}
+		for _, id := range []string{"s00", "s04", "no-date"} {
+			if !remaining[id] {
+				t.Errorf("%d shards: expected %s to be kept", shards, id)
+			}
+		}
+		if remaining["s05"] || remaining["s11"] || len(remaining) != 6 {
+			t.Errorf("%d shards: expected only current documents to remain, got %v", shards, remaining)
+		}
+
+		// A second sweep finds nothing left to delete
+		if deleted, err := engine.DeleteExpired(indexCfg.Name, "created_at", cutoff); err != nil || deleted != 0 {
+			t.Errorf("%d shards: expected nothing to delete, got %d (%v)", shards, deleted, err)
+		}
+	}
+
+	if _, err := engine.DeleteExpired("missing", "created_at", now); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected not found error for unknown index, got %v", err)
+	}
+}
+
+func TestEngine_CompoundScoreOnlyShould(t *testing.T) {
+	engine, err := NewEngine(config.SearchConfig{IndexPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	indexCfg := config.IndexConfig{
+		Name: "products",
+		Definition: config.IndexDefinition{Mappings: config.IndexMappings{Fields: []config.FieldConfig{
+			{Name: "title", Type: "text"},
+			{Name: "category", Type: "keyword"},
+			{Name: "brand", Type: "keyword"},
+		}}},
+	}
+	if err := engine.CreateIndex(indexCfg); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	docs := map[string][3]string{
+		"1": {"plain shirt", "clothing", "zeta"},
+		"2": {"plain shirt", "clothing", "acme"},
+		"3": {"fast car", "vehicles", "acme"},
+		"4": {"plain shirt", "clothing", "other"},
+	}
+	for id, doc := range docs {
+		if err := engine.IndexDocument("products", id, map[string]interface{}{"title": doc[0], "category": doc[1], "brand": doc[2]}); err != nil {
+			t.Fatalf("Failed to index document: %v", err)
+		}
+	}
+
+	search := func(compound map[string]interface{}) []string {
+		t.Helper()
+		result, err := engine.Search(SearchRequest{Index: "products", Query: map[string]interface{}{"compound": compound}, Size: 10})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		ids := make([]string, len(result.Hits))
+		for i, hit := range result.Hits {
+			ids[i] = hit.ID
+		}
+		return ids
+	}
+	clothing := map[string]interface{}{"term": map[string]interface{}{"path": "category", "value": "clothing"}}
+	acme := map[string]interface{}{"term": map[string]interface{}{"path": "brand", "value": "acme"}}
+	scoreOnlyAcme := map[string]interface{}{"term": map[string]interface{}{"path": "brand", "value": "acme"}, "scoreOnly": true}
+	shirt := map[string]interface{}{"text": map[string]interface{}{"query": "shirt", "path": "title"}}
+
+	assertHits := func(name string, got []string, first string, want ...string) {
+		t.Helper()
+		if len(got) == 0 || got[0] != first {
+			t.Errorf("%s: expected %s to rank first, got %v", name, first, got)
+		}
+		sortedGot := append([]string(nil), got...)
+		sort.Strings(sortedGot)
+		if !reflect.DeepEqual(sortedGot, want) {
+			t.Errorf("%s: expected hits %v, got %v", name, want, sortedGot)
+		}
+	}
+
+	// Alongside must, should clauses are already optional: they rank hits
+	// without changing which documents match
+	assertHits("must and should", search(map[string]interface{}{
+		"must":   []interface{}{clothing},
+		"should": []interface{}{acme},
+	}), "2", "1", "2", "4")
+
+	// minimumShouldMatch makes plain should clauses required, but never scoreOnly ones
+	assertHits("should with minimumShouldMatch", search(map[string]interface{}{
+		"must":               []interface{}{clothing},
+		"should":             []interface{}{acme},
+		"minimumShouldMatch": float64(1),
+	}), "2", "2")
+	assertHits("scoreOnly with minimumShouldMatch", search(map[string]interface{}{
+		"must":               []interface{}{clothing},
+		"should":             []interface{}{scoreOnlyAcme},
+		"minimumShouldMatch": float64(1),
+	}), "2", "1", "2", "4")
+
+	// minimumShouldMatch only counts the other should clauses
+	assertHits("scoreOnly beside a matching should", search(map[string]interface{}{
+		"should":             []interface{}{scoreOnlyAcme, shirt},
+		"minimumShouldMatch": float64(1),
+	}), "2", "1", "2", "4")
+
+	// With nothing else to match on, every document matches
+	scoreOnlyCar := map[string]interface{}{"text": map[string]interface{}{"query": "car", "path": "title"}, "scoreOnly": true}
+	assertHits("scoreOnly alone", search(map[string]interface{}{
+		"should": []interface{}{scoreOnlyCar},
+	}), "3", "1", "2", "3", "4")
+
+	for name, compound := range map[string]map[string]interface{}{
+		"scoreOnly on must":   {"must": []interface{}{scoreOnlyAcme}},
+		"scoreOnly on filter": {"filter": []interface{}{scoreOnlyAcme}},
+		"non-boolean":         {"should": []interface{}{map[string]interface{}{"term": acme["term"], "scoreOnly": "yes"}}},
+	} {
+		_, err := engine.Search(SearchRequest{Index: "products", Query: map[string]interface{}{"compound": compound}, Size: 10})
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: expected ErrInvalidQuery, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Errors returned by Engine methods. Callers classify failures with errors.Is
+// rather than matching on error messages.
+var (
+	ErrIndexNotFound      = errors.New("index not found")
+	ErrIndexExists        = errors.New("index already exists")
+	ErrInvalidIndexName   = errors.New("invalid index name")
+	ErrInvalidQuery       = errors.New("invalid query")
+	ErrInvalidFacet       = errors.New("invalid facet")
+	ErrUnknownAnalyzer    = errors.New("unknown analyzer")
+	ErrSearchTimeout      = errors.New("search timed out")
+	ErrOptimizeInProgress = errors.New("optimize already in progress")
+)
+
+// IndexNotFoundError reports an operation on an index that doesn't exist. It
+// matches ErrIndexNotFound.
+type IndexNotFoundError struct {
+	Index string
+}
+
+func (e *IndexNotFoundError) Error() string {
+	return fmt.Sprintf("index %s not found", e.Index)
+}
+
+// Is reports whether target is ErrIndexNotFound
+func (e *IndexNotFoundError) Is(target error) bool {
+	return target == ErrIndexNotFound
+}
+
+// IndexExistsError reports an index name that is already taken. It matches
+// ErrIndexExists.
+type IndexExistsError struct {
+	Index string
+}
+
+func (e *IndexExistsError) Error() string {
+	return fmt.Sprintf("index %s already exists", e.Index)
+}
+
+// Is reports whether target is ErrIndexExists
+func (e *IndexExistsError) Is(target error) bool {
+	return target == ErrIndexExists
+}
+
+// QueryError reports a query or facet that couldn't be converted to a Bleve
+// search request. It matches its Kind, ErrInvalidQuery or ErrInvalidFacet.
+type QueryError struct {
+	Kind error
+	Msg  string
+	Err  error
+}
+
+func (e *QueryError) Error() string {
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of the error
+func (e *QueryError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// indexNotFound returns the error for a missing index
+func indexNotFound(indexName string) error {
+	return &IndexNotFoundError{Index: indexName}
+}
+
+// invalidQuery wraps a query conversion error
+func invalidQuery(msg string, err error) error {
+	return &QueryError{Kind: ErrInvalidQuery, Msg: msg, Err: err}
+}
+
+// invalidFacet wraps a facet conversion error
+func invalidFacet(err error) error {
+	return &QueryError{Kind: ErrInvalidFacet, Msg: "invalid facet", Err: err}
+}
+
+// searchFailed wraps an error from executing a Bleve search, marking deadline
+// errors with ErrSearchTimeout
+func searchFailed(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrSearchTimeout, err)
+	}
+	return fmt.Errorf("search failed: %w", err)
+}
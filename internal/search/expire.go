@@ -0,0 +1,80 @@
+package search
+
+import (
+	"sort"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// expirePageSize is the number of expired documents found and deleted per batch
+const expirePageSize = 1000
+
+// DeleteExpired deletes the documents of an index whose date field is before
+// cutoff and returns how many were deleted. Expired documents are found with a
+// date range query on field and deleted by ID a batch at a time; documents
+// without the field never expire. Sharded indexes are swept one shard after
+// another.
+func (e *Engine) DeleteExpired(indexName, field string, cutoff time.Time) (int, error) {
+	return e.deleteExpired(indexName, field, cutoff, expirePageSize)
+}
+
+// deleteExpired deletes the expired documents of an index pageSize at a time
+func (e *Engine) deleteExpired(indexName, field string, cutoff time.Time, pageSize int) (int, error) {
+	names := []string{indexName}
+	if _, exists := e.GetIndex(indexName); !exists {
+		names = e.getShardsForIndex(indexName)
+		sort.Strings(names)
+		if len(names) == 0 {
+			return 0, indexNotFound(indexName)
+		}
+	}
+
+	deleted := 0
+	for _, name := range names {
+		index, exists := e.GetIndex(name)
+		if !exists {
+			continue
+		}
+		count, err := e.deleteExpiredFrom(name, index, field, cutoff, pageSize)
+		deleted += count
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteExpiredFrom deletes the expired documents of one index or shard
+func (e *Engine) deleteExpiredFrom(name string, index bleve.Index, field string, cutoff time.Time, pageSize int) (int, error) {
+	exclusive := false
+	rangeQuery := bleve.NewDateRangeInclusiveQuery(time.Time{}, cutoff, nil, &exclusive)
+	rangeQuery.SetField(field)
+
+	deleted := 0
+	for {
+		// Deleted documents no longer match, so each batch starts from the top
+		result, err := index.Search(bleve.NewSearchRequestOptions(rangeQuery, pageSize, 0, false))
+		if err != nil {
+			return deleted, searchFailed(err)
+		}
+		if len(result.Hits) == 0 {
+			return deleted, nil
+		}
+
+		batch := index.NewBatch()
+		for _, hit := range result.Hits {
+			batch.Delete(hit.ID)
+		}
+		err = index.Batch(batch)
+		e.invalidateCaches(name)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += len(result.Hits)
+
+		if len(result.Hits) < pageSize {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package search
+
+import (
+	"github.com/blevesearch/bleve/v2"
+)
+
+// exportPageSize is the number of documents fetched per page when exporting
+const exportPageSize = 1000
+
+// ExportedDocument is a stored document written by ExportDocuments
+type ExportedDocument struct {
+	ID     string                 `json:"_id"`
+	Source map[string]interface{} `json:"source"`
+}
+
+// ExportDocuments calls fn with every document of an index and its stored
+// fields, in ID order. Documents are fetched a page at a time, continuing after
+// the last ID of the previous page, so memory use doesn't grow with the index.
+// Sharded indexes are exported one shard after another. Exporting stops at the
+// first error returned by fn.
+func (e *Engine) ExportDocuments(indexName string, fn func(ExportedDocument) error) error {
+	return e.exportDocuments(indexName, exportPageSize, fn)
+}
+
+// exportDocuments exports an index fetching pageSize documents at a time
+func (e *Engine) exportDocuments(indexName string, pageSize int, fn func(ExportedDocument) error) error {
+	indexes := e.indexesFor(indexName)
+	if len(indexes) == 0 {
+		return indexNotFound(indexName)
+	}
+
+	for _, index := range indexes {
+		var after []string
+		for {
+			searchReq := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), pageSize, 0, false)
+			searchReq.Fields = []string{"*"}
+			searchReq.SortBy([]string{"_id"})
+			searchReq.SearchAfter = after
+
+			result, err := index.Search(searchReq)
+			if err != nil {
+				return searchFailed(err)
+			}
+			for _, hit := range result.Hits {
+				source := make(map[string]interface{}, len(hit.Fields))
+				for field, value := range hit.Fields {
+					source[field] = value
+				}
+				if err := fn(ExportedDocument{ID: hit.ID, Source: source}); err != nil {
+					return err
+				}
+			}
+
+			if len(result.Hits) < pageSize {
+				break
+			}
+			after = []string{result.Hits[len(result.Hits)-1].ID}
+		}
+	}
+	return nil
+}
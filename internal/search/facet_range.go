@@ -0,0 +1,111 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// NumericRange is a named bucket of a numeric range facet. Min is inclusive
+// and Max exclusive; either may be left out to leave that side open.
+type NumericRange struct {
+	Name string   `json:"name"`
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+}
+
+// validateRanges checks that a facet's ranges are named uniquely and not empty
+func validateRanges(facet FacetRequest) error {
+	if len(facet.Ranges) > 0 && facet.Type != "numeric" {
+		return fmt.Errorf("ranges are only supported on numeric facets, not %q", facet.Type)
+	}
+	seen := make(map[string]bool, len(facet.Ranges))
+	for _, r := range facet.Ranges {
+		if r.Name == "" {
+			return fmt.Errorf("range on %s has no name", facet.Field)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("duplicate range %q on %s", r.Name, facet.Field)
+		}
+		seen[r.Name] = true
+		if r.Min != nil && r.Max != nil && *r.Min >= *r.Max {
+			return fmt.Errorf("range %q on %s has min %g not below max %g", r.Name, facet.Field, *r.Min, *r.Max)
+		}
+	}
+	return nil
+}
+
+// numericRangeFacet builds a facet counting the documents in each range
+func numericRangeFacet(facet FacetRequest) *bleve.FacetRequest {
+	facetReq := bleve.NewFacetRequest(facet.Field, len(facet.Ranges))
+	for _, r := range facet.Ranges {
+		facetReq.AddNumericRange(r.Name, r.Min, r.Max)
+	}
+	return facetReq
+}
+
+// facetBucketQuery converts a bucket of a numeric range facet into the range
+// query selecting the documents counted in it, so a client can drill down by
+// passing the bucket key back as a facet filter
+func facetBucketQuery(facet FacetRequest, bucket string) (query.Query, error) {
+	if len(facet.Ranges) == 0 {
+		return nil, fmt.Errorf("bucket filters require a numeric facet with ranges")
+	}
+	for _, r := range facet.Ranges {
+		if r.Name != bucket {
+			continue
+		}
+		inclusive, exclusive := true, false
+		rangeQuery := bleve.NewNumericRangeInclusiveQuery(r.Min, r.Max, &inclusive, &exclusive)
+		rangeQuery.SetField(facet.Field)
+		return rangeQuery, nil
+	}
+	return nil, fmt.Errorf("facet has no range %q", bucket)
+}
+
+// bucketFilter returns the bucket selected by a facet filter of the form
+// {"bucket": "name"}, if it is one
+func bucketFilter(filter map[string]interface{}) (string, bool, error) {
+	value, ok := filter["bucket"]
+	if !ok {
+		return "", false, nil
+	}
+	bucket, isString := value.(string)
+	if !isString || len(filter) != 1 {
+		return "", false, fmt.Errorf("bucket filter must be {\"bucket\": <range name>}")
+	}
+	return bucket, true, nil
+}
+
+// numericRangeBuckets returns the buckets of a numeric range facet ordered by
+// their lower bound, open-ended ranges first
+func numericRangeBuckets(ranges []*search.NumericRangeFacet) []map[string]interface{} {
+	sorted := make([]*search.NumericRangeFacet, len(ranges))
+	copy(sorted, ranges)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Min, sorted[j].Min
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return *a < *b
+	})
+
+	buckets := make([]map[string]interface{}, 0, len(sorted))
+	for _, r := range sorted {
+		bucket := map[string]interface{}{
+			"key":   r.Name,
+			"count": r.Count,
+		}
+		if r.Min != nil {
+			bucket["min"] = *r.Min
+		}
+		if r.Max != nil {
+			bucket["max"] = *r.Max
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
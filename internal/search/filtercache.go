@@ -0,0 +1,295 @@
+package search
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2/index/scorch"
+	"github.com/blevesearch/bleve/v2/mapping"
+	blevesearch "github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/blevesearch/bleve/v2/search/scorer"
+	bleveindex "github.com/blevesearch/bleve_index_api"
+)
+
+// maxCachedFilterHits is the most documents a filter may match to have its
+// document numbers cached. Broader filters are cheaper to run again than to
+// keep in memory.
+const maxCachedFilterHits = 10000
+
+// FilterCacheStats counts the lookups of an index's cached compound filters
+type FilterCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// filterCache is an LRU cache of the internal document numbers matching
+// compound filter clauses, keyed by index and canonical clause JSON. Document
+// numbers are only valid for the index snapshot they were read from, so an
+// entry is only used by searches of the same snapshot. Writes to an index
+// invalidate its entries. A nil cache caches nothing.
+type filterCache struct {
+	mutex    sync.Mutex
+	size     int
+	entries  *list.List // Least recently used at the back
+	elements map[filterCacheKey]*list.Element
+	stats    map[string]*FilterCacheStats
+}
+
+// filterCacheKey identifies a filter clause of an index
+type filterCacheKey struct {
+	index  string
+	filter string
+}
+
+// filterCacheEntry holds the document numbers matched by a filter in an index
+// snapshot, in increasing order. Broad is set instead if it matched more than
+// maxCachedFilterHits documents.
+type filterCacheEntry struct {
+	key      filterCacheKey
+	snapshot *scorch.IndexSnapshot
+	docs     []uint64
+	broad    bool
+}
+
+// newFilterCache creates a cache holding up to size filters, or nil if size is
+// zero or less
+func newFilterCache(size int) *filterCache {
+	if size <= 0 {
+		return nil
+	}
+	return &filterCache{
+		size:     size,
+		entries:  list.New(),
+		elements: make(map[filterCacheKey]*list.Element),
+		stats:    make(map[string]*FilterCacheStats),
+	}
+}
+
+// get returns the cached entry of a filter if it was read from snapshot
+func (c *filterCache) get(key filterCacheKey, snapshot *scorch.IndexSnapshot) (*filterCacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.indexStats(key.index)
+	element, exists := c.elements[key]
+	if !exists || element.Value.(*filterCacheEntry).snapshot != snapshot {
+		stats.Misses++
+		return nil, false
+	}
+	stats.Hits++
+	c.entries.MoveToFront(element)
+	return element.Value.(*filterCacheEntry), true
+}
+
+// put caches the documents matched by a filter, replacing those read from an
+// older snapshot and evicting the least recently used filter if full
+func (c *filterCache) put(entry *filterCacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, exists := c.elements[entry.key]; exists {
+		element.Value = entry
+		c.entries.MoveToFront(element)
+		return
+	}
+	c.elements[entry.key] = c.entries.PushFront(entry)
+	c.indexStats(entry.key.index).Entries++
+
+	if c.entries.Len() > c.size {
+		c.remove(c.entries.Back())
+	}
+}
+
+// invalidate drops the cached filters of an index after it was written to
+func (c *filterCache) invalidate(index string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for element := c.entries.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*filterCacheEntry).key.index == index {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+// remove drops a cached filter. The caller must hold the cache lock.
+func (c *filterCache) remove(element *list.Element) {
+	entry := c.entries.Remove(element).(*filterCacheEntry)
+	delete(c.elements, entry.key)
+	c.indexStats(entry.key.index).Entries--
+}
+
+// indexStats returns the counters of an index. The caller must hold the cache lock.
+func (c *filterCache) indexStats(index string) *FilterCacheStats {
+	stats, exists := c.stats[index]
+	if !exists {
+		stats = &FilterCacheStats{}
+		c.stats[index] = stats
+	}
+	return stats
+}
+
+// statsFor returns a copy of the counters of an index, or nil without a cache
+func (c *filterCache) statsFor(index string) *FilterCacheStats {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := *c.indexStats(index)
+	return &stats
+}
+
+// cachedFilter returns a query matching the same documents of an index as a
+// compound filter clause, reading the matching document numbers from the
+// filter cache and caching them on a miss. The filter query itself is returned
+// when the cache is disabled or the filter is a single term, whose postings
+// are as cheap to read as the cache.
+func (e *Engine) cachedFilter(indexName string, clause map[string]interface{}, filter query.Query) query.Query {
+	if e.filterCache == nil {
+		return filter
+	}
+	if _, ok := filter.(*query.TermQuery); ok {
+		return filter
+	}
+	// Maps marshal with sorted keys, so equal clauses share a key
+	canonical, err := json.Marshal(clause)
+	if err != nil {
+		return filter
+	}
+	return &cachedFilterQuery{
+		cache:  e.filterCache,
+		key:    filterCacheKey{index: indexName, filter: string(canonical)},
+		filter: filter,
+		boost:  1.0,
+	}
+}
+
+// cachedFilterQuery matches the documents of a filter clause, served from the
+// filter cache when it holds them for the snapshot being searched
+type cachedFilterQuery struct {
+	cache  *filterCache
+	key    filterCacheKey
+	filter query.Query
+	boost  float64
+}
+
+// Searcher returns a searcher over the cached document numbers of the filter,
+// reading them from the filter's own searcher on a miss. Filters matching more
+// than maxCachedFilterHits documents, and indexes other than scorch, run the
+// filter searcher as is.
+func (q *cachedFilterQuery) Searcher(ctx context.Context, i bleveindex.IndexReader, m mapping.IndexMapping, options blevesearch.SearcherOptions) (blevesearch.Searcher, error) {
+	snapshot, ok := i.(*scorch.IndexSnapshot)
+	if !ok {
+		return q.filter.Searcher(ctx, i, m, options)
+	}
+
+	entry, cached := q.cache.get(q.key, snapshot)
+	if !cached {
+		docs, broad, err := filterDocNumbers(ctx, q.filter, i, m, options)
+		if err != nil {
+			return nil, err
+		}
+		entry = &filterCacheEntry{key: q.key, snapshot: snapshot, docs: docs, broad: broad}
+		q.cache.put(entry)
+	}
+	if entry.broad {
+		return q.filter.Searcher(ctx, i, m, options)
+	}
+	return &docNumberSearcher{
+		docs:   entry.docs,
+		scorer: scorer.NewConstantScorer(1.0, q.boost, options),
+	}, nil
+}
+
+// filterDocNumbers reads the document numbers matched by a filter, reporting
+// broad instead once it matches more than maxCachedFilterHits documents
+func filterDocNumbers(ctx context.Context, filter query.Query, i bleveindex.IndexReader, m mapping.IndexMapping, options blevesearch.SearcherOptions) ([]uint64, bool, error) {
+	searcher, err := filter.Searcher(ctx, i, m, options)
+	if err != nil {
+		return nil, false, err
+	}
+	defer searcher.Close()
+
+	searchCtx := &blevesearch.SearchContext{DocumentMatchPool: blevesearch.NewDocumentMatchPool(searcher.DocumentMatchPoolSize(), 0)}
+	var docs []uint64
+	for {
+		match, err := searcher.Next(searchCtx)
+		if err != nil {
+			return nil, false, err
+		}
+		if match == nil {
+			return docs, false, nil
+		}
+		if len(docs) == maxCachedFilterHits {
+			return nil, true, nil
+		}
+		docs = append(docs, binary.BigEndian.Uint64(match.IndexInternalID))
+		searchCtx.DocumentMatchPool.Put(match)
+	}
+}
+
+// docNumberSearcher matches a sorted list of scorch document numbers with a
+// constant score
+type docNumberSearcher struct {
+	docs   []uint64 // Shared with the filter cache, so never modified
+	next   int
+	scorer *scorer.ConstantScorer
+}
+
+func (s *docNumberSearcher) Next(ctx *blevesearch.SearchContext) (*blevesearch.DocumentMatch, error) {
+	if s.next >= len(s.docs) {
+		return nil, nil
+	}
+	// The match takes ownership of the ID, so it must not share the cached docs
+	id := make(bleveindex.IndexInternalID, 8)
+	binary.BigEndian.PutUint64(id, s.docs[s.next])
+	s.next++
+	return s.scorer.Score(ctx, id), nil
+}
+
+func (s *docNumberSearcher) Advance(ctx *blevesearch.SearchContext, ID bleveindex.IndexInternalID) (*blevesearch.DocumentMatch, error) {
+	target := binary.BigEndian.Uint64(ID)
+	s.next += sort.Search(len(s.docs)-s.next, func(i int) bool { return s.docs[s.next+i] >= target })
+	return s.Next(ctx)
+}
+
+func (s *docNumberSearcher) Close() error {
+	return nil
+}
+
+func (s *docNumberSearcher) Weight() float64 {
+	return s.scorer.Weight()
+}
+
+func (s *docNumberSearcher) SetQueryNorm(qnorm float64) {
+	s.scorer.SetQueryNorm(qnorm)
+}
+
+func (s *docNumberSearcher) Count() uint64 {
+	return uint64(len(s.docs))
+}
+
+func (s *docNumberSearcher) Min() int {
+	return 0
+}
+
+func (s *docNumberSearcher) Size() int {
+	return 8*len(s.docs) + s.scorer.Size()
+}
+
+func (s *docNumberSearcher) DocumentMatchPoolSize() int {
+	return 1
+}
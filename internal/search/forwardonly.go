@@ -0,0 +1,52 @@
+package search
+
+import (
+	"context"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+	bleveindex "github.com/blevesearch/bleve_index_api"
+)
+
+// forwardOnlyQuery wraps a should clause of a compound requiring at least two
+// of them. Bleve's disjunction searcher advances exhausted clauses again when
+// it is advanced past a document it skipped, as under mustNot, which makes a
+// scorch term reader seek backwards. The reader then restarts by recycling
+// itself while still in use, so a later search on the index can share it and
+// get wrong hits. A forward-only clause stays exhausted instead.
+type forwardOnlyQuery struct {
+	query.Query
+}
+
+func (q *forwardOnlyQuery) Searcher(ctx context.Context, i bleveindex.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	s, err := q.Query.Searcher(ctx, i, m, options)
+	if err != nil {
+		return nil, err
+	}
+	return &forwardOnlySearcher{Searcher: s}, nil
+}
+
+// forwardOnlySearcher returns no more matches once its searcher is exhausted
+type forwardOnlySearcher struct {
+	search.Searcher
+	exhausted bool
+}
+
+func (s *forwardOnlySearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	if s.exhausted {
+		return nil, nil
+	}
+	match, err := s.Searcher.Next(ctx)
+	s.exhausted = match == nil && err == nil
+	return match, err
+}
+
+func (s *forwardOnlySearcher) Advance(ctx *search.SearchContext, ID bleveindex.IndexInternalID) (*search.DocumentMatch, error) {
+	if s.exhausted {
+		return nil, nil
+	}
+	match, err := s.Searcher.Advance(ctx, ID)
+	s.exhausted = match == nil && err == nil
+	return match, err
+}
@@ -0,0 +1,182 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/highlight"
+	simplehighlighter "github.com/blevesearch/bleve/v2/search/highlight/highlighter/simple"
+	bleveindex "github.com/blevesearch/bleve_index_api"
+)
+
+// Orders in which the highlight fragments of a field are returned
+const (
+	// FragmentOrderScore returns the fragments matching the most query terms first
+	FragmentOrderScore = "score"
+	// FragmentOrderOffset returns the fragments in the order they appear in the field
+	FragmentOrderOffset = "offset"
+)
+
+// highlightOptions is a search's highlight request
+type highlightOptions struct {
+	fields       []string // Fields to highlight; nil highlights every field with matches
+	order        string   // FragmentOrderScore or FragmentOrderOffset
+	maxFragments int      // Fragments returned per field at most
+}
+
+// parseHighlight reads a highlight request of the form
+// {"fields": [...], "fragmentOrder": "score", "maxNumberOfFragments": 3}.
+// Fragments are ordered by score and limited to search.max_highlight_fragments
+// unless the request says otherwise.
+func (e *Engine) parseHighlight(highlight map[string]interface{}) (highlightOptions, error) {
+	opts := highlightOptions{order: FragmentOrderScore, maxFragments: e.highlightFragments}
+
+	if fields, ok := highlight["fields"]; ok {
+		list, ok := fields.([]interface{})
+		if !ok {
+			return opts, fmt.Errorf("highlight fields must be an array of field names")
+		}
+		opts.fields = make([]string, 0, len(list))
+		for _, field := range list {
+			name, ok := field.(string)
+			if !ok {
+				return opts, fmt.Errorf("highlight fields must be an array of field names, got %v", field)
+			}
+			opts.fields = append(opts.fields, name)
+		}
+	}
+
+	if order, ok := highlight["fragmentOrder"]; ok {
+		switch order {
+		case FragmentOrderScore, FragmentOrderOffset:
+			opts.order = order.(string)
+		default:
+			return opts, fmt.Errorf("highlight fragmentOrder must be %q or %q, got %v", FragmentOrderScore, FragmentOrderOffset, order)
+		}
+	}
+
+	if maxFragments, ok := highlight["maxNumberOfFragments"]; ok {
+		var n float64
+		switch v := maxFragments.(type) {
+		case float64:
+			n = v
+		case int:
+			n = float64(v)
+		default:
+			return opts, fmt.Errorf("highlight maxNumberOfFragments must be a number, got %v", maxFragments)
+		}
+		if n < 1 || n != math.Trunc(n) {
+			return opts, fmt.Errorf("highlight maxNumberOfFragments must be a positive integer, got %v", maxFragments)
+		}
+		opts.maxFragments = int(n)
+	}
+
+	return opts, nil
+}
+
+// highlightHits adds the highlight fragments of the requested fields to each
+// hit. Bleve only returns the best fragment of a field, so the fragments are
+// built here from the default highlighter's fragmenter and formatter.
+func highlightHits(index bleve.Index, hits search.DocumentMatchCollection, opts highlightOptions) error {
+	highlighter, err := bleve.Config.Cache.HighlighterNamed(bleve.Config.DefaultHighlighter)
+	if err != nil {
+		return err
+	}
+
+	for _, hit := range hits {
+		doc, err := index.Document(hit.ID)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			continue
+		}
+
+		fields := opts.fields
+		if fields == nil {
+			for field := range hit.Locations {
+				fields = append(fields, field)
+			}
+		}
+		for _, field := range fields {
+			fragments := bestFragments(highlighter, hit, doc, field, opts)
+			if len(fragments) == 0 {
+				continue
+			}
+			if hit.Fragments == nil {
+				hit.Fragments = make(search.FieldFragmentMap)
+			}
+			hit.Fragments[field] = fragments
+		}
+	}
+	return nil
+}
+
+// bestFragments returns up to opts.maxFragments non-overlapping fragments of a
+// stored text field, picking those matching the most query terms and returning
+// them in opts.order. Equally scored fragments are picked in field order.
+func bestFragments(highlighter highlight.Highlighter, hit *search.DocumentMatch, doc bleveindex.Document, field string, opts highlightOptions) []string {
+	locations := hit.Locations[field]
+	if len(locations) == 0 {
+		return nil
+	}
+	ordered := highlight.OrderTermLocations(locations)
+	scorer := simplehighlighter.NewFragmentScorer(locations)
+
+	var candidates []*highlight.Fragment
+	doc.VisitFields(func(f bleveindex.Field) {
+		if _, ok := f.(bleveindex.TextField); !ok || f.Name() != field {
+			return
+		}
+		var fieldLocations highlight.TermLocations
+		for _, location := range ordered {
+			if location.ArrayPositions.Equals(f.ArrayPositions()) {
+				fieldLocations = append(fieldLocations, location)
+			}
+		}
+		for _, fragment := range highlighter.Fragmenter().Fragment(f.Value(), fieldLocations) {
+			fragment.ArrayPositions = f.ArrayPositions()
+			scorer.Score(fragment)
+			candidates = append(candidates, fragment)
+		}
+	})
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	var best []*highlight.Fragment
+	for _, candidate := range candidates {
+		if len(best) == opts.maxFragments {
+			break
+		}
+		if !slices.ContainsFunc(best, candidate.Overlaps) {
+			best = append(best, candidate)
+		}
+	}
+
+	if opts.order == FragmentOrderOffset {
+		sort.SliceStable(best, func(i, j int) bool {
+			if c := slices.Compare(best[i].ArrayPositions, best[j].ArrayPositions); c != 0 {
+				return c < 0
+			}
+			return best[i].Start < best[j].Start
+		})
+	}
+
+	ordered.MergeOverlapping()
+	formatted := make([]string, len(best))
+	for i, fragment := range best {
+		if fragment.Start != 0 {
+			formatted[i] += highlighter.Separator()
+		}
+		formatted[i] += highlighter.FragmentFormatter().Format(fragment, ordered)
+		if fragment.End != len(fragment.Orig) {
+			formatted[i] += highlighter.Separator()
+		}
+	}
+	return formatted
+}
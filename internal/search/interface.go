@@ -13,6 +13,7 @@ type SearchEngine interface {
 	CreateIndex(indexCfg config.IndexConfig) error
 	ListIndexes() ([]IndexInfo, error)
 	RemoveIndex(indexName string) error
+	RenameIndex(oldName, newName string) error
 	CleanupIndexes(cfg *config.Config)
 
 	// Document operations
@@ -22,10 +23,22 @@ type SearchEngine interface {
 
 	// Search operations
 	Search(req SearchRequest) (*SearchResult, error)
+	DescribeQuery(indexName string, atlasQuery map[string]interface{}) (*QueryDescription, error)
+	ValidateQuery(indexName string, atlasQuery map[string]interface{}) error
+	AnalyzeText(indexName, analyzerName, text string) ([]AnalyzedToken, error)
+	CountBy(indexName, field string, atlasQuery map[string]interface{}) (map[string]int, error)
+	Terms(indexName, field, prefix string, size int) ([]TermCount, error)
+	ExportDocuments(indexName string, fn func(ExportedDocument) error) error
 
 	// Mapping operations
 	GetIndexMapping(indexName string) (map[string]interface{}, error)
 
+	// Statistics
+	GetIndexStats(indexName string) (*IndexStats, error)
+
+	// Maintenance
+	OptimizeIndex(indexName string) (*OptimizeResult, error)
+
 	// Sync tracking
 	UpdateLastSync(indexName string, syncTime time.Time)
 
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// renameDir moves an index directory, replaced in tests
+var renameDir = os.Rename
+
+// RenameIndex renames an index, moving its directory on disk. Sharded indexes
+// have every shard renamed, and if one can't be moved those already moved are
+// moved back, leaving the index under its old name. It fails if an index named newName exists, in
+// memory or on disk. Searches wait until the rename completes, and fail under
+// the old name afterwards.
+func (e *Engine) RenameIndex(oldName, newName string) error {
+	if strings.TrimSpace(newName) != newName || newName == "" || newName == "." || newName == ".." || strings.ContainsAny(newName, `/\`) {
+		return fmt.Errorf("%w %q", ErrInvalidIndexName, newName)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// Map each index or shard to its new name
+	renames := make(map[string]string)
+	if _, exists := e.indexes[oldName]; exists {
+		renames[oldName] = newName
+	} else {
+		for name := range e.indexes {
+			if parent, ok := shardParent(name); ok && parent == oldName {
+				renames[name] = newName + strings.TrimPrefix(name, oldName)
+			}
+		}
+	}
+	if len(renames) == 0 {
+		return indexNotFound(oldName)
+	}
+	if newName == oldName {
+		return nil
+	}
+
+	if _, exists := e.definitions[newName]; exists {
+		return &IndexExistsError{Index: newName}
+	}
+	for _, target := range renames {
+		if _, exists := e.indexes[target]; exists {
+			return &IndexExistsError{Index: newName}
+		}
+		if _, err := os.Stat(filepath.Join(e.indexPath, target)); err == nil {
+			return &IndexExistsError{Index: newName}
+		}
+	}
+
+	names := make([]string, 0, len(renames))
+	for name := range renames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		if err := e.renameIndexDir(name, renames[name]); err != nil {
+			for _, renamed := range names[:i] {
+				if undoErr := e.renameIndexDir(renames[renamed], renamed); undoErr != nil {
+					log.Printf("Failed to move shard %s back after a failed rename: %v", renamed, undoErr)
+				}
+			}
+			return err
+		}
+	}
+
+	if def, exists := e.definitions[oldName]; exists {
+		e.definitions[newName] = def
+		delete(e.definitions, oldName)
+	}
+	if e.outdated[oldName] {
+		e.outdated[newName] = true
+		delete(e.outdated, oldName)
+	}
+	if replicas, exists := e.replicas[oldName]; exists {
+		e.replicas[newName] = replicas
+		delete(e.replicas, oldName)
+	}
+	if field, exists := e.timestamps[oldName]; exists {
+		e.timestamps[newName] = field
+		delete(e.timestamps, oldName)
+	}
+
+	e.syncMutex.Lock()
+	for name, target := range renames {
+		if syncTime, exists := e.lastSync[name]; exists {
+			e.lastSync[target] = syncTime
+			delete(e.lastSync, name)
+		}
+	}
+	if syncTime, exists := e.lastSync[oldName]; exists {
+		e.lastSync[newName] = syncTime
+		delete(e.lastSync, oldName)
+	}
+	e.syncMutex.Unlock()
+
+	return nil
+}
+
+// renameIndexDir closes an index or shard, moves its directory and reopens it
+// under the new name. If the directory can't be moved, or the moved index
+// can't be opened, the index is reopened under its old name. The caller must
+// hold the engine lock.
+func (e *Engine) renameIndexDir(name, target string) error {
+	if err := e.indexes[name].Close(); err != nil {
+		return fmt.Errorf("failed to close index %s: %w", name, err)
+	}
+	delete(e.indexes, name)
+	e.invalidateCaches(name)
+	e.invalidateCaches(target)
+
+	oldPath := filepath.Join(e.indexPath, name)
+	newPath := filepath.Join(e.indexPath, target)
+	if err := renameDir(oldPath, newPath); err != nil {
+		e.reopenIndex(name, oldPath)
+		return fmt.Errorf("failed to rename index directory %s: %w", oldPath, err)
+	}
+
+	index, err := bleve.Open(newPath)
+	if err != nil {
+		if moveErr := renameDir(newPath, oldPath); moveErr == nil {
+			e.reopenIndex(name, oldPath)
+		}
+		return fmt.Errorf("failed to open renamed index %s: %w", target, err)
+	}
+	e.indexes[target] = index
+	return nil
+}
+
+// reopenIndex opens an index closed for a rename that failed, logging if it
+// can't be. The caller must hold the engine lock.
+func (e *Engine) reopenIndex(name, path string) {
+	index, err := bleve.Open(path)
+	if err != nil {
+		log.Printf("Failed to reopen index %s after a failed rename: %v", name, err)
+		return
+	}
+	e.indexes[name] = index
+}
@@ -0,0 +1,187 @@
+package search
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// ResultCacheStats counts the lookups of an index's cached search results
+type ResultCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// resultCache is an LRU cache of search results, keyed by index and canonical
+// request JSON. Entries expire after a TTL, and writes to an index invalidate
+// its entries. Cached results are shared between searches, so they must not be
+// modified. A nil cache caches nothing.
+type resultCache struct {
+	mutex       sync.Mutex
+	size        int
+	ttl         time.Duration    // Zero keeps results until the index is written to
+	now         func() time.Time // Replaced in tests
+	entries     *list.List       // Least recently used at the back
+	elements    map[resultCacheKey]*list.Element
+	generations map[string]uint64 // Incremented on every write to an index
+	stats       map[string]*ResultCacheStats
+}
+
+// resultCacheKey identifies a search request on an index
+type resultCacheKey struct {
+	index   string
+	request string
+}
+
+// resultCacheEntry holds the result of a search until it expires
+type resultCacheEntry struct {
+	key     resultCacheKey
+	result  *SearchResult
+	expires time.Time
+}
+
+// newResultCache creates a cache holding up to size results for ttl each, or
+// nil if size is zero or less
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	if size <= 0 {
+		return nil
+	}
+	return &resultCache{
+		size:        size,
+		ttl:         ttl,
+		now:         time.Now,
+		entries:     list.New(),
+		elements:    make(map[resultCacheKey]*list.Element),
+		generations: make(map[string]uint64),
+		stats:       make(map[string]*ResultCacheStats),
+	}
+}
+
+// get returns the cached result of a search and the index's write generation,
+// which must be passed to put when the result isn't cached or has expired
+func (c *resultCache) get(key resultCacheKey) (*SearchResult, bool, uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.indexStats(key.index)
+	element, exists := c.elements[key]
+	if exists && c.ttl > 0 && !c.now().Before(element.Value.(*resultCacheEntry).expires) {
+		c.remove(element)
+		exists = false
+	}
+	if !exists {
+		stats.Misses++
+		return nil, false, c.generations[key.index]
+	}
+	stats.Hits++
+	c.entries.MoveToFront(element)
+	return element.Value.(*resultCacheEntry).result, true, c.generations[key.index]
+}
+
+// put caches the result of a search unless the index was written to since
+// generation was read, evicting the least recently used result if full
+func (c *resultCache) put(key resultCacheKey, generation uint64, result *SearchResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.generations[key.index] != generation {
+		return
+	}
+	if _, exists := c.elements[key]; exists {
+		return // Cached by a concurrent search
+	}
+	entry := &resultCacheEntry{key: key, result: result, expires: c.now().Add(c.ttl)}
+	c.elements[key] = c.entries.PushFront(entry)
+	c.indexStats(key.index).Entries++
+
+	if c.entries.Len() > c.size {
+		c.remove(c.entries.Back())
+	}
+}
+
+// invalidate drops the cached results of an index after it was written to
+func (c *resultCache) invalidate(index string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generations[index]++
+	for element := c.entries.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*resultCacheEntry).key.index == index {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+// remove drops a cached result. The caller must hold the cache lock.
+func (c *resultCache) remove(element *list.Element) {
+	entry := c.entries.Remove(element).(*resultCacheEntry)
+	delete(c.elements, entry.key)
+	c.indexStats(entry.key.index).Entries--
+}
+
+// indexStats returns the counters of an index. The caller must hold the cache lock.
+func (c *resultCache) indexStats(index string) *ResultCacheStats {
+	stats, exists := c.stats[index]
+	if !exists {
+		stats = &ResultCacheStats{}
+		c.stats[index] = stats
+	}
+	return stats
+}
+
+// statsFor returns a copy of the counters of an index, or nil without a cache
+func (c *resultCache) statsFor(index string) *ResultCacheStats {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := *c.indexStats(index)
+	return &stats
+}
+
+// cachedSearch returns the cached result of an identical earlier search, or
+// runs the search with run and caches its result. Profiled searches bypass the
+// cache since their timings describe the search they ran.
+func (e *Engine) cachedSearch(req SearchRequest, run func(SearchRequest) (*SearchResult, error)) (*SearchResult, error) {
+	if e.resultCache == nil || req.Profile {
+		return run(req)
+	}
+	// Maps marshal with sorted keys, so identical requests share a key
+	canonical, err := json.Marshal(req)
+	if err != nil {
+		return run(req)
+	}
+	key := resultCacheKey{index: req.Index, request: string(canonical)}
+
+	result, cached, generation := e.resultCache.get(key)
+	if cached {
+		return result, nil
+	}
+	result, err = run(req)
+	if err != nil {
+		return nil, err
+	}
+	e.resultCache.put(key, generation, result)
+	return result, nil
+}
+
+// invalidateCaches drops the cached filters, search results and suggestions of
+// an index or shard after it was written to, including those of a shard's index
+func (e *Engine) invalidateCaches(name string) {
+	e.filterCache.invalidate(name)
+	e.resultCache.invalidate(name)
+	e.suggestionCache.invalidate(name)
+	if parent, ok := shardParent(name); ok {
+		e.resultCache.invalidate(parent)
+		e.suggestionCache.invalidate(parent)
+	}
+}
@@ -0,0 +1,121 @@
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/serialx/hashring"
+)
+
+// shardRoutingKey is the internal key under which a shard stores the scheme
+// documents were routed to it with
+var shardRoutingKey = []byte("_shard_routing")
+
+// shardRing assigns the documents of a sharded index to its shards by
+// consistent hashing. Each shard owns virtualNodes points on the ring, so
+// adding a shard only moves the documents of the ranges it takes over instead
+// of nearly all of them, as hashing modulo the shard count would.
+type shardRing struct {
+	shards int
+	ring   *hashring.HashRing
+}
+
+// newShardRing creates the ring of the name_shard_N shards of an index
+func newShardRing(indexName string, shards, virtualNodes int) *shardRing {
+	weights := make(map[string]int, shards)
+	for shard := 0; shard < shards; shard++ {
+		weights[fmt.Sprintf("%s_shard_%d", indexName, shard)] = virtualNodes
+	}
+	return &shardRing{shards: shards, ring: hashring.NewWithWeights(weights)}
+}
+
+// shardFor returns the name of the shard a document belongs to
+func (r *shardRing) shardFor(docID string) string {
+	shard, _ := r.ring.GetNode(docID)
+	return shard
+}
+
+// shardRingFor returns the ring of an index with the given number of shards,
+// building it again when the shard count has changed
+func (e *Engine) shardRingFor(indexName string, shards int) *shardRing {
+	e.ringMutex.Lock()
+	defer e.ringMutex.Unlock()
+
+	if ring, ok := e.shardRings[indexName]; ok && ring.shards == shards {
+		return ring
+	}
+	if e.shardRings == nil {
+		e.shardRings = make(map[string]*shardRing)
+	}
+	ring := newShardRing(indexName, shards, e.virtualNodes())
+	e.shardRings[indexName] = ring
+	return ring
+}
+
+// virtualNodes returns the number of points each shard owns on a ring
+func (e *Engine) virtualNodes() int {
+	return max(e.shardVirtualNodes, 1)
+}
+
+// shardRouting returns the routing scheme of shards on a ring with
+// virtualNodes points each
+func shardRouting(virtualNodes int) []byte {
+	return []byte(fmt.Sprintf("ring:%d", virtualNodes))
+}
+
+// openShard opens or creates a shard like openIndex, and checks its documents
+// were routed with the current scheme. Otherwise updates may land on a
+// different shard than the original document, so a shard routed with another
+// scheme is rebuilt empty if reindex is set, and otherwise reported as outdated.
+func (e *Engine) openShard(name, path string, indexMapping mapping.IndexMapping, hash []byte, reindex bool) (bleve.Index, bool, error) {
+	index, outdated, err := e.openIndex(name, path, indexMapping, hash, reindex)
+	if err != nil {
+		return nil, false, err
+	}
+
+	routing := shardRouting(e.virtualNodes())
+	stored, err := index.GetInternal(shardRoutingKey)
+	if err != nil {
+		index.Close()
+		return nil, false, err
+	}
+	if bytes.Equal(stored, routing) {
+		return index, outdated, nil
+	}
+	if stored == nil {
+		// Shards filled before the scheme was stored hashed IDs modulo the shard count
+		count, err := index.DocCount()
+		if err != nil {
+			index.Close()
+			return nil, false, err
+		}
+		if count == 0 {
+			return index, outdated, index.SetInternal(shardRoutingKey, routing)
+		}
+	}
+	if !reindex {
+		log.Printf("Warning: the documents of shard %s were routed differently than shard_virtual_nodes %d routes them; updates may land on another shard until it is rebuilt (set reindex_on_mapping_change to rebuild it at startup)", name, e.virtualNodes())
+		return index, true, nil
+	}
+
+	log.Printf("The documents of shard %s were routed differently, rebuilding it", name)
+	if err := index.Close(); err != nil {
+		return nil, false, err
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return nil, false, err
+	}
+	index, _, err = e.openIndex(name, path, indexMapping, hash, reindex)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := index.SetInternal(shardRoutingKey, routing); err != nil {
+		index.Close()
+		return nil, false, err
+	}
+	return index, false, nil
+}
@@ -0,0 +1,322 @@
+package search
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2"
+	blevesearch "github.com/blevesearch/bleve/v2/search"
+	bleveindex "github.com/blevesearch/bleve_index_api"
+)
+
+// suggestionCandidate is the closest dictionary term found so far for a query term
+type suggestionCandidate struct {
+	term     string
+	distance int
+	count    uint64
+}
+
+// better reports whether a dictionary term is a better correction than the current candidate
+func (c *suggestionCandidate) better(term string, distance int, count uint64) bool {
+	if c.term == "" {
+		return true
+	}
+	if distance != c.distance {
+		return distance < c.distance
+	}
+	if count != c.count {
+		return count > c.count
+	}
+	return term < c.term
+}
+
+// DidYouMean proposes a corrected version of a query string. The query is run
+// through the index's default analyzer and every term that does not occur in the
+// index is replaced by the closest term from the text field dictionaries,
+// preferring the smallest edit distance and then the most frequent term. It
+// returns an empty string when every term is known or no close term exists.
+// Suggestions are cached until the index is written to.
+func (e *Engine) DidYouMean(indexName, queryText string) (string, error) {
+	indexes := e.indexesFor(indexName)
+	if len(indexes) == 0 {
+		return "", indexNotFound(indexName)
+	}
+
+	suggestion, cached, generation := e.suggestionCache.get(indexName, queryText)
+	if cached {
+		return suggestion, nil
+	}
+
+	indexMapping := indexes[0].Mapping()
+	terms := analyzeTerms(indexMapping, indexMapping.AnalyzerNameForPath(""), queryText)
+	known := make([]bool, len(terms))
+	candidates := make([]suggestionCandidate, len(terms))
+
+	for _, index := range indexes {
+		if err := e.lookupSuggestions(indexName, index, terms, known, candidates); err != nil {
+			return "", err
+		}
+	}
+
+	corrected := make([]string, len(terms))
+	changed := false
+	for i, term := range terms {
+		corrected[i] = term
+		if !known[i] && candidates[i].term != "" {
+			corrected[i] = candidates[i].term
+			changed = true
+		}
+	}
+	if changed {
+		suggestion = strings.Join(corrected, " ")
+	}
+	e.suggestionCache.put(indexName, generation, queryText, suggestion)
+	return suggestion, nil
+}
+
+// lookupSuggestions reads the terms within the allowed edit distance of each
+// query term from the text field dictionaries of an index or shard, marking
+// query terms that exist and recording the closest correction for the others
+func (e *Engine) lookupSuggestions(indexName string, index bleve.Index, terms []string, known []bool, candidates []suggestionCandidate) error {
+	fields, err := e.suggestionFields(indexName, index)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	advanced, err := index.Advanced()
+	if err != nil {
+		return fmt.Errorf("failed to access index %s: %w", indexName, err)
+	}
+	reader, err := advanced.Reader()
+	if err != nil {
+		return fmt.Errorf("failed to open reader for index %s: %w", indexName, err)
+	}
+	defer reader.Close()
+
+	for i, term := range terms {
+		maxEdits := maxSuggestionEdits(term)
+		for _, field := range fields {
+			if known[i] || maxEdits == 0 {
+				break
+			}
+			if err := fuzzyDictionaryTerms(reader, field, term, maxEdits, &known[i], &candidates[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fuzzyDictionaryTerms walks the dictionary terms of a field within maxEdits
+// of a query term, setting known if the term itself exists and otherwise
+// keeping the closest one in candidate. Index types without fuzzy dictionary
+// lookups, such as upsidedown, walk the whole dictionary instead.
+func fuzzyDictionaryTerms(reader bleveindex.IndexReader, field, term string, maxEdits int, known *bool, candidate *suggestionCandidate) error {
+	var dict bleveindex.FieldDict
+	var err error
+	if fuzzyReader, ok := reader.(bleveindex.IndexReaderFuzzy); ok {
+		dict, err = fuzzyReader.FieldDictFuzzy(field, term, maxEdits, "")
+	} else {
+		dict, err = reader.FieldDict(field)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read term dictionary for %s: %w", field, err)
+	}
+	defer dict.Close()
+
+	for {
+		entry, err := dict.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read term dictionary for %s: %w", field, err)
+		}
+		if entry == nil {
+			return nil
+		}
+		if entry.Term == term {
+			*known = true
+			return nil
+		}
+		if !isTextTerm(entry.Term) {
+			continue
+		}
+		distance, exceeded := blevesearch.LevenshteinDistanceMax(term, entry.Term, maxEdits)
+		if exceeded {
+			continue
+		}
+		if candidate.better(entry.Term, distance, entry.Count) {
+			*candidate = suggestionCandidate{term: entry.Term, distance: distance, count: entry.Count}
+		}
+	}
+}
+
+// suggestionFields returns the fields of an index or shard whose terms can
+// correct query text: those mapped as text, or indexed dynamically. Internal
+// fields such as _id and the _all composite field are left out, as are
+// keyword, numeric, date, boolean and ngram fields.
+func (e *Engine) suggestionFields(indexName string, index bleve.Index) ([]string, error) {
+	fieldTypes := make(map[string]string)
+	for _, field := range e.IndexDefinition(indexName).Mappings.Fields {
+		fieldTypes[field.Name] = mappedFieldType(field.Type)
+	}
+
+	fields, err := index.Fields()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fields: %w", err)
+	}
+	textFields := fields[:0]
+	for _, field := range fields {
+		if strings.HasPrefix(field, "_") {
+			continue
+		}
+		if fieldType, mapped := fieldTypes[field]; mapped && fieldType != "text" {
+			continue
+		}
+		textFields = append(textFields, field)
+	}
+	return textFields, nil
+}
+
+// maxSuggestionEdits returns how many edits a correction of term may need.
+// Like Elasticsearch's AUTO fuzziness, short terms are left alone.
+func maxSuggestionEdits(term string) int {
+	switch length := utf8.RuneCountInString(term); {
+	case length < 3:
+		return 0
+	case length <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// isTextTerm filters out the binary prefix-coded terms of numeric and date fields
+func isTextTerm(term string) bool {
+	if !utf8.ValidString(term) {
+		return false
+	}
+	for _, r := range term {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexesFor returns the named index, or all of its shards for sharded indexes
+func (e *Engine) indexesFor(indexName string) []bleve.Index {
+	if index, exists := e.GetIndex(indexName); exists {
+		return []bleve.Index{index}
+	}
+
+	shards := e.getShardsForIndex(indexName)
+	sort.Strings(shards)
+	indexes := make([]bleve.Index, 0, len(shards))
+	for _, shard := range shards {
+		if index, exists := e.GetIndex(shard); exists {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// maxCachedSuggestions is the most suggestions cached per index. The cache of
+// an index is emptied when it fills up.
+const maxCachedSuggestions = 1000
+
+// suggestionCache holds the did-you-mean suggestions of query strings, keyed
+// by index. Writes to an index invalidate its suggestions.
+type suggestionCache struct {
+	mutex       sync.Mutex
+	suggestions map[string]map[string]string // index -> query text -> suggestion
+	generations map[string]uint64            // Incremented on every write to an index
+}
+
+// newSuggestionCache creates an empty suggestion cache
+func newSuggestionCache() *suggestionCache {
+	return &suggestionCache{
+		suggestions: make(map[string]map[string]string),
+		generations: make(map[string]uint64),
+	}
+}
+
+// get returns the cached suggestion for a query string and the index's write
+// generation, which must be passed to put when it isn't cached
+func (c *suggestionCache) get(indexName, queryText string) (string, bool, uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	suggestion, cached := c.suggestions[indexName][queryText]
+	return suggestion, cached, c.generations[indexName]
+}
+
+// put caches the suggestion for a query string unless the index was written
+// to since generation was read
+func (c *suggestionCache) put(indexName string, generation uint64, queryText, suggestion string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.generations[indexName] != generation {
+		return
+	}
+	suggestions := c.suggestions[indexName]
+	if suggestions == nil || len(suggestions) >= maxCachedSuggestions {
+		suggestions = make(map[string]string)
+		c.suggestions[indexName] = suggestions
+	}
+	suggestions[queryText] = suggestion
+}
+
+// invalidate drops the cached suggestions of an index after it was written to
+func (c *suggestionCache) invalidate(indexName string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generations[indexName]++
+	delete(c.suggestions, indexName)
+}
+
+// addSuggestion sets a did-you-mean suggestion on results with fewer hits than
+// the configured threshold
+func (e *Engine) addSuggestion(req SearchRequest, result *SearchResult) {
+	if e.suggestThreshold <= 0 || result.Total >= e.suggestThreshold {
+		return
+	}
+
+	queryText := strings.Join(textQueryStrings(req.Query), " ")
+	if queryText == "" {
+		return
+	}
+
+	suggestion, err := e.DidYouMean(req.Index, queryText)
+	if err != nil {
+		log.Printf("Failed to compute suggestion for index %s: %v", req.Index, err)
+		return
+	}
+	result.Suggestion = suggestion
+}
+
+// textQueryStrings collects the query strings of the text operators in an Atlas
+// Search query, including those nested in compound clauses
+func textQueryStrings(atlasQuery map[string]interface{}) []string {
+	var texts []string
+	if text, ok := atlasQuery["text"].(map[string]interface{}); ok {
+		if queryText, ok := text["query"].(string); ok && queryText != "" {
+			texts = append(texts, queryText)
+		}
+	}
+	if compound, ok := atlasQuery["compound"].(map[string]interface{}); ok {
+		for _, clause := range []string{"must", "should"} {
+			subQueries, _ := compound[clause].([]interface{})
+			for _, subQuery := range subQueries {
+				if sub, ok := subQuery.(map[string]interface{}); ok {
+					texts = append(texts, textQueryStrings(sub)...)
+				}
+			}
+		}
+	}
+	return texts
+}
@@ -0,0 +1,54 @@
+package search
+
+import (
+	"fmt"
+	"log"
+	"path"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// SetIndexTemplates sets the templates applied to indexes created afterwards.
+// Patterns are globs matched against the whole index name, e.g. "logs-*".
+// Templates only fill in the definitions of indexes being created; nothing
+// creates an index because a collection matches a pattern.
+func (e *Engine) SetIndexTemplates(templates []config.IndexTemplate) error {
+	for _, template := range templates {
+		if template.Pattern == "" {
+			return fmt.Errorf("index template %s: pattern is required", template.Name)
+		}
+		if _, err := path.Match(template.Pattern, ""); err != nil {
+			return fmt.Errorf("index template %s: invalid pattern %q: %w", template.Name, template.Pattern, err)
+		}
+		if _, err := e.createMapping(template.Definition); err != nil {
+			return fmt.Errorf("index template %s: invalid mapping: %w", template.Name, err)
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.templates = templates
+	return nil
+}
+
+// applyIndexTemplate gives an index without a definition of its own the
+// definition of the first template whose pattern matches its name. The caller
+// must hold the engine lock.
+func (e *Engine) applyIndexTemplate(indexCfg config.IndexConfig) config.IndexConfig {
+	if !emptyDefinition(indexCfg.Definition) {
+		return indexCfg
+	}
+	for _, template := range e.templates {
+		if matched, _ := path.Match(template.Pattern, indexCfg.Name); matched {
+			log.Printf("Applying index template %s to index %s", template.Name, indexCfg.Name)
+			indexCfg.Definition = template.Definition
+			return indexCfg
+		}
+	}
+	return indexCfg
+}
+
+// emptyDefinition reports whether an index definition configures nothing
+func emptyDefinition(def config.IndexDefinition) bool {
+	return !def.Mappings.Dynamic && len(def.Mappings.Fields) == 0 && def.DefaultAnalyzer == "" && def.DefaultOperator == ""
+}
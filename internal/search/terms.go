@@ -0,0 +1,78 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+
+	bleveindex "github.com/blevesearch/bleve_index_api"
+)
+
+// Term sizes accepted by Terms
+const (
+	DefaultTermsSize = 100
+	MaxTermsSize     = 1000
+)
+
+// TermCount is a term from a field's dictionary with the number of documents containing it
+type TermCount struct {
+	Term  string `json:"term"`
+	Count uint64 `json:"count"`
+}
+
+// Terms lists the distinct terms of a field in dictionary order with their
+// document frequencies, optionally only those starting with prefix. At most
+// size terms are returned. For sharded indexes the frequencies of each shard
+// are summed. Numeric and date fields have no readable terms and return none.
+func (e *Engine) Terms(indexName, field, prefix string, size int) ([]TermCount, error) {
+	indexes := e.indexesFor(indexName)
+	if len(indexes) == 0 {
+		return nil, indexNotFound(indexName)
+	}
+	if size <= 0 {
+		size = DefaultTermsSize
+	}
+	size = min(size, MaxTermsSize)
+
+	counts := make(map[string]uint64)
+	for _, index := range indexes {
+		var dict bleveindex.FieldDict
+		var err error
+		if prefix != "" {
+			dict, err = index.FieldDictPrefix(field, []byte(prefix))
+		} else {
+			dict, err = index.FieldDict(field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read term dictionary for %s: %w", field, err)
+		}
+
+		// Dictionaries are sorted, so each shard contributes at most size terms
+		for read := 0; read < size; {
+			entry, err := dict.Next()
+			if err != nil {
+				dict.Close()
+				return nil, fmt.Errorf("failed to read term dictionary for %s: %w", field, err)
+			}
+			if entry == nil {
+				break
+			}
+			if isTextTerm(entry.Term) {
+				counts[entry.Term] += entry.Count
+				read++
+			}
+		}
+		dict.Close()
+	}
+
+	terms := make([]TermCount, 0, len(counts))
+	for term, count := range counts {
+		terms = append(terms, TermCount{Term: term, Count: count})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > size {
+		terms = terms[:size]
+	}
+	return terms, nil
+}
@@ -0,0 +1,56 @@
+package search
+
+import (
+	"strconv"
+
+	"github.com/davidschrooten/open-atlas-search/config"
+)
+
+// sourceFieldTypes returns the mapped type of each stored date and numeric
+// field of a definition, the fields typedSource tags
+func sourceFieldTypes(def config.IndexDefinition) map[string]string {
+	fieldTypes := make(map[string]string)
+	for _, field := range def.Mappings.Fields {
+		if field.ExcludeFromSource {
+			continue
+		}
+		if field.Type == "date" || field.Type == "numeric" {
+			fieldTypes[field.Name] = field.Type
+		}
+	}
+	return fieldTypes
+}
+
+// typeSource replaces the values of date and numeric fields in a hit source
+// with MongoDB Extended JSON values tagged by their mapped type, such as
+// {"$date": "2024-01-02T03:04:05Z"}. Bleve stores every number as a float64,
+// so numeric fields are tagged as doubles. Fields without a mapped type, such
+// as dynamic fields, are left as they are.
+func typeSource(source map[string]interface{}, fieldTypes map[string]string) {
+	for field, value := range source {
+		if fieldType, mapped := fieldTypes[field]; mapped {
+			source[field] = typedValue(value, fieldType)
+		}
+	}
+}
+
+// typedValue tags a stored value, or each value of an array, with its type
+func typedValue(value interface{}, fieldType string) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		typed := make([]interface{}, len(v))
+		for i, elem := range v {
+			typed[i] = typedValue(elem, fieldType)
+		}
+		return typed
+	case string:
+		if fieldType == "date" {
+			return map[string]interface{}{"$date": v}
+		}
+	case float64:
+		if fieldType == "numeric" {
+			return map[string]interface{}{"$numberDouble": strconv.FormatFloat(v, 'g', -1, 64)}
+		}
+	}
+	return value
+}
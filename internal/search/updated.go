@@ -0,0 +1,64 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// timestampField returns the field an index or one of its shards is polled
+// for changes on, as configured with timestamp_field
+func (e *Engine) timestampField(indexName string) string {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if field, exists := e.timestamps[indexName]; exists {
+		return field
+	}
+	if i := strings.LastIndex(indexName, "_shard_"); i > 0 {
+		return e.timestamps[indexName[:i]]
+	}
+	return ""
+}
+
+// convertUpdatedSinceQuery converts {"updatedSince": {"value": ...}} into a date
+// range query on the index's timestamp field, matching documents changed at or
+// after value. The value is an RFC3339 time or a duration before now such as
+// "24h", so clients can ask for recent changes without knowing the field name.
+func convertUpdatedSinceQuery(updatedSince map[string]interface{}, opts queryOptions) (query.Query, error) {
+	if updatedSince == nil {
+		return nil, fmt.Errorf("updatedSince must be an object")
+	}
+	if opts.timestampField == "" || opts.timestampField == "_id" {
+		return nil, fmt.Errorf("updatedSince requires an index with a timestamp_field")
+	}
+
+	value, ok := updatedSince["value"].(string)
+	if !ok {
+		return nil, fmt.Errorf("updatedSince value must be an RFC3339 time or a duration, got %v", updatedSince["value"])
+	}
+	since, err := parseSince(value)
+	if err != nil {
+		return nil, err
+	}
+
+	inclusive := true
+	rangeQuery := bleve.NewDateRangeInclusiveQuery(since, time.Time{}, &inclusive, nil)
+	rangeQuery.SetField(opts.timestampField)
+	return rangeQuery, nil
+}
+
+// parseSince parses an RFC3339 time, or a positive duration counted back from now
+func parseSince(value string) (time.Time, error) {
+	if since, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return since, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return time.Time{}, fmt.Errorf("updatedSince value must be an RFC3339 time or a positive duration, got %q", value)
+	}
+	return time.Now().Add(-duration), nil
+}
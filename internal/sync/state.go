@@ -29,9 +29,11 @@ type CollectionState struct {
 	TimestampField   string    `json:"timestampField"`
 	IDField          string    `json:"idField"`
 	DocumentsIndexed int64     `json:"documentsIndexed"`
+	DocumentsFailed  int64     `json:"documentsFailed,omitempty"`
 	SyncStatus       Status    `json:"syncStatus"`
 	Progress         string    `json:"progress"`
 	TotalDocuments   int64     `json:"totalDocuments,omitempty"`
+	Paused           bool      `json:"paused,omitempty"` // Syncing is paused until resumed
 }
 
 // SyncState manages persistent state for all collections
@@ -144,6 +146,24 @@ func (sm *StateManager) SetLastPollTime(collectionKey string, pollTime time.Time
 	}
 }
 
+// AdvanceLastPollTime moves the last poll time of a collection forward to
+// pollTime, leaving it unchanged if it is already later
+func (sm *StateManager) AdvanceLastPollTime(collectionKey string, pollTime time.Time) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if state, exists := sm.state.Collections[collectionKey]; exists {
+		if pollTime.After(state.LastPollTime) {
+			state.LastPollTime = pollTime
+		}
+	} else {
+		sm.state.Collections[collectionKey] = &CollectionState{
+			CollectionKey: collectionKey,
+			LastPollTime:  pollTime,
+		}
+	}
+}
+
 // SetLastSyncTime updates the last sync time for a collection
 func (sm *StateManager) SetLastSyncTime(collectionKey string, syncTime time.Time) {
 	sm.mutex.Lock()
@@ -174,6 +194,21 @@ func (sm *StateManager) IncrementDocumentsIndexed(collectionKey string, count in
 	}
 }
 
+// IncrementDocumentsFailed increments the counter of documents that failed to index
+func (sm *StateManager) IncrementDocumentsFailed(collectionKey string, count int64) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if state, exists := sm.state.Collections[collectionKey]; exists {
+		state.DocumentsFailed += count
+	} else {
+		sm.state.Collections[collectionKey] = &CollectionState{
+			CollectionKey:   collectionKey,
+			DocumentsFailed: count,
+		}
+	}
+}
+
 // GetAllCollectionStates returns all collection states
 func (sm *StateManager) GetAllCollectionStates() map[string]*CollectionState {
 	sm.mutex.RLock()
@@ -212,6 +247,30 @@ func (sm *StateManager) SetSyncStatus(collectionKey string, status Status) {
 	}
 }
 
+// SetPaused pauses or resumes syncing a collection
+func (sm *StateManager) SetPaused(collectionKey string, paused bool) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if state, exists := sm.state.Collections[collectionKey]; exists {
+		state.Paused = paused
+	} else {
+		sm.state.Collections[collectionKey] = &CollectionState{
+			CollectionKey: collectionKey,
+			Paused:        paused,
+		}
+	}
+}
+
+// IsPaused reports whether syncing a collection is paused
+func (sm *StateManager) IsPaused(collectionKey string) bool {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	state, exists := sm.state.Collections[collectionKey]
+	return exists && state.Paused
+}
+
 // SetProgress updates the progress for a collection
 func (sm *StateManager) SetProgress(collectionKey string, progress string) {
 	sm.mutex.Lock()
@@ -227,13 +286,18 @@ func (sm *StateManager) SetProgress(collectionKey string, progress string) {
 	}
 }
 
-// SetTotalDocuments updates the total documents count for a collection
+// SetTotalDocuments updates the total documents count for a collection and
+// recomputes the progress against it. Call it again with a live count when
+// documents keep arriving while the initial sync is running.
 func (sm *StateManager) SetTotalDocuments(collectionKey string, total int64) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
 	if state, exists := sm.state.Collections[collectionKey]; exists {
 		state.TotalDocuments = total
+		if state.SyncStatus == StatusInProgress {
+			updateProgress(state)
+		}
 	} else {
 		sm.state.Collections[collectionKey] = &CollectionState{
 			CollectionKey:  collectionKey,
@@ -242,26 +306,72 @@ func (sm *StateManager) SetTotalDocuments(collectionKey string, total int64) {
 	}
 }
 
-// UpdateProgress calculates and updates progress based on indexed vs total documents
+// GetProgressCounts returns the documents indexed and total documents for a collection
+func (sm *StateManager) GetProgressCounts(collectionKey string) (indexed, total int64) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	if state, exists := sm.state.Collections[collectionKey]; exists {
+		return state.DocumentsIndexed, state.TotalDocuments
+	}
+	return 0, 0
+}
+
+// GetDocumentsFailed returns the number of documents of a collection that failed to index
+func (sm *StateManager) GetDocumentsFailed(collectionKey string) int64 {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	if state, exists := sm.state.Collections[collectionKey]; exists {
+		return state.DocumentsFailed
+	}
+	return 0
+}
+
+// UpdateProgress calculates and updates progress based on indexed vs total documents.
+// Progress is clamped to 99% because documents may still arrive while the cursor is
+// being read; only CompleteProgress reports 100%.
 func (sm *StateManager) UpdateProgress(collectionKey string) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
 	if state, exists := sm.state.Collections[collectionKey]; exists {
-		if state.TotalDocuments > 0 {
-			percentage := float64(state.DocumentsIndexed) / float64(state.TotalDocuments) * 100
-			if percentage >= 100 {
-				state.Progress = "100%"
-				state.SyncStatus = StatusIdle
-			} else {
-				state.Progress = fmt.Sprintf("%.1f%%", percentage)
-			}
-		} else {
-			state.Progress = "not_available"
+		updateProgress(state)
+	}
+}
+
+// CompleteProgress marks the sync of a collection as finished with 100% progress
+func (sm *StateManager) CompleteProgress(collectionKey string) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if state, exists := sm.state.Collections[collectionKey]; exists {
+		state.Progress = "100%"
+		state.SyncStatus = StatusIdle
+	} else {
+		sm.state.Collections[collectionKey] = &CollectionState{
+			CollectionKey: collectionKey,
+			Progress:      "100%",
+			SyncStatus:    StatusIdle,
 		}
 	}
 }
 
+// updateProgress recomputes the progress string of a state; the caller must hold the lock
+func updateProgress(state *CollectionState) {
+	if state.TotalDocuments <= 0 {
+		// Without a total we cannot compute a percentage, keep reporting it as unknown
+		state.Progress = "not_available"
+		return
+	}
+
+	percentage := float64(state.DocumentsIndexed) / float64(state.TotalDocuments) * 100
+	if percentage > 99 {
+		percentage = 99
+	}
+	state.Progress = fmt.Sprintf("%.1f%%", percentage)
+}
+
 // StartPeriodicSave starts a goroutine that periodically saves state
 func (sm *StateManager) StartPeriodicSave(interval time.Duration, stopCh <-chan struct{}, wg *sync.WaitGroup) {
 	defer wg.Done()
@@ -145,6 +145,22 @@ func TestStateManager_SetLastPollTime(t *testing.T) {
 	}
 }
 
+func TestStateManager_AdvanceLastPollTime(t *testing.T) {
+	sm := NewStateManager("/tmp/test.json")
+	testTime := time.Now().Truncate(time.Second)
+
+	sm.AdvanceLastPollTime("test.collection", testTime)
+	sm.AdvanceLastPollTime("test.collection", testTime.Add(-time.Hour))
+	if state := sm.GetCollectionState("test.collection"); !state.LastPollTime.Equal(testTime) {
+		t.Errorf("Expected an earlier time to leave LastPollTime at %v, got %v", testTime, state.LastPollTime)
+	}
+
+	sm.AdvanceLastPollTime("test.collection", testTime.Add(time.Hour))
+	if state := sm.GetCollectionState("test.collection"); !state.LastPollTime.Equal(testTime.Add(time.Hour)) {
+		t.Errorf("Expected LastPollTime to advance to %v, got %v", testTime.Add(time.Hour), state.LastPollTime)
+	}
+}
+
 func TestStateManager_SetLastSyncTime(t *testing.T) {
 	sm := NewStateManager("/tmp/test.json")
 	testTime := time.Now().Truncate(time.Second)
@@ -161,6 +177,35 @@ func TestStateManager_SetLastSyncTime(t *testing.T) {
 	}
 }
 
+func TestStateManager_SetPaused_SurvivesReload(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "test_sync_state.json")
+	sm := NewStateManager(tempFile)
+
+	if sm.IsPaused("test.collection") {
+		t.Error("Expected an unknown collection not to be paused")
+	}
+	sm.SetPaused("test.collection", true)
+	if !sm.IsPaused("test.collection") {
+		t.Fatal("Expected the collection to be paused")
+	}
+	if err := sm.Save(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	reloaded := NewStateManager(tempFile)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if !reloaded.IsPaused("test.collection") {
+		t.Error("Expected the paused state to survive a reload")
+	}
+
+	reloaded.SetPaused("test.collection", false)
+	if reloaded.IsPaused("test.collection") {
+		t.Error("Expected the collection to be resumed")
+	}
+}
+
 func TestStateManager_IncrementDocumentsIndexed(t *testing.T) {
 	sm := NewStateManager("/tmp/test.json")
 
@@ -184,6 +229,81 @@ func TestStateManager_IncrementDocumentsIndexed(t *testing.T) {
 	}
 }
 
+func TestStateManager_UpdateProgress(t *testing.T) {
+	sm := NewStateManager("/tmp/test.json")
+	sm.SetSyncStatus("test.collection", StatusInProgress)
+	sm.SetTotalDocuments("test.collection", 200)
+
+	sm.IncrementDocumentsIndexed("test.collection", 50)
+	sm.UpdateProgress("test.collection")
+
+	state := sm.GetCollectionState("test.collection")
+	if state.Progress != "25.0%" {
+		t.Errorf("Expected progress '25.0%%', got '%s'", state.Progress)
+	}
+}
+
+func TestStateManager_UpdateProgress_ClampsOvershoot(t *testing.T) {
+	sm := NewStateManager("/tmp/test.json")
+	sm.SetSyncStatus("test.collection", StatusInProgress)
+	sm.SetTotalDocuments("test.collection", 100)
+
+	// More documents indexed than initially counted because new ones arrived
+	sm.IncrementDocumentsIndexed("test.collection", 150)
+	sm.UpdateProgress("test.collection")
+
+	state := sm.GetCollectionState("test.collection")
+	if state.Progress != "99.0%" {
+		t.Errorf("Expected progress clamped to '99.0%%', got '%s'", state.Progress)
+	}
+	if state.SyncStatus != StatusInProgress {
+		t.Errorf("Expected sync status to stay %s until completion, got %s", StatusInProgress, state.SyncStatus)
+	}
+
+	// Refreshing the total with a live count recomputes the progress
+	sm.SetTotalDocuments("test.collection", 300)
+	state = sm.GetCollectionState("test.collection")
+	if state.Progress != "50.0%" {
+		t.Errorf("Expected progress '50.0%%' after live count, got '%s'", state.Progress)
+	}
+
+	// Reaching the total exactly still clamps until the cursor is exhausted
+	sm.IncrementDocumentsIndexed("test.collection", 150)
+	sm.UpdateProgress("test.collection")
+	state = sm.GetCollectionState("test.collection")
+	if state.Progress != "99.0%" {
+		t.Errorf("Expected progress clamped to '99.0%%', got '%s'", state.Progress)
+	}
+
+	sm.CompleteProgress("test.collection")
+	state = sm.GetCollectionState("test.collection")
+	if state.Progress != "100%" {
+		t.Errorf("Expected progress '100%%' on completion, got '%s'", state.Progress)
+	}
+	if state.SyncStatus != StatusIdle {
+		t.Errorf("Expected sync status %s on completion, got %s", StatusIdle, state.SyncStatus)
+	}
+}
+
+func TestStateManager_UpdateProgress_NotAvailable(t *testing.T) {
+	sm := NewStateManager("/tmp/test.json")
+	sm.SetSyncStatus("test.collection", StatusInProgress)
+	sm.SetProgress("test.collection", "not_available")
+
+	sm.IncrementDocumentsIndexed("test.collection", 10)
+	sm.UpdateProgress("test.collection")
+
+	state := sm.GetCollectionState("test.collection")
+	if state.Progress != "not_available" {
+		t.Errorf("Expected progress 'not_available' without a total, got '%s'", state.Progress)
+	}
+
+	indexed, total := sm.GetProgressCounts("test.collection")
+	if indexed != 10 || total != 0 {
+		t.Errorf("Expected counts (10, 0), got (%d, %d)", indexed, total)
+	}
+}
+
 func TestStateManager_GetAllCollectionStates(t *testing.T) {
 	sm := NewStateManager("/tmp/test.json")
 